@@ -0,0 +1,44 @@
+// Package app holds what the API's handlers depend on. main builds one App and passes it to
+// every route registration; handlers take it instead of reaching for package globals, so a test
+// can build an App over an in-memory SQLite store with a fake mailer and clock, and several Apps
+// can run in one process.
+package app
+
+import (
+	"database/sql"
+
+	"sraraa/config"
+	"sraraa/mailer"
+	"sraraa/metrics"
+	"sraraa/pkg/clock"
+	"sraraa/pkg/lifecycle"
+	"sraraa/storage"
+)
+
+type App struct {
+	Config *config.Config
+	Store  *storage.Store
+	// DB is Store's connection, for the models that still take one directly
+	DB     *sql.DB
+	Mailer mailer.Mailer
+	Clock  clock.Clock
+	// Metrics holds the Prometheus registry and the counters handlers update
+	Metrics *metrics.Metrics
+	// Workers runs background jobs (export builds, cleanups); main stops it on shutdown
+	Workers *lifecycle.Group
+}
+
+// New assembles an App. The mailer is built from cfg's SMTP settings and the clock is the
+// system clock; replace either on the returned App to fake them. Each App has its own metrics
+// registry.
+func New(cfg *config.Config, store *storage.Store) *App {
+	return &App{
+		Config:  cfg,
+		Store:   store,
+		DB:      store.DB,
+		Mailer:  mailer.New(cfg.SMTPHost, cfg.SMTPPort, cfg.FromEmail, cfg.SMTPPassword),
+		Clock:   clock.System,
+		Metrics: metrics.New(store.DB),
+		Workers: lifecycle.NewGroup(),
+	}
+}
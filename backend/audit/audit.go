@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"net/http"
+
+	"sraraa/app"
+	"sraraa/pkg/logging"
+	user_models "sraraa/reciever_src/models/user"
+)
+
+// statusRecorder remembers the status code written by the wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// LogImpersonatedRequests records every request made with an impersonation session (a session
+// token carrying an act claim) in the impersonation log, including the ones that get refused.
+func LogImpersonatedRequests(a *app.App, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			if c, err := r.Cookie("session_token"); err == nil {
+				token = c.Value
+			}
+		}
+
+		if token == "" || user_models.IsAccessToken(token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := user_models.ValidateSessionToken(token)
+		if err != nil || claims.Act == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		err = user_models.LogImpersonationEvent(a.DB, user_models.ImpersonationEvent{
+			AdminUID:  claims.Act.Sub,
+			TargetUID: claims.UID,
+			SessionID: claims.ID,
+			Event:     user_models.ImpersonationEventRequest,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Status:    rec.status,
+			IPAddress: r.RemoteAddr,
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to audit impersonated request",
+				"method", r.Method, "path", r.URL.Path, "admin_uid", claims.Act.Sub, "uid", claims.UID, "err", err)
+		}
+	})
+}
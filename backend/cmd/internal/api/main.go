@@ -2,99 +2,182 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"os/signal"
+	"strconv"
+
+	"sraraa/app"
+	"sraraa/audit"
+	"sraraa/config"
 	"sraraa/cors"
 	"sraraa/db"
-	access_auth_controller "sraraa/reciever_src/controllers/auth/access_auth"
+	"sraraa/health"
+	"sraraa/maintenance"
+	shared_health "sraraa/pkg/health"
+	"sraraa/pkg/lifecycle"
+	"sraraa/pkg/logging"
+	shared_metrics "sraraa/pkg/metrics"
+	"sraraa/pkg/tracing"
+	export_controller "sraraa/reciever_src/controllers/main/export"
+	user_models "sraraa/reciever_src/models/user"
 	"sraraa/reciever_src/routes/auth/access_auth_routes"
+	access_token_routes "sraraa/reciever_src/routes/auth/access_tokens"
+	impersonation_routes "sraraa/reciever_src/routes/auth/impersonation"
+	introspection_routes "sraraa/reciever_src/routes/auth/introspection"
+	invite_routes "sraraa/reciever_src/routes/auth/invites"
+	jwks_routes "sraraa/reciever_src/routes/auth/jwks"
 	login_routes "sraraa/reciever_src/routes/auth/login"
 	forgot_password_routes "sraraa/reciever_src/routes/auth/password"
 	signup_routes "sraraa/reciever_src/routes/auth/signup"
 	"sraraa/reciever_src/routes/auth/signup/onboarding_routes"
+	suspension_routes "sraraa/reciever_src/routes/auth/suspension"
+	username_routes "sraraa/reciever_src/routes/auth/username"
 	verify_session_routes "sraraa/reciever_src/routes/auth/verify_session"
+	config_routes "sraraa/reciever_src/routes/main/config"
+	export_routes "sraraa/reciever_src/routes/main/export"
+	maintenance_routes "sraraa/reciever_src/routes/main/maintenance"
+	profile_routes "sraraa/reciever_src/routes/main/profiles"
 	user_assets_routes "sraraa/reciever_src/routes/main/user"
+	auth_utils "sraraa/reciever_src/utils/auth"
+	"sraraa/router"
 	user_info_sender_routes "sraraa/sender_src/sender_routes/user"
-	"time"
+	"sraraa/storage"
 
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using system env")
-	}
+	envErr := godotenv.Load()
 
-	// ✅ IMPORTANT: Initialize ALL tables, not just the connection
-	_, err := db.InitializeDatabase()
+	cfg, command, err := config.LoadCommand(os.Args[1:])
 	if err != nil {
-		log.Fatal("Failed to initialize database with tables:", err)
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		log.Fatal("Invalid configuration: ", err)
+	}
+
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logger := logging.Setup("api", level)
+	if envErr != nil {
+		slog.Info("No .env file found, using system env")
 	}
+	slog.Info("Loaded configuration", "env", cfg.Env)
 
-	// Get the database connection
-	dbConn := db.GetDB()
-	if dbConn == nil {
-		log.Fatal("Failed to get DB connection")
+	// api [flags] migrate up|down [steps]|status
+	if len(command) > 0 {
+		if command[0] != "migrate" {
+			fatal("Unknown command", fmt.Errorf("%q", command[0]))
+		}
+		store, err := storage.Open(cfg.DatabaseURL)
+		if err != nil {
+			fatal("Failed to open database", err)
+		}
+		err = db.MigrateCommand(store, command[1:], os.Stdout)
+		store.Close()
+		if err != nil {
+			fatal("Migration failed", err)
+		}
+		return
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	auth_utils.SetUsernamePolicy(cfg.UsernamePolicy())
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Service:  "api",
+		Exporter: cfg.TraceExporter,
+		File:     cfg.TraceFile,
+		Endpoint: cfg.TraceEndpoint,
+	})
+	if err != nil {
+		fatal("Failed to set up tracing", err)
 	}
 
-	ginRouter := gin.New()
-	ginRouter.Use(gin.Logger(), gin.Recovery())
+	store, err := db.Open(cfg)
+	if err != nil {
+		fatal("Failed to initialize database", err)
+	}
 
-	signup_routes.RegisterSignupRoutes()
-	onboarding_routes.RegisterOnboardingRoutes()
-	login_routes.LoginRoutes()
+	if err := user_models.LoadSigningKeys(cfg.SessionKeysDir); err != nil {
+		fatal("Failed to load session signing keys", err)
+	}
 
-	access_auth_routes.RegisterAccessAuthRoutes(dbConn)
-	verify_session_routes.VerifySessionRoutes()
-	user_info_sender_routes.RegisterUserSenderRoutes()
-	user_assets_routes.RegisterUserAssetsRoutes(ginRouter)
-	forgot_password_routes.RegisterForgotPasswordRoutes()
+	a := app.New(cfg, store)
+
+	port := strconv.Itoa(cfg.Port)
+
+	apiRouter := router.New(cfg)
+
+	signup_routes.RegisterSignupRoutes(apiRouter, a)
+	onboarding_routes.RegisterOnboardingRoutes(apiRouter, a)
+	login_routes.LoginRoutes(apiRouter, a)
+	username_routes.RegisterUsernameRoutes(apiRouter, a)
+	invite_routes.RegisterInviteRoutes(apiRouter, a)
+	access_token_routes.RegisterAccessTokenRoutes(apiRouter, a)
+	introspection_routes.RegisterIntrospectionRoutes(apiRouter, a)
+	jwks_routes.RegisterJWKSRoutes(apiRouter)
+	impersonation_routes.RegisterImpersonationRoutes(apiRouter, a)
+	suspension_routes.RegisterSuspensionRoutes(apiRouter, a)
+	export_routes.RegisterExportRoutes(apiRouter, a)
+	profile_routes.RegisterProfileRoutes(apiRouter, a)
+	config_routes.RegisterConfigRoutes(apiRouter, a)
+
+	jobs := maintenance.New(a)
+	maintenance_routes.RegisterMaintenanceRoutes(apiRouter, a, jobs)
+
+	access_auth_routes.RegisterAccessAuthRoutes(apiRouter, a)
+	verify_session_routes.VerifySessionRoutes(apiRouter, a)
+	user_info_sender_routes.RegisterUserSenderRoutes(apiRouter, a)
+	user_assets_routes.RegisterUserAssetsRoutes(apiRouter, a)
+	forgot_password_routes.RegisterForgotPasswordRoutes(apiRouter, a)
+	forgot_password_routes.RegisterChangePasswordRoutes(apiRouter, a)
+
+	metricsGate, err := shared_metrics.NewGate(cfg.MetricsToken, cfg.MetricsAllow)
+	if err != nil {
+		fatal("Invalid metrics allowlist", err)
+	}
+	apiRouter.HandleRootFunc(http.MethodGet, "/metrics", shared_metrics.Handler(a.Metrics.Registry, metricsGate).ServeHTTP)
 
-	http.Handle("/", ginRouter)
+	probes := health.New(a)
+	apiRouter.HandleRootFunc(http.MethodGet, "/healthz", shared_health.LiveHandler().ServeHTTP)
+	apiRouter.HandleRootFunc(http.MethodGet, "/readyz", probes.ReadyHandler().ServeHTTP)
 
-	coreHandler := cors.EnableCORS(http.DefaultServeMux)
+	coreHandler := logging.Middleware(logger, shared_metrics.Instrument(a.Metrics.HTTP, tracing.Middleware(
+		cors.EnableCORS(cfg, audit.LogImpersonatedRequests(a, apiRouter)))))
 
 	srv := &http.Server{
 		Addr:    ":" + port,
 		Handler: coreHandler,
 	}
 
-	go func() {
-		for {
-			access_auth_controller.AutoDeleteUnverifiedUsers(dbConn)
-			time.Sleep(1 * time.Hour)
-		}
-	}()
-
-	go func() {
-		fmt.Printf("Server running on port %s\n", port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
-		}
-	}()
+	export_controller.ResumeUnfinishedExports(a)
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	jobs.Start(a.Workers)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	lc := lifecycle.New(cfg.ShutdownTimeout)
+	lc.OnStop("readiness", func(ctx context.Context) error {
+		probes.Drain()
+		return lifecycle.Sleep(ctx, cfg.ShutdownDelay)
+	})
+	lc.Serve("http", srv)
+	lc.OnStop("workers", a.Workers.Stop)
+	lc.OnStop("tracing", shutdownTracing)
+	lc.OnStop("database", func(context.Context) error { return store.Close() })
+	slog.Info("Server running", "port", port)
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+	if err := lc.Wait(); err != nil {
+		fatal("Shutdown incomplete", err)
 	}
+	slog.Info("Server exiting")
+}
 
-	// Close database connection
-	db.CloseDB()
-
-	fmt.Println("Server exiting")
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
@@ -0,0 +1,108 @@
+// hibp-import splits a Have I Been Pwned "SHA1:COUNT" dump into per-prefix range files
+// for the offline breached-password check (HIBP_RANGES_DIR).
+//
+//	go run ./cmd/internal/hibp-import -in pwned-passwords-sha1-ordered-by-hash-v8.txt -out ./hibp
+//
+// Input ordered by hash is written in a single pass; unordered input works too, just slower.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	in := flag.String("in", "-", "HASH:COUNT input file, - for stdin")
+	out := flag.String("out", "", "output directory for the range files")
+	flag.Parse()
+
+	if *out == "" {
+		log.Fatal("-out is required")
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatal("Failed to create output directory:", err)
+	}
+
+	var src io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			log.Fatal("Failed to open input:", err)
+		}
+		defer f.Close()
+		src = f
+	}
+
+	hashes, shards, err := importRanges(src, *out)
+	if err != nil {
+		log.Fatal("Import failed:", err)
+	}
+
+	fmt.Printf("Imported %d hashes into %d range files in %s\n", hashes, shards, *out)
+}
+
+func importRanges(src io.Reader, outDir string) (int, int, error) {
+	seen := map[string]bool{}
+
+	var current string
+	var file *os.File
+	var w *bufio.Writer
+
+	closeShard := func() error {
+		if file == nil {
+			return nil
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return file.Close()
+	}
+
+	scanner := bufio.NewScanner(src)
+	hashes := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		hash, count, ok := strings.Cut(line, ":")
+		if !ok || len(hash) != 40 {
+			continue
+		}
+		hash = strings.ToUpper(hash)
+		prefix, suffix := hash[:5], hash[5:]
+
+		if prefix != current {
+			if err := closeShard(); err != nil {
+				return hashes, len(seen), err
+			}
+
+			// First time a prefix shows up in this run the shard is rewritten, afterwards appended
+			flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+			if !seen[prefix] {
+				flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+				seen[prefix] = true
+			}
+
+			f, err := os.OpenFile(filepath.Join(outDir, prefix+".txt"), flags, 0o644)
+			if err != nil {
+				return hashes, len(seen), err
+			}
+			file, w, current = f, bufio.NewWriter(f), prefix
+		}
+
+		if _, err := fmt.Fprintf(w, "%s:%s\n", suffix, count); err != nil {
+			return hashes, len(seen), err
+		}
+		hashes++
+	}
+	if err := scanner.Err(); err != nil {
+		return hashes, len(seen), err
+	}
+
+	return hashes, len(seen), closeShard()
+}
@@ -0,0 +1,33 @@
+// session-keygen adds a new Ed25519 session signing key to SESSION_KEYS_DIR. The new key signs
+// tokens after the next restart; older keys keep verifying until their files are removed.
+//
+//	go run ./cmd/internal/session-keygen -dir ./keys
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	session_models "sraraa/reciever_src/models/user/sessions"
+)
+
+func main() {
+	defaultDir := os.Getenv("SESSION_KEYS_DIR")
+	if defaultDir == "" {
+		defaultDir = session_models.DefaultKeysDir
+	}
+	dir := flag.String("dir", defaultDir, "directory holding the signing keys")
+	flag.Parse()
+
+	if err := os.MkdirAll(*dir, 0700); err != nil {
+		log.Fatal("Failed to create keys directory:", err)
+	}
+
+	path, err := session_models.GenerateSigningKey(*dir)
+	if err != nil {
+		log.Fatal("Failed to generate key:", err)
+	}
+	fmt.Println(path)
+}
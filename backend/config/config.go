@@ -0,0 +1,345 @@
+// Package config holds the API's typed settings. Load is called once at startup and main hands
+// the result to the app; handlers read it from there. See sraraa/pkg/config for where values
+// come from.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	shared_config "sraraa/pkg/config"
+	"sraraa/pkg/logging"
+	shared_metrics "sraraa/pkg/metrics"
+	"sraraa/pkg/tracing"
+	auth_utils "sraraa/reciever_src/utils/auth"
+	"sraraa/storage"
+)
+
+type Config struct {
+	Env         string   `env:"APP_ENV" default:"development" usage:"environment: development, staging or production"`
+	Port        int      `env:"PORT" default:"8080" usage:"HTTP port"`
+	LogLevel    string   `env:"LOG_LEVEL" default:"info" usage:"lowest level logged: debug, info, warn or error"`
+	DatabaseURL string   `env:"DATABASE_URL" default:"users.db" secret:"true" usage:"SQLite file or postgres:// URL"`
+	AutoMigrate bool     `env:"AUTO_MIGRATE" default:"on" usage:"apply pending migrations at startup; when off, refuse to start with any pending"`
+	CORSOrigins []string `env:"CORS_ORIGINS" default:"http://localhost:5173" usage:"comma-separated origins allowed to call the API from a browser"`
+
+	CDNURL           string `env:"CDN_URL" default:"http://localhost:8090" usage:"base URL the API uses to reach the CDN"`
+	CDNPublicURL     string `env:"CDN_PUBLIC_URL" usage:"base URL stored in image links; defaults to CDN_URL"`
+	CDNInternalToken string `env:"CDN_INTERNAL_TOKEN" secret:"true" usage:"token sent on internal CDN calls"`
+	MaxUploadSize    int64  `env:"MAX_UPLOAD_SIZE" default:"5242880" usage:"largest image accepted for upload in bytes; keep it at the CDN's MAX_UPLOAD_SIZE"`
+
+	SMTPHost     string `env:"SMTP_HOST" usage:"SMTP server for one-time codes; unset skips sending in development"`
+	SMTPPort     string `env:"SMTP_PORT" default:"587" usage:"SMTP server port"`
+	SMTPPassword string `env:"SMTP_PASSWORD" secret:"true" usage:"SMTP password for FROM_EMAIL"`
+	FromEmail    string `env:"FROM_EMAIL" usage:"sender address, also the SMTP login"`
+
+	MetricsToken string   `env:"METRICS_TOKEN" secret:"true" usage:"bearer token that may scrape /metrics from any address"`
+	MetricsAllow []string `env:"METRICS_ALLOW" default:"127.0.0.1,::1" usage:"comma-separated IPs or CIDRs that may scrape /metrics without the token"`
+
+	TraceExporter string `env:"TRACE_EXPORTER" default:"none" usage:"where spans go: none, otlp, stdout or file"`
+	TraceFile     string `env:"TRACE_FILE" default:"traces.jsonl" usage:"file spans are appended to with TRACE_EXPORTER=file"`
+	TraceEndpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT" usage:"OTLP/HTTP collector URL for TRACE_EXPORTER=otlp; defaults to http://localhost:4318"`
+
+	// Internal services calling with HTTP Basic credentials, as "id:secret" pairs
+	ServiceClients       string `env:"SERVICE_CLIENTS" secret:"true" usage:"comma-separated id:secret pairs for internal services (introspection, user lookups)"`
+	IntrospectionClients string `env:"INTROSPECTION_CLIENTS" secret:"true" usage:"older name for SERVICE_CLIENTS, read when that is unset"`
+
+	SignupMode           string        `env:"SIGNUP_MODE" default:"open" usage:"who may sign up: open, invite_only or waitlist"`
+	UserInviteQuota      int           `env:"USER_INVITE_QUOTA" default:"5" usage:"unused invites a user may hold at once"`
+	OnboardingTokenTTL   time.Duration `env:"ONBOARDING_TOKEN_TTL" default:"1h" usage:"time to finish onboarding after the email is verified"`
+	ImpersonationTTL     time.Duration `env:"IMPERSONATION_TTL" default:"15m" usage:"lifetime of an admin impersonation session; at most 1h"`
+	BreachedPasswordMode string        `env:"BREACHED_PASSWORD_MODE" default:"reject" usage:"what a password found in HIBP_RANGES_DIR does: off, warn or reject"`
+	HIBPRangesDir        string        `env:"HIBP_RANGES_DIR" usage:"Have I Been Pwned range files from hibp-import; unset skips the breach check"`
+
+	// Username policy; USERNAME_RESERVED_EXTRA adds to the built-in reserved names
+	UsernameMinLength      int           `env:"USERNAME_MIN_LENGTH" default:"4" usage:"shortest username allowed"`
+	UsernameMaxLength      int           `env:"USERNAME_MAX_LENGTH" default:"30" usage:"longest username allowed"`
+	UsernameAllowUnicode   bool          `env:"USERNAME_ALLOW_UNICODE" default:"off" usage:"allow letters outside ASCII in usernames"`
+	UsernameAllowedSymbols string        `env:"USERNAME_ALLOWED_SYMBOLS" default:"_." usage:"separator characters allowed in usernames"`
+	UsernameReservedExtra  []string      `env:"USERNAME_RESERVED_EXTRA" usage:"comma-separated names nobody may take, on top of the built-in list"`
+	UsernameChangeCooldown time.Duration `env:"USERNAME_CHANGE_COOLDOWN" default:"720h" usage:"time between username changes"`
+	UsernameQuarantine     time.Duration `env:"USERNAME_QUARANTINE" default:"2160h" usage:"time a released username stays reserved for its previous owner"`
+
+	ExportLinkTTL   time.Duration `env:"EXPORT_LINK_TTL" default:"24h" usage:"lifetime of a data export download link"`
+	ExportCooldown  time.Duration `env:"EXPORT_COOLDOWN" default:"24h" usage:"time between data export requests"`
+	ExportRetention time.Duration `env:"EXPORT_RETENTION" default:"168h" usage:"time a finished data export archive is kept"`
+
+	SessionKeysDir  string `env:"SESSION_KEYS_DIR" default:"keys" usage:"directory holding the session signing keys"`
+	ExportsDir      string `env:"EXPORTS_DIR" default:"exports" usage:"directory for personal data export archives"`
+	LegacyAPIRoutes bool   `env:"LEGACY_API_ROUTES" default:"on" usage:"also serve the pre-/api/v1 paths"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"30s" usage:"time allowed for shutdown: draining requests and uploads, stopping workers, flushing traces"`
+	ShutdownDelay   time.Duration `env:"SHUTDOWN_DELAY" default:"0s" usage:"time to keep serving with readiness failing before the listener closes"`
+
+	// Maintenance job intervals; 0 stops scheduling a job, which admins can still run on demand
+	SessionsCleanupInterval    time.Duration `env:"SESSIONS_CLEANUP_INTERVAL" default:"1h" usage:"how often expired sessions are deleted; 0 disables"`
+	OTPCleanupInterval         time.Duration `env:"OTP_CLEANUP_INTERVAL" default:"30m" usage:"how often stale one-time codes are deleted; 0 disables"`
+	OTPRequestCleanupInterval  time.Duration `env:"OTP_REQUEST_CLEANUP_INTERVAL" default:"6h" usage:"how often old code requests are deleted; 0 disables"`
+	CooldownCleanupInterval    time.Duration `env:"COOLDOWN_CLEANUP_INTERVAL" default:"6h" usage:"how often ended cooldowns are deleted; 0 disables"`
+	UnverifiedCleanupInterval  time.Duration `env:"UNVERIFIED_CLEANUP_INTERVAL" default:"1h" usage:"how often never-verified accounts are deleted; 0 disables"`
+	ExportCleanupInterval      time.Duration `env:"EXPORT_CLEANUP_INTERVAL" default:"1h" usage:"how often expired data export archives are deleted; 0 disables"`
+	CDNRenameRetryInterval     time.Duration `env:"CDN_RENAME_RETRY_INTERVAL" default:"5m" usage:"how often renames the CDN has not applied yet are retried; 0 disables"`
+	OTPRetention               time.Duration `env:"OTP_RETENTION" default:"1h" usage:"age at which one-time codes are deleted; at least the 10m they stay valid"`
+	OTPRequestRetention        time.Duration `env:"OTP_REQUEST_RETENTION" default:"24h" usage:"age at which code requests are deleted; at least the 1h rate limit window"`
+	UnverifiedAccountRetention time.Duration `env:"UNVERIFIED_ACCOUNT_RETENTION" default:"24h" usage:"age at which accounts that never verified their email are deleted"`
+	MaintenanceJitter          time.Duration `env:"MAINTENANCE_JITTER" default:"1m" usage:"random delay added to each scheduled run, so instances don't all run a job at once"`
+	MaintenanceLockTimeout     time.Duration `env:"MAINTENANCE_LOCK_TIMEOUT" default:"10m" usage:"longest a job run may take; its lock expires after that"`
+}
+
+var (
+	mu       sync.RWMutex
+	snapshot *shared_config.Snapshot
+)
+
+// Load reads and validates the settings, keeping their redacted view for Snapshot
+func Load(args []string) (*Config, error) {
+	cfg := &Config{}
+	snap, err := shared_config.Load(cfg, args)
+	if err != nil {
+		return nil, err
+	}
+	set(snap)
+	return cfg, nil
+}
+
+// LoadCommand is Load for a command line that may end in a subcommand, which it returns
+func LoadCommand(args []string) (*Config, []string, error) {
+	cfg := &Config{}
+	snap, rest, err := shared_config.LoadCommand(cfg, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	set(snap)
+	return cfg, rest, nil
+}
+
+func set(snap *shared_config.Snapshot) {
+	mu.Lock()
+	snapshot = snap
+	mu.Unlock()
+}
+
+// Snapshot returns the redacted view of the loaded settings, nil before Load
+func Snapshot() *shared_config.Snapshot {
+	mu.RLock()
+	defer mu.RUnlock()
+	return snapshot
+}
+
+func (c *Config) Validate() error {
+	if err := shared_config.CheckPort("PORT", c.Port); err != nil {
+		return err
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+	if _, _, err := storage.ParseDSN(c.DatabaseURL); err != nil {
+		return fmt.Errorf("DATABASE_URL: %w", err)
+	}
+	if c.SessionKeysDir == "" {
+		return errors.New("SESSION_KEYS_DIR is required")
+	}
+	if c.ExportsDir == "" {
+		return errors.New("EXPORTS_DIR is required")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return errors.New("SHUTDOWN_TIMEOUT must be positive")
+	}
+	if c.ShutdownDelay < 0 || c.ShutdownDelay >= c.ShutdownTimeout {
+		return errors.New("SHUTDOWN_DELAY must be between 0 and SHUTDOWN_TIMEOUT")
+	}
+	if err := c.validateMaintenance(); err != nil {
+		return err
+	}
+	if err := c.validateAccounts(); err != nil {
+		return err
+	}
+	if _, err := shared_metrics.ParseAllowlist(c.MetricsAllow); err != nil {
+		return fmt.Errorf("METRICS_ALLOW: %w", err)
+	}
+	if err := tracing.CheckExporter(c.TraceExporter); err != nil {
+		return fmt.Errorf("TRACE_EXPORTER: %w", err)
+	}
+	if c.TraceExporter == tracing.ExporterFile && c.TraceFile == "" {
+		return errors.New("TRACE_FILE is required with TRACE_EXPORTER=file")
+	}
+	if err := shared_config.CheckURL("OTEL_EXPORTER_OTLP_ENDPOINT", c.TraceEndpoint, true); err != nil {
+		return err
+	}
+	if err := shared_config.CheckOrigins("CORS_ORIGINS", c.CORSOrigins, c.Env); err != nil {
+		return err
+	}
+	if err := shared_config.CheckURL("CDN_URL", c.CDNURL, false); err != nil {
+		return err
+	}
+	if err := shared_config.CheckURL("CDN_PUBLIC_URL", c.CDNPublicURL, true); err != nil {
+		return err
+	}
+	if c.MaxUploadSize <= 0 {
+		return errors.New("MAX_UPLOAD_SIZE must be positive")
+	}
+	c.CDNURL = strings.TrimSuffix(c.CDNURL, "/")
+	c.CDNPublicURL = strings.TrimSuffix(c.CDNPublicURL, "/")
+
+	if c.Env == shared_config.Production {
+		if c.CDNInternalToken == "" {
+			return errors.New("CDN_INTERNAL_TOKEN is required in production")
+		}
+		if !strings.HasPrefix(c.PublicCDNURL(), "https://") {
+			return errors.New("CDN_PUBLIC_URL (or CDN_URL) must use https in production")
+		}
+	}
+	return nil
+}
+
+// Shortest retentions that keep what the auth flows still read: codes are accepted for 10
+// minutes and requests are rate limited over the last hour
+const (
+	minOTPRetention        = 10 * time.Minute
+	minOTPRequestRetention = time.Hour
+)
+
+func (c *Config) validateMaintenance() error {
+	intervals := []struct {
+		key      string
+		interval time.Duration
+	}{
+		{"SESSIONS_CLEANUP_INTERVAL", c.SessionsCleanupInterval},
+		{"OTP_CLEANUP_INTERVAL", c.OTPCleanupInterval},
+		{"OTP_REQUEST_CLEANUP_INTERVAL", c.OTPRequestCleanupInterval},
+		{"COOLDOWN_CLEANUP_INTERVAL", c.CooldownCleanupInterval},
+		{"UNVERIFIED_CLEANUP_INTERVAL", c.UnverifiedCleanupInterval},
+		{"EXPORT_CLEANUP_INTERVAL", c.ExportCleanupInterval},
+		{"CDN_RENAME_RETRY_INTERVAL", c.CDNRenameRetryInterval},
+	}
+	for _, i := range intervals {
+		if i.interval < 0 {
+			return fmt.Errorf("%s must not be negative", i.key)
+		}
+	}
+	if c.OTPRetention < minOTPRetention {
+		return fmt.Errorf("OTP_RETENTION must be at least %s", minOTPRetention)
+	}
+	if c.OTPRequestRetention < minOTPRequestRetention {
+		return fmt.Errorf("OTP_REQUEST_RETENTION must be at least %s", minOTPRequestRetention)
+	}
+	if c.UnverifiedAccountRetention <= 0 {
+		return errors.New("UNVERIFIED_ACCOUNT_RETENTION must be positive")
+	}
+	if c.MaintenanceJitter < 0 {
+		return errors.New("MAINTENANCE_JITTER must not be negative")
+	}
+	if c.MaintenanceLockTimeout <= 0 {
+		return errors.New("MAINTENANCE_LOCK_TIMEOUT must be positive")
+	}
+	return nil
+}
+
+// Longest impersonation session an admin may get, whatever IMPERSONATION_TTL says
+const MaxImpersonationTTL = time.Hour
+
+func (c *Config) validateAccounts() error {
+	mode, ok := auth_utils.ParseSignupMode(c.SignupMode)
+	if !ok {
+		return fmt.Errorf("SIGNUP_MODE: %q, expected open, invite_only or waitlist", c.SignupMode)
+	}
+	c.SignupMode = mode
+	if _, err := c.ServiceClientSecrets(); err != nil {
+		return err
+	}
+	if c.UserInviteQuota < 0 {
+		return errors.New("USER_INVITE_QUOTA must not be negative")
+	}
+	if c.OnboardingTokenTTL <= 0 {
+		return errors.New("ONBOARDING_TOKEN_TTL must be positive")
+	}
+	if c.ImpersonationTTL <= 0 || c.ImpersonationTTL > MaxImpersonationTTL {
+		return fmt.Errorf("IMPERSONATION_TTL must be between 0 and %s", MaxImpersonationTTL)
+	}
+	switch c.BreachedPasswordMode = strings.ToLower(c.BreachedPasswordMode); c.BreachedPasswordMode {
+	case auth_utils.BreachModeOff, auth_utils.BreachModeWarn, auth_utils.BreachModeReject:
+	default:
+		return fmt.Errorf("BREACHED_PASSWORD_MODE: %q, expected off, warn or reject", c.BreachedPasswordMode)
+	}
+	if c.UsernameMinLength <= 0 {
+		return errors.New("USERNAME_MIN_LENGTH must be positive")
+	}
+	if c.UsernameMaxLength < c.UsernameMinLength {
+		return errors.New("USERNAME_MAX_LENGTH must be at least USERNAME_MIN_LENGTH")
+	}
+	if c.UsernameChangeCooldown < 0 {
+		return errors.New("USERNAME_CHANGE_COOLDOWN must not be negative")
+	}
+	if c.UsernameQuarantine < 0 {
+		return errors.New("USERNAME_QUARANTINE must not be negative")
+	}
+	if c.ExportLinkTTL <= 0 {
+		return errors.New("EXPORT_LINK_TTL must be positive")
+	}
+	if c.ExportCooldown < 0 {
+		return errors.New("EXPORT_COOLDOWN must not be negative")
+	}
+	if c.ExportRetention <= 0 {
+		return errors.New("EXPORT_RETENTION must be positive")
+	}
+	return nil
+}
+
+// ServiceClientSecrets returns the internal service clients by id, from SERVICE_CLIENTS or,
+// when that is unset, INTROSPECTION_CLIENTS
+func (c *Config) ServiceClientSecrets() (map[string]string, error) {
+	key, raw := "SERVICE_CLIENTS", c.ServiceClients
+	if raw == "" {
+		key, raw = "INTROSPECTION_CLIENTS", c.IntrospectionClients
+	}
+	clients := map[string]string{}
+	for i, pair := range strings.Split(raw, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, secret, found := strings.Cut(pair, ":")
+		if !found || id == "" || secret == "" {
+			// The pair holds a secret, so only its position is reported
+			return nil, fmt.Errorf("%s: entry %d is not id:secret", key, i+1)
+		}
+		clients[id] = secret
+	}
+	return clients, nil
+}
+
+// UsernamePolicy is the username policy built from the USERNAME_* settings
+func (c *Config) UsernamePolicy() auth_utils.UsernamePolicy {
+	p := auth_utils.DefaultUsernamePolicy
+	p.MinLength = c.UsernameMinLength
+	p.MaxLength = c.UsernameMaxLength
+	p.AllowUnicodeLetters = c.UsernameAllowUnicode
+	p.AllowedSymbols = c.UsernameAllowedSymbols
+	p.Reserved = append(append([]string{}, p.Reserved...), c.UsernameReservedExtra...)
+	return p
+}
+
+// BreachPolicy is how CheckPassword treats passwords found in the breach dataset
+func (c *Config) BreachPolicy() auth_utils.BreachPolicy {
+	return auth_utils.BreachPolicy{Mode: c.BreachedPasswordMode, Dir: c.HIBPRangesDir}
+}
+
+// PublicCDNURL is the base URL put in links to CDN files
+func (c *Config) PublicCDNURL() string {
+	if c.CDNPublicURL != "" {
+		return c.CDNPublicURL
+	}
+	return c.CDNURL
+}
+
+// AllowsOrigin reports whether browsers on origin may call the API
+func (c *Config) AllowsOrigin(origin string) bool {
+	for _, o := range c.CORSOrigins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
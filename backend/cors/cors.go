@@ -1,14 +1,16 @@
 package cors
 
-import "net/http"
-
-func EnableCORS(next http.Handler) http.Handler {
-	allowedOrigin := "http://localhost:5173"
+import (
+	"net/http"
+	"sraraa/config"
+)
 
+// EnableCORS lets browsers on the CORS_ORIGINS origins call the API with credentials
+func EnableCORS(cfg *config.Config, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
 
-		if origin != allowedOrigin {
+		if !cfg.AllowsOrigin(origin) {
 			if r.Method == http.MethodOptions {
 				w.WriteHeader(http.StatusForbidden)
 				return
@@ -17,9 +19,11 @@ func EnableCORS(next http.Handler) http.Handler {
 			return
 		}
 
-		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if r.Method == http.MethodOptions {
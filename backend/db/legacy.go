@@ -0,0 +1,103 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"sraraa/db/db_utils"
+	auth_utils "sraraa/reciever_src/utils/auth"
+)
+
+// legacyColumns were added to tables with ALTER TABLE before the migrations existed. A users.db
+// from that time may lack any of them, and the baseline's CREATE TABLE IF NOT EXISTS would not
+// add them.
+var legacyColumns = []struct {
+	table, column, definition string
+}{
+	{"users", "username_canonical", "TEXT"},
+	{"users", "role", "TEXT NOT NULL DEFAULT 'user'"},
+	{"users", "profile_visibility", "TEXT NOT NULL DEFAULT 'public'"},
+	{"users", "show_fullname", "BOOLEAN NOT NULL DEFAULT 1"},
+	{"users", "suspended_at", "DATETIME"},
+	{"sessions", "impersonated_by", "TEXT"},
+}
+
+// upgradeLegacySQLite brings a users.db written before migrations up to the point the baseline
+// can adopt it. Files without a users table are new and are left to the baseline.
+func upgradeLegacySQLite(db *sql.DB) error {
+	hasUsers, err := sqliteTableExists(db, "users")
+	if err != nil || !hasUsers {
+		return err
+	}
+
+	slog.Info("Upgrading database created before migrations")
+	for _, c := range legacyColumns {
+		exists, err := sqliteTableExists(db, c.table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if err := db_utils.AddColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return fmt.Errorf("failed to add %s.%s column: %v", c.table, c.column, err)
+		}
+	}
+
+	if err := backfillCanonicalUsernames(db); err != nil {
+		return fmt.Errorf("failed to backfill canonical usernames: %v", err)
+	}
+	return nil
+}
+
+func sqliteTableExists(db *sql.DB, table string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type='table' AND name=?)`, table).Scan(&exists)
+	return exists, err
+}
+
+// backfillCanonicalUsernames fills username_canonical for rows written before the column existed.
+// Rows whose canonical form collides with an earlier account are left NULL and logged so the
+// unique index can still be created. Those users log in with their exact username until they
+// pick a new name.
+func backfillCanonicalUsernames(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, username FROM users WHERE username IS NOT NULL AND username_canonical IS NULL ORDER BY id`)
+	if err != nil {
+		return err
+	}
+
+	type pending struct {
+		id       int
+		username string
+	}
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.username); err != nil {
+			rows.Close()
+			return err
+		}
+		todo = append(todo, p)
+	}
+	rows.Close()
+
+	for _, p := range todo {
+		canonical := auth_utils.CanonicalUsername(p.username)
+
+		var taken bool
+		if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE username_canonical=?)`, canonical).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			slog.Warn("Username collides with an existing canonical username; leaving it unset", "username", p.username, "id", p.id)
+			continue
+		}
+
+		if _, err := db.Exec(`UPDATE users SET username_canonical=? WHERE id=?`, canonical, p.id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+
+	"sraraa/pkg/migrate"
+	"sraraa/storage"
+)
+
+// migrationFiles holds one directory of numbered scripts per dialect. Every schema change is
+// added to both, under the same version.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// baselineVersion is the migration that adopts databases created before migrations existed
+const baselineVersion = 1
+
+// NewMigrator returns the migrator for db's dialect
+func NewMigrator(db *sql.DB, dialect storage.Dialect) (*migrate.Migrator, error) {
+	scripts, err := fs.Sub(migrationFiles, "migrations/"+string(dialect))
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, scripts)
+}
+
+// Migrate applies every pending migration to db
+func Migrate(db *sql.DB, dialect storage.Dialect) error {
+	ctx := context.Background()
+	m, err := NewMigrator(db, dialect)
+	if err != nil {
+		return err
+	}
+	if err := prepareBaseline(ctx, m, db, dialect); err != nil {
+		return err
+	}
+
+	applied, err := m.Up(ctx)
+	for _, mig := range applied {
+		slog.Info("Applied migration", "version", mig.Version, "name", mig.Name)
+	}
+	return err
+}
+
+// MigrateCommand runs the "migrate up|down|status" subcommand against store
+func MigrateCommand(store *storage.Store, args []string, out io.Writer) error {
+	ctx := context.Background()
+	m, err := NewMigrator(store.DB, store.Dialect)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 && args[0] == "up" {
+		if err := prepareBaseline(ctx, m, store.DB, store.Dialect); err != nil {
+			return err
+		}
+	}
+	return migrate.Command(ctx, m, args, out)
+}
+
+// prepareBaseline gives a SQLite file from before migrations the columns the baseline expects,
+// when the baseline is about to be applied to it
+func prepareBaseline(ctx context.Context, m *migrate.Migrator, db *sql.DB, dialect storage.Dialect) error {
+	if dialect != storage.SQLite {
+		return nil
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 || pending[0].Version != baselineVersion {
+		return nil
+	}
+	return upgradeLegacySQLite(db)
+}
+
+// checkMigrated fails when db has migrations waiting, for when they are not applied at startup
+func checkMigrated(db *sql.DB, dialect storage.Dialect) error {
+	m, err := NewMigrator(db, dialect)
+	if err != nil {
+		return err
+	}
+	pending, err := m.Pending(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d migration(s) pending, starting with %04d_%s; run \"migrate up\"",
+			len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
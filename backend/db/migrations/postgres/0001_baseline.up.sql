@@ -0,0 +1,190 @@
+-- Baseline: the PostgreSQL version of the SQLite baseline, with the same columns, defaults,
+-- uniques, foreign keys and indexes. Schema changes go in new numbered migrations for both.
+
+CREATE TABLE IF NOT EXISTS users (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	uid TEXT UNIQUE,
+	email TEXT UNIQUE NOT NULL,
+	username TEXT UNIQUE,
+	username_canonical TEXT,
+	password TEXT,
+	fullname TEXT,
+	verified BOOLEAN DEFAULT FALSE,
+	role TEXT NOT NULL DEFAULT 'user',
+	profile_visibility TEXT NOT NULL DEFAULT 'public',
+	show_fullname BOOLEAN NOT NULL DEFAULT TRUE,
+	suspended_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	uid TEXT NOT NULL REFERENCES users(uid) ON DELETE CASCADE,
+	session_token TEXT UNIQUE NOT NULL,
+	user_agent TEXT,
+	ip_address TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMPTZ,
+	impersonated_by TEXT
+);
+
+CREATE TABLE IF NOT EXISTS signup_otps (
+	email TEXT NOT NULL REFERENCES users(email) ON DELETE CASCADE,
+	code TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS signup_otp_requests (
+	email TEXT NOT NULL REFERENCES users(email) ON DELETE CASCADE,
+	request_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS signup_otp_cooldowns (
+	email TEXT PRIMARY KEY REFERENCES users(email) ON DELETE CASCADE,
+	cooldown_until TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS login_otps (
+	email TEXT NOT NULL REFERENCES users(email) ON DELETE CASCADE,
+	code TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS login_otp_requests (
+	email TEXT NOT NULL REFERENCES users(email) ON DELETE CASCADE,
+	request_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS login_otp_cooldowns (
+	email TEXT PRIMARY KEY REFERENCES users(email) ON DELETE CASCADE,
+	cooldown_until TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS password_reset_otps (
+	email TEXT NOT NULL REFERENCES users(email) ON DELETE CASCADE,
+	code TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS password_reset_requests (
+	email TEXT NOT NULL REFERENCES users(email) ON DELETE CASCADE,
+	request_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS password_reset_cooldowns (
+	email TEXT PRIMARY KEY REFERENCES users(email) ON DELETE CASCADE,
+	cooldown_until TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS user_images (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	uid TEXT NOT NULL REFERENCES users(uid) ON DELETE CASCADE,
+	username TEXT NOT NULL,
+	type TEXT NOT NULL,
+	image_url TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (uid, type)
+);
+
+CREATE TABLE IF NOT EXISTS username_history (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	uid TEXT NOT NULL REFERENCES users(uid) ON DELETE CASCADE,
+	old_username TEXT NOT NULL,
+	old_canonical TEXT NOT NULL,
+	new_username TEXT NOT NULL,
+	changed_at TIMESTAMPTZ NOT NULL,
+	released_until TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS invite_codes (
+	code TEXT PRIMARY KEY,
+	created_by_uid TEXT,
+	email TEXT,
+	max_uses INTEGER NOT NULL DEFAULT 1,
+	uses INTEGER NOT NULL DEFAULT 0,
+	expires_at TIMESTAMPTZ,
+	revoked BOOLEAN DEFAULT FALSE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS invite_redemptions (
+	code TEXT NOT NULL REFERENCES invite_codes(code) ON DELETE CASCADE,
+	email TEXT NOT NULL,
+	redeemed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (code, email)
+);
+
+CREATE TABLE IF NOT EXISTS waitlist (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	email TEXT UNIQUE NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	invite_code TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	approved_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	uid TEXT NOT NULL REFERENCES users(uid) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	token_hash TEXT UNIQUE NOT NULL,
+	token_prefix TEXT NOT NULL,
+	scopes TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMPTZ NOT NULL,
+	last_used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS impersonation_log (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	admin_uid TEXT NOT NULL,
+	target_uid TEXT NOT NULL,
+	session_id TEXT,
+	event TEXT NOT NULL,
+	reason TEXT,
+	method TEXT,
+	path TEXT,
+	status INTEGER,
+	ip_address TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS data_exports (
+	id TEXT PRIMARY KEY,
+	uid TEXT NOT NULL REFERENCES users(uid) ON DELETE CASCADE,
+	status TEXT NOT NULL DEFAULT 'pending',
+	file_path TEXT,
+	size_bytes BIGINT,
+	error TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
+CREATE INDEX IF NOT EXISTS idx_users_uid ON users(uid);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_canonical ON users(username_canonical);
+CREATE INDEX IF NOT EXISTS idx_sessions_uid ON sessions(uid);
+CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(session_token);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires ON sessions(expires_at);
+CREATE INDEX IF NOT EXISTS idx_otps_email ON signup_otps(email);
+CREATE INDEX IF NOT EXISTS idx_login_otps_email ON login_otps(email);
+CREATE INDEX IF NOT EXISTS idx_password_otps_email ON password_reset_otps(email);
+CREATE INDEX IF NOT EXISTS idx_signup_otp_requests_email_time ON signup_otp_requests(email, request_time);
+CREATE INDEX IF NOT EXISTS idx_login_requests_email_time ON login_otp_requests(email, request_time);
+CREATE INDEX IF NOT EXISTS idx_password_requests_email_time ON password_reset_requests(email, request_time);
+CREATE INDEX IF NOT EXISTS idx_user_images_uid ON user_images(uid);
+CREATE INDEX IF NOT EXISTS idx_user_images_type ON user_images(type);
+CREATE INDEX IF NOT EXISTS idx_user_images_username ON user_images(username);
+CREATE INDEX IF NOT EXISTS idx_username_history_uid_changed ON username_history(uid, changed_at);
+CREATE INDEX IF NOT EXISTS idx_username_history_old_canonical ON username_history(old_canonical);
+CREATE INDEX IF NOT EXISTS idx_invite_codes_created_by ON invite_codes(created_by_uid);
+CREATE INDEX IF NOT EXISTS idx_waitlist_status_created ON waitlist(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_uid ON personal_access_tokens(uid);
+CREATE INDEX IF NOT EXISTS idx_impersonation_log_target ON impersonation_log(target_uid, created_at);
+CREATE INDEX IF NOT EXISTS idx_impersonation_log_admin ON impersonation_log(admin_uid, created_at);
+CREATE INDEX IF NOT EXISTS idx_data_exports_uid_created ON data_exports(uid, created_at);
+CREATE INDEX IF NOT EXISTS idx_data_exports_status ON data_exports(status);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_password_reset_requests_time;
+DROP INDEX IF EXISTS idx_login_otp_requests_time;
+DROP INDEX IF EXISTS idx_signup_otp_requests_time;
+DROP INDEX IF EXISTS idx_password_reset_otps_created;
+DROP INDEX IF EXISTS idx_login_otps_created;
+DROP INDEX IF EXISTS idx_signup_otps_created;
+DROP TABLE IF EXISTS maintenance_jobs;
@@ -0,0 +1,21 @@
+-- One row per maintenance job, created on its first run: the lock that keeps a job to a single
+-- instance at a time, and how the last run went.
+
+CREATE TABLE maintenance_jobs (
+	name TEXT PRIMARY KEY,
+	locked_by TEXT,
+	locked_until TIMESTAMPTZ,
+	last_started_at TIMESTAMPTZ,
+	last_finished_at TIMESTAMPTZ,
+	last_status TEXT,
+	last_error TEXT,
+	last_result BIGINT NOT NULL DEFAULT 0,
+	run_count BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_signup_otps_created ON signup_otps(created_at);
+CREATE INDEX IF NOT EXISTS idx_login_otps_created ON login_otps(created_at);
+CREATE INDEX IF NOT EXISTS idx_password_reset_otps_created ON password_reset_otps(created_at);
+CREATE INDEX IF NOT EXISTS idx_signup_otp_requests_time ON signup_otp_requests(request_time);
+CREATE INDEX IF NOT EXISTS idx_login_otp_requests_time ON login_otp_requests(request_time);
+CREATE INDEX IF NOT EXISTS idx_password_reset_requests_time ON password_reset_requests(request_time);
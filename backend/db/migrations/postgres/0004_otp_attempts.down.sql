@@ -0,0 +1,3 @@
+ALTER TABLE password_reset_otps DROP COLUMN failed_attempts;
+ALTER TABLE login_otps DROP COLUMN failed_attempts;
+ALTER TABLE signup_otps DROP COLUMN failed_attempts;
@@ -0,0 +1,6 @@
+-- Wrong guesses against the current code. The handlers delete a code after a few of them, so it
+-- cannot be brute forced while it is valid. Save replaces the row, which starts the count over.
+
+ALTER TABLE signup_otps ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE login_otps ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE password_reset_otps ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,21 @@
+-- Drops everything the baseline created, dependants first. This deletes all data.
+
+DROP TABLE IF EXISTS data_exports;
+DROP TABLE IF EXISTS impersonation_log;
+DROP TABLE IF EXISTS personal_access_tokens;
+DROP TABLE IF EXISTS waitlist;
+DROP TABLE IF EXISTS invite_redemptions;
+DROP TABLE IF EXISTS invite_codes;
+DROP TABLE IF EXISTS username_history;
+DROP TABLE IF EXISTS user_images;
+DROP TABLE IF EXISTS password_reset_cooldowns;
+DROP TABLE IF EXISTS password_reset_requests;
+DROP TABLE IF EXISTS password_reset_otps;
+DROP TABLE IF EXISTS login_otp_cooldowns;
+DROP TABLE IF EXISTS login_otp_requests;
+DROP TABLE IF EXISTS login_otps;
+DROP TABLE IF EXISTS signup_otp_cooldowns;
+DROP TABLE IF EXISTS signup_otp_requests;
+DROP TABLE IF EXISTS signup_otps;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
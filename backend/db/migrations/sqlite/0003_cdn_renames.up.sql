@@ -0,0 +1,13 @@
+-- Username changes the CDN has not applied yet: the user's files are still stored under
+-- old_username. A second rename before the CDN catches up only moves new_username along, so
+-- one row per user is enough.
+
+CREATE TABLE cdn_renames (
+	uid TEXT PRIMARY KEY,
+	old_username TEXT NOT NULL,
+	new_username TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
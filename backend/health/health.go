@@ -0,0 +1,53 @@
+// Package health builds the API's readiness checks on top of sraraa/pkg/health: the database
+// takes writes and is fully migrated, the CDN answers, and email can be sent. main serves them
+// at /readyz next to the /healthz liveness probe.
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"sraraa/app"
+	"sraraa/db"
+	"sraraa/mailer"
+	shared_config "sraraa/pkg/config"
+	shared_health "sraraa/pkg/health"
+	"sraraa/pkg/tracing"
+)
+
+// New returns the checker behind /readyz
+func New(a *app.App) *shared_health.Checker {
+	cdnClient := &http.Client{Transport: tracing.Transport(nil)}
+
+	return shared_health.New(
+		shared_health.Check{Name: "database", Run: func(ctx context.Context) (string, error) {
+			return string(a.Store.Dialect), shared_health.CheckWritable(ctx, a.DB)
+		}},
+		shared_health.Check{Name: "migrations", Run: func(ctx context.Context) (string, error) {
+			m, err := db.NewMigrator(a.DB, a.Store.Dialect)
+			if err != nil {
+				return "", err
+			}
+			return shared_health.CheckMigrated(ctx, m)
+		}},
+		shared_health.Check{Name: "cdn", Run: func(ctx context.Context) (string, error) {
+			return shared_health.CheckHTTP(ctx, cdnClient, a.Config.CDNURL+"/healthz")
+		}},
+		shared_health.Check{Name: "mailer", Run: func(ctx context.Context) (string, error) {
+			return checkMailer(a)
+		}},
+	)
+}
+
+// checkMailer only fails in production: elsewhere missing SMTP settings mean codes are logged
+// as skipped, which is how development runs
+func checkMailer(a *app.App) (string, error) {
+	if mailer.Configured(a.Mailer) {
+		return "smtp " + a.Config.SMTPHost, nil
+	}
+	if a.Config.Env == shared_config.Production {
+		return "", errors.New("SMTP is not configured")
+	}
+	return "SMTP not configured; emails are skipped", nil
+}
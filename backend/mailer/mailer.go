@@ -0,0 +1,68 @@
+// Package mailer sends the API's transactional email (one-time codes). Handlers get a Mailer
+// from the app, so tests can hand them a fake instead of a real SMTP server.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+
+	"sraraa/pkg/tracing"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+)
+
+// ErrNotConfigured is returned by the Mailer used when SMTP settings are missing
+var ErrNotConfigured = errors.New("mailer: SMTP is not configured")
+
+// Mailer sends a plain-text message. ctx carries the request's trace.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// SMTP sends through an SMTP server with PLAIN auth, logging in as From
+type SMTP struct {
+	Host     string
+	Port     string
+	From     string
+	Password string
+}
+
+func (m *SMTP) Send(ctx context.Context, to, subject, body string) (err error) {
+	_, span := tracing.Start(ctx, "smtp.send", semconv.ServerAddress(m.Host))
+	defer func() { tracing.End(span, err) }()
+
+	auth := smtp.PlainAuth("", m.From, m.Password, m.Host)
+	msg := fmt.Sprintf("From: %s\r\n"+
+		"To: %s\r\n"+
+		"Subject: %s\r\n"+
+		"\r\n"+
+		"%s", m.From, to, subject, body)
+
+	if err := smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+type unconfigured struct{}
+
+func (unconfigured) Send(ctx context.Context, to, subject, body string) error {
+	return ErrNotConfigured
+}
+
+// New returns an SMTP mailer, or one that fails every send with ErrNotConfigured when any
+// setting is empty
+func New(host, port, from, password string) Mailer {
+	if host == "" || port == "" || from == "" || password == "" {
+		return unconfigured{}
+	}
+	return &SMTP{Host: host, Port: port, From: from, Password: password}
+}
+
+// Configured reports whether m can actually send, i.e. was built from complete SMTP settings
+func Configured(m Mailer) bool {
+	_, missing := m.(unconfigured)
+	return !missing
+}
@@ -0,0 +1,90 @@
+package maintenance
+
+import (
+	"context"
+	"time"
+
+	"sraraa/app"
+	access_auth_controller "sraraa/reciever_src/controllers/auth/access_auth"
+	username_change_controller "sraraa/reciever_src/controllers/auth/username"
+	export_controller "sraraa/reciever_src/controllers/main/export"
+	"sraraa/storage"
+)
+
+// New returns the scheduler for the API's cleanups, with intervals and retentions from a's
+// config
+func New(a *app.App) *Scheduler {
+	cfg := a.Config
+	return NewScheduler(a.Store.Jobs, a.Clock, cfg.MaintenanceJitter, cfg.MaintenanceLockTimeout,
+		Job{
+			Name:        "expired_sessions",
+			Description: "Delete sessions past their expiry",
+			Interval:    cfg.SessionsCleanupInterval,
+			Run: func(ctx context.Context) (int64, error) {
+				return a.Store.Sessions.DeleteExpired(ctx, a.Clock.Now())
+			},
+		},
+		Job{
+			Name:        "stale_otps",
+			Description: "Delete one-time codes older than OTP_RETENTION",
+			Interval:    cfg.OTPCleanupInterval,
+			Run: func(ctx context.Context) (int64, error) {
+				return eachPurpose(ctx, a.Store.OTPs.DeleteCodesBefore, a.Clock.Now().Add(-cfg.OTPRetention))
+			},
+		},
+		Job{
+			Name:        "otp_requests",
+			Description: "Delete code requests older than OTP_REQUEST_RETENTION",
+			Interval:    cfg.OTPRequestCleanupInterval,
+			Run: func(ctx context.Context) (int64, error) {
+				return eachPurpose(ctx, a.Store.OTPs.DeleteRequestsBefore, a.Clock.Now().Add(-cfg.OTPRequestRetention))
+			},
+		},
+		Job{
+			Name:        "cooldowns",
+			Description: "Delete cooldowns that have ended",
+			Interval:    cfg.CooldownCleanupInterval,
+			Run: func(ctx context.Context) (int64, error) {
+				return eachPurpose(ctx, a.Store.OTPs.DeleteCooldownsBefore, a.Clock.Now())
+			},
+		},
+		Job{
+			Name:        "unverified_users",
+			Description: "Delete accounts left unverified longer than UNVERIFIED_ACCOUNT_RETENTION",
+			Interval:    cfg.UnverifiedCleanupInterval,
+			Run: func(ctx context.Context) (int64, error) {
+				return access_auth_controller.AutoDeleteUnverifiedUsers(ctx, a)
+			},
+		},
+		Job{
+			Name:        "expired_exports",
+			Description: "Delete data export archives past their expiry",
+			Interval:    cfg.ExportCleanupInterval,
+			Run: func(ctx context.Context) (int64, error) {
+				return export_controller.DeleteExpiredExports(ctx, a)
+			},
+		},
+		Job{
+			Name:        "cdn_renames",
+			Description: "Move renamed users' files on the CDN where the rename did not go through",
+			Interval:    cfg.CDNRenameRetryInterval,
+			Run: func(ctx context.Context) (int64, error) {
+				return username_change_controller.RetryCDNRenames(ctx, a)
+			},
+		},
+	)
+}
+
+// eachPurpose runs an OTP purge for the signup, login and password reset tables, adding up what
+// they removed
+func eachPurpose(ctx context.Context, purge func(context.Context, storage.OTPPurpose, time.Time) (int64, error), cutoff time.Time) (int64, error) {
+	var total int64
+	for _, purpose := range storage.Purposes {
+		n, err := purge(ctx, purpose, cutoff)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,266 @@
+// Package maintenance runs the API's periodic cleanups: expired sessions, stale one-time codes,
+// old code requests, ended cooldowns, never-verified accounts and expired data exports. It also
+// retries CDN renames that failed when the username changed.
+//
+// Each job has a name and an interval. Runs are spread by a random jitter, and a lock row in
+// maintenance_jobs keeps a job to one run at a time across every instance sharing the database.
+// The lock is a lease: a run is cancelled when it expires, so a crashed instance can't hold a
+// job forever. The row also keeps how the last run went, which admins read and which times the
+// first run after a restart.
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"sraraa/pkg/clock"
+	"sraraa/pkg/lifecycle"
+	"sraraa/pkg/tracing"
+	"sraraa/storage"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Run statuses, as stored in maintenance_jobs.last_status
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+var (
+	ErrUnknownJob = errors.New("unknown maintenance job")
+	// ErrLocked means the job is already running, here or on another instance
+	ErrLocked = errors.New("maintenance job is already running")
+)
+
+// Job is one named cleanup. Run returns how many rows or files it removed, or for a retry job
+// how many items it completed.
+type Job struct {
+	Name        string
+	Description string
+	// Interval between scheduled runs; 0 only runs the job on demand
+	Interval time.Duration
+	Run      func(ctx context.Context) (int64, error)
+}
+
+// Result is the outcome of one run
+type Result struct {
+	Job        string `json:"job"`
+	Status     string `json:"status"`
+	Removed    int64  `json:"removed"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Scheduler runs jobs on their intervals and on demand
+type Scheduler struct {
+	store  storage.JobRepository
+	clock  clock.Clock
+	jitter time.Duration
+	lease  time.Duration
+	owner  string
+
+	jobs   []Job
+	byName map[string]Job
+
+	mu      sync.Mutex
+	nextRun map[string]time.Time
+}
+
+// NewScheduler returns a scheduler for jobs. Each run holds its lock for at most lease, and
+// scheduled runs are delayed by up to jitter.
+func NewScheduler(store storage.JobRepository, clk clock.Clock, jitter, lease time.Duration, jobs ...Job) *Scheduler {
+	s := &Scheduler{
+		store:   store,
+		clock:   clk,
+		jitter:  jitter,
+		lease:   lease,
+		owner:   owner(),
+		jobs:    jobs,
+		byName:  make(map[string]Job, len(jobs)),
+		nextRun: map[string]time.Time{},
+	}
+	for _, j := range jobs {
+		s.byName[j.Name] = j
+	}
+	return s
+}
+
+// owner names this process in the lock rows
+func owner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// Start schedules every job with an interval in g, which stops them on shutdown
+func (s *Scheduler) Start(g *lifecycle.Group) {
+	for _, j := range s.jobs {
+		if j.Interval <= 0 {
+			slog.Info("Maintenance job not scheduled", "job", j.Name)
+			continue
+		}
+		g.Go("maintenance:"+j.Name, func(ctx context.Context) {
+			s.loop(ctx, j)
+		})
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, j Job) {
+	next := s.firstRun(ctx, j)
+	for {
+		s.setNextRun(j.Name, next)
+		if err := lifecycle.Sleep(ctx, next.Sub(s.clock.Now())); err != nil {
+			return
+		}
+		if _, err := s.Run(ctx, j.Name); err != nil && !errors.Is(err, ErrLocked) && ctx.Err() == nil {
+			slog.Error("Maintenance job failed", "job", j.Name, "err", err)
+		}
+		next = s.clock.Now().Add(j.Interval + s.randomJitter())
+	}
+}
+
+// firstRun continues the schedule of the previous process: a job that ran recently waits out
+// the rest of its interval instead of running again at every restart
+func (s *Scheduler) firstRun(ctx context.Context, j Job) time.Time {
+	now := s.clock.Now()
+	next := now
+	state, err := s.store.Get(ctx, j.Name)
+	switch {
+	case err == nil && state.LastStartedAt != nil:
+		if due := state.LastStartedAt.Add(j.Interval); due.After(now) {
+			next = due
+		}
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		slog.Warn("Could not read maintenance job state", "job", j.Name, "err", err)
+	}
+	return next.Add(s.randomJitter())
+}
+
+func (s *Scheduler) randomJitter() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	return rand.N(s.jitter)
+}
+
+func (s *Scheduler) setNextRun(name string, at time.Time) {
+	s.mu.Lock()
+	s.nextRun[name] = at
+	s.mu.Unlock()
+}
+
+// NextRun reports when the job is next scheduled, false when it isn't
+func (s *Scheduler) NextRun(name string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.nextRun[name]
+	return at, ok
+}
+
+// Run runs the named job now, unless it is already running anywhere (ErrLocked). The run is
+// recorded in maintenance_jobs; a failed run returns its Result along with the error.
+func (s *Scheduler) Run(ctx context.Context, name string) (Result, error) {
+	j, ok := s.byName[name]
+	if !ok {
+		return Result{}, fmt.Errorf("%w: %q", ErrUnknownJob, name)
+	}
+
+	now := s.clock.Now()
+	acquired, err := s.store.Acquire(ctx, name, s.owner, now, now.Add(s.lease))
+	if err != nil {
+		return Result{}, fmt.Errorf("lock %s: %w", name, err)
+	}
+	if !acquired {
+		return Result{}, ErrLocked
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, s.lease)
+	defer cancel()
+	runCtx, span := tracing.Start(runCtx, "maintenance."+name, attribute.String("maintenance.job", name))
+
+	start := time.Now()
+	removed, runErr := j.Run(runCtx)
+	tracing.End(span, runErr)
+
+	result := Result{Job: name, Status: StatusOK, Removed: removed, DurationMS: time.Since(start).Milliseconds()}
+	if runErr != nil {
+		result.Status = StatusFailed
+		result.Error = runErr.Error()
+	}
+
+	// Record the outcome even when shutdown cancelled the run, and release the lock
+	if err := s.store.Finish(context.WithoutCancel(ctx), name, s.owner, s.clock.Now(), result.Status, removed, result.Error); err != nil {
+		slog.Error("Could not record maintenance job run", "job", name, "err", err)
+	}
+
+	if runErr != nil {
+		return result, runErr
+	}
+	slog.Info("Maintenance job finished", "job", name, "removed", removed, "duration_ms", result.DurationMS)
+	return result, nil
+}
+
+// JobStatus is a job's configuration together with its persisted state
+type JobStatus struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Interval is empty for a job that only runs on demand
+	Interval       string     `json:"interval,omitempty"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+	Running        bool       `json:"running"`
+	LockedBy       string     `json:"locked_by,omitempty"`
+	LastStartedAt  *time.Time `json:"last_started_at,omitempty"`
+	LastFinishedAt *time.Time `json:"last_finished_at,omitempty"`
+	LastStatus     string     `json:"last_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastRemoved    int64      `json:"last_removed"`
+	RunCount       int64      `json:"run_count"`
+}
+
+// Status reports every job, in registration order. NextRunAt is this instance's schedule.
+func (s *Scheduler) Status(ctx context.Context) ([]JobStatus, error) {
+	states, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]storage.Job, len(states))
+	for _, st := range states {
+		byName[st.Name] = st
+	}
+
+	now := s.clock.Now()
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status := JobStatus{Name: j.Name, Description: j.Description}
+		if j.Interval > 0 {
+			status.Interval = j.Interval.String()
+		}
+		if at, ok := s.NextRun(j.Name); ok {
+			status.NextRunAt = &at
+		}
+		if st, ok := byName[j.Name]; ok {
+			status.Running = st.LockedUntil != nil && st.LockedUntil.After(now)
+			if status.Running {
+				status.LockedBy = st.LockedBy
+			}
+			status.LastStartedAt = st.LastStartedAt
+			status.LastFinishedAt = st.LastFinishedAt
+			status.LastStatus = st.LastStatus
+			status.LastError = st.LastError
+			status.LastRemoved = st.LastResult
+			status.RunCount = st.RunCount
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,89 @@
+// Package metrics holds the API's Prometheus registry and business counters. The app owns one
+// Metrics; handlers record events through its methods and main serves the registry at /metrics
+// behind the gate from sraraa/pkg/metrics.
+package metrics
+
+import (
+	"database/sql"
+
+	shared_metrics "sraraa/pkg/metrics"
+	user_models "sraraa/reciever_src/models/user"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// OTP purposes
+const (
+	PurposeSignup        = "signup"
+	PurposeLogin         = "login"
+	PurposePasswordReset = "password_reset"
+)
+
+type Metrics struct {
+	Registry *prometheus.Registry
+	// HTTP is the request histogram, filled by shared_metrics.Instrument
+	HTTP *prometheus.HistogramVec
+
+	otps            *prometheus.CounterVec
+	loginFailures   *prometheus.CounterVec
+	sessionsCreated *prometheus.CounterVec
+	sessionsRevoked *prometheus.CounterVec
+}
+
+// New registers the API's metrics, including pool stats for db and the export queue depth
+func New(db *sql.DB) *Metrics {
+	reg := shared_metrics.NewRegistry()
+	m := &Metrics{
+		Registry: reg,
+		HTTP:     shared_metrics.NewHTTPDuration(reg),
+		otps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sraraa_otp_events_total",
+			Help: "One-time codes issued, verified and failed, by purpose.",
+		}, []string{"purpose", "result"}),
+		loginFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sraraa_login_failures_total",
+			Help: "Refused login attempts by reason.",
+		}, []string{"reason"}),
+		sessionsCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sraraa_sessions_created_total",
+			Help: "Sessions created, by kind.",
+		}, []string{"kind"}),
+		sessionsRevoked: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sraraa_session_revocations_total",
+			Help: "Session revocations (one logout, or all of a user's sessions at once), by reason.",
+		}, []string{"reason"}),
+	}
+
+	reg.MustRegister(m.otps, m.loginFailures, m.sessionsCreated, m.sessionsRevoked)
+	reg.MustRegister(collectors.NewDBStatsCollector(db, "main"))
+	reg.MustRegister(shared_metrics.NewQueueCollector("sraraa_export_queue_depth",
+		"Personal data exports waiting or being built.",
+		func() (map[string]int, error) { return user_models.CountUnfinishedExports(db) }))
+	return m
+}
+
+func (m *Metrics) OTPIssued(purpose string) {
+	m.otps.WithLabelValues(purpose, "issued").Inc()
+}
+
+func (m *Metrics) OTPVerified(purpose string) {
+	m.otps.WithLabelValues(purpose, "verified").Inc()
+}
+
+// OTPFailed counts a wrong, expired or missing code
+func (m *Metrics) OTPFailed(purpose string) {
+	m.otps.WithLabelValues(purpose, "failed").Inc()
+}
+
+func (m *Metrics) LoginFailed(reason string) {
+	m.loginFailures.WithLabelValues(reason).Inc()
+}
+
+func (m *Metrics) SessionCreated(kind string) {
+	m.sessionsCreated.WithLabelValues(kind).Inc()
+}
+
+func (m *Metrics) SessionsRevoked(reason string) {
+	m.sessionsRevoked.WithLabelValues(reason).Inc()
+}
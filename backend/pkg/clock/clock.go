@@ -0,0 +1,22 @@
+// Package clock lets the services ask for the current time through an interface, so code that
+// depends on time (cooldowns, expiries, cleanup cutoffs) can be run at a chosen instant.
+package clock
+
+import "time"
+
+// Clock returns the current time
+type Clock interface {
+	Now() time.Time
+}
+
+type system struct{}
+
+func (system) Now() time.Time { return time.Now() }
+
+// System is the real wall clock
+var System Clock = system{}
+
+// Fixed always reports t
+type Fixed time.Time
+
+func (f Fixed) Now() time.Time { return time.Time(f) }
@@ -0,0 +1,440 @@
+// Package config loads a service's typed settings. The backend and the CDN each describe their
+// settings as a struct whose fields are tagged with the environment variable they come from:
+//
+//	Port int      `env:"PORT" default:"8080" usage:"HTTP port"`
+//	Token string  `env:"CDN_INTERNAL_TOKEN" secret:"true"`
+//
+// The same tag names the key in the config file (lowercased, "port") and the command-line flag
+// (lowercased with dashes, -port). Sources are applied in this order, later ones winning:
+//
+//  1. the default tag
+//  2. the config file named by CONFIG_FILE or -config (YAML, or TOML for a .toml file)
+//  3. the file's profiles.<APP_ENV> section
+//  4. environment variables
+//  5. flags given on the command line
+//
+// After loading, a settings struct with a Validate() error method is validated; Load fails on
+// the first problem so a misconfigured service does not start. Fields tagged secret are never
+// included in the Snapshot returned for logging and the operators' dump endpoint.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvKey selects the environment and with it the config file profile
+	EnvKey = "APP_ENV"
+	// FileKey names the optional config file
+	FileKey = "CONFIG_FILE"
+
+	Development = "development"
+	Staging     = "staging"
+	Production  = "production"
+
+	redacted = "[redacted]"
+)
+
+// Environments lists the values APP_ENV may take
+var Environments = []string{Development, Staging, Production}
+
+// Validator is implemented by settings structs that check themselves after loading
+type Validator interface {
+	Validate() error
+}
+
+// Setting is one resolved value as reported by a Snapshot
+type Setting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+	Secret bool        `json:"secret,omitempty"`
+}
+
+// Snapshot describes where a loaded configuration came from. Secret values are replaced with
+// "[redacted]", so a Snapshot is safe to log or serve.
+type Snapshot struct {
+	Env      string    `json:"env"`
+	File     string    `json:"file,omitempty"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Settings []Setting `json:"settings"`
+}
+
+type field struct {
+	index  int
+	env    string
+	def    string
+	usage  string
+	secret bool
+}
+
+func (f field) fileKey() string { return strings.ToLower(f.env) }
+func (f field) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(f.env), "_", "-")
+}
+
+// Load fills cfg, a pointer to a tagged settings struct, from the sources above. args are the
+// command-line arguments without the program name; pass nil to ignore flags. flag.ErrHelp is
+// returned after printing usage when args ask for help.
+func Load(cfg interface{}, args []string) (*Snapshot, error) {
+	snap, rest, err := LoadCommand(cfg, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("config: unexpected argument %q", rest[0])
+	}
+	return snap, nil
+}
+
+// LoadCommand is Load for programs with subcommands: flags come first, and the arguments left
+// after them (e.g. "migrate status") are returned instead of being rejected.
+func LoadCommand(cfg interface{}, args []string) (*Snapshot, []string, error) {
+	v, fields, err := settingsValue(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	flags, rest, err := parseFlags(fields, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file := firstNonEmpty(flags[FileKey], os.Getenv(FileKey))
+	base, profiles, err := readFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkKeys(file, base, fields); err != nil {
+		return nil, nil, err
+	}
+
+	env := firstNonEmpty(flags[EnvKey], os.Getenv(EnvKey), base[strings.ToLower(EnvKey)], Development)
+	if !isEnvironment(env) {
+		return nil, nil, fmt.Errorf("config: %s=%q, expected one of %s", EnvKey, env, strings.Join(Environments, ", "))
+	}
+	profile := profiles[env]
+	if err := checkKeys(file+" profiles."+env, profile, fields); err != nil {
+		return nil, nil, err
+	}
+
+	snap := &Snapshot{Env: env, File: file, LoadedAt: time.Now().UTC()}
+	for _, f := range fields {
+		raw, source := f.def, "default"
+		if s, ok := base[f.fileKey()]; ok {
+			raw, source = s, "file"
+		}
+		if s, ok := profile[f.fileKey()]; ok {
+			raw, source = s, "profile:"+env
+		}
+		if s, ok := os.LookupEnv(f.env); ok {
+			raw, source = s, "env"
+		}
+		if s, ok := flags[f.env]; ok {
+			raw, source = s, "flag"
+		}
+		if f.env == EnvKey {
+			raw = env
+		}
+
+		if err := setValue(v.Field(f.index), raw); err != nil {
+			return nil, nil, fmt.Errorf("config: %s (from %s): %w", f.env, source, err)
+		}
+		snap.Settings = append(snap.Settings, Setting{Key: f.env, Source: source, Secret: f.secret})
+	}
+
+	if val, ok := cfg.(Validator); ok {
+		if err := val.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("config: %w", err)
+		}
+	}
+
+	for i, f := range fields {
+		snap.Settings[i].Value = displayValue(v.Field(f.index), f.secret)
+	}
+	return snap, rest, nil
+}
+
+// Defaults fills cfg from its default tags only. It is for code that runs without Load, such as
+// command-line tools sharing a service's settings.
+func Defaults(cfg interface{}) error {
+	v, fields, err := settingsValue(cfg)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err := setValue(v.Field(f.index), f.def); err != nil {
+			return fmt.Errorf("config: default for %s: %w", f.env, err)
+		}
+	}
+	return nil
+}
+
+// Get returns the setting for key, or false when the snapshot has none
+func (s *Snapshot) Get(key string) (Setting, bool) {
+	for _, setting := range s.Settings {
+		if setting.Key == key {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+func settingsValue(cfg interface{}) (reflect.Value, []field, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, nil, errors.New("config: settings must be a pointer to a struct")
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		env := sf.Tag.Get("env")
+		if env == "" || !sf.IsExported() {
+			continue
+		}
+		fields = append(fields, field{
+			index:  i,
+			env:    env,
+			def:    sf.Tag.Get("default"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+		})
+	}
+	return v, fields, nil
+}
+
+// parseFlags returns the flags given in args keyed by their env name. Flags that were not given
+// are left out so they don't override other sources with their zero value.
+func parseFlags(fields []field, args []string) (map[string]string, []string, error) {
+	set := map[string]string{}
+	if args == nil {
+		return set, nil, nil
+	}
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	byName := map[string]string{"config": FileKey}
+	fs.String("config", "", "config file (YAML, or TOML with a .toml extension)")
+	for _, f := range fields {
+		usage := f.usage
+		if usage == "" {
+			usage = f.env
+		}
+		fs.String(f.flagName(), f.def, usage+" (env "+f.env+")")
+		byName[f.flagName()] = f.env
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		set[byName[fl.Name]] = fl.Value.String()
+	})
+	return set, fs.Args(), nil
+}
+
+// readFile returns the top-level settings of the config file and its profiles, all as strings.
+// A missing path means no file; a path that can't be read is an error.
+func readFile(path string) (map[string]string, map[string]map[string]string, error) {
+	if path == "" {
+		return map[string]string{}, map[string]map[string]string{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("config: parse %s: %w", path, err)
+	}
+
+	profiles := map[string]map[string]string{}
+	if p, ok := raw["profiles"]; ok {
+		sections, ok := p.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("config: %s: profiles must be a table of environments", path)
+		}
+		for env, section := range sections {
+			if !isEnvironment(env) {
+				return nil, nil, fmt.Errorf("config: %s: unknown profile %q", path, env)
+			}
+			values, ok := section.(map[string]interface{})
+			if !ok {
+				return nil, nil, fmt.Errorf("config: %s: profile %q must be a table", path, env)
+			}
+			if profiles[env], err = flatten(values); err != nil {
+				return nil, nil, fmt.Errorf("config: %s: profile %q: %w", path, env, err)
+			}
+		}
+		delete(raw, "profiles")
+	}
+
+	base, err := flatten(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config: %s: %w", path, err)
+	}
+	return base, profiles, nil
+}
+
+// flatten turns file values into the strings env vars and flags use; lists become
+// comma-separated
+func flatten(values map[string]interface{}) (map[string]string, error) {
+	out := make(map[string]string, len(values))
+	for key, value := range values {
+		switch val := value.(type) {
+		case []interface{}:
+			items := make([]string, len(val))
+			for i, item := range val {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s must be a single value or a list", key)
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(val)
+		}
+	}
+	return out, nil
+}
+
+// checkKeys rejects file keys that match no setting, which are usually typos
+func checkKeys(where string, values map[string]string, fields []field) error {
+	known := map[string]bool{strings.ToLower(EnvKey): true}
+	for _, f := range fields {
+		known[f.fileKey()] = true
+	}
+
+	var unknown []string
+	for key := range values {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("config: %s: unknown setting(s) %s", where, strings.Join(unknown, ", "))
+}
+
+func setValue(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		if raw == "" {
+			v.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		if raw == "" {
+			v.SetBool(false)
+			return nil
+		}
+		b, err := parseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if raw == "" {
+			v.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// parseBool also accepts the on/off and yes/no spellings used in env files
+func parseBool(raw string) (bool, error) {
+	switch strings.ToLower(raw) {
+	case "1", "t", "true", "on", "yes", "y":
+		return true, nil
+	case "0", "f", "false", "off", "no", "n":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", raw)
+}
+
+func displayValue(v reflect.Value, secret bool) interface{} {
+	if secret {
+		if v.IsZero() {
+			return ""
+		}
+		return redacted
+	}
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return v.Interface()
+}
+
+func isEnvironment(env string) bool {
+	for _, e := range Environments {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// CheckPort reports an error unless port is a usable TCP port
+func CheckPort(key string, port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("%s=%d is not a valid port", key, port)
+	}
+	return nil
+}
+
+// CheckURL reports an error unless raw is an absolute http(s) URL. An empty value passes when
+// the setting is optional.
+func CheckURL(key, raw string, optional bool) error {
+	if raw == "" {
+		if optional {
+			return nil
+		}
+		return fmt.Errorf("%s is required", key)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s=%q is not an http(s) URL", key, raw)
+	}
+	return nil
+}
+
+// CheckOrigins reports an error unless each entry is a bare origin such as
+// https://app.example.com. In production plain http is only accepted for localhost.
+func CheckOrigins(key string, origins []string, env string) error {
+	for _, origin := range origins {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			(u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return fmt.Errorf("%s: %q is not an origin", key, origin)
+		}
+		if strings.HasSuffix(origin, "/") {
+			return fmt.Errorf("%s: %q must not end with a slash", key, origin)
+		}
+		if env == Production && u.Scheme != "https" {
+			return fmt.Errorf("%s: %q must use https in production", key, origin)
+		}
+	}
+	return nil
+}
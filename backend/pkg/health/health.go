@@ -0,0 +1,202 @@
+// Package health serves the liveness and readiness probes of the backend and the CDN. Liveness
+// (/healthz) only says the process is up and serving. Readiness (/readyz) runs each service's
+// dependency checks and reports them one by one with their latency, failing as a whole when any
+// check fails or once the service has started shutting down.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sraraa/pkg/migrate"
+)
+
+// Statuses
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// DefaultTimeout bounds each readiness check
+const DefaultTimeout = 2 * time.Second
+
+// CheckFunc probes one dependency. detail is shown next to the result, e.g. free disk space;
+// a non-nil error fails the check.
+type CheckFunc func(ctx context.Context) (detail string, err error)
+
+type Check struct {
+	Name string
+	Run  CheckFunc
+}
+
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Detail    string  `json:"detail,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks,omitempty"`
+}
+
+// Checker runs a service's readiness checks
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// New returns a checker running checks with DefaultTimeout each
+func New(checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: DefaultTimeout}
+}
+
+// Drain makes readiness fail from now on, so load balancers stop sending traffic while the
+// service shuts down
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Ready runs every check concurrently and collects the results in registration order
+func (c *Checker) Ready(ctx context.Context) Report {
+	if c.draining.Load() {
+		return Report{Status: StatusFail, Checks: []Result{{
+			Name:   "shutdown",
+			Status: StatusFail,
+			Error:  "shutting down",
+		}}}
+	}
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, r := range results {
+		if r.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	detail, err := check.Run(ctx)
+	result := Result{
+		Name:      check.Name,
+		Status:    StatusOK,
+		Detail:    detail,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// ReadyHandler serves /readyz: the report with 200 when every check passes, 503 otherwise
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Ready(r.Context())
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		writeReport(w, status, report)
+	})
+}
+
+// LiveHandler serves /healthz. It checks nothing: answering at all means the process is alive.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// CheckWritable proves db accepts writes (not read-only, not locked past its busy timeout) by
+// rewriting a schema_migrations row unchanged inside a transaction that is rolled back
+func CheckWritable(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE `+migrate.Table+` SET applied_at = applied_at
+		WHERE version = (SELECT MAX(version) FROM `+migrate.Table+`)`)
+	return err
+}
+
+// CheckMigrated reports the schema version, failing while m has migrations waiting or an
+// applied one was changed
+func CheckMigrated(ctx context.Context, m *migrate.Migrator) (string, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return "", err
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return "", err
+	}
+	version := 0
+	for _, s := range statuses {
+		if s.Applied {
+			version = s.Version
+		}
+	}
+	detail := fmt.Sprintf("schema version %d", version)
+	if len(pending) > 0 {
+		return detail, fmt.Errorf("%d migration(s) pending, starting with %04d_%s",
+			len(pending), pending[0].Version, pending[0].Name)
+	}
+	return detail, nil
+}
+
+// ErrUnhealthy is returned for a dependency answering with an unexpected status
+var ErrUnhealthy = errors.New("unhealthy")
+
+// CheckHTTP expects a 2xx answer to a GET of url
+func CheckHTTP(ctx context.Context, client *http.Client, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("%w: %s answered %d", ErrUnhealthy, url, resp.StatusCode)
+	}
+	return fmt.Sprintf("%s answered %d", url, resp.StatusCode), nil
+}
@@ -0,0 +1,229 @@
+// Package introspection is a small client for the backend's token introspection endpoint
+// (POST /api/v1/internal/introspect). It lets other services check session tokens and personal
+// access tokens without database access. It only depends on the standard library so any
+// service can vendor or replace-import it.
+package introspection
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCacheTTL         = 30 * time.Second
+	DefaultNegativeCacheTTL = 5 * time.Second
+	defaultMaxCacheEntries  = 10000
+)
+
+// ErrUnauthorizedClient means the backend rejected this service's client credentials
+var ErrUnauthorizedClient = errors.New("introspection: client credentials rejected")
+
+// Response is the RFC 7662 introspection result
+type Response struct {
+	Active    bool   `json:"active"`
+	UID       string `json:"uid"`
+	Sub       string `json:"sub"`
+	Username  string `json:"username"`
+	Scope     string `json:"scope"`
+	TokenType string `json:"token_type"`
+	Exp       int64  `json:"exp"`
+	Iat       int64  `json:"iat"`
+	ClientID  string `json:"client_id"`
+
+	// Act is set for impersonation sessions and names the admin behind them
+	Act *Actor `json:"act,omitempty"`
+}
+
+type Actor struct {
+	Sub string `json:"sub"`
+}
+
+// Scopes splits the space-separated scope claim
+func (r *Response) Scopes() []string {
+	return strings.Fields(r.Scope)
+}
+
+// HasScope reports whether the token is active and was granted scope
+func (r *Response) HasScope(scope string) bool {
+	if r == nil || !r.Active {
+		return false
+	}
+	for _, s := range r.Scopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type cacheEntry struct {
+	resp    *Response
+	expires time.Time
+}
+
+// Client calls the introspection endpoint and caches results. Active results are cached for
+// CacheTTL (never past the token's exp), inactive ones for NegativeCacheTTL, so a logout can take
+// up to CacheTTL to be noticed by the calling service.
+type Client struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+
+	HTTPClient       *http.Client
+	CacheTTL         time.Duration
+	NegativeCacheTTL time.Duration
+	MaxCacheEntries  int
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// NewClient returns a client with default cache settings. endpoint is the full URL of the
+// introspection endpoint.
+func NewClient(endpoint, clientID, clientSecret string) *Client {
+	return &Client{
+		URL:              endpoint,
+		ClientID:         clientID,
+		ClientSecret:     clientSecret,
+		HTTPClient:       &http.Client{Timeout: 5 * time.Second},
+		CacheTTL:         DefaultCacheTTL,
+		NegativeCacheTTL: DefaultNegativeCacheTTL,
+		MaxCacheEntries:  defaultMaxCacheEntries,
+	}
+}
+
+// Introspect returns the token's introspection result. An inactive token is not an error; check
+// Response.Active. Errors mean the backend could not be asked.
+func (c *Client) Introspect(ctx context.Context, token string) (*Response, error) {
+	if token == "" {
+		return &Response{Active: false}, nil
+	}
+
+	key := cacheKey(token)
+	if resp, ok := c.cached(key); ok {
+		return resp, nil
+	}
+
+	resp, err := c.fetch(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store(key, resp)
+	return resp, nil
+}
+
+// Forget drops a token from the cache, e.g. after the service sees it being logged out
+func (c *Client) Forget(token string) {
+	c.mu.Lock()
+	delete(c.cache, cacheKey(token))
+	c.mu.Unlock()
+}
+
+func (c *Client) fetch(ctx context.Context, token string) (*Response, error) {
+	form := url.Values{"token": {token}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(c.ClientID, c.ClientSecret)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspection: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthorizedClient
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection: unexpected status %d", res.StatusCode)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("introspection: decode response: %w", err)
+	}
+	return &resp, nil
+}
+
+func (c *Client) cached(key string) (*Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.cache, key)
+		return nil, false
+	}
+	return entry.resp, true
+}
+
+func (c *Client) store(key string, resp *Response) {
+	ttl := c.NegativeCacheTTL
+	if resp.Active {
+		ttl = c.CacheTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	expires := time.Now().Add(ttl)
+	if resp.Active && resp.Exp > 0 {
+		if exp := time.Unix(resp.Exp, 0); exp.Before(expires) {
+			expires = exp
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cache == nil {
+		c.cache = make(map[string]cacheEntry)
+	}
+
+	max := c.MaxCacheEntries
+	if max <= 0 {
+		max = defaultMaxCacheEntries
+	}
+	if len(c.cache) >= max {
+		now := time.Now()
+		for k, e := range c.cache {
+			if now.After(e.expires) {
+				delete(c.cache, k)
+			}
+		}
+		// Still full: start over rather than track recency
+		if len(c.cache) >= max {
+			c.cache = make(map[string]cacheEntry)
+		}
+	}
+
+	c.cache[key] = cacheEntry{resp: resp, expires: expires}
+}
+
+// cacheKey hashes the token so raw credentials are not kept in memory longer than needed
+func cacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
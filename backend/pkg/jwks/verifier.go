@@ -0,0 +1,230 @@
+// Package jwks verifies backend session tokens offline using the public keys published at
+// /.well-known/jwks.json. Keys are cached and refetched when a token names an unknown kid, so
+// key rotation on the backend needs no coordination. Like the introspection client it only
+// depends on the standard library.
+//
+// Offline verification checks the signature and expiry only; it cannot see logouts. Use the
+// introspection client where a revoked session must be refused immediately.
+package jwks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMinRefreshInterval limits refetches triggered by unknown kids
+	DefaultMinRefreshInterval = 30 * time.Second
+	// DefaultMaxAge forces a refetch so removed keys stop verifying
+	DefaultMaxAge = time.Hour
+)
+
+var (
+	ErrMalformedToken = errors.New("jwks: malformed token")
+	ErrUnsupportedAlg = errors.New("jwks: unsupported algorithm")
+	ErrUnknownKey     = errors.New("jwks: unknown signing key")
+	ErrBadSignature   = errors.New("jwks: signature verification failed")
+	ErrExpired        = errors.New("jwks: token expired")
+	ErrNotSession     = errors.New("jwks: not a session token")
+)
+
+// Claims are the session claims the backend puts in its tokens
+type Claims struct {
+	UserID   int    `json:"user_id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Fullname string `json:"fullname"`
+	Verified bool   `json:"verified"`
+	UID      string `json:"uid"`
+	ID       string `json:"jti"`
+	Exp      int64  `json:"exp"`
+	Nbf      int64  `json:"nbf"`
+	Iat      int64  `json:"iat"`
+
+	// Act is set for impersonation sessions and names the admin behind them. Such sessions are
+	// read-only; reject them for anything that changes state.
+	Act *Actor `json:"act,omitempty"`
+
+	// Scoped tokens (onboarding) carry an audience and are not sessions
+	Audience json.RawMessage `json:"aud,omitempty"`
+}
+
+type Actor struct {
+	Sub string `json:"sub"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+}
+
+// Verifier verifies EdDSA session tokens against a cached JWKS
+type Verifier struct {
+	URL                string
+	HTTPClient         *http.Client
+	MinRefreshInterval time.Duration
+	MaxAge             time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]ed25519.PublicKey
+	lastRefresh time.Time
+}
+
+// NewVerifier returns a verifier for the JWKS at url with default refresh settings
+func NewVerifier(url string) *Verifier {
+	return &Verifier{
+		URL:                url,
+		HTTPClient:         &http.Client{Timeout: 5 * time.Second},
+		MinRefreshInterval: DefaultMinRefreshInterval,
+		MaxAge:             DefaultMaxAge,
+	}
+}
+
+// Verify checks the token's signature and time claims and returns its session claims
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrMalformedToken
+	}
+	if header.Alg != "EdDSA" {
+		return nil, ErrUnsupportedAlg
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	if !ed25519.Verify(key, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrBadSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	now := time.Now().Unix()
+	if claims.Exp == 0 || now >= claims.Exp {
+		return nil, ErrExpired
+	}
+	if claims.Nbf != 0 && now < claims.Nbf {
+		return nil, ErrExpired
+	}
+	if len(claims.Audience) > 0 || claims.UID == "" {
+		return nil, ErrNotSession
+	}
+
+	return &claims, nil
+}
+
+// key returns the public key for kid, refetching the JWKS when kid is unknown or the cache is old
+func (v *Verifier) key(ctx context.Context, kid string) (ed25519.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	maxAge := v.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	stale := time.Since(v.lastRefresh) > maxAge
+
+	if key, ok := v.keys[kid]; ok && !stale {
+		return key, nil
+	}
+
+	minInterval := v.MinRefreshInterval
+	if minInterval <= 0 {
+		minInterval = DefaultMinRefreshInterval
+	}
+	if stale || time.Since(v.lastRefresh) >= minInterval {
+		if err := v.refresh(ctx); err != nil {
+			// Keep serving known keys if the backend is briefly unreachable
+			if key, ok := v.keys[kid]; ok {
+				return key, nil
+			}
+			return nil, err
+		}
+	}
+
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// refresh fetches the JWKS; callers hold v.mu
+func (v *Verifier) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	httpClient := v.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks: unexpected status %d", res.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return fmt.Errorf("jwks: decode key set: %w", err)
+	}
+
+	keys := make(map[string]ed25519.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "OKP" || k.Crv != "Ed25519" || k.Kid == "" {
+			continue
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			continue
+		}
+		keys[k.Kid] = ed25519.PublicKey(x)
+	}
+
+	v.keys = keys
+	v.lastRefresh = time.Now()
+	return nil
+}
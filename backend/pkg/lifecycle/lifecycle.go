@@ -0,0 +1,221 @@
+// Package lifecycle starts and stops the backend and the CDN in an orderly way. A Manager
+// waits for SIGINT or SIGTERM (or an HTTP server failing), then runs the registered stop steps
+// one after the other under a single deadline, typically:
+//
+//  1. fail readiness, so load balancers stop routing to the instance
+//  2. shut the HTTP server down, letting in-flight requests and uploads finish
+//  3. stop background workers and wait for them
+//  4. flush buffered telemetry
+//  5. close the database
+//
+// A second signal during shutdown exits at once. Background work runs in a Group, whose
+// context is cancelled when the group is stopped.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Group runs background goroutines that stop together: Stop cancels the context they were
+// handed and waits for them to return
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]int
+}
+
+func NewGroup() *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{ctx: ctx, cancel: cancel, running: map[string]int{}}
+}
+
+// Go runs fn in a goroutine with the group's context. After Stop it does nothing.
+func (g *Group) Go(name string, fn func(ctx context.Context)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ctx.Err() != nil {
+		return
+	}
+	g.running[name]++
+	g.wg.Add(1)
+
+	go func() {
+		defer func() {
+			g.mu.Lock()
+			if g.running[name]--; g.running[name] == 0 {
+				delete(g.running, name)
+			}
+			g.mu.Unlock()
+			g.wg.Done()
+		}()
+		fn(g.ctx)
+	}()
+}
+
+// Every runs fn now and then every interval until the group stops. A run is never cut short
+// by the next tick; the ticker just waits for it.
+func (g *Group) Every(name string, interval time.Duration, fn func(ctx context.Context)) {
+	g.Go(name, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			fn(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// Stop cancels the group's context and waits for its goroutines, until ctx is done. It then
+// reports the ones still running.
+func (g *Group) Stop(ctx context.Context) error {
+	g.mu.Lock()
+	g.cancel()
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		names := make([]string, 0, len(g.running))
+		for name, n := range g.running {
+			names = append(names, fmt.Sprintf("%s (%d)", name, n))
+		}
+		slices.Sort(names)
+		return fmt.Errorf("workers still running: %v", names)
+	}
+}
+
+type step struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Manager runs a service's shutdown
+type Manager struct {
+	timeout time.Duration
+
+	mu     sync.Mutex
+	steps  []step
+	failed chan error
+}
+
+// New returns a manager giving the whole shutdown timeout to complete
+func New(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout, failed: make(chan error, 1)}
+}
+
+// OnStop adds a shutdown step. Steps run in the order they were added, each with what is left
+// of the deadline; a failing step is logged and the next one still runs.
+func (m *Manager) OnStop(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.steps = append(m.steps, step{name: name, fn: fn})
+}
+
+// Serve starts srv and adds its graceful shutdown as the next stop step: the listener closes
+// and in-flight requests get until the deadline to finish, after which their connections are
+// cut so later steps (closing the database) don't pull the rug from under them. If srv fails,
+// Wait stops everything and returns the error.
+func (m *Manager) Serve(name string, srv *http.Server) {
+	m.OnStop(name, func(ctx context.Context) error {
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+			return fmt.Errorf("requests still in flight at the deadline were cut: %w", err)
+		}
+		return nil
+	})
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			select {
+			case m.failed <- fmt.Errorf("%s: %w", name, err):
+			default:
+			}
+		}
+	}()
+}
+
+// Wait blocks until SIGINT, SIGTERM or a server failure, then runs the stop steps. It returns
+// the server failure and any step errors.
+func (m *Manager) Wait() error {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var cause error
+	select {
+	case sig := <-signals:
+		slog.Info("Shutting down", "signal", sig.String(), "timeout", m.timeout.String())
+	case cause = <-m.failed:
+		slog.Error("Shutting down after server failure", "err", cause)
+	}
+
+	go func() {
+		sig := <-signals
+		slog.Error("Second signal, exiting without finishing shutdown", "signal", sig.String())
+		os.Exit(1)
+	}()
+
+	return errors.Join(cause, m.Stop())
+}
+
+// Stop runs the stop steps now, under the shutdown timeout
+func (m *Manager) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	m.mu.Lock()
+	steps := slices.Clone(m.steps)
+	m.mu.Unlock()
+
+	var errs []error
+	for _, s := range steps {
+		start := time.Now()
+		if err := s.fn(ctx); err != nil {
+			slog.Error("Shutdown step failed", "step", s.name, "err", err)
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+			continue
+		}
+		slog.Info("Shutdown step done", "step", s.name, "duration_ms", time.Since(start).Milliseconds())
+	}
+	return errors.Join(errs...)
+}
+
+// Sleep waits for d, or less if ctx ends first. It gives load balancers time to notice a
+// failing readiness probe before the listener closes.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,39 @@
+// Package logging sets up the services' structured logs: JSON lines from log/slog, passed
+// through a redacting handler so emails, tokens and one-time codes don't end up in log storage.
+// Both the backend and the CDN use it; like the other shared packages it only depends on the
+// standard library.
+//
+// Each request gets a logger carrying its request ID (see Middleware), which handlers reach with
+// FromContext. Code outside a request logs through slog's default logger, and so do the
+// remaining log.Printf calls once Setup has run.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// New returns a JSON logger writing to w, redacting as it goes
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(NewRedactor(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})))
+}
+
+// Setup makes a redacting JSON logger on stderr the default for slog and the log package, and
+// tags every line with service
+func Setup(service string, level slog.Level) *slog.Logger {
+	logger := New(os.Stderr, level).With("service", service)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// ParseLevel reads debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+	}
+	return level, nil
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secret values
+const Redacted = "[REDACTED]"
+
+// secretKeys are attribute keys whose values are never logged
+var secretKeys = map[string]bool{
+	"token":         true,
+	"session_token": true,
+	"access_token":  true,
+	"authorization": true,
+	"password":      true,
+	"secret":        true,
+	"otp":           true,
+	"code":          true,
+	"invite_code":   true,
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// Session JWTs and export links, and personal access tokens
+	tokenPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+|sr_pat_[A-Za-z0-9_\-]+`)
+	// "OTP: 123456", "token=abc" and the like in free-form messages
+	labelledPattern = regexp.MustCompile(`(?i)\b(otp|code|token|password|secret)(\s*[:=]\s*)[^\s,;]+`)
+)
+
+// MaskEmail keeps the first letter of the local part and the domain: j***@example.com
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return Redacted
+	}
+	return local[:1] + "***@" + domain
+}
+
+// RedactString masks emails and removes tokens and labelled codes from free-form text
+func RedactString(s string) string {
+	s = tokenPattern.ReplaceAllString(s, Redacted)
+	s = labelledPattern.ReplaceAllString(s, "${1}${2}"+Redacted)
+	return emailPattern.ReplaceAllStringFunc(s, MaskEmail)
+}
+
+// Redactor is a slog.Handler that cleans records before passing them on
+type Redactor struct {
+	next slog.Handler
+}
+
+// NewRedactor wraps next. Attributes named like secrets (token, otp, password, ...) are
+// replaced, email attributes are masked, and every other string, error and the message itself
+// go through RedactString.
+func NewRedactor(next slog.Handler) *Redactor {
+	return &Redactor{next: next}
+}
+
+func (h *Redactor) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Redactor) Handle(ctx context.Context, r slog.Record) error {
+	clean := slog.NewRecord(r.Time, r.Level, RedactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		clean.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, clean)
+}
+
+func (h *Redactor) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		clean[i] = redactAttr(a)
+	}
+	return &Redactor{next: h.next.WithAttrs(clean)}
+}
+
+func (h *Redactor) WithGroup(name string) slog.Handler {
+	return &Redactor{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	key := strings.ToLower(a.Key)
+
+	if v.Kind() == slog.KindGroup {
+		group := v.Group()
+		clean := make([]any, len(group))
+		for i, g := range group {
+			clean[i] = redactAttr(g)
+		}
+		return slog.Group(a.Key, clean...)
+	}
+	if secretKeys[key] {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch v.Kind() {
+	case slog.KindString:
+		if key == "email" || strings.HasSuffix(key, "_email") {
+			return slog.String(a.Key, MaskEmail(v.String()))
+		}
+		return slog.String(a.Key, RedactString(v.String()))
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, RedactString(err.Error()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestIDHeader carries a request's ID between clients, the backend and the CDN
+const RequestIDHeader = "X-Request-ID"
+
+type ctxKey struct{}
+
+// requestLog is shared by everything handling one request, so an authenticated handler can add
+// the uid and have it show up on the access log line too
+type requestLog struct {
+	mu     sync.Mutex
+	id     string
+	logger *slog.Logger
+}
+
+// RequestID returns the ID from an incoming X-Request-ID header when it looks sane, or a new one
+func RequestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); validRequestID(id) {
+		return id
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns ctx carrying a request logger with id
+func NewContext(ctx context.Context, logger *slog.Logger, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &requestLog{id: id, logger: logger.With("request_id", id)})
+}
+
+// FromContext returns the request's logger, or the default logger outside a request
+func FromContext(ctx context.Context) *slog.Logger {
+	if rl, ok := ctx.Value(ctxKey{}).(*requestLog); ok {
+		rl.mu.Lock()
+		defer rl.mu.Unlock()
+		return rl.logger
+	}
+	return slog.Default()
+}
+
+// IDFromContext returns the request's ID, empty outside a request
+func IDFromContext(ctx context.Context) string {
+	if rl, ok := ctx.Value(ctxKey{}).(*requestLog); ok {
+		return rl.id
+	}
+	return ""
+}
+
+// With adds attributes to the request's logger for the rest of the request, e.g. the uid once
+// the caller is authenticated
+func With(ctx context.Context, args ...any) {
+	if rl, ok := ctx.Value(ctxKey{}).(*requestLog); ok {
+		rl.mu.Lock()
+		rl.logger = rl.logger.With(args...)
+		rl.mu.Unlock()
+	}
+}
+
+// statusRecorder remembers the status code written by the wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Middleware gives every request an ID, echoed in the X-Request-ID response header, and a
+// logger carrying it, then writes one access log line when the handler returns
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := RequestID(r)
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := NewContext(r.Context(), logger, id)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		FromContext(ctx).Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
@@ -0,0 +1,208 @@
+// Package metrics holds the Prometheus plumbing shared by the backend and the CDN: the HTTP
+// request histogram, the gate in front of /metrics and a collector for queue depths. Each
+// service keeps its own registry and business counters next to its app.
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sraraa/pkg/response"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// UnmatchedRoute labels requests no route matched, so probes for random paths can't blow up the
+// number of series
+const UnmatchedRoute = "unmatched"
+
+// NewRegistry returns a registry with the Go runtime and process collectors
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// NewHTTPDuration registers the request histogram, labelled by method, route pattern and status
+func NewHTTPDuration(reg prometheus.Registerer) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route pattern and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	reg.MustRegister(h)
+	return h
+}
+
+// Observe records one request. route is the matched pattern, empty when nothing matched.
+func Observe(h *prometheus.HistogramVec, method, route string, status int, elapsed time.Duration) {
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	h.WithLabelValues(method, route, strconv.Itoa(status)).Observe(elapsed.Seconds())
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Instrument times requests to a ServeMux-based handler. The route label is the pattern the mux
+// matched, read back from the request after it returns, so next must receive r itself.
+func Instrument(h *prometheus.HistogramVec, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := r.Pattern
+		if _, path, ok := strings.Cut(route, " "); ok {
+			route = path
+		}
+		Observe(h, r.Method, route, rec.status, time.Since(start))
+	})
+}
+
+// Gate decides who may scrape /metrics: callers from an allowlisted address, or callers sending
+// the bearer token
+type Gate struct {
+	token string
+	nets  []*net.IPNet
+}
+
+// NewGate builds a gate from a token (may be empty) and a list of IPs and CIDRs
+func NewGate(token string, allow []string) (*Gate, error) {
+	nets, err := ParseAllowlist(allow)
+	if err != nil {
+		return nil, err
+	}
+	return &Gate{token: token, nets: nets}, nil
+}
+
+// ParseAllowlist reads IPs ("127.0.0.1") and CIDRs ("10.0.0.0/8")
+func ParseAllowlist(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address or CIDR", e)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR", e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Allows reports whether r may read the metrics
+func (g *Gate) Allows(r *http.Request) bool {
+	if g.token != "" {
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok &&
+			subtle.ConstantTimeCompare([]byte(bearer), []byte(g.token)) == 1 {
+			return true
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range g.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler serves reg in the Prometheus text format to callers the gate lets through. Everyone
+// else gets the same 404 as a missing route, so the endpoint doesn't advertise itself.
+func Handler(reg *prometheus.Registry, g *Gate) http.Handler {
+	serve := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !g.Allows(r) {
+			response.WriteError(w, r, response.ErrNotFound)
+			return
+		}
+		serve.ServeHTTP(w, r)
+	})
+}
+
+// queueCollector reports queue depths read at scrape time
+type queueCollector struct {
+	desc  *prometheus.Desc
+	depth func() (map[string]int, error)
+}
+
+// NewQueueCollector reports a gauge name{state=...} from depth, which is called on every scrape
+// and returns the number of queued items per state
+func NewQueueCollector(name, help string, depth func() (map[string]int, error)) prometheus.Collector {
+	return &queueCollector{
+		desc:  prometheus.NewDesc(name, help, []string{"state"}, nil),
+		depth: depth,
+	}
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := c.depth()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for state, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), state)
+	}
+}
@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Usage describes the arguments Command accepts
+const Usage = `usage: migrate up | down [steps] | status`
+
+// Command runs the "migrate" subcommand shared by the services: up applies everything pending,
+// down rolls back the given number of migrations (one by default) and status lists them all.
+// Progress is written to out.
+func Command(ctx context.Context, m *Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", Usage)
+	}
+
+	switch args[0] {
+	case "up":
+		if len(args) > 1 {
+			return fmt.Errorf("%s", Usage)
+		}
+		done, err := m.Up(ctx)
+		for _, mig := range done {
+			fmt.Fprintf(out, "applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "nothing to apply")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 2 {
+			return fmt.Errorf("%s", Usage)
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("migrate: steps must be a positive number, got %q", args[1])
+			}
+			steps = n
+		}
+		done, err := m.Down(ctx, steps)
+		for _, mig := range done {
+			fmt.Fprintf(out, "rolled back %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "nothing to roll back")
+		}
+		return err
+
+	case "status":
+		if len(args) > 1 {
+			return fmt.Errorf("%s", Usage)
+		}
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, s := range statuses {
+			state, at := "pending", ""
+			if s.Applied {
+				state, at = "applied", s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			if s.Modified {
+				state = "modified"
+			}
+			if s.Unknown {
+				state = "unknown"
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, at)
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("migrate: unknown command %q\n%s", args[0], Usage)
+}
@@ -0,0 +1,319 @@
+// Package migrate applies versioned SQL migrations. The backend and the CDN embed their scripts
+// and hand them to New; applied versions are recorded in a schema_migrations table.
+//
+// A migration is a pair of files named by version and description:
+//
+//	0001_baseline.up.sql
+//	0001_baseline.down.sql
+//
+// Versions apply in ascending order, each in its own transaction together with its
+// schema_migrations row, so a failing script leaves neither its changes nor its record behind.
+// The checksum of every applied up script is stored; Up refuses to run when a script was edited
+// after it was applied or when the database has versions this build does not know. Down
+// scripts are optional, and a migration without one can't be rolled back.
+//
+// Queries use ? placeholders, which the SQLite driver and the backend's PostgreSQL driver accept.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Table records the applied migrations
+const Table = "schema_migrations"
+
+// Migration is one version read from the scripts
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status reports one migration, known to this build or found in the database
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the up script changed after it was applied
+	Modified bool
+	// Unknown is set for versions in the database that this build has no script for
+	Unknown bool
+}
+
+// Migrator applies one set of migrations to one database
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New reads the *.up.sql and *.down.sql files at the root of fsys
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Read(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Read parses the migration files at the root of fsys, sorted by version
+func Read(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		version, name, direction, err := parseFileName(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migrate: version %d has two names, %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+			m.Checksum = checksum(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: version %d (%s) has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// parseFileName splits "0002_add_column.up.sql" into 2, "add_column" and "up"
+func parseFileName(file string) (int, string, string, error) {
+	base := strings.TrimSuffix(file, ".sql")
+	direction := path.Ext(base)
+	if direction != ".up" && direction != ".down" {
+		return 0, "", "", fmt.Errorf("migrate: %s: expected a .up.sql or .down.sql file", file)
+	}
+	num, name, ok := strings.Cut(strings.TrimSuffix(base, direction), "_")
+	version, err := strconv.Atoi(num)
+	if !ok || err != nil || version <= 0 || name == "" {
+		return 0, "", "", fmt.Errorf("migrate: %s: expected <version>_<name>%s.sql", file, direction)
+	}
+	return version, name, direction[1:], nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Migrations returns the migrations known to this build, oldest first
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+type appliedRow struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+Table+` (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`)
+	if err != nil {
+		return fmt.Errorf("migrate: create %s: %w", Table, err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]appliedRow, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := m.db.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM `+Table)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read %s: %w", Table, err)
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedRow{}
+	for rows.Next() {
+		var version int
+		var r appliedRow
+		if err := rows.Scan(&version, &r.name, &r.checksum, &r.appliedAt); err != nil {
+			return nil, fmt.Errorf("migrate: read %s: %w", Table, err)
+		}
+		applied[version] = r
+	}
+	return applied, rows.Err()
+}
+
+// Status lists every known migration and every applied version, oldest first
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	known := map[int]bool{}
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if r, ok := applied[mig.Version]; ok {
+			s.Applied, s.AppliedAt = true, r.appliedAt
+			s.Modified = r.checksum != mig.Checksum
+		}
+		statuses = append(statuses, s)
+	}
+	for version, r := range applied {
+		if !known[version] {
+			statuses = append(statuses, Status{Version: version, Name: r.name, Applied: true, AppliedAt: r.appliedAt, Unknown: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Pending returns the migrations Up would apply
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConsistent(statuses); err != nil {
+		return nil, err
+	}
+
+	applied := map[int]bool{}
+	for _, s := range statuses {
+		applied[s.Version] = s.Applied
+	}
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if !applied[mig.Version] {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+func checkConsistent(statuses []Status) error {
+	for _, s := range statuses {
+		if s.Modified {
+			return fmt.Errorf("migrate: %04d_%s was changed after it was applied; add a new migration instead", s.Version, s.Name)
+		}
+		if s.Unknown {
+			return fmt.Errorf("migrate: database has version %04d_%s, which this build does not know", s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// Up applies every pending migration in order and returns the ones it applied. It stops at
+// the first failure; the migrations before it stay applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range pending {
+		err := m.inTx(ctx, mig.Up, `INSERT INTO `+Table+` (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`,
+			mig.Version, mig.Name, mig.Checksum, time.Now().UTC())
+		if err != nil {
+			return done, fmt.Errorf("migrate: apply %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down rolls back the latest steps applied migrations, newest first, and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps < 1 {
+		return nil, errors.New("migrate: down needs at least one step")
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConsistent(statuses); err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]Migration{}
+	for _, mig := range m.migrations {
+		byVersion[mig.Version] = mig
+	}
+
+	var done []Migration
+	for i := len(statuses) - 1; i >= 0 && len(done) < steps; i-- {
+		if !statuses[i].Applied {
+			continue
+		}
+		mig := byVersion[statuses[i].Version]
+		if mig.Down == "" {
+			return done, fmt.Errorf("migrate: %04d_%s has no down script", mig.Version, mig.Name)
+		}
+		if err := m.inTx(ctx, mig.Down, `DELETE FROM `+Table+` WHERE version=?`, mig.Version); err != nil {
+			return done, fmt.Errorf("migrate: roll back %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// inTx runs script and the bookkeeping statement in one transaction
+func (m *Migrator) inTx(ctx context.Context, script, record string, args ...interface{}) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,129 @@
+package response
+
+import "net/http"
+
+// Code identifies an error for clients. Codes are part of the API: add new ones rather than
+// renaming or reusing them.
+type Code string
+
+// Codes for any endpoint
+const (
+	// CodeInvalidRequest is a malformed request: bad JSON, unknown fields, missing parameters
+	CodeInvalidRequest Code = "invalid_request"
+	// CodeValidationFailed is a well-formed request with a rejected value; details name the
+	// field
+	CodeValidationFailed Code = "validation_failed"
+	// CodeUnauthenticated is a request without credentials
+	CodeUnauthenticated  Code = "unauthenticated"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodeGone             Code = "gone"
+	CodePayloadTooLarge  Code = "payload_too_large"
+	// CodeRateLimited asks the client to wait; details may say until when
+	CodeRateLimited Code = "rate_limited"
+	// CodeQuotaExceeded means something must be removed first, waiting won't help
+	CodeQuotaExceeded Code = "quota_exceeded"
+	CodeInternal      Code = "internal_error"
+	// CodeUpstream is a failure of a service behind this one, like the CDN or the API
+	CodeUpstream    Code = "upstream_error"
+	CodeUnavailable Code = "unavailable"
+)
+
+// Codes for signup, login and sessions
+const (
+	CodeInvalidCredentials Code = "invalid_credentials"
+	// CodeSessionInvalid is a session or access token that is malformed, expired, logged out or
+	// revoked
+	CodeSessionInvalid         Code = "session_invalid"
+	CodeInsufficientScope      Code = "insufficient_scope"
+	CodeImpersonationForbidden Code = "impersonation_not_allowed"
+	CodeEmailNotVerified       Code = "email_not_verified"
+	CodeAccountSuspended       Code = "account_suspended"
+	CodeOTPInvalid             Code = "otp_invalid"
+	CodeOTPExpired             Code = "otp_expired"
+	CodeOnboardingTokenInvalid Code = "onboarding_token_invalid"
+	CodeOnboardingComplete     Code = "onboarding_complete"
+	CodeInviteRequired         Code = "invite_required"
+	CodeInviteInvalid          Code = "invite_invalid"
+	// CodeUsernameTaken and CodeUsernameReserved carry suggestions in their details
+	CodeUsernameTaken    Code = "username_taken"
+	CodeUsernameReserved Code = "username_reserved"
+	// CodePasswordBreached carries the password's strength estimate in its details
+	CodePasswordBreached Code = "password_breached"
+	// CodeLinkInvalid is a signed link (such as an export download) that is wrong or expired
+	CodeLinkInvalid Code = "link_invalid"
+)
+
+var statuses = map[Code]int{
+	CodeInvalidRequest:   http.StatusBadRequest,
+	CodeValidationFailed: http.StatusBadRequest,
+	CodeUnauthenticated:  http.StatusUnauthorized,
+	CodeForbidden:        http.StatusForbidden,
+	CodeNotFound:         http.StatusNotFound,
+	CodeMethodNotAllowed: http.StatusMethodNotAllowed,
+	CodeConflict:         http.StatusConflict,
+	CodeGone:             http.StatusGone,
+	CodePayloadTooLarge:  http.StatusRequestEntityTooLarge,
+	CodeRateLimited:      http.StatusTooManyRequests,
+	CodeQuotaExceeded:    http.StatusTooManyRequests,
+	CodeInternal:         http.StatusInternalServerError,
+	CodeUpstream:         http.StatusBadGateway,
+	CodeUnavailable:      http.StatusServiceUnavailable,
+
+	CodeInvalidCredentials:     http.StatusUnauthorized,
+	CodeSessionInvalid:         http.StatusUnauthorized,
+	CodeInsufficientScope:      http.StatusForbidden,
+	CodeImpersonationForbidden: http.StatusForbidden,
+	CodeEmailNotVerified:       http.StatusForbidden,
+	CodeAccountSuspended:       http.StatusForbidden,
+	CodeOTPInvalid:             http.StatusUnauthorized,
+	CodeOTPExpired:             http.StatusUnauthorized,
+	CodeOnboardingTokenInvalid: http.StatusUnauthorized,
+	CodeOnboardingComplete:     http.StatusConflict,
+	CodeInviteRequired:         http.StatusForbidden,
+	CodeInviteInvalid:          http.StatusForbidden,
+	CodeUsernameTaken:          http.StatusConflict,
+	CodeUsernameReserved:       http.StatusBadRequest,
+	CodePasswordBreached:       http.StatusBadRequest,
+	CodeLinkInvalid:            http.StatusUnauthorized,
+}
+
+// Status is the HTTP status c is always sent with; unknown codes are sent as 500
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// ForStatus is the generic code for an HTTP error status, for errors raised outside handlers
+// (no route, wrong method, a body over its limit)
+func ForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusGone:
+		return CodeGone
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway:
+		return CodeUpstream
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
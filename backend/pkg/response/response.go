@@ -0,0 +1,143 @@
+// Package response writes the JSON bodies of the backend and the CDN. Every failure uses the same
+// envelope, so clients can branch on a stable code instead of parsing messages:
+//
+//	{"error": {"code": "otp_expired", "message": "OTP has expired", "request_id": "..."}}
+//
+// "details" is added when a client can use more than the code, such as the field that failed
+// validation or how long to wait before retrying. A code always comes with the same HTTP status;
+// the codes and their statuses are listed in codes.go.
+//
+// Successful responses are JSON objects too. Ones with nothing to return but a confirmation use
+// Message: {"message": "Logged out successfully"}.
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sraraa/pkg/logging"
+)
+
+// Error is a failure a handler reports to the client
+type Error struct {
+	Code    Code
+	Message string
+	// Details is encoded as is; nil leaves it out
+	Details any
+}
+
+// NewError returns an error with code's status and a message for people
+func NewError(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Errorf is NewError with a formatted message
+func Errorf(code Code, format string, args ...any) *Error {
+	return NewError(code, fmt.Sprintf(format, args...))
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Status is the HTTP status the error is sent with
+func (e *Error) Status() int {
+	return e.Code.Status()
+}
+
+// WithDetails returns a copy of e carrying details
+func (e *Error) WithDetails(details any) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+// Field is the details of a validation error
+type Field struct {
+	Field string `json:"field"`
+}
+
+// Invalid reports that field of the request was rejected, with the reason as the message
+func Invalid(field, message string) *Error {
+	return NewError(CodeValidationFailed, message).WithDetails(Field{Field: field})
+}
+
+// Retry is the details of a rate_limited error
+type Retry struct {
+	RetryAt time.Time `json:"retry_at"`
+}
+
+// RateLimited asks the client to come back at until
+func RateLimited(message string, until time.Time) *Error {
+	return NewError(CodeRateLimited, message).WithDetails(Retry{RetryAt: until.UTC()})
+}
+
+// Errors used across handlers
+var (
+	ErrInvalidBody   = NewError(CodeInvalidRequest, "Invalid request body")
+	ErrNoToken       = NewError(CodeUnauthenticated, "No session token provided")
+	ErrAdminRequired = NewError(CodeForbidden, "Admin access required")
+	ErrNotFound      = NewError(CodeNotFound, "Not found")
+	ErrInternal      = NewError(CodeInternal, "Server error")
+)
+
+// ErrorBody is the content of the envelope
+type ErrorBody struct {
+	Code      Code   `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Envelope is the body of every error response
+type Envelope struct {
+	Error ErrorBody `json:"error"`
+}
+
+// WriteError sends err in the envelope. An err that isn't (or doesn't wrap) an *Error is a bug
+// or an unexpected failure: it is logged and the client gets a plain internal_error, so no
+// detail of it leaks out.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		logging.FromContext(r.Context()).Error("Unhandled error", "err", err)
+		e = ErrInternal
+	}
+	JSON(w, e.Status(), Envelope{Error: ErrorBody{
+		Code:      e.Code,
+		Message:   e.Message,
+		Details:   e.Details,
+		RequestID: logging.IDFromContext(r.Context()),
+	}})
+}
+
+// Fail sends a new error with code and message, the envelope's version of http.Error
+func Fail(w http.ResponseWriter, r *http.Request, code Code, message string) {
+	WriteError(w, r, NewError(code, message))
+}
+
+// JSON sends v as the body with status
+func JSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// OK sends v with 200
+func OK(w http.ResponseWriter, v any) {
+	JSON(w, http.StatusOK, v)
+}
+
+// MessageBody is the body of a response that only confirms something happened
+type MessageBody struct {
+	Message string `json:"message"`
+}
+
+// Message sends {"message": message} with status
+func Message(w http.ResponseWriter, status int, message string) {
+	JSON(w, status, MessageBody{Message: message})
+}
@@ -0,0 +1,273 @@
+// Package tracing sets up OpenTelemetry for the backend and the CDN, so a request can be
+// followed from the API through its call to the CDN, the SQL it runs, the files it writes and
+// the email it sends. Setup installs the tracer provider and the W3C trace context propagator;
+// the helpers here create the spans:
+//
+//   - Middleware (or StartServer and EndServer, for gin) for incoming requests
+//   - Transport for outgoing requests, which also sends the traceparent header
+//   - OpenDB for SQL queries
+//   - Start and End for anything else worth its own span
+//
+// Until Setup runs, and with the "none" exporter, spans are not recorded, but trace context is
+// still passed on to the services we call.
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"sraraa/pkg/logging"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer behind the spans started here
+const instrumentationName = "sraraa/pkg/tracing"
+
+// Exporters
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// CheckExporter accepts none, otlp, stdout or file
+func CheckExporter(name string) error {
+	switch name {
+	case ExporterNone, ExporterOTLP, ExporterStdout, ExporterFile:
+		return nil
+	}
+	return fmt.Errorf("unknown exporter %q, expected none, otlp, stdout or file", name)
+}
+
+type Options struct {
+	// Service is the service.name spans are reported under
+	Service  string
+	Exporter string
+	// File receives the spans, one JSON object per line, with the file exporter
+	File string
+	// Endpoint is the OTLP/HTTP collector's base URL. When empty the exporter falls back to
+	// the OTEL_EXPORTER_OTLP_* variables, then http://localhost:4318.
+	Endpoint string
+}
+
+// Setup installs the global tracer provider and propagator. The returned function flushes
+// buffered spans and closes the exporter; call it on the way out.
+//
+// The stdout and file exporters write each span as it ends, which is what you want while
+// developing. OTLP batches them.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var processor sdktrace.SpanProcessor
+	closeOutput := func() error { return nil }
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var clientOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+		}
+		exporter, err := otlptracehttp.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: otlp exporter: %w", err)
+		}
+		processor = sdktrace.NewBatchSpanProcessor(exporter)
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("tracing: stdout exporter: %w", err)
+		}
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	case ExporterFile:
+		f, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("tracing: file exporter: %w", err)
+		}
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+		closeOutput = f.Close
+	default:
+		return nil, CheckExporter(opts.Exporter)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(opts.Service)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(processor),
+		// Follow the caller's sampling decision, so a trace entering the backend is kept
+		// across the CDN too
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), closeOutput())
+	}, nil
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start opens an internal span under ctx for work worth seeing on its own in a trace, like a
+// file write or an SMTP send. Finish it with End.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End marks span failed when err is not nil, then ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// StartServer starts the span for an incoming request, continuing the caller's trace when the
+// request carries a traceparent header. It is named after the method until EndServer knows
+// the route. The trace ID is added to the request's log lines.
+func StartServer(r *http.Request) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer().Start(ctx, r.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+			semconv.ClientAddress(clientAddress(r)),
+			semconv.UserAgentOriginal(r.UserAgent()),
+		),
+	)
+	if sc := span.SpanContext(); sc.IsValid() {
+		logging.With(ctx, "trace_id", sc.TraceID().String())
+	}
+	return ctx, span
+}
+
+// EndServer names span after the matched route (empty when none matched), records the
+// response status and ends it. 5xx responses mark the span failed.
+func EndServer(span trace.Span, method, route string, status int) {
+	if route != "" {
+		span.SetName(method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// statusRecorder remembers the status code written by the wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Middleware traces requests to a ServeMux-based handler. It hands next a copy of r carrying
+// the span, then copies the matched pattern back onto r, so middleware outside it (the route
+// label in sraraa/pkg/metrics) still sees the route.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := StartServer(r)
+		rec := &statusRecorder{ResponseWriter: w}
+		traced := r.WithContext(ctx)
+		next.ServeHTTP(rec, traced)
+
+		r.Pattern = traced.Pattern
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := traced.Pattern
+		if _, path, ok := strings.Cut(route, " "); ok {
+			route = path
+		}
+		EndServer(span, r.Method, route, rec.status)
+	})
+}
+
+// Transport wraps base (http.DefaultTransport when nil) so each outgoing request gets a client
+// span and carries the current trace in a traceparent header
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
+
+// OpenDB is sql.Open with queries traced as children of the span in their context. system is
+// the db.system.name attribute ("sqlite", "postgresql"). Queries run without a span in their
+// context, like those of models still passing context.Background(), are left out rather than
+// each starting a trace of their own.
+func OpenDB(driverName, source, system string) (*sql.DB, error) {
+	return otelsql.Open(driverName, source,
+		otelsql.WithAttributes(semconv.DBSystemNameKey.String(system)),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitConnPrepare:      true,
+			OmitRows:             true,
+			OmitConnectorConnect: true,
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+	)
+}
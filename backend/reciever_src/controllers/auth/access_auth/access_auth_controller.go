@@ -1,101 +1,75 @@
 package access_auth_controller
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"sraraa/app"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
 	user_models "sraraa/reciever_src/models/user"
+	auth_utils "sraraa/reciever_src/utils/auth"
 	"strings"
 )
 
 // CheckUsernameHandler checks if a username already exists
-func CheckUsernameHandler(db *sql.DB) http.HandlerFunc {
+func CheckUsernameHandler(a *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
-			return
-		}
-
 		type requestBody struct {
 			Username string `json:"username"`
 		}
 
 		var body requestBody
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+			response.WriteError(w, r, response.ErrInvalidBody)
 			return
 		}
 
 		if strings.TrimSpace(body.Username) == "" {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Username is required"})
+			response.WriteError(w, r, response.Invalid("username", "Username is required"))
 			return
 		}
 
-		exists, err := user_models.UsernameExists(db, body.Username)
+		if err := auth_utils.ValidateUsername(body.Username); err != nil {
+			if errors.Is(err, auth_utils.ErrUsernameReserved) {
+				response.WriteError(w, r, response.NewError(response.CodeUsernameReserved, err.Error()).
+					WithDetails(suggestUsernames(r, a, body.Username)))
+				return
+			}
+			response.WriteError(w, r, response.Invalid("username", err.Error()))
+			return
+		}
+
+		exists, err := user_models.UsernameExists(a.DB, body.Username)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+			logging.FromContext(r.Context()).Error("UsernameExists error", "err", err)
+			response.Fail(w, r, response.CodeInternal, "Database error")
 			return
 		}
 
 		if exists {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Username already taken"})
+			response.WriteError(w, r, response.NewError(response.CodeUsernameTaken, "Username already taken").
+				WithDetails(suggestUsernames(r, a, body.Username)))
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Username available"})
+		response.Message(w, http.StatusOK, "Username available")
 	}
 }
 
-// CheckUserCompleteHandler checks if a user already has all basic fields
-func CheckUserCompleteHandler(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
-			return
-		}
-
-		type requestBody struct {
-			Email string `json:"email"`
-		}
-
-		var body requestBody
-		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
-			return
-		}
-
-		if strings.TrimSpace(body.Email) == "" {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Email is required"})
-			return
-		}
-
-		hasAll, err := user_models.HasAllRequiredFieldsForLogin(db, body.Email)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
-			return
-		}
-
-		if !hasAll {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "User does not have all basic information"})
-			return
-		}
+// Suggestions are the details of a taken or reserved username error
+type Suggestions struct {
+	Suggestions []string `json:"suggestions"`
+}
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": "User already has all basic information, try login",
-		})
+// suggestUsernames returns alternatives for a taken or reserved username; failures only log
+func suggestUsernames(r *http.Request, a *app.App, username string) Suggestions {
+	suggestions, err := user_models.SuggestUsernames(a.DB, username, 5)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("SuggestUsernames error", "err", err)
+	}
+	if suggestions == nil {
+		suggestions = []string{}
 	}
+	return Suggestions{Suggestions: suggestions}
 }
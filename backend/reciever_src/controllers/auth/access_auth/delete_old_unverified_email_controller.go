@@ -1,17 +1,13 @@
 package access_auth_controller
 
 import (
-	"database/sql"
-	"log"
+	"context"
+
+	"sraraa/app"
 )
 
-func AutoDeleteUnverifiedUsers(db *sql.DB) {
-	_, err := db.Exec(`
-		DELETE FROM users
-		WHERE verified = 0 
-		AND created_at <= datetime('now', '-24 hours')
-	`)
-	if err != nil {
-		log.Println("Auto delete failed:", err)
-	}
+// AutoDeleteUnverifiedUsers removes signups left unverified for longer than
+// UNVERIFIED_ACCOUNT_RETENTION and reports how many went
+func AutoDeleteUnverifiedUsers(ctx context.Context, a *app.App) (int64, error) {
+	return a.Store.Users.DeleteUnverifiedBefore(ctx, a.Clock.Now().Add(-a.Config.UnverifiedAccountRetention))
 }
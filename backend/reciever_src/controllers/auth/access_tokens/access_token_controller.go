@@ -0,0 +1,167 @@
+package access_token_controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"sraraa/app"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/session_auth"
+	user_models "sraraa/reciever_src/models/user"
+)
+
+const (
+	defaultTokenTTLDays = 90
+	maxTokenTTLDays     = 365
+	maxActiveTokens     = 25
+	maxTokenNameLength  = 64
+)
+
+// ListAccessTokensHandler lists the caller's personal access tokens. Managing tokens requires an
+// interactive session; a token cannot mint other tokens.
+func ListAccessTokensHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := session_auth.Authenticate(a, w, r)
+		if !ok {
+			return
+		}
+
+		tokens, err := user_models.GetAccessTokensByUID(a.DB, claims.UID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetAccessTokensByUID error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.OK(w, map[string]interface{}{
+			"tokens":           tokens,
+			"available_scopes": user_models.AccessTokenScopes,
+		})
+	}
+}
+
+// CreateAccessTokenHandler creates a personal access token and returns its raw value once
+func CreateAccessTokenHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		claims, ok := session_auth.Authenticate(a, w, r)
+		if !ok {
+			return
+		}
+
+		type requestBody struct {
+			Name          string   `json:"name"`
+			Scopes        []string `json:"scopes"`
+			ExpiresInDays int      `json:"expires_in_days"`
+		}
+		var body requestBody
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+
+		body.Name = strings.TrimSpace(body.Name)
+		if body.Name == "" || len(body.Name) > maxTokenNameLength {
+			response.WriteError(w, r, response.Invalid("name", "Token name is required (max 64 characters)"))
+			return
+		}
+		if len(body.Scopes) == 0 {
+			response.WriteError(w, r, response.Invalid("scopes", "At least one scope is required"))
+			return
+		}
+
+		days := body.ExpiresInDays
+		if days == 0 {
+			days = defaultTokenTTLDays
+		}
+		if days < 0 || days > maxTokenTTLDays {
+			response.WriteError(w, r, response.Invalid("expires_in_days", "expires_in_days must be between 1 and 365"))
+			return
+		}
+
+		for _, scope := range body.Scopes {
+			if !user_models.IsAdminScope(scope) {
+				continue
+			}
+			role, err := user_models.GetRoleByUID(r.Context(), a.Store, claims.UID)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("GetRoleByUID error", "err", err)
+				response.WriteError(w, r, response.ErrInternal)
+				return
+			}
+			if role != "admin" {
+				response.Fail(w, r, response.CodeForbidden, "Only admins can grant the "+scope+" scope")
+				return
+			}
+			break
+		}
+
+		active, err := user_models.CountActiveAccessTokens(a.DB, claims.UID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("CountActiveAccessTokens error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+		if active >= maxActiveTokens {
+			response.Fail(w, r, response.CodeQuotaExceeded, "Too many active access tokens, revoke one first")
+			return
+		}
+
+		expiresAt := a.Clock.Now().UTC().AddDate(0, 0, days)
+		token, raw, err := user_models.CreateAccessToken(a.DB, claims.UID, body.Name, body.Scopes, expiresAt)
+		if err != nil {
+			if errors.Is(err, user_models.ErrUnknownScope) {
+				response.WriteError(w, r, response.Invalid("scopes", "Unknown scope, valid scopes: "+strings.Join(user_models.AccessTokenScopes, ", ")))
+				return
+			}
+			logging.FromContext(r.Context()).Error("CreateAccessToken error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		// The raw token is only ever returned here
+		response.JSON(w, http.StatusCreated, map[string]interface{}{
+			"token":        raw,
+			"access_token": token,
+		})
+	}
+}
+
+// RevokeAccessTokenHandler revokes one of the caller's tokens by id
+func RevokeAccessTokenHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		claims, ok := session_auth.Authenticate(a, w, r)
+		if !ok {
+			return
+		}
+
+		type requestBody struct {
+			ID int64 `json:"id"`
+		}
+		var body requestBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ID <= 0 {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+
+		if err := user_models.RevokeAccessToken(a.DB, claims.UID, body.ID); err != nil {
+			if errors.Is(err, user_models.ErrTokenNotFound) {
+				response.Fail(w, r, response.CodeNotFound, "Access token not found")
+				return
+			}
+			logging.FromContext(r.Context()).Error("RevokeAccessToken error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.Message(w, http.StatusOK, "Access token revoked")
+	}
+}
@@ -0,0 +1,142 @@
+package impersonation_controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sraraa/app"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/session_auth"
+	user_models "sraraa/reciever_src/models/user"
+)
+
+// StartImpersonationHandler lets an admin open a short-lived, read-only session as another user.
+// Body: {"uid": "...", "reason": "..."}. The reason is required and goes into the audit log.
+func StartImpersonationHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		admin, ok := session_auth.RequireAdmin(a, w, r)
+		if !ok {
+			return
+		}
+
+		type requestBody struct {
+			UID    string `json:"uid"`
+			Reason string `json:"reason"`
+		}
+		var body requestBody
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || body.UID == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+		body.Reason = strings.TrimSpace(body.Reason)
+		if body.Reason == "" {
+			response.WriteError(w, r, response.Invalid("reason", "A reason is required"))
+			return
+		}
+		if body.UID == admin.UID {
+			response.WriteError(w, r, response.Invalid("uid", "Cannot impersonate yourself"))
+			return
+		}
+
+		role, err := user_models.GetRoleByUID(r.Context(), a.Store, body.UID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.Fail(w, r, response.CodeNotFound, "User not found")
+				return
+			}
+			logging.FromContext(r.Context()).Error("GetRoleByUID error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+		// Impersonating another admin would be a way around per-admin auditing
+		if role == "admin" {
+			response.Fail(w, r, response.CodeForbidden, "Admins cannot be impersonated")
+			return
+		}
+
+		userID, err := user_models.GetUserIDByUID(r.Context(), a.Store, body.UID)
+		if err != nil {
+			response.Fail(w, r, response.CodeNotFound, "User not found")
+			return
+		}
+
+		ttl := a.Config.ImpersonationTTL
+		token, err := user_models.CreateImpersonationSession(r.Context(), a.Store, userID, admin.UID, ttl, r.UserAgent(), r.RemoteAddr)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("CreateImpersonationSession error", "err", err)
+			response.Fail(w, r, response.CodeInternal, "Failed to create impersonation session (has the user finished onboarding?)")
+			return
+		}
+
+		var sessionID string
+		if claims, err := user_models.ValidateSessionToken(token); err == nil {
+			sessionID = claims.ID
+		}
+
+		err = user_models.LogImpersonationEvent(a.DB, user_models.ImpersonationEvent{
+			AdminUID:  admin.UID,
+			TargetUID: body.UID,
+			SessionID: sessionID,
+			Event:     user_models.ImpersonationEventStart,
+			Reason:    body.Reason,
+			IPAddress: r.RemoteAddr,
+		})
+		if err != nil {
+			// No audit record, no session
+			logging.FromContext(r.Context()).Error("LogImpersonationEvent error", "err", err)
+			if _, err := user_models.DeleteSession(r.Context(), a.Store, token); err != nil {
+				logging.FromContext(r.Context()).Error("DeleteSession error", "err", err)
+			}
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+		a.Metrics.SessionCreated("impersonation")
+
+		logging.FromContext(r.Context()).Info("Admin started impersonating a user",
+			"target_uid", body.UID, "session_id", sessionID, "reason", body.Reason)
+
+		response.JSON(w, http.StatusCreated, map[string]interface{}{
+			"session_token": token,
+			"impersonating": body.UID,
+			"expires_at":    a.Clock.Now().Add(ttl).UTC(),
+			"read_only":     true,
+		})
+	}
+}
+
+// ImpersonationLogHandler returns the audit trail for admins (?uid=<target>&admin=<admin uid>)
+func ImpersonationLogHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := session_auth.RequireAdmin(a, w, r); !ok {
+			return
+		}
+
+		q := r.URL.Query()
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || limit <= 0 || limit > 500 {
+			limit = 100
+		}
+		offset, err := strconv.Atoi(q.Get("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		events, err := user_models.GetImpersonationLog(a.DB, q.Get("uid"), q.Get("admin"), limit, offset)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetImpersonationLog error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.OK(w, map[string]interface{}{"events": events})
+	}
+}
@@ -0,0 +1,131 @@
+package introspection_controller
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"sraraa/app"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/service_auth"
+	user_models "sraraa/reciever_src/models/user"
+)
+
+// introspectionResponse follows RFC 7662. Inactive tokens only get {"active": false}.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	UID       string `json:"uid,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+
+	Act *user_models.ActorClaim `json:"act,omitempty"`
+}
+
+// IntrospectHandler lets internal services (the CDN, workers) check a session JWT or personal
+// access token without talking to the database themselves. Callers authenticate with HTTP Basic as one of the
+// service clients (see service_auth) and post the token as the form
+// field "token".
+func IntrospectHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID, ok := service_auth.AuthenticateClient(a, r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="introspection"`)
+			response.Fail(w, r, response.CodeInvalidCredentials, "Invalid client credentials")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+		if err := r.ParseForm(); err != nil {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+		token := r.PostForm.Get("token")
+		if token == "" {
+			response.Fail(w, r, response.CodeInvalidRequest, "token is required")
+			return
+		}
+
+		// Introspection results must not be cached by intermediaries
+		w.Header().Set("Cache-Control", "no-store")
+
+		claims, tokenType, err := inspectToken(r.Context(), a, token)
+		if err != nil {
+			response.OK(w, introspectionResponse{Active: false})
+			return
+		}
+
+		resp := introspectionResponse{
+			Active:    true,
+			UID:       claims.UID,
+			Sub:       claims.UID,
+			Username:  claims.Username,
+			TokenType: tokenType,
+			ClientID:  clientID,
+		}
+		switch {
+		case claims.AccessTokenID != 0:
+			resp.Scope = strings.Join(claims.Scopes, " ")
+		case claims.Act != nil:
+			// Impersonation sessions are read-only
+			resp.Scope = user_models.ScopeProfileRead
+			resp.Act = claims.Act
+		default:
+			resp.Scope = strings.Join(user_models.SessionScopes, " ")
+		}
+		if claims.ExpiresAt != nil {
+			resp.Exp = claims.ExpiresAt.Unix()
+		}
+		if claims.IssuedAt != nil {
+			resp.Iat = claims.IssuedAt.Unix()
+		}
+
+		response.OK(w, resp)
+	}
+}
+
+// inspectToken checks the signature of a session JWT and that it has not been logged out, or
+// looks up a personal access token. Either way the account must not be suspended, and the
+// username reported is the account's current one rather than the one the token was issued with.
+func inspectToken(ctx context.Context, a *app.App, token string) (*user_models.SessionClaims, string, error) {
+	var claims *user_models.SessionClaims
+	var err error
+	tokenType := "session"
+	if user_models.IsAccessToken(token) {
+		claims, err = user_models.AuthenticateAccessToken(a.DB, token)
+		if err != nil {
+			return nil, "", err
+		}
+		tokenType = "access_token"
+	} else {
+		claims, err = user_models.ValidateSessionToken(token)
+		if err != nil {
+			return nil, "", err
+		}
+
+		exists, err := user_models.SessionExists(ctx, a.Store, token)
+		if err != nil {
+			slog.Error("SessionExists error", "err", err)
+			return nil, "", err
+		}
+		if !exists {
+			return nil, "", user_models.ErrAccessTokenInvalid
+		}
+	}
+
+	account, err := user_models.GetAccountByUID(ctx, a.Store, claims.UID)
+	if err != nil {
+		return nil, "", err
+	}
+	if account.SuspendedAt != nil {
+		return nil, "", user_models.ErrAccessTokenInvalid
+	}
+	claims.Username = account.Username
+
+	return claims, tokenType, nil
+}
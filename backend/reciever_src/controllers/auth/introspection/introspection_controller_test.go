@@ -0,0 +1,104 @@
+package introspection_controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"sraraa/app"
+	"sraraa/config"
+	"sraraa/db"
+	user_models "sraraa/reciever_src/models/user"
+	"sraraa/storage"
+)
+
+// newTestApp builds an App over a migrated in-memory SQLite store that the client "cdn" may
+// introspect against
+func newTestApp(t *testing.T) *app.App {
+	t.Helper()
+
+	cfg, err := config.Load([]string{"-service-clients", "cdn:cdn-secret"})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	store, err := storage.Open(storage.Memory)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := db.Migrate(store.DB, store.Dialect); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := user_models.LoadSigningKeys(t.TempDir()); err != nil {
+		t.Fatalf("load signing keys: %v", err)
+	}
+	return app.New(cfg, store)
+}
+
+func introspect(t *testing.T, a *app.App, token string) introspectionResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("cdn", "cdn-secret")
+	rec := httptest.NewRecorder()
+	IntrospectHandler(a)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	var resp introspectionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp
+}
+
+func TestIntrospectReportsCurrentAccount(t *testing.T) {
+	ctx := context.Background()
+	a := newTestApp(t)
+
+	email := "liam@example.com"
+	if err := a.Store.Users.Create(ctx, email); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := a.Store.Users.SetUID(ctx, email, "uid-liam"); err != nil {
+		t.Fatalf("set uid: %v", err)
+	}
+	if err := a.Store.Users.MarkVerified(ctx, email); err != nil {
+		t.Fatalf("mark verified: %v", err)
+	}
+	if err := user_models.SetUsername(a.DB, email, "liamold"); err != nil {
+		t.Fatalf("set username: %v", err)
+	}
+	userID, err := user_models.GetUserIDByEmailOrUsername(ctx, a.Store, email)
+	if err != nil {
+		t.Fatalf("user id: %v", err)
+	}
+	token, err := user_models.CreateSession(ctx, a.Store, userID, time.Hour, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	if resp := introspect(t, a, token); !resp.Active || resp.Username != "liamold" {
+		t.Fatalf("before rename: %+v", resp)
+	}
+
+	// the token still says liamold; introspection must not
+	if _, err := user_models.ChangeUsername(ctx, a.DB, "uid-liam", "liamnew", 0, 0, time.Now()); err != nil {
+		t.Fatalf("change username: %v", err)
+	}
+	if resp := introspect(t, a, token); !resp.Active || resp.Username != "liamnew" {
+		t.Fatalf("after rename: %+v", resp)
+	}
+
+	if err := user_models.SetSuspended(ctx, a.Store, "uid-liam", true); err != nil {
+		t.Fatalf("suspend: %v", err)
+	}
+	if resp := introspect(t, a, token); resp.Active {
+		t.Fatalf("suspended account's session is active: %+v", resp)
+	}
+}
@@ -0,0 +1,343 @@
+package invite_controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"sraraa/app"
+	"sraraa/mailer"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/session_auth"
+	user_models "sraraa/reciever_src/models/user"
+	auth_utils "sraraa/reciever_src/utils/auth"
+)
+
+const (
+	defaultInviteTTL = 7 * 24 * time.Hour
+	maxUserInviteTTL = 30 * 24 * time.Hour
+	maxApproveBatch  = 500
+)
+
+// SignupModeHandler tells the client which signup form to show
+func SignupModeHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.OK(w, map[string]string{"mode": a.Config.SignupMode})
+	}
+}
+
+// JoinWaitlistHandler records interest from an email address
+func JoinWaitlistHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		type requestBody struct {
+			Email string `json:"email"`
+		}
+		var body requestBody
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || body.Email == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+
+		if !isValidEmail(body.Email) {
+			response.WriteError(w, r, response.Invalid("email", "Invalid email format"))
+			return
+		}
+
+		if err := user_models.JoinWaitlist(a.DB, body.Email); err != nil {
+			logging.FromContext(r.Context()).Error("JoinWaitlist error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.Message(w, http.StatusAccepted, "You are on the waitlist")
+	}
+}
+
+// ListInvitesHandler lists the caller's invite codes
+func ListInvitesHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := session_auth.AuthenticateScope(a, w, r, user_models.ScopeInvitesWrite)
+		if !ok {
+			return
+		}
+
+		invites, err := user_models.GetInvitesByUser(a.DB, claims.UID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetInvitesByUser error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.OK(w, map[string]interface{}{"invites": invites})
+	}
+}
+
+// CreateInviteHandler creates an invite code. Regular users get single-use codes within a quota;
+// admins may set any usage limit and expiry.
+func CreateInviteHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		claims, ok := session_auth.AuthenticateScope(a, w, r, user_models.ScopeInvitesWrite)
+		if !ok {
+			return
+		}
+
+		type requestBody struct {
+			MaxUses        int `json:"max_uses"`
+			ExpiresInHours int `json:"expires_in_hours"`
+		}
+		var body requestBody
+		if r.ContentLength != 0 {
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&body); err != nil {
+				response.WriteError(w, r, response.ErrInvalidBody)
+				return
+			}
+		}
+
+		role, err := user_models.GetRoleByUID(r.Context(), a.Store, claims.UID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetRoleByUID error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+		isAdmin := role == "admin"
+
+		maxUses := 1
+		ttl := defaultInviteTTL
+		if body.ExpiresInHours > 0 {
+			ttl = time.Duration(body.ExpiresInHours) * time.Hour
+		}
+
+		if isAdmin {
+			if body.MaxUses > 0 {
+				maxUses = body.MaxUses
+			}
+		} else {
+			if body.MaxUses > 1 {
+				response.Fail(w, r, response.CodeForbidden, "Only admins can create multi-use invites")
+				return
+			}
+			if ttl > maxUserInviteTTL {
+				ttl = maxUserInviteTTL
+			}
+
+			active, err := user_models.CountActiveInvitesByUser(a.DB, claims.UID)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("CountActiveInvitesByUser error", "err", err)
+				response.WriteError(w, r, response.ErrInternal)
+				return
+			}
+			if active >= a.Config.UserInviteQuota {
+				response.Fail(w, r, response.CodeQuotaExceeded, user_models.ErrInviteQuota.Error())
+				return
+			}
+		}
+
+		expiresAt := a.Clock.Now().UTC().Add(ttl)
+		invite, err := user_models.CreateInvite(a.DB, claims.UID, "", maxUses, &expiresAt)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("CreateInvite error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.JSON(w, http.StatusCreated, invite)
+	}
+}
+
+// RevokeInviteHandler disables an invite code. Users can revoke their own codes, admins any code.
+func RevokeInviteHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		claims, ok := session_auth.AuthenticateScope(a, w, r, user_models.ScopeInvitesWrite)
+		if !ok {
+			return
+		}
+
+		type requestBody struct {
+			Code string `json:"code"`
+		}
+		var body requestBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Code == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+
+		owner := claims.UID
+		if role, err := user_models.GetRoleByUID(r.Context(), a.Store, claims.UID); err == nil && role == "admin" {
+			owner = ""
+		}
+
+		if err := user_models.RevokeInvite(a.DB, body.Code, owner); err != nil {
+			if errors.Is(err, user_models.ErrInviteInvalid) {
+				response.Fail(w, r, response.CodeNotFound, "Invite not found")
+				return
+			}
+			logging.FromContext(r.Context()).Error("RevokeInvite error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.Message(w, http.StatusOK, "Invite revoked")
+	}
+}
+
+// WaitlistHandler lists waitlist entries for admins (?status=pending&limit=50&offset=0)
+func WaitlistHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := session_auth.RequireAdmin(a, w, r); !ok {
+			return
+		}
+
+		q := r.URL.Query()
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxApproveBatch {
+			limit = 50
+		}
+		offset, err := strconv.Atoi(q.Get("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		entries, err := user_models.GetWaitlist(a.DB, q.Get("status"), limit, offset)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetWaitlist error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.OK(w, map[string]interface{}{"entries": entries})
+	}
+}
+
+// ApproveWaitlistHandler approves a batch of waitlist entries and emails each one an invite.
+// Body: {"emails": [...]} for specific addresses or {"count": N} for the N oldest pending entries.
+func ApproveWaitlistHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		if _, ok := session_auth.RequireAdmin(a, w, r); !ok {
+			return
+		}
+
+		type requestBody struct {
+			Emails []string `json:"emails"`
+			Count  int      `json:"count"`
+		}
+		var body requestBody
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || (len(body.Emails) == 0 && body.Count <= 0) {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+		if len(body.Emails) > maxApproveBatch || body.Count > maxApproveBatch {
+			response.WriteError(w, r, response.Errorf(response.CodeInvalidRequest, "At most %d entries per batch", maxApproveBatch))
+			return
+		}
+
+		approved, err := user_models.ApproveWaitlist(r.Context(), a.DB, body.Emails, body.Count, defaultInviteTTL, a.Clock.Now())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("ApproveWaitlist error", "err", err)
+			if len(approved) == 0 {
+				response.WriteError(w, r, response.ErrInternal)
+				return
+			}
+		}
+
+		failed := []string{}
+		for _, entry := range approved {
+			if err := sendInviteEmail(r.Context(), a.Mailer, entry.Email, entry.InviteCode); err != nil {
+				logging.FromContext(r.Context()).Error("Failed to send invite email", "email", entry.Email, "err", err)
+				failed = append(failed, entry.Email)
+			}
+		}
+
+		response.OK(w, map[string]interface{}{
+			"approved":     approved,
+			"email_failed": failed,
+		})
+	}
+}
+
+// EnforceSignupMode decides whether email may start a signup under the active mode. Existing
+// accounts (e.g. finishing onboarding) are always allowed. In waitlist mode an email without a
+// valid invite is added to the waitlist. It writes the response itself and returns false when
+// the signup must stop.
+func EnforceSignupMode(a *app.App, w http.ResponseWriter, r *http.Request, email, inviteCode string) bool {
+	mode := a.Config.SignupMode
+	if mode == auth_utils.SignupModeOpen {
+		return true
+	}
+
+	exists, err := user_models.EmailExists(r.Context(), a.Store, email)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("EmailExists error", "err", err)
+		response.WriteError(w, r, response.ErrInternal)
+		return false
+	}
+	if exists {
+		return true
+	}
+
+	if inviteCode != "" {
+		err := user_models.RedeemInvite(r.Context(), a.DB, inviteCode, email, a.Clock.Now())
+		if err == nil {
+			return true
+		}
+		if !errors.Is(err, user_models.ErrInviteInvalid) && !errors.Is(err, user_models.ErrInviteExhausted) {
+			logging.FromContext(r.Context()).Error("RedeemInvite error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return false
+		}
+		response.Fail(w, r, response.CodeInviteInvalid, err.Error())
+		return false
+	}
+
+	if mode == auth_utils.SignupModeWaitlist {
+		if err := user_models.JoinWaitlist(a.DB, email); err != nil {
+			logging.FromContext(r.Context()).Error("JoinWaitlist error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return false
+		}
+		response.JSON(w, http.StatusAccepted, map[string]string{
+			"message": "Signup is currently waitlist only, you have been added to the waitlist",
+			"mode":    mode,
+		})
+		return false
+	}
+
+	response.Fail(w, r, response.CodeInviteRequired, "Signup requires an invite code")
+	return false
+}
+
+// sendInviteEmail sends the invite code. In development (no SMTP settings) it will be skipped.
+func sendInviteEmail(ctx context.Context, m mailer.Mailer, to, code string) error {
+	err := m.Send(ctx, to, "You're invited", fmt.Sprintf(
+		"You're off the waitlist! Sign up with this email address and invite code: %s\r\n"+
+			"The code expires in 7 days.\r\n", code))
+	if errors.Is(err, mailer.ErrNotConfigured) {
+		logging.FromContext(ctx).Info("SMTP not configured; skipping invite email", "email", to)
+		return nil
+	}
+	return err
+}
+
+func isValidEmail(e string) bool {
+	var re = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+	return re.MatchString(e)
+}
@@ -0,0 +1,25 @@
+package jwks_controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	user_models "sraraa/reciever_src/models/user"
+)
+
+// JWKSHandler publishes the public session signing keys so other services can verify session
+// tokens offline. Verifiers should cache the set and refetch when they meet an unknown kid.
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := user_models.PublicJWKs()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("PublicJWKs error", "err", err)
+		response.WriteError(w, r, response.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
@@ -1,34 +1,30 @@
 package login_controller
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math/big"
 	"net/http"
-	"net/smtp"
-	"os"
 	"time"
 
-	"sraraa/db"
+	"sraraa/app"
+	"sraraa/mailer"
+	"sraraa/metrics"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/session_auth"
 	user_models "sraraa/reciever_src/models/user"
 )
 
-// sendOTPEmail sends an OTP code via email using SMTP
-func sendOTPEmail(to, code string) error {
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPort := os.Getenv("SMTP_PORT")
-	smtpPassword := os.Getenv("SMTP_PASSWORD")
-	fromEmail := os.Getenv("FROM_EMAIL")
-
-	if smtpHost == "" || smtpPort == "" || smtpPassword == "" || fromEmail == "" {
-		return fmt.Errorf("SMTP configuration missing in environment variables")
-	}
-
-	auth := smtp.PlainAuth("", fromEmail, smtpPassword, smtpHost)
+var (
+	errInvalidCredentials = response.NewError(response.CodeInvalidCredentials, "Invalid credentials")
+	errSuspended          = response.NewError(response.CodeAccountSuspended, "Account suspended")
+)
 
-	subject := "Your Login OTP Code"
+// sendOTPEmail sends an OTP code by email
+func sendOTPEmail(ctx context.Context, m mailer.Mailer, to, code string) error {
 	body := fmt.Sprintf(`
 Hello,
 
@@ -42,252 +38,249 @@ Best regards,
 Your App Team
 `, code)
 
-	message := fmt.Sprintf("From: %s\r\n"+
-		"To: %s\r\n"+
-		"Subject: %s\r\n"+
-		"\r\n"+
-		"%s", fromEmail, to, subject, body)
-
-	addr := smtpHost + ":" + smtpPort
-	err := smtp.SendMail(addr, auth, fromEmail, []string{to}, []byte(message))
-	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
-	}
-
-	return nil
+	return m.Send(ctx, to, "Your Login OTP Code", body)
 }
 
 // RequestLoginOTPHandler - Step 1: Send OTP to user's email
-func RequestLoginOTPHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	type request struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	var body request
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&body); err != nil || body.Email == "" || body.Password == "" {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+func RequestLoginOTPHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type request struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		var body request
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || body.Email == "" || body.Password == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
 
-	DB := db.DB
-	if DB == nil {
-		log.Println("database not initialized")
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		// Check if user exists
+		var userID int
+		err := a.DB.QueryRow(`SELECT id FROM users WHERE email=?`, body.Email).Scan(&userID)
+		if err != nil {
+			response.WriteError(w, r, errInvalidCredentials)
+			return
+		}
 
-	// Check if user exists
-	var userID int
-	err := DB.QueryRow(`SELECT id FROM users WHERE email=?`, body.Email).Scan(&userID)
-	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
-	}
+		// Verify password
+		storedPassword, err := user_models.GetStoredPasswordByEmail(r.Context(), a.Store, body.Email)
+		if err != nil || storedPassword != body.Password {
+			a.Metrics.LoginFailed("invalid_credentials")
+			response.WriteError(w, r, errInvalidCredentials)
+			return
+		}
 
-	// Verify password
-	storedPassword, err := user_models.GetStoredPasswordByEmail(DB, body.Email)
-	if err != nil || storedPassword != body.Password {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
-	}
+		// Check if user is verified
+		verified, err := user_models.IsVerified(r.Context(), a.Store, body.Email)
+		if err != nil || !verified {
+			a.Metrics.LoginFailed("unverified")
+			response.Fail(w, r, response.CodeEmailNotVerified, "Email not verified")
+			return
+		}
 
-	// Check if user is verified
-	verified, err := user_models.IsVerified(DB, body.Email)
-	if err != nil || !verified {
-		http.Error(w, "Email not verified", http.StatusForbidden)
-		return
-	}
+		if suspended, err := user_models.IsSuspendedByEmail(r.Context(), a.Store, body.Email); err != nil || suspended {
+			a.Metrics.LoginFailed("suspended")
+			response.WriteError(w, r, errSuspended)
+			return
+		}
 
-	// Check cooldown
-	cooldownUntil, err := user_models.GetLoginCooldown(DB, body.Email)
-	if err == nil && time.Now().Before(cooldownUntil) {
-		remaining := int(time.Until(cooldownUntil).Minutes())
-		http.Error(w, fmt.Sprintf("Too many requests. Try again in %d minutes", remaining), http.StatusTooManyRequests)
-		return
-	}
+		// Check cooldown
+		cooldownUntil, err := user_models.GetLoginCooldown(r.Context(), a.Store, body.Email)
+		if err == nil && a.Clock.Now().Before(cooldownUntil) {
+			remaining := int(cooldownUntil.Sub(a.Clock.Now()).Minutes())
+			a.Metrics.LoginFailed("rate_limited")
+			response.WriteError(w, r, response.RateLimited(fmt.Sprintf("Too many requests. Try again in %d minutes", remaining), cooldownUntil))
+			return
+		}
 
-	// Check rate limiting (max 5 requests per hour)
-	count, _ := user_models.CountLoginRequestsLastHour(DB, body.Email)
-	if count >= 5 {
-		cooldownUntil := time.Now().Add(1 * time.Hour)
-		_ = user_models.SetLoginCooldown(DB, body.Email, cooldownUntil)
-		http.Error(w, "Too many OTP requests. Try again later", http.StatusTooManyRequests)
-		return
-	}
+		// Check rate limiting (max 5 requests per hour)
+		count, _ := user_models.CountLoginRequestsLastHour(r.Context(), a.Store, body.Email, a.Clock.Now())
+		if count >= 5 {
+			cooldownUntil := a.Clock.Now().Add(1 * time.Hour)
+			_ = user_models.SetLoginCooldown(r.Context(), a.Store, body.Email, cooldownUntil)
+			a.Metrics.LoginFailed("rate_limited")
+			response.WriteError(w, r, response.RateLimited("Too many OTP requests. Try again later", cooldownUntil))
+			return
+		}
 
-	// Generate 6-digit OTP
-	code, err := generateOTP(6)
-	if err != nil {
-		log.Println("OTP generation error:", err)
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		// Generate 6-digit OTP
+		code, err := generateOTP(6)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("OTP generation error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
 
-	// Save OTP
-	if err := user_models.SaveLoginOTP(DB, body.Email, code); err != nil {
-		log.Println("SaveLoginOTP error:", err)
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		// Save OTP
+		if err := user_models.SaveLoginOTP(r.Context(), a.Store, body.Email, code); err != nil {
+			logging.FromContext(r.Context()).Error("SaveLoginOTP error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
 
-	// Track request
-	_ = user_models.AddLoginOTPRequest(DB, body.Email)
+		// Track request
+		_ = user_models.AddLoginOTPRequest(r.Context(), a.Store, body.Email)
 
-	// Send OTP via email
-	if err := sendOTPEmail(body.Email, code); err != nil {
-		log.Printf("Failed to send OTP email to %s: %v", body.Email, err)
-		http.Error(w, "Failed to send OTP email", http.StatusInternalServerError)
-		return
-	}
+		// Send OTP via email
+		if err := sendOTPEmail(r.Context(), a.Mailer, body.Email, code); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to send OTP email", "email", body.Email, "err", err)
+			response.Fail(w, r, response.CodeInternal, "Failed to send OTP email")
+			return
+		}
 
-	log.Printf("Login OTP sent to %s", body.Email)
+		a.Metrics.OTPIssued(metrics.PurposeLogin)
+		logging.FromContext(r.Context()).Info("Login OTP sent", "email", body.Email)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "OTP sent to your email",
-	})
+		response.Message(w, http.StatusOK, "OTP sent to your email")
+	}
 }
 
 // VerifyLoginOTPHandler - Step 2: Verify OTP and create session
-func VerifyLoginOTPHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+func VerifyLoginOTPHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type request struct {
+			Email string `json:"email"`
+			OTP   string `json:"otp"`
+		}
+		var body request
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || body.Email == "" || body.OTP == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
 
-	type request struct {
-		Email string `json:"email"`
-		OTP   string `json:"otp"`
-	}
-	var body request
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&body); err != nil || body.Email == "" || body.OTP == "" {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+		// Get stored OTP
+		storedOTP, createdAt, err := user_models.GetLoginOTP(r.Context(), a.Store, body.Email)
+		if err != nil {
+			a.Metrics.OTPFailed(metrics.PurposeLogin)
+			response.Fail(w, r, response.CodeOTPInvalid, "Invalid or expired OTP")
+			return
+		}
 
-	DB := db.DB
-	if DB == nil {
-		log.Println("database not initialized")
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		// Check if OTP is expired (valid for 10 minutes)
+		if a.Clock.Now().Sub(createdAt) > 10*time.Minute {
+			_ = user_models.DeleteLoginOTP(r.Context(), a.Store, body.Email)
+			a.Metrics.OTPFailed(metrics.PurposeLogin)
+			response.Fail(w, r, response.CodeOTPExpired, "OTP has expired")
+			return
+		}
 
-	// Get stored OTP
-	storedOTP, createdAt, err := user_models.GetLoginOTP(DB, body.Email)
-	if err != nil {
-		http.Error(w, "Invalid or expired OTP", http.StatusUnauthorized)
-		return
-	}
+		// Verify OTP
+		if storedOTP != body.OTP {
+			a.Metrics.OTPFailed(metrics.PurposeLogin)
+			response.Fail(w, r, response.CodeOTPInvalid, "Invalid OTP")
+			return
+		}
 
-	// Check if OTP is expired (valid for 10 minutes)
-	if time.Since(createdAt) > 10*time.Minute {
-		_ = user_models.DeleteLoginOTP(DB, body.Email)
-		http.Error(w, "OTP has expired", http.StatusUnauthorized)
-		return
-	}
+		// Delete OTP after successful verification
+		_ = user_models.DeleteLoginOTP(r.Context(), a.Store, body.Email)
+		a.Metrics.OTPVerified(metrics.PurposeLogin)
 
-	// Verify OTP
-	if storedOTP != body.OTP {
-		http.Error(w, "Invalid OTP", http.StatusUnauthorized)
-		return
-	}
+		// The account may have been suspended after the OTP was sent
+		if suspended, err := user_models.IsSuspendedByEmail(r.Context(), a.Store, body.Email); err != nil || suspended {
+			a.Metrics.LoginFailed("suspended")
+			response.WriteError(w, r, errSuspended)
+			return
+		}
 
-	// Delete OTP after successful verification
-	_ = user_models.DeleteLoginOTP(DB, body.Email)
+		// Get user ID
+		userID, err := user_models.GetUserIDByEmailOrUsername(r.Context(), a.Store, body.Email)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetUserIDByEmailOrUsername error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
 
-	// Get user ID
-	userID, err := user_models.GetUserIDByEmailOrUsername(DB, body.Email)
-	if err != nil {
-		log.Println("GetUserIDByEmailOrUsername error:", err)
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		// Create session
+		userAgent := r.UserAgent()
+		ip := r.RemoteAddr
+		token, err := user_models.CreateSession(r.Context(), a.Store, userID, 7*24*time.Hour, userAgent, ip)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("CreateSession error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+		a.Metrics.SessionCreated("login")
 
-	// Create session
-	userAgent := r.UserAgent()
-	ip := r.RemoteAddr
-	token, err := user_models.CreateSession(DB, userID, 7*24*time.Hour, userAgent, ip)
-	if err != nil {
-		log.Println("CreateSession error:", err)
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
+		// Return session token
+		response.OK(w, map[string]string{
+			"session_token": token,
+			"message":       "Login successful",
+		})
 	}
-
-	// Return session token
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"session_token": token,
-		"message":       "Login successful",
-	})
 }
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		http.Error(w, "No session token provided", http.StatusBadRequest)
-		return
+func LogoutHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			response.WriteError(w, r, response.ErrNoToken)
+			return
+		}
+		// Logging out twice, or with a token that was never stored, still succeeds but revokes
+		// nothing, so only a deleted row is counted
+		deleted, err := user_models.DeleteSession(r.Context(), a.Store, token)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("DeleteSession error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+		if deleted {
+			a.Metrics.SessionsRevoked("logout")
+		}
+		response.Message(w, http.StatusOK, "Logged out successfully")
 	}
-	DB := db.DB
-	_ = user_models.DeleteSession(DB, token)
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "Logged out successfully")
 }
 
-func LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
-	token := r.Header.Get("Authorization")
-	DB := db.DB
-	claims, err := user_models.ValidateSessionToken(token)
-	if err != nil {
-		http.Error(w, "Invalid session", http.StatusUnauthorized)
-		return
+func LogoutAllHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		claims, err := session_auth.AuthenticateToken(r.Context(), a, token, "")
+		if err != nil {
+			response.WriteError(w, r, session_auth.AuthError(err))
+			return
+		}
+		_ = user_models.DeleteAllSessions(r.Context(), a.Store, claims.UserID)
+		a.Metrics.SessionsRevoked("logout_all")
+		response.Message(w, http.StatusOK, "Logged out from all sessions")
 	}
-	_ = user_models.DeleteAllSessions(DB, claims.UserID)
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "Logged out from all sessions")
 }
 
-func ValidateSessionHandler(w http.ResponseWriter, r *http.Request) {
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		http.Error(w, "No session token provided", http.StatusBadRequest)
-		return
-	}
+func ValidateSessionHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			response.WriteError(w, r, response.ErrNoToken)
+			return
+		}
 
-	claims, err := user_models.ValidateSessionToken(token)
-	if err != nil {
-		http.Error(w, "Invalid or expired session token", http.StatusUnauthorized)
-		return
-	}
+		// Accepts sessions as well as personal access tokens with profile:read
+		claims, err := session_auth.AuthenticateToken(r.Context(), a, token, user_models.ScopeProfileRead)
+		if err != nil {
+			response.WriteError(w, r, session_auth.AuthError(err))
+			return
+		}
 
-	DB := db.DB
-	var exists bool
-	err = DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM sessions WHERE session_token=?)`, token).Scan(&exists)
-	if err != nil || !exists {
-		http.Error(w, "Session token not found", http.StatusUnauthorized)
-		return
-	}
+		resp := map[string]interface{}{
+			"user_id":  claims.UserID,
+			"email":    claims.Email,
+			"username": claims.Username,
+			"fullname": claims.Fullname,
+			"verified": claims.Verified,
+			"uid":      claims.UID,
+		}
+		if claims.AccessTokenID != 0 {
+			resp["scopes"] = claims.Scopes
+		}
+		if impersonator := claims.ImpersonatorUID(); impersonator != "" {
+			resp["impersonated_by"] = impersonator
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"user_id":  claims.UserID,
-		"email":    claims.Email,
-		"username": claims.Username,
-		"fullname": claims.Fullname,
-		"verified": claims.Verified,
-		"uid":      claims.UID,
-	})
+		response.OK(w, resp)
+	}
 }
 
 // Helper function to generate OTP
@@ -303,3 +296,35 @@ func generateOTP(length int) (string, error) {
 	}
 	return string(otp), nil
 }
+
+// ListSessionsHandler lists the caller's active sessions. Sessions an admin opened by
+// impersonating the user carry "impersonated_by" so they stand out.
+func ListSessionsHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := session_auth.AuthenticateScope(a, w, r, user_models.ScopeProfileRead)
+		if !ok {
+			return
+		}
+
+		sessions, err := user_models.GetSessionsByUID(r.Context(), a.Store, claims.UID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetSessionsByUID error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		// Never hand out other sessions' tokens, just mark the caller's own
+		current := r.Header.Get("Authorization")
+		list := make([]map[string]interface{}, 0, len(sessions))
+		for _, s := range sessions {
+			s["current"] = s["session_token"] == current
+			delete(s, "session_token")
+			if s["impersonated_by"] == "" {
+				delete(s, "impersonated_by")
+			}
+			list = append(list, s)
+		}
+
+		response.OK(w, map[string]interface{}{"sessions": list})
+	}
+}
@@ -0,0 +1,202 @@
+package login_controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sraraa/app"
+	"sraraa/config"
+	"sraraa/db"
+	"sraraa/pkg/clock"
+	user_models "sraraa/reciever_src/models/user"
+	"sraraa/storage"
+)
+
+// fakeMailer keeps what it is asked to send instead of sending it
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (m *fakeMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, body)
+	return nil
+}
+
+func (m *fakeMailer) last() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sent) == 0 {
+		return ""
+	}
+	return m.sent[len(m.sent)-1]
+}
+
+var otpPattern = regexp.MustCompile(`code is: (\d{6})`)
+
+// newTestApp builds an App over a migrated in-memory SQLite store with a fake mailer
+func newTestApp(t *testing.T) (*app.App, *fakeMailer) {
+	t.Helper()
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	store, err := storage.Open(storage.Memory)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := db.Migrate(store.DB, store.Dialect); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := user_models.LoadSigningKeys(t.TempDir()); err != nil {
+		t.Fatalf("load signing keys: %v", err)
+	}
+
+	a := app.New(cfg, store)
+	m := &fakeMailer{}
+	a.Mailer = m
+	return a, m
+}
+
+// addUser stores a verified account that can log in with password
+func addUser(t *testing.T, a *app.App, email, password string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := a.Store.Users.Create(ctx, email); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := a.Store.Users.SetUID(ctx, email, "uid-"+strings.Split(email, "@")[0]); err != nil {
+		t.Fatalf("set uid: %v", err)
+	}
+	if err := a.Store.Users.MarkVerified(ctx, email); err != nil {
+		t.Fatalf("mark verified: %v", err)
+	}
+	if err := a.Store.Users.SetPassword(ctx, email, password); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+}
+
+func call(h http.HandlerFunc, method, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func TestLoginWithOTP(t *testing.T) {
+	a, m := newTestApp(t)
+	addUser(t, a, "alice@example.com", "correct horse")
+
+	rec := call(RequestLoginOTPHandler(a), http.MethodPost, `{"email":"alice@example.com","password":"wrong"}`, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d, body %s", rec.Code, rec.Body)
+	}
+	if m.last() != "" {
+		t.Fatal("wrong password: an OTP was mailed")
+	}
+
+	rec = call(RequestLoginOTPHandler(a), http.MethodPost, `{"email":"alice@example.com","password":"correct horse"}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("request OTP: status %d, body %s", rec.Code, rec.Body)
+	}
+	match := otpPattern.FindStringSubmatch(m.last())
+	if match == nil {
+		t.Fatalf("no OTP in the mailed body %q", m.last())
+	}
+
+	rec = call(VerifyLoginOTPHandler(a), http.MethodPost, `{"email":"alice@example.com","otp":"not-it"}`, "")
+	if rec.Code == http.StatusOK {
+		t.Fatal("a wrong OTP was accepted")
+	}
+
+	rec = call(VerifyLoginOTPHandler(a), http.MethodPost, `{"email":"alice@example.com","otp":"`+match[1]+`"}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify OTP: status %d, body %s", rec.Code, rec.Body)
+	}
+	var session struct {
+		SessionToken string `json:"session_token"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&session); err != nil || session.SessionToken == "" {
+		t.Fatalf("verify OTP: no session token (%v)", err)
+	}
+
+	// the code is single use
+	rec = call(VerifyLoginOTPHandler(a), http.MethodPost, `{"email":"alice@example.com","otp":"`+match[1]+`"}`, "")
+	if rec.Code == http.StatusOK {
+		t.Fatal("an OTP was accepted twice")
+	}
+
+	rec = call(ValidateSessionHandler(a), http.MethodGet, "", session.SessionToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("validate session: status %d, body %s", rec.Code, rec.Body)
+	}
+	var claims struct {
+		Email string `json:"email"`
+		UID   string `json:"uid"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&claims); err != nil {
+		t.Fatalf("validate session: %v", err)
+	}
+	if claims.Email != "alice@example.com" || claims.UID != "uid-alice" {
+		t.Fatalf("validate session: got %+v", claims)
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	a, _ := newTestApp(t)
+	addUser(t, a, "bob@example.com", "hunter22")
+
+	userID, err := user_models.GetUserIDByEmailOrUsername(context.Background(), a.Store, "bob@example.com")
+	if err != nil {
+		t.Fatalf("user id: %v", err)
+	}
+	token, err := user_models.CreateSession(context.Background(), a.Store, userID, time.Hour, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	if rec := call(LogoutHandler(a), http.MethodPost, "", token); rec.Code != http.StatusOK {
+		t.Fatalf("logout: status %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := call(ValidateSessionHandler(a), http.MethodGet, "", token); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("validate after logout: status %d, body %s", rec.Code, rec.Body)
+	}
+	// logging out again still succeeds
+	if rec := call(LogoutHandler(a), http.MethodPost, "", token); rec.Code != http.StatusOK {
+		t.Fatalf("second logout: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLoginOTPExpiresByAppClock(t *testing.T) {
+	a, m := newTestApp(t)
+	addUser(t, a, "erin@example.com", "open sesame")
+
+	rec := call(RequestLoginOTPHandler(a), http.MethodPost, `{"email":"erin@example.com","password":"open sesame"}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("request OTP: status %d, body %s", rec.Code, rec.Body)
+	}
+	match := otpPattern.FindStringSubmatch(m.last())
+	if match == nil {
+		t.Fatalf("no OTP in the mailed body %q", m.last())
+	}
+
+	a.Clock = clock.Fixed(time.Now().Add(11 * time.Minute))
+	rec = call(VerifyLoginOTPHandler(a), http.MethodPost, `{"email":"erin@example.com","otp":"`+match[1]+`"}`, "")
+	if rec.Code == http.StatusOK || !strings.Contains(rec.Body.String(), "expired") {
+		t.Fatalf("verify after expiry: status %d, body %s", rec.Code, rec.Body)
+	}
+}
@@ -1,18 +1,26 @@
 package forgot_password_controller
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
-	"math/rand"
+	"math/big"
 	"net/http"
-	"net/smtp"
-	"os"
 	"time"
 
-	"sraraa/db"
+	"sraraa/app"
+	"sraraa/mailer"
+	"sraraa/metrics"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
 	user_models "sraraa/reciever_src/models/user"
 )
 
+// maxResetAttempts is how many wrong guesses a reset code survives before it is deleted
+const maxResetAttempts = 5
+
 type requestPayload struct {
 	Email string `json:"email"`
 }
@@ -22,93 +30,120 @@ type verifyPayload struct {
 	Code  string `json:"code"`
 }
 
-func SendResetOTP(w http.ResponseWriter, r *http.Request) {
-	var payload requestPayload
-	json.NewDecoder(r.Body).Decode(&payload)
-
-	if payload.Email == "" {
-		http.Error(w, "email required", http.StatusBadRequest)
-		return
-	}
-
-	exists, err := user_models.EmailExists(db.DB, payload.Email)
-	if err != nil {
-		http.Error(w, "server error", http.StatusInternalServerError)
-		return
-	}
-	if !exists {
-		http.Error(w, "user not found", http.StatusBadRequest)
-		return
+func SendResetOTP(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload requestPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		if payload.Email == "" {
+			response.WriteError(w, r, response.Invalid("email", "email required"))
+			return
+		}
+
+		exists, err := user_models.EmailExists(r.Context(), a.Store, payload.Email)
+		if err != nil {
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+		if !exists {
+			response.Fail(w, r, response.CodeNotFound, "user not found")
+			return
+		}
+
+		cooldown, _ := user_models.GetPasswordResetCooldown(r.Context(), a.Store, payload.Email)
+		if a.Clock.Now().Before(cooldown) {
+			response.WriteError(w, r, response.RateLimited("cooldown active", cooldown))
+			return
+		}
+
+		count, _ := user_models.CountPasswordResetRequestsLastHour(r.Context(), a.Store, payload.Email, a.Clock.Now())
+		if count >= 5 {
+			until := a.Clock.Now().Add(30 * time.Minute)
+			user_models.SetPasswordResetCooldown(r.Context(), a.Store, payload.Email, until)
+			response.WriteError(w, r, response.RateLimited("too many requests", until))
+			return
+		}
+
+		code, err := generateOTP()
+		if err != nil {
+			logging.FromContext(r.Context()).Error("OTP generation error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		err = SendOTPEmail(r.Context(), a.Mailer, payload.Email, code)
+		if err != nil {
+			response.Fail(w, r, response.CodeUnavailable, "email service unavailable")
+			return
+		}
+
+		user_models.SavePasswordResetOTP(r.Context(), a.Store, payload.Email, code)
+		user_models.AddPasswordResetRequest(r.Context(), a.Store, payload.Email)
+		a.Metrics.OTPIssued(metrics.PurposePasswordReset)
+
+		response.Message(w, http.StatusOK, "otp sent")
 	}
+}
 
-	cooldown, _ := user_models.GetPasswordResetCooldown(db.DB, payload.Email)
-	if time.Now().Before(cooldown) {
-		http.Error(w, "cooldown active", http.StatusTooManyRequests)
-		return
-	}
+func VerifyResetOTP(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload verifyPayload
+		json.NewDecoder(r.Body).Decode(&payload)
 
-	count, _ := user_models.CountPasswordResetRequestsLastHour(db.DB, payload.Email)
-	if count >= 5 {
-		user_models.SetPasswordResetCooldown(db.DB, payload.Email, time.Now().Add(30*time.Minute))
-		http.Error(w, "too many requests", http.StatusTooManyRequests)
-		return
-	}
+		if !checkResetCode(a, w, r, payload.Email, payload.Code) {
+			return
+		}
+		a.Metrics.OTPVerified(metrics.PurposePasswordReset)
 
-	code := rand.Intn(900000) + 100000
+		// The code is consumed by ResetPassword, which needs it to authorize the new password
 
-	err = SendOTPEmail(payload.Email, fmt.Sprint(code))
-	if err != nil {
-		http.Error(w, "email service unavailable", http.StatusServiceUnavailable)
-		return
+		response.Message(w, http.StatusOK, "otp verified")
 	}
-
-	user_models.SavePasswordResetOTP(db.DB, payload.Email, fmt.Sprint(code))
-	user_models.AddPasswordResetRequest(db.DB, payload.Email)
-
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message":"otp sent"}`))
 }
 
-func VerifyResetOTP(w http.ResponseWriter, r *http.Request) {
-	var payload verifyPayload
-	json.NewDecoder(r.Body).Decode(&payload)
-
-	code, created, err := user_models.GetPasswordResetOTP(db.DB, payload.Email)
+// checkResetCode reports whether code is email's current reset code and still valid. A wrong
+// guess is counted against the code, which is deleted after maxResetAttempts of them, so it
+// cannot be brute forced through either endpoint. On failure it writes the error response.
+func checkResetCode(a *app.App, w http.ResponseWriter, r *http.Request, email, code string) bool {
+	stored, created, err := user_models.GetPasswordResetOTP(r.Context(), a.Store, email)
 	if err != nil {
-		http.Error(w, "otp not found", http.StatusBadRequest)
-		return
+		a.Metrics.OTPFailed(metrics.PurposePasswordReset)
+		response.Fail(w, r, response.CodeOTPInvalid, "otp not found")
+		return false
 	}
 
-	if time.Since(created) > 10*time.Minute {
-		user_models.DeletePasswordResetOTP(db.DB, payload.Email)
-		http.Error(w, "otp expired", http.StatusBadRequest)
-		return
+	if a.Clock.Now().Sub(created) > 10*time.Minute {
+		user_models.DeletePasswordResetOTP(r.Context(), a.Store, email)
+		a.Metrics.OTPFailed(metrics.PurposePasswordReset)
+		response.Fail(w, r, response.CodeOTPExpired, "otp expired")
+		return false
 	}
 
-	if payload.Code != code {
-		http.Error(w, "invalid otp", http.StatusBadRequest)
-		return
+	if subtle.ConstantTimeCompare([]byte(code), []byte(stored)) != 1 {
+		a.Metrics.OTPFailed(metrics.PurposePasswordReset)
+		failures, err := user_models.AddPasswordResetFailure(r.Context(), a.Store, email)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("AddPasswordResetFailure error", "err", err)
+		}
+		if err != nil || failures >= maxResetAttempts {
+			user_models.DeletePasswordResetOTP(r.Context(), a.Store, email)
+		}
+		response.Fail(w, r, response.CodeOTPInvalid, "invalid otp")
+		return false
 	}
-
-	user_models.DeletePasswordResetOTP(db.DB, payload.Email)
-
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message":"otp verified"}`))
+	return true
 }
 
-func SendOTPEmail(to, code string) error {
-	host := os.Getenv("SMTP_HOST")
-	port := os.Getenv("SMTP_PORT")
-	from := os.Getenv("FROM_EMAIL")
-	password := os.Getenv("SMTP_PASSWORD")
-
-	auth := smtp.PlainAuth("", from, password, host)
-
-	msg := []byte(
-		"To: " + to + "\r\n" +
-			"Subject: Password Reset Code\r\n\r\n" +
-			"Your password reset code is: " + code + "\nThis code expires in 10 minutes.",
-	)
+// generateOTP generates a 6-digit code using crypto/rand
+func generateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
 
-	return smtp.SendMail(host+":"+port, auth, from, []string{to}, msg)
+func SendOTPEmail(ctx context.Context, m mailer.Mailer, to, code string) error {
+	return m.Send(ctx, to, "Password Reset Code",
+		"Your password reset code is: "+code+"\nThis code expires in 10 minutes.")
 }
@@ -0,0 +1,153 @@
+package forgot_password_controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"sraraa/app"
+	"sraraa/config"
+	"sraraa/db"
+	user_models "sraraa/reciever_src/models/user"
+	"sraraa/storage"
+)
+
+// fakeMailer keeps what it is asked to send instead of sending it
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (m *fakeMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, body)
+	return nil
+}
+
+var codePattern = regexp.MustCompile(`code is: (\d{6})`)
+
+// lastCode returns the code in the last mail sent
+func (m *fakeMailer) lastCode(t *testing.T) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sent) == 0 {
+		t.Fatal("no mail was sent")
+	}
+	match := codePattern.FindStringSubmatch(m.sent[len(m.sent)-1])
+	if match == nil {
+		t.Fatalf("no code in the mailed body %q", m.sent[len(m.sent)-1])
+	}
+	return match[1]
+}
+
+// newTestApp builds an App over a migrated in-memory SQLite store with a fake mailer, holding
+// one account, email
+func newTestApp(t *testing.T, email string) (*app.App, *fakeMailer) {
+	t.Helper()
+
+	cfg, err := config.Load([]string{"-breached-password-mode", "off"})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	store, err := storage.Open(storage.Memory)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := db.Migrate(store.DB, store.Dialect); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := user_models.LoadSigningKeys(t.TempDir()); err != nil {
+		t.Fatalf("load signing keys: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := store.Users.Create(ctx, email); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := store.Users.MarkVerified(ctx, email); err != nil {
+		t.Fatalf("mark verified: %v", err)
+	}
+
+	a := app.New(cfg, store)
+	m := &fakeMailer{}
+	a.Mailer = m
+	return a, m
+}
+
+func call(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	return rec
+}
+
+// wrongCode returns a code that is not code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "000001"
+	}
+	return "000000"
+}
+
+func TestResetPassword(t *testing.T) {
+	a, m := newTestApp(t, "frank@example.com")
+
+	if rec := call(SendResetOTP(a), `{"email":"frank@example.com"}`); rec.Code != http.StatusOK {
+		t.Fatalf("send: status %d, body %s", rec.Code, rec.Body)
+	}
+	code := m.lastCode(t)
+
+	if rec := call(VerifyResetOTP(a), `{"email":"frank@example.com","code":"`+code+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("verify: status %d, body %s", rec.Code, rec.Body)
+	}
+	rec := call(ResetPassword(a), `{"email":"frank@example.com","code":"`+code+`","password":"New-passphrase-42"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reset: status %d, body %s", rec.Code, rec.Body)
+	}
+	stored, err := a.Store.Users.GetPassword(context.Background(), "frank@example.com")
+	if err != nil || stored != "New-passphrase-42" {
+		t.Fatalf("stored password %q, %v", stored, err)
+	}
+
+	// the code is consumed by the reset
+	rec = call(ResetPassword(a), `{"email":"frank@example.com","code":"`+code+`","password":"Other-passphrase-42"}`)
+	if rec.Code == http.StatusOK {
+		t.Fatal("a reset code was used twice")
+	}
+}
+
+func TestResetCodeDeletedAfterWrongGuesses(t *testing.T) {
+	a, m := newTestApp(t, "grace@example.com")
+
+	if rec := call(SendResetOTP(a), `{"email":"grace@example.com"}`); rec.Code != http.StatusOK {
+		t.Fatalf("send: status %d, body %s", rec.Code, rec.Body)
+	}
+	code := m.lastCode(t)
+	wrong := wrongCode(code)
+
+	// guesses through either endpoint count against the same code
+	for i := 0; i < maxResetAttempts; i++ {
+		h := VerifyResetOTP(a)
+		if i%2 == 1 {
+			h = ResetPassword(a)
+		}
+		rec := call(h, `{"email":"grace@example.com","code":"`+wrong+`","password":"New-passphrase-42"}`)
+		if rec.Code == http.StatusOK {
+			t.Fatalf("guess %d: a wrong code was accepted", i+1)
+		}
+	}
+
+	rec := call(ResetPassword(a), `{"email":"grace@example.com","code":"`+code+`","password":"New-passphrase-42"}`)
+	if rec.Code == http.StatusOK {
+		t.Fatal("the right code still worked after too many wrong guesses")
+	}
+	if _, _, err := a.Store.OTPs.Get(context.Background(), storage.PurposePasswordReset, "grace@example.com"); err == nil {
+		t.Fatal("the reset code was not deleted")
+	}
+}
@@ -0,0 +1,125 @@
+package forgot_password_controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"sraraa/app"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/session_auth"
+	user_models "sraraa/reciever_src/models/user"
+)
+
+type resetPayload struct {
+	Email    string `json:"email"`
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+// ResetPassword completes the forgot-password flow: it checks the reset code, stores the new
+// password and logs the account out everywhere, revoking personal access tokens too
+func ResetPassword(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		var payload resetPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Email == "" || payload.Code == "" || payload.Password == "" {
+			response.Fail(w, r, response.CodeInvalidRequest, "email, code and password required")
+			return
+		}
+
+		if !checkResetCode(a, w, r, payload.Email, payload.Code) {
+			return
+		}
+
+		check, err := user_models.SetPassword(r.Context(), a.Store, payload.Email, payload.Password, a.Config.BreachPolicy())
+		if err != nil {
+			writePasswordError(w, r, check, err)
+			return
+		}
+
+		user_models.DeletePasswordResetOTP(r.Context(), a.Store, payload.Email)
+
+		if uid, err := user_models.GetUIDByEmail(r.Context(), a.Store, payload.Email); err == nil && uid != "" {
+			if err := user_models.DeleteAllSessionsByUID(r.Context(), a.Store, uid); err != nil {
+				logging.FromContext(r.Context()).Error("DeleteAllSessionsByUID error", "err", err)
+			} else {
+				a.Metrics.SessionsRevoked("password_reset")
+			}
+			if err := user_models.RevokeAllAccessTokens(a.DB, uid); err != nil {
+				logging.FromContext(r.Context()).Error("RevokeAllAccessTokens error", "err", err)
+			}
+		}
+
+		response.OK(w, map[string]interface{}{
+			"message":        "password reset",
+			"password_check": check,
+		})
+	}
+}
+
+type changePayload struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePasswordHandler lets a logged in user change their password. Other sessions are revoked,
+// the calling session stays valid.
+func ChangePasswordHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		claims, ok := session_auth.Authenticate(a, w, r)
+		if !ok {
+			return
+		}
+
+		var payload changePayload
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&payload); err != nil || payload.CurrentPassword == "" || payload.NewPassword == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+
+		stored, err := user_models.GetStoredPasswordByEmail(r.Context(), a.Store, claims.Email)
+		if err != nil || stored != payload.CurrentPassword {
+			response.Fail(w, r, response.CodeInvalidCredentials, "Current password is incorrect")
+			return
+		}
+
+		if payload.NewPassword == payload.CurrentPassword {
+			response.WriteError(w, r, response.Invalid("new_password", "New password must be different"))
+			return
+		}
+
+		check, err := user_models.SetPassword(r.Context(), a.Store, claims.Email, payload.NewPassword, a.Config.BreachPolicy())
+		if err != nil {
+			writePasswordError(w, r, check, err)
+			return
+		}
+
+		if err := user_models.DeleteOtherSessions(r.Context(), a.Store, claims.UID, r.Header.Get("Authorization")); err != nil {
+			logging.FromContext(r.Context()).Error("DeleteOtherSessions error", "err", err)
+		} else {
+			a.Metrics.SessionsRevoked("password_change")
+		}
+
+		response.OK(w, map[string]interface{}{
+			"message":        "Password changed",
+			"password_check": check,
+		})
+	}
+}
+
+// writePasswordError rejects a password; breached passwords include the strength estimate
+func writePasswordError(w http.ResponseWriter, r *http.Request, check user_models.PasswordCheck, err error) {
+	if errors.Is(err, user_models.ErrPasswordBreached) {
+		response.WriteError(w, r, response.NewError(response.CodePasswordBreached, err.Error()).
+			WithDetails(map[string]interface{}{"password_check": check}))
+		return
+	}
+	response.WriteError(w, r, response.Invalid("password", err.Error()))
+}
@@ -0,0 +1,35 @@
+package service_auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"sraraa/app"
+)
+
+// AuthenticateClient checks HTTP Basic credentials against the internal service clients
+// configured in SERVICE_CLIENTS ("cdn:secret,worker:secret2"), or INTROSPECTION_CLIENTS when
+// that is not set. Returns the client id.
+func AuthenticateClient(a *app.App, r *http.Request) (string, bool) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id == "" || secret == "" {
+		return "", false
+	}
+
+	// Validate has already refused malformed entries
+	clients, _ := a.Config.ServiceClientSecrets()
+	wantSecret, found := clients[id]
+	if !found {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(wantSecret)) == 1 {
+		return id, true
+	}
+	return "", false
+}
+
+// HasBasicAuth reports whether the request carries service credentials rather than a token
+func HasBasicAuth(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), "Basic ")
+}
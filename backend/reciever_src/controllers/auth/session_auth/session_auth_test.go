@@ -0,0 +1,68 @@
+package session_auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"sraraa/app"
+	"sraraa/config"
+	"sraraa/db"
+	user_models "sraraa/reciever_src/models/user"
+	"sraraa/storage"
+)
+
+// newTestApp builds an App over a migrated in-memory SQLite store
+func newTestApp(t *testing.T) *app.App {
+	t.Helper()
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	store, err := storage.Open(storage.Memory)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := db.Migrate(store.DB, store.Dialect); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return app.New(cfg, store)
+}
+
+func TestAdminScopeFollowsCurrentRole(t *testing.T) {
+	ctx := context.Background()
+	a := newTestApp(t)
+
+	if err := a.Store.Users.Create(ctx, "kate@example.com"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := a.Store.Users.SetUID(ctx, "kate@example.com", "uid-kate"); err != nil {
+		t.Fatalf("set uid: %v", err)
+	}
+	if _, err := a.DB.Exec(`UPDATE users SET role='admin' WHERE uid=?`, "uid-kate"); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+
+	_, raw, err := user_models.CreateAccessToken(a.DB, "uid-kate", "export",
+		[]string{user_models.ScopeUsersRead, user_models.ScopeProfileRead}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if _, err := AuthenticateToken(ctx, a, raw, user_models.ScopeUsersRead); err != nil {
+		t.Fatalf("as admin: %v", err)
+	}
+
+	if _, err := a.DB.Exec(`UPDATE users SET role='user' WHERE uid=?`, "uid-kate"); err != nil {
+		t.Fatalf("demote: %v", err)
+	}
+	if _, err := AuthenticateToken(ctx, a, raw, user_models.ScopeUsersRead); !errors.Is(err, ErrInsufficientScope) {
+		t.Fatalf("after demotion: got %v, want ErrInsufficientScope", err)
+	}
+	// the token's other scopes are unaffected
+	if _, err := AuthenticateToken(ctx, a, raw, user_models.ScopeProfileRead); err != nil {
+		t.Fatalf("non-admin scope after demotion: %v", err)
+	}
+}
@@ -2,197 +2,221 @@ package onboarding_controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"regexp"
 
-	"sraraa/db"
+	"sraraa/app"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
 	"sraraa/reciever_src/controllers/auth/uniqueid"
 	user_models "sraraa/reciever_src/models/user"
 	auth_utils "sraraa/reciever_src/utils/auth"
 )
 
-// --- Username ---
-func SetUsernameHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+var errOnboardingToken = response.NewError(response.CodeOnboardingTokenInvalid, "Invalid or expired onboarding token")
 
-	// Limit body size
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+// --- Username ---
+func SetUsernameHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Limit body size
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		type request struct {
+			Email    string `json:"email,omitempty"`
+			Username string `json:"username"`
+		}
 
-	type request struct {
-		Email    string `json:"email"`
-		Username string `json:"username"`
-	}
+		var body request
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || body.Username == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
 
-	var body request
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&body); err != nil || body.Email == "" || body.Username == "" {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+		email, ok := authorizeOnboarding(a, w, r, body.Email)
+		if !ok {
+			return
+		}
 
-	if !isValidEmail(body.Email) {
-		http.Error(w, "Invalid email format", http.StatusBadRequest)
-		return
-	}
+		if err := user_models.SetUsername(a.DB, email, body.Username); err != nil {
+			logging.FromContext(r.Context()).Error("SetUsername error", "err", err)
+			response.WriteError(w, r, usernameError(err))
+			return
+		}
 
-	DB := db.DB
-	if DB == nil {
-		log.Println("database not initialized")
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
+		response.Message(w, http.StatusOK, "Username set successfully")
 	}
+}
 
-	verified, err := user_models.IsVerified(DB, body.Email)
-	if err != nil || !verified {
-		http.Error(w, "Email not verified", http.StatusBadRequest)
-		return
-	}
+// --- Fullname ---
+func SetFullnameHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
 
-	if err := user_models.SetUsername(DB, body.Email, body.Username); err != nil {
-		log.Println("SetUsername error:", err)
-		http.Error(w, fmt.Sprintf("Failed to set username: %s", err.Error()), http.StatusBadRequest)
-		return
-	}
+		type request struct {
+			Email    string `json:"email,omitempty"`
+			Fullname string `json:"fullname"`
+		}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Username set successfully")
-}
+		var body request
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || body.Fullname == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
 
-// --- Fullname ---
-func SetFullnameHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+		email, ok := authorizeOnboarding(a, w, r, body.Email)
+		if !ok {
+			return
+		}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+		if err := user_models.SetFullname(r.Context(), a.Store, email, body.Fullname); err != nil {
+			logging.FromContext(r.Context()).Error("SetFullname error", "err", err)
+			response.WriteError(w, r, response.Invalid("fullname", fmt.Sprintf("Failed to set fullname: %s", err.Error())))
+			return
+		}
 
-	type request struct {
-		Email    string `json:"email"`
-		Fullname string `json:"fullname"`
+		response.Message(w, http.StatusOK, "Fullname set successfully")
 	}
+}
 
-	var body request
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&body); err != nil || body.Email == "" || body.Fullname == "" {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+// Password
+func SetPasswordHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
 
-	if !isValidEmail(body.Email) {
-		http.Error(w, "Invalid email format", http.StatusBadRequest)
-		return
-	}
+		type request struct {
+			Email    string `json:"email,omitempty"`
+			Password string `json:"password"`
+		}
 
-	DB := db.DB
-	if DB == nil {
-		log.Println("database not initialized")
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		var body request
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || body.Password == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
 
-	verified, err := user_models.IsVerified(DB, body.Email)
-	if err != nil || !verified {
-		http.Error(w, "Email not verified", http.StatusBadRequest)
-		return
-	}
+		email, ok := authorizeOnboarding(a, w, r, body.Email)
+		if !ok {
+			return
+		}
 
-	if err := user_models.SetFullname(DB, body.Email, body.Fullname); err != nil {
-		log.Println("SetFullname error:", err)
-		http.Error(w, fmt.Sprintf("Failed to set fullname: %s", err.Error()), http.StatusBadRequest)
-		return
-	}
+		hasUID, err := user_models.HasUID(r.Context(), a.Store, email)
+		if err != nil {
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Fullname set successfully")
-}
+		check, err := user_models.SetPassword(r.Context(), a.Store, email, body.Password, a.Config.BreachPolicy())
+		if err != nil {
+			writePasswordError(w, r, check, err)
+			return
+		}
 
-// Password
-func SetPasswordHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+		if !hasUID {
+			for {
+				uid, err := uniqueid.Generate()
+				if err != nil {
+					response.WriteError(w, r, response.ErrInternal)
+					return
+				}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+				if err := auth_utils.ValidateUniqueID(uid); err != nil {
+					continue
+				}
 
-	type request struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+				exists, _ := user_models.UniqueIDExists(r.Context(), a.Store, uid)
+				if !exists {
+					if err := user_models.SetUniqueID(r.Context(), a.Store, email, uid); err != nil {
+						response.Fail(w, r, response.CodeInternal, "UID creation failed")
+						return
+					}
+					break
+				}
+			}
+		}
 
-	var body request
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&body); err != nil || body.Email == "" || body.Password == "" {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+		response.OK(w, map[string]interface{}{
+			"message":        "Password set and UID created",
+			"password_check": check,
+		})
 	}
+}
 
-	if !isValidEmail(body.Email) {
-		http.Error(w, "Invalid email format", http.StatusBadRequest)
-		return
+// usernameError maps a SetUsername error; anything that isn't a conflict is the username policy
+// rejecting it
+func usernameError(err error) *response.Error {
+	switch {
+	case errors.Is(err, user_models.ErrUsernameTaken):
+		return response.Errorf(response.CodeUsernameTaken, "Failed to set username: %s", err.Error())
+	case errors.Is(err, auth_utils.ErrUsernameReserved):
+		return response.Errorf(response.CodeUsernameReserved, "Failed to set username: %s", err.Error())
+	default:
+		return response.Invalid("username", fmt.Sprintf("Failed to set username: %s", err.Error()))
 	}
+}
 
-	DB := db.DB
-	if DB == nil {
-		http.Error(w, "Server error", http.StatusInternalServerError)
+// writePasswordError rejects a password; breached passwords include the strength estimate so the
+// client can explain why
+func writePasswordError(w http.ResponseWriter, r *http.Request, check user_models.PasswordCheck, err error) {
+	if errors.Is(err, user_models.ErrPasswordBreached) {
+		response.WriteError(w, r, response.NewError(response.CodePasswordBreached, err.Error()).
+			WithDetails(map[string]interface{}{"password_check": check}))
 		return
 	}
+	response.WriteError(w, r, response.Invalid("password", err.Error()))
+}
 
-	verified, err := user_models.IsVerified(DB, body.Email)
-	if err != nil || !verified {
-		http.Error(w, "Email not verified", http.StatusBadRequest)
-		return
+// OnboardingStateHandler reports which onboarding steps remain for the token's account
+func OnboardingStateHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, err := user_models.ValidateOnboardingToken(r.Header.Get("Authorization"))
+		if err != nil {
+			response.WriteError(w, r, errOnboardingToken)
+			return
+		}
+
+		state, err := user_models.GetOnboardingState(r.Context(), a.Store, email)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetOnboardingState error", "err", err)
+			response.Fail(w, r, response.CodeNotFound, "Account not found")
+			return
+		}
+
+		response.OK(w, state)
 	}
+}
 
-	hasUID, err := user_models.HasUID(DB, body.Email)
+// authorizeOnboarding resolves the account from the onboarding token in the Authorization header.
+// bodyEmail is still accepted from older clients but must match the token. Accounts that already
+// finished onboarding are refused; they change details through the authenticated endpoints.
+func authorizeOnboarding(a *app.App, w http.ResponseWriter, r *http.Request, bodyEmail string) (string, bool) {
+	email, err := user_models.ValidateOnboardingToken(r.Header.Get("Authorization"))
 	if err != nil {
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
+		response.WriteError(w, r, errOnboardingToken)
+		return "", false
 	}
 
-	if err := user_models.SetPassword(DB, body.Email, body.Password); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	if bodyEmail != "" && bodyEmail != email {
+		response.Fail(w, r, response.CodeForbidden, "Email does not match onboarding token")
+		return "", false
 	}
 
-	if !hasUID {
-		for {
-			uid, err := uniqueid.Generate()
-			if err != nil {
-				http.Error(w, "Server error", http.StatusInternalServerError)
-				return
-			}
-
-			if err := auth_utils.ValidateUniqueID(uid); err != nil {
-				continue
-			}
-
-			exists, _ := user_models.UniqueIDExists(DB, uid)
-			if !exists {
-				if err := user_models.SetUniqueID(DB, body.Email, uid); err != nil {
-					http.Error(w, "UID creation failed", http.StatusInternalServerError)
-					return
-				}
-				break
-			}
-		}
+	state, err := user_models.GetOnboardingState(r.Context(), a.Store, email)
+	if err != nil || !state.Verified {
+		response.Fail(w, r, response.CodeEmailNotVerified, "Email not verified")
+		return "", false
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Password set and UID created"))
-}
+	if state.Complete {
+		response.Fail(w, r, response.CodeOnboardingComplete, "Onboarding already completed")
+		return "", false
+	}
 
-// local email validation used across handlers
-func isValidEmail(e string) bool {
-	var re = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
-	return re.MatchString(e)
+	return email, true
 }
@@ -1,201 +1,214 @@
 package signup_controller
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"math/big"
 	"net/http"
-	"net/smtp"
-	"os"
 	"regexp"
 	"time"
 
-	"sraraa/db"
+	"sraraa/app"
+	"sraraa/mailer"
+	"sraraa/metrics"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	invite_controller "sraraa/reciever_src/controllers/auth/invites"
 	user_models "sraraa/reciever_src/models/user"
 )
 
-// Use the shared DB instance that main initializes (db.DB). Do not init DB at package load.
+// Use the shared DB instance that main initializes (a.DB). Do not init DB at package load.
 // SendOTPHandler sends OTP to email with cooldowns and limits
-func SendOTPHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+func SendOTPHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Limit body size to avoid abuse
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB
+
+		type requestBody struct {
+			Email      string `json:"email"`
+			InviteCode string `json:"invite_code"`
+		}
+		var body requestBody
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || body.Email == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
 
-	// Limit body size to avoid abuse
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB
+		// basic email validation
+		if !isValidEmail(body.Email) {
+			response.WriteError(w, r, response.Invalid("email", "Invalid email format"))
+			return
+		}
 
-	type requestBody struct {
-		Email string `json:"email"`
-	}
-	var body requestBody
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&body); err != nil || body.Email == "" {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+		// New emails need an invite (or join the waitlist) unless signup is open
+		if !invite_controller.EnforceSignupMode(a, w, r, body.Email, body.InviteCode) {
+			return
+		}
 
-	// basic email validation
-	if !isValidEmail(body.Email) {
-		http.Error(w, "Invalid email format", http.StatusBadRequest)
-		return
-	}
+		// Create user if not exists
+		if err := user_models.CreateUser(r.Context(), a.Store, body.Email); err != nil {
+			logging.FromContext(r.Context()).Error("CreateUser error", "err", err)
+			// continue, but return server error
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
 
-	DB := db.DB
-	if DB == nil {
-		log.Println("database not initialized")
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		// Check if already verified
+		verified, err := user_models.IsVerified(r.Context(), a.Store, body.Email)
+		if err != nil && !errors.Is(err, sqlErrNoRows()) {
+			logging.FromContext(r.Context()).Error("IsVerified error", "err", err)
+			response.Fail(w, r, response.CodeInternal, "Failed to check verification status")
+			return
+		}
+		// Verified accounts that never finished onboarding get a new code so they can obtain a
+		// fresh onboarding token; complete accounts should log in instead
+		if verified {
+			state, err := user_models.GetOnboardingState(r.Context(), a.Store, body.Email)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("GetOnboardingState error", "err", err)
+				response.WriteError(w, r, response.ErrInternal)
+				return
+			}
+			if state.Complete {
+				response.Message(w, http.StatusOK, "Email already verified")
+				return
+			}
+		}
 
-	// Create user if not exists
-	if err := user_models.CreateUser(DB, body.Email); err != nil {
-		log.Println("CreateUser error:", err)
-		// continue, but return server error
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		// Check cooldown
+		cooldown, err := user_models.GetCooldown(r.Context(), a.Store, body.Email)
+		if err == nil {
+			if a.Clock.Now().Before(cooldown) {
+				response.WriteError(w, r, response.RateLimited(fmt.Sprintf("Email is on cooldown until %s", cooldown.Format(time.RFC3339)), cooldown))
+				return
+			}
+		}
 
-	// Check if already verified
-	verified, err := user_models.IsVerified(DB, body.Email)
-	if err != nil && !errors.Is(err, sqlErrNoRows()) {
-		log.Println("IsVerified error:", err)
-		http.Error(w, "Failed to check verification status", http.StatusInternalServerError)
-		return
-	}
-	if verified {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"message":"Email already verified"}`))
-		return
-	}
+		// Check last request time for 1 minute rule
+		_, lastCreated, err := user_models.GetOTP(r.Context(), a.Store, body.Email)
+		if err == nil && a.Clock.Now().Sub(lastCreated) < 1*time.Minute {
+			response.WriteError(w, r, response.RateLimited("You can request a new OTP after 1 minute", lastCreated.Add(time.Minute)))
+			return
+		}
 
-	// Check cooldown
-	cooldown, err := user_models.GetCooldown(DB, body.Email)
-	if err == nil {
-		if time.Now().Before(cooldown) {
-			http.Error(w, fmt.Sprintf("Email is on cooldown until %s", cooldown.Format(time.RFC3339)), http.StatusTooManyRequests)
+		// Count requests in last hour
+		count, err := user_models.CountRequestsLastHour(r.Context(), a.Store, body.Email, a.Clock.Now())
+		if err == nil && count >= 7 {
+			// set 6-hour cooldown
+			until := a.Clock.Now().Add(6 * time.Hour)
+			_ = user_models.SetCooldown(r.Context(), a.Store, body.Email, until)
+			response.WriteError(w, r, response.RateLimited("Too many OTP requests, cooldown 6 hours applied", until))
 			return
 		}
-	}
 
-	// Check last request time for 1 minute rule
-	_, lastCreated, err := user_models.GetOTP(DB, body.Email)
-	if err == nil && time.Since(lastCreated) < 1*time.Minute {
-		http.Error(w, "You can request a new OTP after 1 minute", http.StatusTooManyRequests)
-		return
-	}
+		otp, genErr := generateOTP()
+		if genErr != nil {
+			logging.FromContext(r.Context()).Error("OTP generation failed", "err", genErr)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
 
-	// Count requests in last hour
-	count, err := user_models.CountRequestsLastHour(DB, body.Email)
-	if err == nil && count >= 7 {
-		// set 6-hour cooldown
-		_ = user_models.SetCooldown(DB, body.Email, time.Now().Add(6*time.Hour))
-		http.Error(w, "Too many OTP requests, cooldown 6 hours applied", http.StatusTooManyRequests)
-		return
-	}
+		// Save OTP (handle error)
+		if err := user_models.SaveOTP(r.Context(), a.Store, body.Email, otp); err != nil {
+			logging.FromContext(r.Context()).Error("SaveOTP error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
 
-	otp, genErr := generateOTP()
-	if genErr != nil {
-		log.Println("OTP generation failed:", genErr)
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		// Track request
+		if err := user_models.AddOTPRequest(r.Context(), a.Store, body.Email); err != nil {
+			logging.FromContext(r.Context()).Error("AddOTPRequest error", "err", err)
+			// continue; not fatal for user
+		}
 
-	// Save OTP (handle error)
-	if err := user_models.SaveOTP(DB, body.Email, otp); err != nil {
-		log.Println("SaveOTP error:", err)
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		a.Metrics.OTPIssued(metrics.PurposeSignup)
 
-	// Track request
-	if err := user_models.AddOTPRequest(DB, body.Email); err != nil {
-		log.Println("AddOTPRequest error:", err)
-		// continue; not fatal for user
-	}
+		// Send email. In development if SMTP env not set, skip sending and log.
+		if err := sendEmail(r.Context(), a.Mailer, body.Email, otp); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to send email", "err", err)
+			// For dev we do not fail hard on email send; return success but log.
+			// If you want to enforce sending even in dev, return an error here.
+		}
 
-	// Send email. In development if SMTP env not set, skip sending and log.
-	if err := sendEmail(body.Email, otp); err != nil {
-		log.Println("Failed to send email:", err)
-		// For dev we do not fail hard on email send; return success but log.
-		// If you want to enforce sending even in dev, return an error here.
+		response.Message(w, http.StatusOK, fmt.Sprintf("OTP sent to %s", body.Email))
 	}
-
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "OTP sent to %s", body.Email)
 }
 
 // VerifyOTPHandler verifies OTP and marks user as verified
-func VerifyOTPHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Limit body size
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+func VerifyOTPHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Limit body size
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		type requestBody struct {
+			Email string `json:"email"`
+			OTP   string `json:"otp"`
+		}
+		var body requestBody
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || body.Email == "" || body.OTP == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
 
-	type requestBody struct {
-		Email string `json:"email"`
-		OTP   string `json:"otp"`
-	}
-	var body requestBody
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&body); err != nil || body.Email == "" || body.OTP == "" {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+		if !isValidEmail(body.Email) {
+			response.WriteError(w, r, response.Invalid("email", "Invalid email format"))
+			return
+		}
 
-	if !isValidEmail(body.Email) {
-		http.Error(w, "Invalid email format", http.StatusBadRequest)
-		return
-	}
+		code, created, err := user_models.GetOTP(r.Context(), a.Store, body.Email)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetOTP error", "err", err)
+			a.Metrics.OTPFailed(metrics.PurposeSignup)
+			response.Fail(w, r, response.CodeOTPInvalid, "OTP not found")
+			return
+		}
 
-	DB := db.DB
-	if DB == nil {
-		log.Println("database not initialized")
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		if a.Clock.Now().Sub(created) > 10*time.Minute {
+			_ = user_models.DeleteOTP(r.Context(), a.Store, body.Email)
+			a.Metrics.OTPFailed(metrics.PurposeSignup)
+			response.Fail(w, r, response.CodeOTPExpired, "OTP expired")
+			return
+		}
 
-	code, created, err := user_models.GetOTP(DB, body.Email)
-	if err != nil {
-		log.Println("GetOTP error:", err)
-		http.Error(w, "OTP not found", http.StatusNotFound)
-		return
-	}
+		if code != body.OTP {
+			a.Metrics.OTPFailed(metrics.PurposeSignup)
+			response.Fail(w, r, response.CodeOTPInvalid, "Invalid OTP")
+			return
+		}
+		a.Metrics.OTPVerified(metrics.PurposeSignup)
 
-	if time.Since(created) > 10*time.Minute {
-		_ = user_models.DeleteOTP(DB, body.Email)
-		http.Error(w, "OTP expired", http.StatusBadRequest)
-		return
-	}
+		// Mark user verified
+		if err := user_models.MarkVerified(r.Context(), a.Store, body.Email); err != nil {
+			logging.FromContext(r.Context()).Error("MarkVerified error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
 
-	if code != body.OTP {
-		http.Error(w, "Invalid OTP", http.StatusUnauthorized)
-		return
-	}
+		// Delete OTP immediately (no background goroutines)
+		if err := user_models.DeleteOTP(r.Context(), a.Store, body.Email); err != nil {
+			logging.FromContext(r.Context()).Error("DeleteOTP error", "err", err)
+		}
 
-	// Mark user verified
-	if err := user_models.MarkVerified(DB, body.Email); err != nil {
-		log.Println("MarkVerified error:", err)
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
+		// The onboarding endpoints only accept this token, never a bare email
+		onboardingToken, err := user_models.CreateOnboardingToken(body.Email, a.Config.OnboardingTokenTTL)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("CreateOnboardingToken error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
 
-	// Delete OTP immediately (no background goroutines)
-	if err := user_models.DeleteOTP(DB, body.Email); err != nil {
-		log.Println("DeleteOTP error:", err)
+		response.OK(w, map[string]string{
+			"message":          "OTP verified successfully",
+			"onboarding_token": onboardingToken,
+		})
 	}
-
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "OTP verified successfully")
 }
 
 // generateOTP generates a 6-digit code using crypto/rand
@@ -208,29 +221,14 @@ func generateOTP() (string, error) {
 	return fmt.Sprintf("%06d", n.Int64()), nil
 }
 
-// sendEmail sends OTP email. In development (no SMTP env) it will be skipped.
-func sendEmail(to, otp string) error {
-	host := os.Getenv("SMTP_HOST")
-	port := os.Getenv("SMTP_PORT")
-	from := os.Getenv("FROM_EMAIL")
-	password := os.Getenv("SMTP_PASSWORD")
-
-	// If SMTP not configured, assume development and skip sending
-	if host == "" || port == "" || from == "" || password == "" {
-		log.Printf("SMTP not configured; skipping send to %s. OTP: %s\n", to, otp)
+// sendEmail sends OTP email. In development (no SMTP settings) it will be skipped.
+func sendEmail(ctx context.Context, m mailer.Mailer, to, otp string) error {
+	err := m.Send(ctx, to, "Your OTP Code", fmt.Sprintf("Your 6-digit OTP code is: %s\r\n", otp))
+	if errors.Is(err, mailer.ErrNotConfigured) {
+		logging.FromContext(ctx).Info("SMTP not configured; skipping OTP email", "email", to)
 		return nil
 	}
-
-	auth := smtp.PlainAuth("", from, password, host)
-	msg := []byte(fmt.Sprintf(
-		"To: %s\r\n"+
-			"Subject: Your OTP Code\r\n"+
-			"\r\n"+
-			"Your 6-digit OTP code is: %s\r\n", to, otp))
-
-	addr := fmt.Sprintf("%s:%s", host, port)
-	// smtp.SendMail will block; keep it but return any error
-	return smtp.SendMail(addr, auth, from, []string{to}, msg)
+	return err
 }
 
 // simple email regex (not perfect but good enough for dev)
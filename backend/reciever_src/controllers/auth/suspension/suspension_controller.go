@@ -0,0 +1,83 @@
+package suspension_controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"sraraa/app"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/session_auth"
+	user_models "sraraa/reciever_src/models/user"
+)
+
+// SuspendUserHandler suspends or reinstates an account. Body: {"uid": "...", "suspended": true}.
+// Suspending signs the user out everywhere, revokes their access tokens and hides their profile.
+func SuspendUserHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		admin, ok := session_auth.RequireAdmin(a, w, r)
+		if !ok {
+			return
+		}
+
+		type requestBody struct {
+			UID       string `json:"uid"`
+			Suspended *bool  `json:"suspended"`
+		}
+		var body requestBody
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || body.UID == "" || body.Suspended == nil {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+		if body.UID == admin.UID {
+			response.WriteError(w, r, response.Invalid("uid", "Cannot suspend yourself"))
+			return
+		}
+
+		role, err := user_models.GetRoleByUID(r.Context(), a.Store, body.UID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.Fail(w, r, response.CodeNotFound, "User not found")
+				return
+			}
+			logging.FromContext(r.Context()).Error("GetRoleByUID error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+		if role == "admin" {
+			response.Fail(w, r, response.CodeForbidden, "Admins cannot be suspended")
+			return
+		}
+
+		if err := user_models.SetSuspended(r.Context(), a.Store, body.UID, *body.Suspended); err != nil {
+			logging.FromContext(r.Context()).Error("SetSuspended error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		if *body.Suspended {
+			if err := user_models.DeleteAllSessionsByUID(r.Context(), a.Store, body.UID); err != nil {
+				logging.FromContext(r.Context()).Error("DeleteAllSessionsByUID error", "err", err)
+			} else {
+				a.Metrics.SessionsRevoked("suspension")
+			}
+			if err := user_models.RevokeAllAccessTokens(a.DB, body.UID); err != nil {
+				logging.FromContext(r.Context()).Error("RevokeAllAccessTokens error", "err", err)
+			}
+			logging.FromContext(r.Context()).Info("Admin suspended a user", "target_uid", body.UID)
+		} else {
+			logging.FromContext(r.Context()).Info("Admin reinstated a user", "target_uid", body.UID)
+		}
+
+		response.OK(w, map[string]interface{}{
+			"uid":       body.UID,
+			"suspended": *body.Suspended,
+		})
+	}
+}
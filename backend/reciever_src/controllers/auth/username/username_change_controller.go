@@ -0,0 +1,240 @@
+package username_change_controller
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sraraa/app"
+	"sraraa/config"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/pkg/tracing"
+	"sraraa/reciever_src/controllers/auth/session_auth"
+	user_models "sraraa/reciever_src/models/user"
+	auth_utils "sraraa/reciever_src/utils/auth"
+)
+
+const cdnRenamePath = "/api/internal/users/rename"
+
+// ChangeUsernameHandler renames the authenticated user. The response carries a fresh session
+// token because every existing token still has the old username in its claims.
+func ChangeUsernameHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		claims, ok := session_auth.Authenticate(a, w, r)
+		if !ok {
+			return
+		}
+
+		type request struct {
+			Username string `json:"username"`
+		}
+		var body request
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil || body.Username == "" {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+
+		change, err := user_models.ChangeUsername(r.Context(), a.DB, claims.UID, body.Username,
+			a.Config.UsernameChangeCooldown, a.Config.UsernameQuarantine, a.Clock.Now())
+		if err != nil {
+			var cooldownErr *user_models.UsernameCooldownError
+			switch {
+			case errors.As(err, &cooldownErr):
+				response.WriteError(w, r, response.RateLimited(err.Error(), cooldownErr.Until))
+			case errors.Is(err, user_models.ErrUsernameTaken):
+				response.Fail(w, r, response.CodeUsernameTaken, err.Error())
+			case errors.Is(err, auth_utils.ErrUsernameReserved):
+				response.Fail(w, r, response.CodeUsernameReserved, err.Error())
+			case errors.Is(err, user_models.ErrUserNotFound):
+				response.Fail(w, r, response.CodeNotFound, err.Error())
+			default:
+				response.WriteError(w, r, response.Invalid("username", fmt.Sprintf("Failed to change username: %s", err.Error())))
+			}
+			return
+		}
+
+		// Files stay reachable under the old path until the CDN moves them. ChangeUsername queued
+		// the move with the rename, so one the CDN can't do now is retried by the cdn_renames job.
+		filesMoved, err := moveFilesOnCDN(r.Context(), a, change.UID)
+		if err != nil {
+			logging.FromContext(r.Context()).Warn("CDN rename failed, queued for retry", "err", err)
+		}
+
+		if err := user_models.DeleteAllSessionsByUID(r.Context(), a.Store, change.UID); err != nil {
+			logging.FromContext(r.Context()).Error("DeleteAllSessionsByUID error", "err", err)
+		} else {
+			a.Metrics.SessionsRevoked("username_change")
+		}
+
+		token, err := user_models.CreateSession(r.Context(), a.Store, claims.UserID, 7*24*time.Hour, r.UserAgent(), r.RemoteAddr)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("CreateSession error", "err", err)
+			response.Fail(w, r, response.CodeInternal, "Username changed, please log in again")
+			return
+		}
+		a.Metrics.SessionCreated("username_change")
+
+		result := map[string]interface{}{
+			"message":       "Username changed successfully",
+			"username":      change.NewUsername,
+			"old_username":  change.OldUsername,
+			"held_until":    change.HeldUntil,
+			"session_token": token,
+			"files_pending": !filesMoved,
+		}
+		if !filesMoved {
+			result["warning"] = "Your images could not be moved to the new username yet and keep their old links until they are"
+		}
+		response.OK(w, result)
+	}
+}
+
+// UsernameHistoryHandler lists the authenticated user's previous usernames
+func UsernameHistoryHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := session_auth.AuthenticateScope(a, w, r, user_models.ScopeProfileRead)
+		if !ok {
+			return
+		}
+
+		history, err := user_models.GetUsernameHistory(a.DB, claims.UID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetUsernameHistory error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.OK(w, map[string]interface{}{"history": history})
+	}
+}
+
+// ResolveUsernameHandler maps a current or old username to the account's current username
+func ResolveUsernameHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := r.URL.Query().Get("username")
+		if username == "" {
+			response.Fail(w, r, response.CodeInvalidRequest, "Missing username")
+			return
+		}
+
+		uid, current, redirected, err := user_models.ResolveUsername(a.DB, username)
+		if err != nil {
+			if errors.Is(err, user_models.ErrUserNotFound) {
+				response.WriteError(w, r, response.ErrNotFound)
+				return
+			}
+			logging.FromContext(r.Context()).Error("ResolveUsername error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.OK(w, map[string]interface{}{
+			"uid":        uid,
+			"username":   current,
+			"redirected": redirected,
+		})
+	}
+}
+
+// retryBatch caps the renames one RetryCDNRenames run works through
+const retryBatch = 100
+
+// RetryCDNRenames tries the renames the CDN has not applied yet and returns how many went
+// through. The maintenance scheduler runs it.
+func RetryCDNRenames(ctx context.Context, a *app.App) (int64, error) {
+	pending, err := a.Store.CDNRenames.List(ctx, retryBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	var done int64
+	var failed int
+	var lastErr error
+	for _, rn := range pending {
+		moved, err := moveFilesOnCDN(ctx, a, rn.UID)
+		if err != nil {
+			failed++
+			lastErr = err
+			continue
+		}
+		if moved {
+			done++
+		}
+	}
+	if lastErr != nil {
+		return done, fmt.Errorf("%d of %d renames failed, last: %w", failed, len(pending), lastErr)
+	}
+	return done, nil
+}
+
+// moveFilesOnCDN asks the CDN to move uid's files for their pending rename, then points the
+// stored image URLs at the new path. It reports whether the files are now where the current
+// username says; on failure the rename stays queued.
+func moveFilesOnCDN(ctx context.Context, a *app.App, uid string) (bool, error) {
+	rn, err := a.Store.CDNRenames.Get(ctx, uid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := renameOnCDN(ctx, a.Config, rn.UID, rn.OldUsername, rn.NewUsername); err != nil {
+		if ferr := a.Store.CDNRenames.Failed(ctx, rn.UID, err.Error(), a.Clock.Now()); ferr != nil {
+			logging.FromContext(ctx).Error("Record CDN rename failure error", "err", ferr)
+		}
+		return false, err
+	}
+
+	oldPath := "/media/" + rn.UID + "/" + rn.OldUsername + "/"
+	newPath := "/media/" + rn.UID + "/" + rn.NewUsername + "/"
+	if err := user_models.ReplaceImageURLPaths(a.DB, rn.UID, oldPath, newPath); err != nil {
+		return false, err
+	}
+	if err := a.Store.CDNRenames.Moved(ctx, rn.UID, rn.NewUsername); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// renameOnCDN asks the CDN to move the user's stored files to the new username path
+func renameOnCDN(ctx context.Context, cfg *config.Config, uid, oldUsername, newUsername string) error {
+	payload, err := json.Marshal(map[string]string{
+		"uid":          uid,
+		"old_username": oldUsername,
+		"new_username": newUsername,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.CDNURL+cdnRenamePath, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Token", cfg.CDNInternalToken)
+	req.Header.Set(logging.RequestIDHeader, logging.IDFromContext(ctx))
+
+	client := &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(nil)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cdn responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
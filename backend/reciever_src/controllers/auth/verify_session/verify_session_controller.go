@@ -1,45 +1,45 @@
 package verify_session_controller
 
 import (
-	"encoding/json"
 	"net/http"
-	"sraraa/db"
+	"sraraa/app"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/session_auth"
 	user_models "sraraa/reciever_src/models/user"
 )
 
 // VerifySessionHandler checks if the session token from frontend is valid
-func VerifySessionHandler(w http.ResponseWriter, r *http.Request) {
-	// token from frontend IndexedDB should be sent in Authorization header
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		http.Error(w, "No session token provided", http.StatusBadRequest)
-		return
-	}
+func VerifySessionHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// token from frontend IndexedDB should be sent in Authorization header
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			response.WriteError(w, r, response.ErrNoToken)
+			return
+		}
 
-	// validate JWT token
-	claims, err := user_models.ValidateSessionToken(token)
-	if err != nil {
-		http.Error(w, "Invalid or expired session token", http.StatusUnauthorized)
-		return
-	}
+		// validate JWT token and make sure the session exists; personal access tokens need profile:read
+		claims, err := session_auth.AuthenticateToken(r.Context(), a, token, user_models.ScopeProfileRead)
+		if err != nil {
+			response.WriteError(w, r, session_auth.AuthError(err))
+			return
+		}
 
-	// check DB to make sure session exists
-	DB := db.DB
-	var exists bool
-	err = DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM sessions WHERE session_token=?)`, token).Scan(&exists)
-	if err != nil || !exists {
-		http.Error(w, "Session not found", http.StatusUnauthorized)
-		return
+		// success: return user info including UID
+		resp := map[string]interface{}{
+			"user_id":  claims.UserID,
+			"email":    claims.Email,
+			"username": claims.Username,
+			"fullname": claims.Fullname,
+			"verified": claims.Verified,
+			"uid":      claims.UID, // ✅ Added UID to response
+		}
+		if claims.AccessTokenID != 0 {
+			resp["scopes"] = claims.Scopes
+		}
+		if impersonator := claims.ImpersonatorUID(); impersonator != "" {
+			resp["impersonated_by"] = impersonator
+		}
+		response.OK(w, resp)
 	}
-
-	// success: return user info including UID
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"user_id":  claims.UserID,
-		"email":    claims.Email,
-		"username": claims.Username,
-		"fullname": claims.Fullname,
-		"verified": claims.Verified,
-		"uid":      claims.UID, // ✅ Added UID to response
-	})
 }
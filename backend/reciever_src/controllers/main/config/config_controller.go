@@ -0,0 +1,29 @@
+package config_controller
+
+import (
+	"net/http"
+
+	"sraraa/app"
+	"sraraa/config"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/session_auth"
+)
+
+// ConfigDumpHandler shows admins the settings the API is running with and where each value came
+// from. Secrets are redacted.
+func ConfigDumpHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := session_auth.RequireAdmin(a, w, r); !ok {
+			return
+		}
+
+		snapshot := config.Snapshot()
+		if snapshot == nil {
+			response.Fail(w, r, response.CodeUnavailable, "Configuration not loaded")
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		response.OK(w, snapshot)
+	}
+}
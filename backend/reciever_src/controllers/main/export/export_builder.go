@@ -0,0 +1,288 @@
+package export_controller
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"sraraa/app"
+	"sraraa/pkg/tracing"
+	user_models "sraraa/reciever_src/models/user"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	maxImageDownload      = 20 << 20
+	manifestFormatVersion = 1
+)
+
+// At most two archives are built at a time; further jobs wait their turn
+var buildSlots = make(chan struct{}, 2)
+
+// imageClient fetches the user's images from the CDN, each fetch a span of the export build
+var imageClient = &http.Client{Timeout: 15 * time.Second, Transport: tracing.Transport(nil)}
+
+type manifestFile struct {
+	Path        string `json:"path"`
+	Description string `json:"description"`
+	SizeBytes   int64  `json:"size_bytes"`
+	SHA256      string `json:"sha256"`
+}
+
+type missingFile struct {
+	Path  string `json:"path"`
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+type manifest struct {
+	FormatVersion int            `json:"format_version"`
+	ExportID      string         `json:"export_id"`
+	UID           string         `json:"uid"`
+	GeneratedAt   time.Time      `json:"generated_at"`
+	Files         []manifestFile `json:"files"`
+	MissingFiles  []missingFile  `json:"missing_files,omitempty"`
+}
+
+// StartExport builds the archive for a queued export in the background. A build stopped by
+// shutdown, or still waiting for a slot, stays pending or running and is resumed on the next
+// start.
+func StartExport(a *app.App, exportID string) {
+	a.Workers.Go("export", func(ctx context.Context) {
+		select {
+		case buildSlots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		defer func() { <-buildSlots }()
+
+		// The build is its own trace, with the CDN image fetches under it
+		buildCtx, span := tracing.Start(ctx, "export.build", attribute.String("export.id", exportID))
+		err := buildExport(buildCtx, a, exportID)
+		tracing.End(span, err)
+		if err != nil && ctx.Err() != nil {
+			slog.Info("Data export interrupted by shutdown", "export_id", exportID)
+			return
+		}
+		if err != nil {
+			slog.Error("Data export failed", "export_id", exportID, "err", err)
+			if err := user_models.MarkExportFailed(a.DB, exportID, "Export could not be built, please try again later"); err != nil {
+				slog.Error("MarkExportFailed error", "err", err)
+			}
+		}
+	})
+}
+
+// ResumeUnfinishedExports restarts jobs that were pending or running when the server stopped
+func ResumeUnfinishedExports(a *app.App) {
+	exports, err := user_models.GetUnfinishedExports(a.DB)
+	if err != nil {
+		slog.Error("GetUnfinishedExports error", "err", err)
+		return
+	}
+	for _, e := range exports {
+		slog.Info("Resuming data export", "export_id", e.ID)
+		StartExport(a, e.ID)
+	}
+}
+
+// DeleteExpiredExports removes archives past their expiry and reports how many went. An archive
+// that can't be removed is logged and left for the next run.
+func DeleteExpiredExports(ctx context.Context, a *app.App) (int64, error) {
+	exports, err := user_models.GetExpiredExports(a.DB)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, e := range exports {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+		if err := os.Remove(e.FilePath); err != nil && !os.IsNotExist(err) {
+			slog.Error("Failed to remove export archive", "path", e.FilePath, "err", err)
+			continue
+		}
+		if err := user_models.MarkExportExpired(a.DB, e.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func buildExport(ctx context.Context, a *app.App, exportID string) error {
+	if err := user_models.MarkExportRunning(a.DB, exportID); err != nil {
+		return err
+	}
+
+	export, err := user_models.GetExport(a.DB, exportID)
+	if err != nil {
+		return err
+	}
+
+	data, err := user_models.CollectUserData(a.DB, export.UID)
+	if err != nil {
+		return fmt.Errorf("collect user data: %w", err)
+	}
+
+	dir := a.Config.ExportsDir
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	finalPath := filepath.Join(dir, exportID+".zip")
+	tmpPath := finalPath + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	if err := writeArchive(ctx, f, export, data, a.Clock.Now()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(finalPath)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Data export ready", "export_id", exportID, "size_bytes", info.Size())
+	return user_models.MarkExportReady(a.DB, exportID, finalPath, info.Size(), a.Clock.Now().Add(a.Config.ExportRetention))
+}
+
+func writeArchive(ctx context.Context, w io.Writer, export *user_models.DataExport, data *user_models.UserData, generatedAt time.Time) error {
+	zw := zip.NewWriter(w)
+
+	m := manifest{
+		FormatVersion: manifestFormatVersion,
+		ExportID:      export.ID,
+		UID:           export.UID,
+		GeneratedAt:   generatedAt.UTC(),
+		Files:         []manifestFile{},
+	}
+
+	sections := []struct {
+		path        string
+		description string
+		value       interface{}
+	}{
+		{"account.json", "Your account record (password excluded)", data.Account},
+		{"sessions.json", "Sessions, including ones opened by support staff (tokens excluded)", data.Sessions},
+		{"auth_events.json", "Sign-in, signup and password reset requests, username changes, access tokens, invites and support access", data.AuthEvents},
+		{"images.json", "Metadata of your uploaded images", data.Images},
+	}
+	for _, s := range sections {
+		b, err := json.MarshalIndent(s.value, "", "  ")
+		if err != nil {
+			return err
+		}
+		entry, err := writeZipEntry(zw, s.path, s.description, b)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, entry)
+	}
+
+	for _, img := range data.Images {
+		imageType, _ := img["type"].(string)
+		url, _ := img["image_url"].(string)
+		name := "images/" + imageType + path.Ext(url)
+
+		b, err := fetchImage(ctx, url)
+		if ctx.Err() != nil {
+			// not a missing image: the archive would be incomplete
+			return ctx.Err()
+		}
+		if err != nil {
+			m.MissingFiles = append(m.MissingFiles, missingFile{Path: name, URL: url, Error: err.Error()})
+			continue
+		}
+		entry, err := writeZipEntry(zw, name, "Uploaded "+imageType+" image", b)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, entry)
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	fw, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(b); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func writeZipEntry(zw *zip.Writer, name, description string, b []byte) (manifestFile, error) {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return manifestFile{}, err
+	}
+	if _, err := fw.Write(b); err != nil {
+		return manifestFile{}, err
+	}
+
+	sum := sha256.Sum256(b)
+	return manifestFile{
+		Path:        name,
+		Description: description,
+		SizeBytes:   int64(len(b)),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// fetchImage downloads an image from the CDN
+func fetchImage(ctx context.Context, url string) ([]byte, error) {
+	if url == "" {
+		return nil, fmt.Errorf("no url stored")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := imageClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CDN returned %d", resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxImageDownload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxImageDownload {
+		return nil, fmt.Errorf("image larger than %d bytes", maxImageDownload)
+	}
+	return b, nil
+}
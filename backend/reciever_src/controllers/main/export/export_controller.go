@@ -0,0 +1,160 @@
+package export_controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"sraraa/app"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/session_auth"
+	user_models "sraraa/reciever_src/models/user"
+)
+
+// RequestExportHandler queues a data export. Only interactive sessions may export: access tokens
+// and impersonation sessions are refused.
+func RequestExportHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := session_auth.Authenticate(a, w, r)
+		if !ok {
+			return
+		}
+
+		latest, err := user_models.GetLatestExport(a.DB, claims.UID)
+		if err != nil && !errors.Is(err, user_models.ErrExportNotFound) {
+			logging.FromContext(r.Context()).Error("GetLatestExport error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		if latest != nil {
+			switch latest.Status {
+			case user_models.ExportStatusPending, user_models.ExportStatusRunning:
+				response.Fail(w, r, response.CodeConflict, "An export is already in progress")
+				return
+			case user_models.ExportStatusFailed:
+				// Failed jobs don't count towards the cooldown
+			default:
+				if wait := latest.CreatedAt.Add(a.Config.ExportCooldown).Sub(a.Clock.Now()); wait > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+					response.WriteError(w, r, response.RateLimited("An export was requested recently, please try again later", a.Clock.Now().Add(wait)))
+					return
+				}
+			}
+		}
+
+		export, err := user_models.CreateExport(a.DB, claims.UID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("CreateExport error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		StartExport(a, export.ID)
+
+		response.JSON(w, http.StatusAccepted, export)
+	}
+}
+
+// ExportStatusHandler reports the caller's latest export, with a fresh download link when it is
+// ready
+func ExportStatusHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := session_auth.Authenticate(a, w, r)
+		if !ok {
+			return
+		}
+
+		export, err := user_models.GetLatestExport(a.DB, claims.UID)
+		if errors.Is(err, user_models.ErrExportNotFound) {
+			response.Fail(w, r, response.CodeNotFound, "No export requested")
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetLatestExport error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		resp := map[string]interface{}{"export": export}
+
+		// Each status check hands out a fresh link, never outliving the archive itself
+		if export.Status == user_models.ExportStatusReady && export.ExpiresAt != nil && a.Clock.Now().Before(*export.ExpiresAt) {
+			linkExpires := a.Clock.Now().Add(a.Config.ExportLinkTTL)
+			if export.ExpiresAt.Before(linkExpires) {
+				linkExpires = *export.ExpiresAt
+			}
+
+			token, err := user_models.CreateExportDownloadToken(export.ID, claims.UID, linkExpires)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("CreateExportDownloadToken error", "err", err)
+				response.WriteError(w, r, response.ErrInternal)
+				return
+			}
+
+			resp["download_url"] = "/api/v1/user/export/download?token=" + url.QueryEscape(token)
+			resp["download_expires_at"] = linkExpires.UTC()
+		}
+
+		response.OK(w, resp)
+	}
+}
+
+// DownloadExportHandler serves an export archive. The link token is the only credential so the
+// link can be opened directly in a browser.
+func DownloadExportHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			response.Fail(w, r, response.CodeInvalidRequest, "Missing token")
+			return
+		}
+
+		exportID, uid, err := user_models.ValidateExportDownloadToken(token)
+		if err != nil {
+			response.Fail(w, r, response.CodeLinkInvalid, "Invalid or expired download link")
+			return
+		}
+
+		export, err := user_models.GetExport(a.DB, exportID)
+		if errors.Is(err, user_models.ErrExportNotFound) || (err == nil && export.UID != uid) {
+			response.Fail(w, r, response.CodeNotFound, "Export not found")
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetExport error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		if export.Status != user_models.ExportStatusReady || export.ExpiresAt == nil || a.Clock.Now().After(*export.ExpiresAt) {
+			response.Fail(w, r, response.CodeGone, "Export is no longer available")
+			return
+		}
+
+		f, err := os.Open(export.FilePath)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Open export archive error", "err", err)
+			response.Fail(w, r, response.CodeGone, "Export is no longer available")
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Stat export archive error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		filename := fmt.Sprintf("sraraa-export-%s.zip", export.CreatedAt.UTC().Format("2006-01-02"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.Header().Set("Cache-Control", "no-store")
+		http.ServeContent(w, r, filename, info.ModTime(), f)
+	}
+}
@@ -0,0 +1,69 @@
+package maintenance_controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"sraraa/app"
+	"sraraa/maintenance"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/session_auth"
+)
+
+// ListJobsHandler reports every maintenance job with its schedule and last run
+func ListJobsHandler(a *app.App, s *maintenance.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := session_auth.RequireAdmin(a, w, r); !ok {
+			return
+		}
+
+		jobs, err := s.Status(r.Context())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Maintenance status error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.OK(w, map[string]interface{}{"jobs": jobs})
+	}
+}
+
+// RunJobHandler runs the job named in the path now and answers with its result once it is
+// done. A job already running, here or on another instance, gets 409.
+func RunJobHandler(a *app.App, s *maintenance.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin, ok := session_auth.RequireAdmin(a, w, r)
+		if !ok {
+			return
+		}
+
+		name := r.PathValue("name")
+		logger := logging.FromContext(r.Context())
+		logger.Info("Admin started a maintenance job", "job", name, "admin_uid", admin.UID)
+
+		// The run is recorded and its lock held either way, so don't stop it halfway when the
+		// admin's connection drops
+		result, err := s.Run(context.WithoutCancel(r.Context()), name)
+		switch {
+		case errors.Is(err, maintenance.ErrUnknownJob):
+			response.Fail(w, r, response.CodeNotFound, "Unknown job")
+			return
+		case errors.Is(err, maintenance.ErrLocked):
+			response.Fail(w, r, response.CodeConflict, "Job is already running")
+			return
+		case err != nil && result.Status == "":
+			logger.Error("Maintenance job error", "job", name, "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		if result.Status == maintenance.StatusFailed {
+			logger.Error("Maintenance job failed", "job", name, "err", err)
+			response.WriteError(w, r, response.NewError(response.CodeInternal, "Job failed").WithDetails(result))
+			return
+		}
+		response.OK(w, result)
+	}
+}
@@ -0,0 +1,303 @@
+package profile_controller
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"sraraa/app"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/session_auth"
+	user_models "sraraa/reciever_src/models/user"
+	auth_utils "sraraa/reciever_src/utils/auth"
+)
+
+// maxBatchLookup caps uids plus usernames per request
+const maxBatchLookup = 250
+
+// BatchLookupHandler returns profile cards for up to maxBatchLookup uids and usernames in one
+// call. Cards come back in request order, uids first; anything not found, including profiles
+// the caller may not see under their owner's privacy settings, is listed in not_found so the
+// client can render a placeholder.
+func BatchLookupHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		claims, ok := session_auth.AuthenticateScope(a, w, r, user_models.ScopeProfileRead)
+		if !ok {
+			return
+		}
+
+		type requestBody struct {
+			UIDs      []string `json:"uids"`
+			Usernames []string `json:"usernames"`
+		}
+		var body requestBody
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+
+		uids := dedupe(body.UIDs, func(s string) string { return strings.TrimSpace(s) })
+		usernames := dedupe(body.Usernames, auth_utils.CanonicalUsername)
+		if len(uids)+len(usernames) == 0 {
+			response.Fail(w, r, response.CodeInvalidRequest, "uids or usernames are required")
+			return
+		}
+		if len(uids)+len(usernames) > maxBatchLookup {
+			response.Fail(w, r, response.CodeInvalidRequest, "Too many users requested, the limit is 250")
+			return
+		}
+
+		canonical := make([]string, len(usernames))
+		for i, u := range usernames {
+			canonical[i] = u.key
+		}
+		ids := make([]string, len(uids))
+		for i, u := range uids {
+			ids[i] = u.key
+		}
+
+		cards, err := user_models.GetProfileCards(a.DB, claims.UID, ids, canonical)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetProfileCards error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		byUID := make(map[string]user_models.ProfileCard, len(cards))
+		byUsername := make(map[string]user_models.ProfileCard, len(cards))
+		for _, c := range cards {
+			byUID[c.UID] = c
+			byUsername[auth_utils.CanonicalUsername(c.Username)] = c
+		}
+
+		result := []user_models.ProfileCard{}
+		notFound := []string{}
+		returned := map[string]bool{}
+		add := func(c user_models.ProfileCard, ok bool, requested string) {
+			if !ok {
+				notFound = append(notFound, requested)
+				return
+			}
+			if !returned[c.UID] {
+				returned[c.UID] = true
+				result = append(result, c)
+			}
+		}
+		for _, u := range uids {
+			c, ok := byUID[u.key]
+			add(c, ok, u.raw)
+		}
+		for _, u := range usernames {
+			c, ok := byUsername[u.key]
+			add(c, ok, u.raw)
+		}
+
+		response.OK(w, map[string]interface{}{
+			"users":     result,
+			"not_found": notFound,
+		})
+	}
+}
+
+type lookupKey struct {
+	raw string
+	key string
+}
+
+// dedupe normalizes values with keyFn, dropping empty and repeated keys but keeping order
+func dedupe(values []string, keyFn func(string) string) []lookupKey {
+	seen := map[string]bool{}
+	out := []lookupKey{}
+	for _, v := range values {
+		key := keyFn(v)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, lookupKey{raw: v, key: key})
+	}
+	return out
+}
+
+// PublicProfileHandler serves GET /api/v1/profiles/{username}. Unknown, unverified and suspended
+// accounts all get the same 404, as do profiles the viewer may not see under the owner's privacy
+// settings. A handle the user has renamed away from redirects to their current one. Responses
+// carry an ETag and honour If-None-Match.
+func PublicProfileHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+
+		// Signing in is optional, but a token that was sent has to be valid
+		var viewerUID string
+		if r.Header.Get("Authorization") != "" {
+			claims, ok := session_auth.AuthenticateScope(a, w, r, user_models.ScopeProfileRead)
+			if !ok {
+				return
+			}
+			viewerUID = claims.UID
+		}
+
+		profile, err := user_models.GetPublicProfile(a.DB, auth_utils.CanonicalUsername(username))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logging.FromContext(r.Context()).Error("GetPublicProfile error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			redirectRenamed(a, w, r, username, viewerUID)
+			return
+		}
+		if !canView(profile, viewerUID) {
+			response.Fail(w, r, response.CodeNotFound, "Profile not found")
+			return
+		}
+
+		body, err := json.Marshal(profile)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Marshal profile error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Vary", "Authorization")
+		if profile.Visibility == user_models.ProfileVisibilityPublic && viewerUID == "" {
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		} else {
+			w.Header().Set("Cache-Control", "private, no-cache")
+		}
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(body, '\n'))
+	}
+}
+
+// redirectRenamed sends a request for an old handle on to the user's current one, or 404s. The
+// redirect is temporary because released handles can be taken again, and is only given when the
+// viewer may see the profile it leads to, so it never reveals a hidden user's new handle.
+func redirectRenamed(a *app.App, w http.ResponseWriter, r *http.Request, username, viewerUID string) {
+	_, current, redirected, err := user_models.ResolveUsername(a.DB, username)
+	if err != nil && !errors.Is(err, user_models.ErrUserNotFound) {
+		logging.FromContext(r.Context()).Error("ResolveUsername error", "err", err)
+		response.WriteError(w, r, response.ErrInternal)
+		return
+	}
+	if err != nil || !redirected || current == "" {
+		response.Fail(w, r, response.CodeNotFound, "Profile not found")
+		return
+	}
+
+	profile, err := user_models.GetPublicProfile(a.DB, auth_utils.CanonicalUsername(current))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logging.FromContext(r.Context()).Error("GetPublicProfile error", "err", err)
+		response.WriteError(w, r, response.ErrInternal)
+		return
+	}
+	if err != nil || !canView(profile, viewerUID) {
+		response.Fail(w, r, response.CodeNotFound, "Profile not found")
+		return
+	}
+
+	w.Header().Set("Location", path.Join(path.Dir(r.URL.Path), url.PathEscape(profile.Username)))
+	w.Header().Set("Vary", "Authorization")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	response.JSON(w, http.StatusTemporaryRedirect, map[string]string{"username": profile.Username})
+}
+
+func canView(profile *user_models.PublicProfile, viewerUID string) bool {
+	switch profile.Visibility {
+	case user_models.ProfileVisibilityPublic:
+		return true
+	case user_models.ProfileVisibilityMembers:
+		return viewerUID != ""
+	default:
+		return viewerUID == profile.UID
+	}
+}
+
+// etagMatches implements the weak comparison If-None-Match calls for
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPrivacySettingsHandler shows who can see the caller's profile
+func GetPrivacySettingsHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := session_auth.AuthenticateScope(a, w, r, user_models.ScopeProfileRead)
+		if !ok {
+			return
+		}
+
+		settings, err := user_models.GetPrivacySettings(a.DB, claims.UID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetPrivacySettings error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.OK(w, settings)
+	}
+}
+
+// UpdatePrivacySettingsHandler changes who can see the caller's profile
+func UpdatePrivacySettingsHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		claims, ok := session_auth.Authenticate(a, w, r)
+		if !ok {
+			return
+		}
+
+		settings, err := user_models.GetPrivacySettings(a.DB, claims.UID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetPrivacySettings error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		// Fields left out keep their current value
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(settings); err != nil {
+			response.WriteError(w, r, response.ErrInvalidBody)
+			return
+		}
+
+		if err := user_models.UpdatePrivacySettings(a.DB, claims.UID, *settings); err != nil {
+			if errors.Is(err, user_models.ErrInvalidVisibility) {
+				response.Fail(w, r, response.CodeValidationFailed, err.Error())
+				return
+			}
+			logging.FromContext(r.Context()).Error("UpdatePrivacySettings error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		response.OK(w, settings)
+	}
+}
@@ -3,17 +3,36 @@ package user_assets_controller
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
-	"sraraa/db"
+	"net/url"
+	"sraraa/app"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/pkg/tracing"
+	"sraraa/reciever_src/controllers/auth/session_auth"
 	user_models "sraraa/reciever_src/models/user"
-
-	"github.com/gin-gonic/gin"
+	"sraraa/storage"
+	"strings"
+	"time"
 )
 
-const CDN_UPLOAD_URL = "http://localhost:8090/api/upload/image"
+// cdnUploadPaths are the CDN's upload routes, one per image type it stores
+var cdnUploadPaths = map[string]string{
+	"profile": "/api/upload/image/profile-photo-image",
+	"cover":   "/api/upload/image/profile-cover-image",
+}
+
+// multipartOverhead is room in the body for the form's boundaries, part headers and text fields on
+// top of the image itself
+const multipartOverhead = 64 << 10
+
+// cdnClient sends uploads on to the CDN. The traced transport also passes the trace on to the
+// CDN in a traceparent header.
+var cdnClient = &http.Client{Timeout: 30 * time.Second, Transport: tracing.Transport(nil)}
 
 type CDNResponse struct {
 	File    string `json:"file"`
@@ -22,211 +41,279 @@ type CDNResponse struct {
 }
 
 // Upload Image
-func UploadImage(c *gin.Context) {
-	// Get the session token from cookie or header
-	token := c.GetHeader("Authorization")
-	if token == "" {
-		token, _ = c.Cookie("session_token")
+func UploadImage(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the session token from cookie or header
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			if cookie, err := r.Cookie("session_token"); err == nil {
+				token = cookie.Value
+			}
+		}
+
+		if token == "" {
+			response.WriteError(w, r, response.ErrNoToken)
+			return
+		}
+
+		// Validate session (or an access token with images:write) and get user claims
+		claims, err := session_auth.AuthenticateToken(r.Context(), a, token, user_models.ScopeImagesWrite)
+		if err != nil {
+			response.WriteError(w, r, session_auth.AuthError(err))
+			return
+		}
+
+		// Get the image file from form
+		r.Body = http.MaxBytesReader(w, r.Body, a.Config.MaxUploadSize+multipartOverhead)
+		file, header, err := r.FormFile("image")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				response.Fail(w, r, response.CodePayloadTooLarge, "image is too large")
+				return
+			}
+			response.WriteError(w, r, response.Invalid("image", "image file is required"))
+			return
+		}
+		defer file.Close()
+		if header.Size > a.Config.MaxUploadSize {
+			response.Fail(w, r, response.CodePayloadTooLarge, "image is too large")
+			return
+		}
+
+		// Get the type from form: "profile" or "cover"
+		imageType := r.PostFormValue("type")
+		if imageType == "" {
+			response.WriteError(w, r, response.Invalid("type", "type is required"))
+			return
+		}
+		uploadPath, ok := cdnUploadPaths[imageType]
+		if !ok {
+			response.WriteError(w, r, response.Invalid("type", "type must be profile or cover"))
+			return
+		}
+
+		// Prepare multipart form to send to CDN
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+
+		_ = writer.WriteField("username", claims.Username)
+		_ = writer.WriteField("uid", claims.UID)
+		_ = writer.WriteField("type", imageType)
+
+		part, err := writer.CreateFormFile("image", header.Filename)
+		if err != nil {
+			response.Fail(w, r, response.CodeInternal, "failed to create form file")
+			return
+		}
+
+		_, err = io.Copy(part, file)
+		if err != nil {
+			response.Fail(w, r, response.CodeInternal, "failed to copy file")
+			return
+		}
+
+		err = writer.Close()
+		if err != nil {
+			response.Fail(w, r, response.CodeInternal, "failed to close writer")
+			return
+		}
+
+		// Send request to CDN API
+		req, err := http.NewRequestWithContext(r.Context(), "POST", a.Config.CDNURL+uploadPath, body)
+		if err != nil {
+			response.Fail(w, r, response.CodeInternal, "failed to create CDN request")
+			return
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		// The CDN introspects the caller's token to confirm the uid it is writing for
+		req.Header.Set("Authorization", token)
+		req.Header.Set(logging.RequestIDHeader, logging.IDFromContext(r.Context()))
+
+		resp, err := cdnClient.Do(req)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("CDN upload error", "err", err)
+			response.Fail(w, r, response.CodeUpstream, "failed to upload to CDN")
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			response.WriteError(w, r, cdnError(r, resp))
+			return
+		}
+
+		// Parse CDN response
+		var cdnResponse CDNResponse
+		if err := json.NewDecoder(resp.Body).Decode(&cdnResponse); err != nil {
+			response.Fail(w, r, response.CodeUpstream, "failed to parse CDN response")
+			return
+		}
+
+		// The CDN links the file through the host it was reached on, the internal CDN_URL, so
+		// only its path is kept and the public base is put in front
+		mediaURL, err := url.Parse(cdnResponse.URL)
+		if err != nil || !strings.HasPrefix(mediaURL.Path, "/media/") {
+			response.Fail(w, r, response.CodeUpstream, "invalid CDN response")
+			return
+		}
+		fullURL := a.Config.PublicCDNURL() + mediaURL.EscapedPath()
+
+		// Save full URL to database
+		err = a.Store.Images.Save(r.Context(), storage.Image{
+			UID:      claims.UID,
+			Username: claims.Username,
+			Type:     imageType,
+			URL:      fullURL,
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Save image error", "err", err)
+			response.Fail(w, r, response.CodeInternal, "failed to save image to database")
+			return
+		}
+
+		response.OK(w, map[string]interface{}{
+			"image_url": fullURL,
+			"type":      imageType,
+			"uid":       claims.UID,
+			"username":  claims.Username,
+		})
 	}
-
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
-	}
-
-	// Validate session and get user claims
-	claims, err := user_models.ValidateSessionToken(token)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid session"})
-		return
-	}
-
-	// Get the image file from form
-	file, header, err := c.Request.FormFile("image")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "image file is required"})
-		return
-	}
-	defer file.Close()
-
-	// Get the type from form (e.g., "profile", "cover", "post", etc.)
-	imageType := c.PostForm("type")
-	if imageType == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "type is required"})
-		return
-	}
-
-	// Prepare multipart form to send to CDN
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	_ = writer.WriteField("username", claims.Username)
-	_ = writer.WriteField("uid", claims.UID)
-	_ = writer.WriteField("type", imageType)
-
-	part, err := writer.CreateFormFile("image", header.Filename)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create form file"})
-		return
-	}
-
-	_, err = io.Copy(part, file)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to copy file"})
-		return
-	}
-
-	err = writer.Close()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to close writer"})
-		return
-	}
-
-	// Send request to CDN API
-	req, err := http.NewRequest("POST", CDN_UPLOAD_URL, body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create CDN request"})
-		return
-	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload to CDN"})
-		return
-	}
-	defer resp.Body.Close()
-
-	// Parse CDN response
-	var cdnResponse struct {
-		File    string `json:"file"`
-		Message string `json:"message"`
-		URL     string `json:"url"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&cdnResponse); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse CDN response"})
-		return
-	}
-
-	if cdnResponse.URL == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid CDN response"})
-		return
-	}
-
-	// Prepend base URL to make full URL
-	fullURL := fmt.Sprintf("http://localhost:8090%s", cdnResponse.URL)
-
-	// Save full URL to database
-	err = user_models.SaveUserImage(db.DB, claims.UID, claims.Username, imageType, fullURL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save image to database"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success":   true,
-		"image_url": fullURL,
-		"type":      imageType,
-		"uid":       claims.UID,
-		"username":  claims.Username,
-	})
 }
 
 // GetImage retrieves image URL for a specific user and type
-func GetImage(c *gin.Context) {
-	// Accept either uid or username in query
-	uid := c.Query("uid")
-	username := c.Query("username")
-	imageType := c.Param("type")
-
-	if uid == "" && username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "uid or username is required"})
-		return
-	}
-
-	if imageType == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "type is required"})
-		return
-	}
-
-	// Get image URL from database
-	imageData, err := user_models.GetUserImage(db.DB, uid, username, imageType)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
-		return
+func GetImage(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Accept either uid or username in query
+		uid := r.URL.Query().Get("uid")
+		username := r.URL.Query().Get("username")
+		imageType := r.PathValue("type")
+
+		if uid == "" && username == "" {
+			response.Fail(w, r, response.CodeInvalidRequest, "uid or username is required")
+			return
+		}
+
+		// Old handles keep resolving to the renamed account
+		if uid == "" {
+			resolvedUID, _, _, err := user_models.ResolveUsername(a.DB, username)
+			if err != nil {
+				response.Fail(w, r, response.CodeNotFound, "user not found")
+				return
+			}
+			uid = resolvedUID
+		}
+
+		if imageType == "" {
+			response.WriteError(w, r, response.Invalid("type", "type is required"))
+			return
+		}
+
+		// Get image URL from database
+		imageData, err := user_models.GetUserImage(r.Context(), a.Store, uid, username, imageType)
+		if err != nil {
+			response.Fail(w, r, response.CodeNotFound, "image not found")
+			return
+		}
+
+		response.OK(w, map[string]interface{}{
+			"image_url": imageData["image_url"],
+			"type":      imageData["type"],
+			"uid":       imageData["uid"],
+			"username":  imageData["username"],
+		})
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success":   true,
-		"image_url": imageData["image_url"],
-		"type":      imageData["type"],
-		"uid":       imageData["uid"],
-		"username":  imageData["username"],
-	})
 }
 
 // GetAllUserImages retrieves all images for a specific user
-func GetAllUserImages(c *gin.Context) {
-	// Accept either uid or username in query
-	uid := c.Query("uid")
-	username := c.Query("username")
-
-	if uid == "" && username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "uid or username is required"})
-		return
-	}
-
-	// Get all images from database
-	images, err := user_models.GetAllUserImages(db.DB, uid, username)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve images"})
-		return
+func GetAllUserImages(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Accept either uid or username in query
+		uid := r.URL.Query().Get("uid")
+		username := r.URL.Query().Get("username")
+
+		if uid == "" && username == "" {
+			response.Fail(w, r, response.CodeInvalidRequest, "uid or username is required")
+			return
+		}
+
+		// Old handles keep resolving to the renamed account
+		if uid == "" {
+			resolvedUID, _, _, err := user_models.ResolveUsername(a.DB, username)
+			if err != nil {
+				response.Fail(w, r, response.CodeNotFound, "user not found")
+				return
+			}
+			uid = resolvedUID
+		}
+
+		// Get all images from database
+		images, err := user_models.GetAllUserImages(r.Context(), a.Store, uid, username)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetAllUserImages error", "err", err)
+			response.Fail(w, r, response.CodeInternal, "failed to retrieve images")
+			return
+		}
+
+		response.OK(w, map[string]interface{}{
+			"uid":      uid,
+			"username": username,
+			"images":   images,
+		})
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success":  true,
-		"uid":      uid,
-		"username": username,
-		"images":   images,
-	})
 }
 
 // DeleteImage removes an image record from database
-func DeleteImage(c *gin.Context) {
-	// Get the session token from cookie or header
-	token := c.GetHeader("Authorization")
-	if token == "" {
-		token, _ = c.Cookie("session_token")
-	}
-
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
-	}
-
-	// Validate session and get user claims
-	claims, err := user_models.ValidateSessionToken(token)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid session"})
-		return
-	}
-
-	imageType := c.Param("type")
-	if imageType == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "type is required"})
-		return
+func DeleteImage(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the session token from cookie or header
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			if cookie, err := r.Cookie("session_token"); err == nil {
+				token = cookie.Value
+			}
+		}
+
+		if token == "" {
+			response.WriteError(w, r, response.ErrNoToken)
+			return
+		}
+
+		// Validate session (or an access token with images:write) and get user claims
+		claims, err := session_auth.AuthenticateToken(r.Context(), a, token, user_models.ScopeImagesWrite)
+		if err != nil {
+			response.WriteError(w, r, session_auth.AuthError(err))
+			return
+		}
+
+		imageType := r.PathValue("type")
+		if imageType == "" {
+			response.WriteError(w, r, response.Invalid("type", "type is required"))
+			return
+		}
+
+		// Delete image from database
+		err = user_models.DeleteUserImage(r.Context(), a.Store, claims.UID, imageType)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("DeleteUserImage error", "err", err)
+			response.Fail(w, r, response.CodeInternal, "failed to delete image")
+			return
+		}
+
+		response.Message(w, http.StatusOK, fmt.Sprintf("Image of type '%s' deleted successfully", imageType))
 	}
+}
 
-	// Delete image from database
-	err = user_models.DeleteUserImage(db.DB, claims.UID, imageType)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete image"})
-		return
+// cdnError turns a failed CDN upload into the error for the client. The CDN answers with the
+// same envelope, so a rejected upload (too large, wrong type, bad token) keeps its code and
+// message. Its own failures become upstream_error, and so does a 404: the upload route is
+// missing, which is a deployment problem rather than something the client asked for.
+func cdnError(r *http.Request, resp *http.Response) *response.Error {
+	var env response.Envelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err == nil && env.Error.Code != "" &&
+		resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusNotFound {
+		return response.NewError(env.Error.Code, env.Error.Message).WithDetails(env.Error.Details)
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": fmt.Sprintf("Image of type '%s' deleted successfully", imageType),
-	})
+	logging.FromContext(r.Context()).Error("CDN upload failed", "status", resp.StatusCode, "error_code", env.Error.Code, "error_message", env.Error.Message)
+	return response.NewError(response.CodeUpstream, "failed to upload to CDN")
 }
@@ -0,0 +1,193 @@
+package user_assets_controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"sraraa/app"
+	"sraraa/config"
+	"sraraa/db"
+	user_models "sraraa/reciever_src/models/user"
+	"sraraa/storage"
+)
+
+// fakeCDN answers uploads the way the CDN does and records the form it was sent
+type fakeCDN struct {
+	mu    sync.Mutex
+	paths []string
+	forms []map[string]string
+}
+
+func (c *fakeCDN) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	form := map[string]string{}
+	for k, v := range r.MultipartForm.Value {
+		form[k] = v[0]
+	}
+	c.mu.Lock()
+	c.paths = append(c.paths, r.URL.Path)
+	c.forms = append(c.forms, form)
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CDNResponse{
+		File:    "photo.png",
+		Message: "uploaded",
+		URL:     "http://" + r.Host + "/media/" + form["username"] + "/" + form["type"] + "/photo.png",
+	})
+}
+
+func (c *fakeCDN) calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.paths)
+}
+
+// newTestApp builds an App over a migrated in-memory SQLite store that uploads to cdn, with any
+// further config flags in args
+func newTestApp(t *testing.T, cdn http.Handler, args ...string) *app.App {
+	t.Helper()
+
+	srv := httptest.NewServer(cdn)
+	t.Cleanup(srv.Close)
+
+	cfg, err := config.Load(append([]string{"-cdn-url", srv.URL, "-cdn-public-url", "https://cdn.example.com"}, args...))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	store, err := storage.Open(storage.Memory)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := db.Migrate(store.DB, store.Dialect); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := user_models.LoadSigningKeys(t.TempDir()); err != nil {
+		t.Fatalf("load signing keys: %v", err)
+	}
+	return app.New(cfg, store)
+}
+
+// newSession stores a verified account named username and returns a session token for it
+func newSession(t *testing.T, a *app.App, username string) string {
+	t.Helper()
+	ctx := context.Background()
+	email := username + "@example.com"
+	if err := a.Store.Users.Create(ctx, email); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := a.Store.Users.SetUID(ctx, email, "uid-"+username); err != nil {
+		t.Fatalf("set uid: %v", err)
+	}
+	if err := a.Store.Users.MarkVerified(ctx, email); err != nil {
+		t.Fatalf("mark verified: %v", err)
+	}
+	if err := user_models.SetUsername(a.DB, email, username); err != nil {
+		t.Fatalf("set username: %v", err)
+	}
+	userID, err := user_models.GetUserIDByEmailOrUsername(ctx, a.Store, email)
+	if err != nil {
+		t.Fatalf("user id: %v", err)
+	}
+	token, err := user_models.CreateSession(ctx, a.Store, userID, time.Hour, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	return token
+}
+
+func uploadRequest(t *testing.T, token, imageType string) *http.Request {
+	t.Helper()
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	_ = mw.WriteField("type", imageType)
+	part, err := mw.CreateFormFile("image", "photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("\x89PNG\r\n\x1a\n"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", token)
+	return req
+}
+
+func TestUploadImage(t *testing.T) {
+	cdn := &fakeCDN{}
+	a := newTestApp(t, cdn)
+	token := newSession(t, a, "carol")
+
+	for imageType, path := range cdnUploadPaths {
+		rec := httptest.NewRecorder()
+		UploadImage(a)(rec, uploadRequest(t, token, imageType))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, body %s", imageType, rec.Code, rec.Body)
+		}
+
+		cdn.mu.Lock()
+		gotPath, form := cdn.paths[len(cdn.paths)-1], cdn.forms[len(cdn.forms)-1]
+		cdn.mu.Unlock()
+		if gotPath != path {
+			t.Errorf("%s: CDN path %q, want %q", imageType, gotPath, path)
+		}
+		// the CDN is told who is uploading from the session, not from the form
+		if form["username"] != "carol" || form["uid"] != "uid-carol" || form["type"] != imageType {
+			t.Errorf("%s: CDN form %v", imageType, form)
+		}
+
+		want := "https://cdn.example.com/media/carol/" + imageType + "/photo.png"
+		var resp struct {
+			ImageURL string `json:"image_url"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.ImageURL != want {
+			t.Errorf("%s: image_url %q (%v), want %q", imageType, resp.ImageURL, err, want)
+		}
+		img, err := a.Store.Images.Get(context.Background(), "uid-carol", imageType)
+		if err != nil || img.URL != want {
+			t.Errorf("%s: stored image %+v (%v), want URL %q", imageType, img, err, want)
+		}
+	}
+}
+
+func TestUploadImageRejectsUnknownType(t *testing.T) {
+	cdn := &fakeCDN{}
+	a := newTestApp(t, cdn)
+	token := newSession(t, a, "dave")
+
+	rec := httptest.NewRecorder()
+	UploadImage(a)(rec, uploadRequest(t, token, "../../x"))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	if n := cdn.calls(); n != 0 {
+		t.Fatalf("the CDN was called %d times", n)
+	}
+}
+
+func TestUploadImageRejectsOversizedImage(t *testing.T) {
+	cdn := &fakeCDN{}
+	a := newTestApp(t, cdn, "-max-upload-size", "4")
+	token := newSession(t, a, "erin")
+
+	rec := httptest.NewRecorder()
+	UploadImage(a)(rec, uploadRequest(t, token, "profile"))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	if n := cdn.calls(); n != 0 {
+		t.Fatalf("the CDN was called %d times", n)
+	}
+}
@@ -0,0 +1,230 @@
+package access_token_models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	session_models "sraraa/reciever_src/models/user/sessions"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenPrefix marks a credential as a personal access token rather than a session JWT
+const TokenPrefix = "sr_pat_"
+
+const (
+	ScopeProfileRead  = "profile:read"
+	ScopeImagesWrite  = "images:write"
+	ScopeInvitesWrite = "invites:write"
+
+	// ScopeUsersRead lets a token read other users' info through the internal API. Only admins
+	// can grant it and sessions never carry it.
+	ScopeUsersRead = "users:read"
+)
+
+// Scopes lists every scope a personal access token can be granted
+var Scopes = []string{ScopeProfileRead, ScopeImagesWrite, ScopeInvitesWrite, ScopeUsersRead}
+
+// SessionScopes are the scopes an interactive session implicitly has
+var SessionScopes = []string{ScopeProfileRead, ScopeImagesWrite, ScopeInvitesWrite}
+
+// IsAdminScope reports whether only admins may create tokens with scope
+func IsAdminScope(scope string) bool {
+	return scope == ScopeUsersRead
+}
+
+var (
+	ErrAccessTokenInvalid = errors.New("access token is invalid, expired or revoked")
+	ErrUnknownScope       = errors.New("unknown scope")
+	ErrTokenNotFound      = errors.New("access token not found")
+)
+
+type AccessToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// IsAccessToken reports whether raw looks like a personal access token
+func IsAccessToken(raw string) bool {
+	return strings.HasPrefix(raw, TokenPrefix)
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeScopes validates scopes and returns them sorted without duplicates
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if seen[s] {
+			continue
+		}
+		known := false
+		for _, k := range Scopes {
+			if s == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, ErrUnknownScope
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// CreateAccessToken stores a new token for uid and returns it together with the raw secret.
+// The raw value is not stored and cannot be shown again.
+func CreateAccessToken(db *sql.DB, uid, name string, scopes []string, expiresAt time.Time) (*AccessToken, string, error) {
+	scopes, err := NormalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	raw := TokenPrefix + hex.EncodeToString(b)
+	prefix := raw[:len(TokenPrefix)+6]
+
+	now := time.Now().UTC()
+	var id int64
+	err = db.QueryRow(`
+		INSERT INTO personal_access_tokens (uid, name, token_hash, token_prefix, scopes, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		uid, name, hashToken(raw), prefix, strings.Join(scopes, " "), expiresAt.UTC(), now).Scan(&id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &AccessToken{
+		ID:        id,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt.UTC(),
+		CreatedAt: now,
+	}, raw, nil
+}
+
+// CountActiveAccessTokens counts tokens of uid that are neither revoked nor expired
+func CountActiveAccessTokens(db *sql.DB, uid string) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM personal_access_tokens
+		WHERE uid=? AND revoked_at IS NULL AND expires_at > ?
+	`, uid, time.Now().UTC()).Scan(&count)
+	return count, err
+}
+
+func GetAccessTokensByUID(db *sql.DB, uid string) ([]AccessToken, error) {
+	rows, err := db.Query(`
+		SELECT id, name, token_prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM personal_access_tokens
+		WHERE uid=?
+		ORDER BY created_at DESC, id DESC
+	`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []AccessToken{}
+	for rows.Next() {
+		var t AccessToken
+		var scopes string
+		var lastUsed, revoked sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &scopes, &t.ExpiresAt, &lastUsed, &revoked, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Fields(scopes)
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		if revoked.Valid {
+			t.RevokedAt = &revoked.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAccessToken revokes token id if it belongs to uid
+func RevokeAccessToken(db *sql.DB, uid string, id int64) error {
+	res, err := db.Exec(`UPDATE personal_access_tokens SET revoked_at=? WHERE id=? AND uid=? AND revoked_at IS NULL`,
+		time.Now().UTC(), id, uid)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// RevokeAllAccessTokens revokes every token of uid, e.g. after a password reset
+func RevokeAllAccessTokens(db *sql.DB, uid string) error {
+	_, err := db.Exec(`UPDATE personal_access_tokens SET revoked_at=? WHERE uid=? AND revoked_at IS NULL`,
+		time.Now().UTC(), uid)
+	return err
+}
+
+// AuthenticateAccessToken looks up a raw token and returns claims for its owner, shaped like
+// session claims so handlers can treat both alike. last_used_at is updated on success.
+func AuthenticateAccessToken(db *sql.DB, raw string) (*session_models.SessionClaims, error) {
+	if !IsAccessToken(raw) {
+		return nil, ErrAccessTokenInvalid
+	}
+
+	var claims session_models.SessionClaims
+	var scopes string
+	var expires time.Time
+	var revoked sql.NullTime
+	err := db.QueryRow(`
+		SELECT t.id, t.scopes, t.expires_at, t.revoked_at,
+			u.id, u.uid, u.email, COALESCE(u.username, ''), COALESCE(u.fullname, ''), u.verified
+		FROM personal_access_tokens t
+		JOIN users u ON u.uid = t.uid
+		WHERE t.token_hash=?
+	`, hashToken(raw)).Scan(&claims.AccessTokenID, &scopes, &expires, &revoked,
+		&claims.UserID, &claims.UID, &claims.Email, &claims.Username, &claims.Fullname, &claims.Verified)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccessTokenInvalid
+		}
+		return nil, err
+	}
+
+	if revoked.Valid || time.Now().After(expires) {
+		return nil, ErrAccessTokenInvalid
+	}
+
+	if _, err := db.Exec(`UPDATE personal_access_tokens SET last_used_at=? WHERE id=?`, time.Now().UTC(), claims.AccessTokenID); err != nil {
+		return nil, err
+	}
+
+	claims.Scopes = strings.Fields(scopes)
+	claims.ExpiresAt = jwt.NewNumericDate(expires)
+	return &claims, nil
+}
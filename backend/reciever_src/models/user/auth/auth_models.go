@@ -1,35 +1,75 @@
 package auth_models
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
 	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 	"time"
 
 	auth_utils "sraraa/reciever_src/utils/auth"
+	"sraraa/storage"
 )
 
-func SetPassword(db *sql.DB, email, password string) error {
-	if err := auth_utils.ValidatePassword(password); err != nil {
-		return err
+// SetPassword validates the password (rules, breach check) and stores it. The returned check
+// carries the strength estimate and any breach warning for the client.
+func SetPassword(ctx context.Context, s *storage.Store, email, password string, breach auth_utils.BreachPolicy) (auth_utils.PasswordCheck, error) {
+	check, err := auth_utils.CheckPassword(password, breach)
+	if err != nil {
+		return check, err
 	}
-	_, err := db.Exec("UPDATE users SET password=? WHERE email=?", password, email)
-	return err
+	return check, s.Users.SetPassword(ctx, email, password)
 }
 
+var ErrUsernameTaken = errors.New("username already taken")
+
 func SetUsername(db *sql.DB, email, username string) error {
+	username = auth_utils.NormalizeUsername(username)
 	if err := auth_utils.ValidateUsername(username); err != nil {
 		return err
 	}
-	_, err := db.Exec("UPDATE users SET username=? WHERE email=?", username, email)
+
+	canonical := auth_utils.CanonicalUsername(username)
+
+	var takenBy sql.NullString
+	err := db.QueryRow(`SELECT email FROM users WHERE username_canonical=?`, canonical).Scan(&takenBy)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && takenBy.String != email {
+		return ErrUsernameTaken
+	}
+
+	// Names released by a rename stay reserved for their previous owner during quarantine
+	var quarantined bool
+	err = db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM username_history
+			WHERE old_canonical=? AND released_until > ?
+			AND uid IS DISTINCT FROM (SELECT uid FROM users WHERE email=?)
+		)`, canonical, time.Now().UTC(), email).Scan(&quarantined)
+	if err != nil {
+		return err
+	}
+	if quarantined {
+		return ErrUsernameTaken
+	}
+
+	_, err = db.Exec("UPDATE users SET username=?, username_canonical=? WHERE email=?", username, canonical, email)
+	if storage.IsUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
 	return err
 }
 
-func SetFullname(db *sql.DB, email, fullname string) error {
+func SetFullname(ctx context.Context, s *storage.Store, email, fullname string) error {
 	if err := auth_utils.ValidateFullname(fullname); err != nil {
 		return err
 	}
-	_, err := db.Exec("UPDATE users SET fullname=? WHERE email=?", fullname, email)
-	return err
+	return s.Users.SetFullname(ctx, email, fullname)
 }
 
 func UsernameExists(db *sql.DB, username string) (bool, error) {
@@ -37,8 +77,14 @@ func UsernameExists(db *sql.DB, username string) (bool, error) {
 		return false, nil
 	}
 
+	canonical := auth_utils.CanonicalUsername(username)
+
 	var count int
-	err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE username=?`, username).Scan(&count)
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM users WHERE username_canonical=?) +
+			(SELECT COUNT(*) FROM username_history WHERE old_canonical=? AND released_until > ?)
+	`, canonical, canonical, time.Now().UTC()).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -46,54 +92,159 @@ func UsernameExists(db *sql.DB, username string) (bool, error) {
 	return count > 0, nil
 }
 
-func EmailExists(db *sql.DB, email string) (bool, error) {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email=?", email).Scan(&count)
+// SuggestUsernames returns up to limit available usernames derived from the requested one
+func SuggestUsernames(db *sql.DB, username string, limit int) ([]string, error) {
+	policy := auth_utils.GetUsernamePolicy()
+
+	base := usernameSuggestionBase(username, policy)
+	if base == "" {
+		return nil, nil
+	}
+
+	candidates := make([]string, 0, limit*3)
+	seen := map[string]bool{}
+	addCandidate := func(c string) {
+		canonical := auth_utils.CanonicalUsername(c)
+		if seen[canonical] || auth_utils.ValidateUsername(c) != nil {
+			return
+		}
+		seen[canonical] = true
+		candidates = append(candidates, c)
+	}
+
+	for _, suffix := range []string{"_", "."} {
+		if strings.ContainsAny(policy.AllowedSymbols, suffix) {
+			addCandidate(base + suffix + "official")
+			break
+		}
+	}
+	for i := 0; i < limit*3; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(9000))
+		if err != nil {
+			return nil, err
+		}
+		addCandidate(fmt.Sprintf("%s%d", base, n.Int64()+100))
+	}
+
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	canonicals := make([]interface{}, len(candidates))
+	placeholders := make([]string, len(candidates))
+	for i, c := range candidates {
+		canonicals[i] = auth_utils.CanonicalUsername(c)
+		placeholders[i] = "?"
+	}
+
+	in := strings.Join(placeholders, ",")
+	args := append(append(canonicals, canonicals...), time.Now().UTC())
+	rows, err := db.Query(`
+		SELECT username_canonical FROM users WHERE username_canonical IN (`+in+`)
+		UNION
+		SELECT old_canonical FROM username_history WHERE old_canonical IN (`+in+`) AND released_until > ?
+	`, args...)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return count > 0, nil
+	defer rows.Close()
+
+	taken := map[string]bool{}
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		taken[c] = true
+	}
+
+	suggestions := make([]string, 0, limit)
+	for _, c := range candidates {
+		if len(suggestions) == limit {
+			break
+		}
+		if !taken[auth_utils.CanonicalUsername(c)] {
+			suggestions = append(suggestions, c)
+		}
+	}
+
+	return suggestions, nil
 }
 
-func HasAllRequiredFields(db *sql.DB, email string) (bool, time.Time, error) {
-	var username, password, fullname sql.NullString
-	var updated time.Time
+// usernameSuggestionBase strips characters the policy would reject and trims the result so there
+// is room for a numeric suffix
+func usernameSuggestionBase(username string, policy auth_utils.UsernamePolicy) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(username)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || strings.ContainsRune(policy.AllowedSymbols, r) {
+			b.WriteRune(r)
+		}
+	}
 
-	err := db.QueryRow(`
-		SELECT username, password, fullname, created_at
-		FROM users WHERE email=?
-	`, email).Scan(&username, &password, &fullname, &updated)
+	base := strings.Trim(b.String(), policy.AllowedSymbols)
+	if maxBase := policy.MaxLength - 4; maxBase > 0 && len(base) > maxBase {
+		base = base[:maxBase]
+	}
+	return base
+}
 
+// GetRoleByUID returns the account role ("user" or "admin")
+func GetRoleByUID(ctx context.Context, s *storage.Store, uid string) (string, error) {
+	u, err := s.Users.GetByUID(ctx, uid)
 	if err != nil {
-		return false, time.Time{}, err
+		return "", err
 	}
+	return u.Role, nil
+}
+
+// GetAccountByUID returns the account as it is stored now, for checks that must not rely on what a
+// token says about it
+func GetAccountByUID(ctx context.Context, s *storage.Store, uid string) (*storage.User, error) {
+	return s.Users.GetByUID(ctx, uid)
+}
 
-	if !username.Valid || !password.Valid || !fullname.Valid {
-		return false, updated, nil
+// IsSuspendedByEmail reports whether an admin has suspended the account
+func IsSuspendedByEmail(ctx context.Context, s *storage.Store, email string) (bool, error) {
+	u, err := s.Users.GetByEmail(ctx, email)
+	if err != nil {
+		return false, err
 	}
+	return u.SuspendedAt != nil, nil
+}
 
-	return true, updated, nil
+// SetSuspended suspends or reinstates an account
+func SetSuspended(ctx context.Context, s *storage.Store, uid string, suspended bool) error {
+	var at *time.Time
+	if suspended {
+		now := time.Now().UTC()
+		at = &now
+	}
+	return s.Users.SetSuspended(ctx, uid, at)
 }
 
-func HasAllRequiredFieldsForLogin(db *sql.DB, email string) (bool, error) {
-	var username, password, fullname sql.NullString
+func EmailExists(ctx context.Context, s *storage.Store, email string) (bool, error) {
+	return s.Users.EmailExists(ctx, email)
+}
 
-	err := db.QueryRow(`
-		SELECT username, password, fullname
-		FROM users
-		WHERE email=?
-	`, email).Scan(&username, &password, &fullname)
+func HasAllRequiredFields(ctx context.Context, s *storage.Store, email string) (bool, time.Time, error) {
+	u, err := s.Users.GetByEmail(ctx, email)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	return hasRequiredFields(u), u.CreatedAt, nil
+}
 
+func HasAllRequiredFieldsForLogin(ctx context.Context, s *storage.Store, email string) (bool, error) {
+	u, err := s.Users.GetByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return false, nil
 		}
 		return false, err
 	}
+	return hasRequiredFields(u), nil
+}
 
-	if username.Valid && password.Valid && fullname.Valid {
-		return true, nil
-	}
-
-	return false, nil
+func hasRequiredFields(u *storage.User) bool {
+	return u.Username != "" && u.HasPassword && u.Fullname != ""
 }
@@ -0,0 +1,160 @@
+package export_models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+	StatusExpired = "expired"
+)
+
+var ErrExportNotFound = errors.New("export not found")
+
+type DataExport struct {
+	ID          string     `json:"id"`
+	UID         string     `json:"-"`
+	Status      string     `json:"status"`
+	FilePath    string     `json:"-"`
+	SizeBytes   int64      `json:"size_bytes,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+const exportColumns = `id, uid, status, COALESCE(file_path, ''), COALESCE(size_bytes, 0), COALESCE(error, ''), created_at, completed_at, expires_at`
+
+func scanExport(row interface{ Scan(...interface{}) error }) (*DataExport, error) {
+	var e DataExport
+	var completed, expires sql.NullTime
+	if err := row.Scan(&e.ID, &e.UID, &e.Status, &e.FilePath, &e.SizeBytes, &e.Error, &e.CreatedAt, &completed, &expires); err != nil {
+		return nil, err
+	}
+	if completed.Valid {
+		e.CompletedAt = &completed.Time
+	}
+	if expires.Valid {
+		e.ExpiresAt = &expires.Time
+	}
+	return &e, nil
+}
+
+// CreateExport queues a new export job for uid
+func CreateExport(db *sql.DB, uid string) (*DataExport, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	e := &DataExport{
+		ID:        hex.EncodeToString(b),
+		UID:       uid,
+		Status:    StatusPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	_, err := db.Exec(`INSERT INTO data_exports (id, uid, status, created_at) VALUES (?, ?, ?, ?)`,
+		e.ID, e.UID, e.Status, e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func GetExport(db *sql.DB, id string) (*DataExport, error) {
+	e, err := scanExport(db.QueryRow(`SELECT `+exportColumns+` FROM data_exports WHERE id=?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExportNotFound
+	}
+	return e, err
+}
+
+// GetLatestExport returns uid's most recent export job
+func GetLatestExport(db *sql.DB, uid string) (*DataExport, error) {
+	e, err := scanExport(db.QueryRow(`SELECT `+exportColumns+` FROM data_exports WHERE uid=? ORDER BY created_at DESC LIMIT 1`, uid))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExportNotFound
+	}
+	return e, err
+}
+
+func MarkExportRunning(db *sql.DB, id string) error {
+	_, err := db.Exec(`UPDATE data_exports SET status=? WHERE id=?`, StatusRunning, id)
+	return err
+}
+
+func MarkExportReady(db *sql.DB, id, filePath string, size int64, expiresAt time.Time) error {
+	_, err := db.Exec(`UPDATE data_exports SET status=?, file_path=?, size_bytes=?, completed_at=?, expires_at=? WHERE id=?`,
+		StatusReady, filePath, size, time.Now().UTC(), expiresAt.UTC(), id)
+	return err
+}
+
+func MarkExportFailed(db *sql.DB, id, reason string) error {
+	_, err := db.Exec(`UPDATE data_exports SET status=?, error=?, completed_at=? WHERE id=?`,
+		StatusFailed, reason, time.Now().UTC(), id)
+	return err
+}
+
+// GetUnfinishedExports returns jobs left pending or running, e.g. by a restart
+func GetUnfinishedExports(db *sql.DB) ([]DataExport, error) {
+	return queryExports(db, `SELECT `+exportColumns+` FROM data_exports WHERE status IN (?, ?) ORDER BY created_at`,
+		StatusPending, StatusRunning)
+}
+
+// CountUnfinishedExports returns how many jobs are pending and how many are running
+func CountUnfinishedExports(db *sql.DB) (map[string]int, error) {
+	rows, err := db.Query(`SELECT status, COUNT(*) FROM data_exports WHERE status IN (?, ?) GROUP BY status`,
+		StatusPending, StatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{StatusPending: 0, StatusRunning: 0}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// GetExpiredExports returns ready exports whose archive is past its expiry
+func GetExpiredExports(db *sql.DB) ([]DataExport, error) {
+	return queryExports(db, `SELECT `+exportColumns+` FROM data_exports WHERE status=? AND expires_at <= ?`,
+		StatusReady, time.Now().UTC())
+}
+
+// MarkExportExpired records that an archive was removed; the job row stays for the user's history
+func MarkExportExpired(db *sql.DB, id string) error {
+	_, err := db.Exec(`UPDATE data_exports SET status=?, file_path=NULL WHERE id=?`, StatusExpired, id)
+	return err
+}
+
+func queryExports(db *sql.DB, query string, args ...interface{}) ([]DataExport, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []DataExport{}
+	for rows.Next() {
+		e, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, *e)
+	}
+	return exports, rows.Err()
+}
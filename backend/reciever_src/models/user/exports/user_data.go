@@ -0,0 +1,113 @@
+package export_models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// UserData is everything stored about a user, minus secrets (password, OTP codes, session and
+// access token values). It becomes the JSON files of the export archive.
+type UserData struct {
+	Account    map[string]interface{}   `json:"account"`
+	Sessions   []map[string]interface{} `json:"sessions"`
+	AuthEvents map[string]interface{}   `json:"auth_events"`
+	Images     []map[string]interface{} `json:"images"`
+}
+
+// CollectUserData reads uid's rows from every table that holds user data
+func CollectUserData(db *sql.DB, uid string) (*UserData, error) {
+	accounts, err := queryRows(db, `
+		SELECT uid, email, username, fullname, verified, role, created_at
+		FROM users WHERE uid=?`, uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, errors.New("user not found")
+	}
+	account := accounts[0]
+	email, _ := account["email"].(string)
+
+	data := &UserData{Account: account, AuthEvents: map[string]interface{}{}}
+
+	data.Sessions, err = queryRows(db, `
+		SELECT id, user_agent, ip_address, created_at, expires_at, impersonated_by
+		FROM sessions WHERE uid=? ORDER BY created_at`, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Images, err = queryRows(db, `
+		SELECT type, username, image_url, created_at, updated_at
+		FROM user_images WHERE uid=? ORDER BY type`, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []struct {
+		name  string
+		query string
+		arg   string
+	}{
+		{"login_otp_requests", `SELECT request_time FROM login_otp_requests WHERE email=? ORDER BY request_time`, email},
+		{"signup_otp_requests", `SELECT request_time FROM signup_otp_requests WHERE email=? ORDER BY request_time`, email},
+		{"password_reset_requests", `SELECT request_time FROM password_reset_requests WHERE email=? ORDER BY request_time`, email},
+		{"username_changes", `SELECT old_username, new_username, changed_at FROM username_history WHERE uid=? ORDER BY changed_at`, uid},
+		{"access_tokens", `SELECT name, token_prefix, scopes, created_at, expires_at, last_used_at, revoked_at FROM personal_access_tokens WHERE uid=? ORDER BY created_at`, uid},
+		{"impersonations", `SELECT admin_uid, event, reason, method, path, status, created_at FROM impersonation_log WHERE target_uid=? ORDER BY created_at`, uid},
+		{"invites_created", `SELECT code, max_uses, uses, expires_at, revoked, created_at FROM invite_codes WHERE created_by_uid=? ORDER BY created_at`, uid},
+		{"invite_redemptions", `SELECT code, redeemed_at FROM invite_redemptions WHERE email=? ORDER BY redeemed_at`, email},
+		{"waitlist", `SELECT status, created_at, approved_at FROM waitlist WHERE email=?`, email},
+		{"data_exports", `SELECT id, status, created_at, completed_at FROM data_exports WHERE uid=? ORDER BY created_at`, uid},
+	}
+	for _, ev := range events {
+		rows, err := queryRows(db, ev.query, ev.arg)
+		if err != nil {
+			return nil, err
+		}
+		data.AuthEvents[ev.name] = rows
+	}
+
+	return data, nil
+}
+
+// queryRows returns each row as a column -> value map, with text kept as strings
+func queryRows(db *sql.DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			switch v := values[i].(type) {
+			case []byte:
+				row[col] = string(v)
+			case time.Time:
+				row[col] = v.UTC()
+			default:
+				row[col] = v
+			}
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,70 @@
+package impersonation_models
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	EventStart   = "start"
+	EventRequest = "request"
+)
+
+type ImpersonationEvent struct {
+	ID        int64     `json:"id"`
+	AdminUID  string    `json:"admin_uid"`
+	TargetUID string    `json:"target_uid"`
+	SessionID string    `json:"session_id,omitempty"`
+	Event     string    `json:"event"`
+	Reason    string    `json:"reason,omitempty"`
+	Method    string    `json:"method,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func LogImpersonationEvent(db *sql.DB, e ImpersonationEvent) error {
+	_, err := db.Exec(`
+		INSERT INTO impersonation_log (admin_uid, target_uid, session_id, event, reason, method, path, status, ip_address, created_at)
+		VALUES (?, ?, NULLIF(?, ''), ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, 0), NULLIF(?, ''), ?)`,
+		e.AdminUID, e.TargetUID, e.SessionID, e.Event, e.Reason, e.Method, e.Path, e.Status, e.IPAddress, time.Now().UTC())
+	return err
+}
+
+// GetImpersonationLog returns events newest first, optionally filtered by target and/or admin uid
+func GetImpersonationLog(db *sql.DB, targetUID, adminUID string, limit, offset int) ([]ImpersonationEvent, error) {
+	query := `
+		SELECT id, admin_uid, target_uid, COALESCE(session_id, ''), event, COALESCE(reason, ''),
+			COALESCE(method, ''), COALESCE(path, ''), COALESCE(status, 0), COALESCE(ip_address, ''), created_at
+		FROM impersonation_log
+		WHERE 1=1`
+	var args []interface{}
+	if targetUID != "" {
+		query += ` AND target_uid=?`
+		args = append(args, targetUID)
+	}
+	if adminUID != "" {
+		query += ` AND admin_uid=?`
+		args = append(args, adminUID)
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ImpersonationEvent{}
+	for rows.Next() {
+		var e ImpersonationEvent
+		if err := rows.Scan(&e.ID, &e.AdminUID, &e.TargetUID, &e.SessionID, &e.Event, &e.Reason,
+			&e.Method, &e.Path, &e.Status, &e.IPAddress, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,333 @@
+package invite_models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"sraraa/storage"
+)
+
+var (
+	ErrInviteInvalid   = errors.New("invite code is invalid or expired")
+	ErrInviteExhausted = errors.New("invite code has no uses left")
+	ErrInviteQuota     = errors.New("invite quota reached")
+)
+
+type Invite struct {
+	Code         string     `json:"code"`
+	CreatedByUID string     `json:"created_by_uid,omitempty"`
+	Email        string     `json:"email,omitempty"`
+	MaxUses      int        `json:"max_uses"`
+	Uses         int        `json:"uses"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Revoked      bool       `json:"revoked"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type WaitlistEntry struct {
+	ID         int        `json:"id"`
+	Email      string     `json:"email"`
+	Status     string     `json:"status"`
+	InviteCode string     `json:"invite_code,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+}
+
+// No 0/O or 1/I so codes survive being read out or retyped
+const inviteCharset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const inviteLength = 10
+
+func generateInviteCode() (string, error) {
+	b := make([]byte, inviteLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(inviteCharset))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = inviteCharset[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// NormalizeInviteCode makes user-typed codes comparable: uppercase, no spaces or dashes
+func NormalizeInviteCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// CreateInvite stores a new invite code. createdByUID is empty for codes minted by the system
+// (waitlist approvals); email binds the code to a single address.
+func CreateInvite(db *sql.DB, createdByUID, email string, maxUses int, expiresAt *time.Time) (*Invite, error) {
+	return createInvite(context.Background(), db, createdByUID, email, maxUses, expiresAt)
+}
+
+// execer is a connection or a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func createInvite(ctx context.Context, db execer, createdByUID, email string, maxUses int, expiresAt *time.Time) (*Invite, error) {
+	if maxUses <= 0 {
+		return nil, errors.New("max uses must be positive")
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := generateInviteCode()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = db.ExecContext(ctx, `
+			INSERT INTO invite_codes (code, created_by_uid, email, max_uses, expires_at)
+			VALUES (?, NULLIF(?, ''), NULLIF(?, ''), ?, ?)`,
+			code, createdByUID, email, maxUses, expiresAt)
+		if err != nil {
+			if storage.IsUniqueViolation(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		return &Invite{
+			Code:         code,
+			CreatedByUID: createdByUID,
+			Email:        email,
+			MaxUses:      maxUses,
+			ExpiresAt:    expiresAt,
+			CreatedAt:    time.Now().UTC(),
+		}, nil
+	}
+
+	return nil, errors.New("failed to generate a unique invite code")
+}
+
+// CountActiveInvitesByUser counts codes created by uid that are not revoked, expired or used up
+func CountActiveInvitesByUser(db *sql.DB, uid string) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM invite_codes
+		WHERE created_by_uid=? AND revoked=FALSE AND uses < max_uses
+		AND (expires_at IS NULL OR expires_at > ?)
+	`, uid, time.Now().UTC()).Scan(&count)
+	return count, err
+}
+
+func GetInvitesByUser(db *sql.DB, uid string) ([]Invite, error) {
+	rows, err := db.Query(`
+		SELECT code, COALESCE(created_by_uid, ''), COALESCE(email, ''), max_uses, uses, expires_at, revoked, created_at
+		FROM invite_codes
+		WHERE created_by_uid=?
+		ORDER BY created_at DESC
+	`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []Invite{}
+	for rows.Next() {
+		var inv Invite
+		var expires sql.NullTime
+		if err := rows.Scan(&inv.Code, &inv.CreatedByUID, &inv.Email, &inv.MaxUses, &inv.Uses, &expires, &inv.Revoked, &inv.CreatedAt); err != nil {
+			return nil, err
+		}
+		if expires.Valid {
+			inv.ExpiresAt = &expires.Time
+		}
+		invites = append(invites, inv)
+	}
+	return invites, rows.Err()
+}
+
+// RevokeInvite disables a code. Non-admins may only revoke their own codes (pass their uid as owner).
+func RevokeInvite(db *sql.DB, code, ownerUID string) error {
+	query := `UPDATE invite_codes SET revoked=TRUE WHERE code=?`
+	args := []interface{}{NormalizeInviteCode(code)}
+	if ownerUID != "" {
+		query += ` AND created_by_uid=?`
+		args = append(args, ownerUID)
+	}
+
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInviteInvalid
+	}
+	return nil
+}
+
+// RedeemInvite checks the code for email at now and records the use. Redeeming the same code
+// again for the same email (e.g. re-requesting the signup OTP) does not consume another use. The
+// use is taken by a guarded update, so concurrent signups cannot overspend a code.
+func RedeemInvite(ctx context.Context, db *sql.DB, code, email string, now time.Time) error {
+	code = NormalizeInviteCode(code)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var boundEmail sql.NullString
+	var expires sql.NullTime
+	var revoked bool
+	err = tx.QueryRowContext(ctx, `SELECT email, expires_at, revoked FROM invite_codes WHERE code=?`, code).
+		Scan(&boundEmail, &expires, &revoked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInviteInvalid
+		}
+		return err
+	}
+
+	if revoked || (expires.Valid && now.After(expires.Time)) {
+		return ErrInviteInvalid
+	}
+	if boundEmail.Valid && !strings.EqualFold(boundEmail.String, email) {
+		return ErrInviteInvalid
+	}
+
+	var alreadyRedeemed bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM invite_redemptions WHERE code=? AND email=?)`, code, email).Scan(&alreadyRedeemed)
+	if err != nil {
+		return err
+	}
+	if alreadyRedeemed {
+		return tx.Commit()
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE invite_codes SET uses = uses + 1 WHERE code=? AND uses < max_uses`, code)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrInviteExhausted
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO invite_redemptions (code, email) VALUES (?, ?)`, code, email); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// JoinWaitlist adds email to the waitlist; joining twice is a no-op
+func JoinWaitlist(db *sql.DB, email string) error {
+	_, err := db.Exec(`INSERT INTO waitlist (email) VALUES (?) ON CONFLICT (email) DO NOTHING`, email)
+	return err
+}
+
+// GetWaitlist returns entries with the given status (all when empty), oldest first
+func GetWaitlist(db *sql.DB, status string, limit, offset int) ([]WaitlistEntry, error) {
+	query := `SELECT id, email, status, COALESCE(invite_code, ''), created_at, approved_at FROM waitlist`
+	var args []interface{}
+	if status != "" {
+		query += ` WHERE status=?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at, id LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []WaitlistEntry{}
+	for rows.Next() {
+		var e WaitlistEntry
+		var approved sql.NullTime
+		if err := rows.Scan(&e.ID, &e.Email, &e.Status, &e.InviteCode, &e.CreatedAt, &approved); err != nil {
+			return nil, err
+		}
+		if approved.Valid {
+			e.ApprovedAt = &approved.Time
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// ApproveWaitlist approves pending entries, either the given emails or the oldest count entries,
+// and mints a single-use invite bound to each email. The approved entries are returned so the
+// caller can send the invite emails. An entry another approval claimed first is skipped, so
+// concurrent approvals never mint two invites for one email.
+func ApproveWaitlist(ctx context.Context, db *sql.DB, emails []string, count int, inviteTTL time.Duration, now time.Time) ([]WaitlistEntry, error) {
+	var pending []WaitlistEntry
+	var err error
+
+	if len(emails) > 0 {
+		for _, email := range emails {
+			var e WaitlistEntry
+			err = db.QueryRowContext(ctx, `SELECT id, email, status, created_at FROM waitlist WHERE email=? AND status='pending'`, email).
+				Scan(&e.ID, &e.Email, &e.Status, &e.CreatedAt)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			pending = append(pending, e)
+		}
+	} else {
+		pending, err = GetWaitlist(db, "pending", count, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now = now.UTC()
+	approved := make([]WaitlistEntry, 0, len(pending))
+	for _, e := range pending {
+		code, err := approveEntry(ctx, db, e, now.Add(inviteTTL), now)
+		if err != nil {
+			return approved, err
+		}
+		if code == "" {
+			continue
+		}
+
+		e.Status = "approved"
+		e.InviteCode = code
+		e.ApprovedAt = &now
+		approved = append(approved, e)
+	}
+
+	return approved, nil
+}
+
+// approveEntry claims a pending entry and mints its invite in one transaction. It returns the
+// invite code, or "" when the entry was no longer pending.
+func approveEntry(ctx context.Context, db *sql.DB, e WaitlistEntry, expires, now time.Time) (string, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE waitlist SET status='approved', approved_at=? WHERE id=? AND status='pending'`, now, e.ID)
+	if err != nil {
+		return "", err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return "", err
+	}
+
+	invite, err := createInvite(ctx, tx, "", e.Email, 1, &expires)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE waitlist SET invite_code=? WHERE id=?`, invite.Code, e.ID); err != nil {
+		return "", err
+	}
+	return invite.Code, tx.Commit()
+}
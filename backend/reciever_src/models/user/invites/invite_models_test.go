@@ -0,0 +1,88 @@
+package invite_models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"sraraa/db"
+	"sraraa/storage"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	store, err := storage.Open(storage.Memory)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := db.Migrate(store.DB, store.Dialect); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return store.DB
+}
+
+func TestRedeemInviteUses(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	now := time.Now()
+
+	invite, err := CreateInvite(d, "", "", 1, nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := RedeemInvite(ctx, d, invite.Code, "a@example.com", now); err != nil {
+		t.Fatalf("first redeem: %v", err)
+	}
+	// the same email again does not take another use
+	if err := RedeemInvite(ctx, d, invite.Code, "a@example.com", now); err != nil {
+		t.Fatalf("repeat redeem: %v", err)
+	}
+	if err := RedeemInvite(ctx, d, invite.Code, "b@example.com", now); !errors.Is(err, ErrInviteExhausted) {
+		t.Fatalf("second email: got %v, want ErrInviteExhausted", err)
+	}
+
+	var uses int
+	if err := d.QueryRow(`SELECT uses FROM invite_codes WHERE code=?`, invite.Code).Scan(&uses); err != nil || uses != 1 {
+		t.Fatalf("uses = %d, %v; want 1", uses, err)
+	}
+
+	expires := now.Add(time.Hour)
+	later, err := CreateInvite(d, "", "", 1, &expires)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := RedeemInvite(ctx, d, later.Code, "c@example.com", now.Add(2*time.Hour)); !errors.Is(err, ErrInviteInvalid) {
+		t.Fatalf("expired: got %v, want ErrInviteInvalid", err)
+	}
+}
+
+func TestApproveWaitlistOnce(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+
+	if err := JoinWaitlist(d, "w@example.com"); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	approved, err := ApproveWaitlist(ctx, d, []string{"w@example.com"}, 0, time.Hour, time.Now())
+	if err != nil || len(approved) != 1 || approved[0].InviteCode == "" {
+		t.Fatalf("approve = %+v, %v; want one entry with a code", approved, err)
+	}
+
+	approved, err = ApproveWaitlist(ctx, d, []string{"w@example.com"}, 0, time.Hour, time.Now())
+	if err != nil || len(approved) != 0 {
+		t.Fatalf("approve again = %+v, %v; want nothing", approved, err)
+	}
+
+	// a claim that lost the race mints nothing
+	code, err := approveEntry(ctx, d, WaitlistEntry{ID: 1, Email: "w@example.com"}, time.Now().Add(time.Hour), time.Now())
+	if err != nil || code != "" {
+		t.Fatalf("approveEntry on an approved entry = %q, %v", code, err)
+	}
+	var invites int
+	if err := d.QueryRow(`SELECT COUNT(*) FROM invite_codes WHERE email=?`, "w@example.com").Scan(&invites); err != nil || invites != 1 {
+		t.Fatalf("invites for the email = %d, %v; want 1", invites, err)
+	}
+}
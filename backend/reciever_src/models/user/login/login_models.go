@@ -1,14 +1,17 @@
 package login_models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
+
+	auth_utils "sraraa/reciever_src/utils/auth"
+	"sraraa/storage"
 )
 
-func GetUserIDByEmailOrUsername(db *sql.DB, login string) (int, error) {
-	var id int
-	err := db.QueryRow(`SELECT id FROM users WHERE email=? OR username=?`, login, login).Scan(&id)
+func GetUserIDByEmailOrUsername(ctx context.Context, s *storage.Store, login string) (int, error) {
+	id, err := s.Users.GetIDByLogin(ctx, login, auth_utils.CanonicalUsername(login))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, errors.New("user not found")
@@ -18,57 +21,44 @@ func GetUserIDByEmailOrUsername(db *sql.DB, login string) (int, error) {
 	return id, nil
 }
 
-func GetStoredPasswordByEmail(db *sql.DB, email string) (string, error) {
-	var password sql.NullString
-	err := db.QueryRow("SELECT password FROM users WHERE email=?", email).Scan(&password)
+func GetStoredPasswordByEmail(ctx context.Context, s *storage.Store, email string) (string, error) {
+	password, err := s.Users.GetPassword(ctx, email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return "", errors.New("user not found")
 		}
 		return "", err
 	}
-	if !password.Valid || password.String == "" {
+	if password == "" {
 		return "", errors.New("password not set")
 	}
-	return password.String, nil
+	return password, nil
 }
 
-func SaveLoginOTP(db *sql.DB, email, code string) error {
-	_, _ = db.Exec("DELETE FROM login_otps WHERE email=?", email)
-	_, err := db.Exec("INSERT INTO login_otps (email, code) VALUES (?, ?)", email, code)
-	return err
+func SaveLoginOTP(ctx context.Context, s *storage.Store, email, code string) error {
+	return s.OTPs.Save(ctx, storage.PurposeLogin, email, code)
 }
 
-func GetLoginOTP(db *sql.DB, email string) (string, time.Time, error) {
-	var code string
-	var created time.Time
-	err := db.QueryRow("SELECT code, created_at FROM login_otps WHERE email=? ORDER BY created_at DESC LIMIT 1", email).Scan(&code, &created)
-	return code, created, err
+func GetLoginOTP(ctx context.Context, s *storage.Store, email string) (string, time.Time, error) {
+	return s.OTPs.Get(ctx, storage.PurposeLogin, email)
 }
 
-func DeleteLoginOTP(db *sql.DB, email string) error {
-	_, err := db.Exec("DELETE FROM login_otps WHERE email=?", email)
-	return err
+func DeleteLoginOTP(ctx context.Context, s *storage.Store, email string) error {
+	return s.OTPs.Delete(ctx, storage.PurposeLogin, email)
 }
 
-func AddLoginOTPRequest(db *sql.DB, email string) error {
-	_, err := db.Exec("INSERT INTO login_otp_requests (email) VALUES (?)", email)
-	return err
+func AddLoginOTPRequest(ctx context.Context, s *storage.Store, email string) error {
+	return s.OTPs.AddRequest(ctx, storage.PurposeLogin, email)
 }
 
-func CountLoginRequestsLastHour(db *sql.DB, email string) (int, error) {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM login_otp_requests WHERE email=? AND request_time > datetime('now','-1 hour')", email).Scan(&count)
-	return count, err
+func CountLoginRequestsLastHour(ctx context.Context, s *storage.Store, email string, now time.Time) (int, error) {
+	return s.OTPs.CountRequestsSince(ctx, storage.PurposeLogin, email, now.Add(-time.Hour))
 }
 
-func SetLoginCooldown(db *sql.DB, email string, until time.Time) error {
-	_, err := db.Exec("INSERT OR REPLACE INTO login_otp_cooldowns (email, cooldown_until) VALUES (?, ?)", email, until)
-	return err
+func SetLoginCooldown(ctx context.Context, s *storage.Store, email string, until time.Time) error {
+	return s.OTPs.SetCooldown(ctx, storage.PurposeLogin, email, until)
 }
 
-func GetLoginCooldown(db *sql.DB, email string) (time.Time, error) {
-	var t time.Time
-	err := db.QueryRow("SELECT cooldown_until FROM login_otp_cooldowns WHERE email=?", email).Scan(&t)
-	return t, err
+func GetLoginCooldown(ctx context.Context, s *storage.Store, email string) (time.Time, error) {
+	return s.OTPs.GetCooldown(ctx, storage.PurposeLogin, email)
 }
@@ -1,30 +1,73 @@
 package onboard_models
 
 import (
-	"database/sql"
+	"context"
+
+	"sraraa/storage"
 )
 
-func CreateUser(db *sql.DB, email string) error {
-	_, err := db.Exec("INSERT OR IGNORE INTO users (email) VALUES (?)", email)
-	return err
+func CreateUser(ctx context.Context, s *storage.Store, email string) error {
+	return s.Users.Create(ctx, email)
 }
 
-func SetUniqueID(db *sql.DB, email, uid string) error {
-	_, err := db.Exec(`UPDATE users SET uid=? WHERE email=?`, uid, email)
-	return err
+func SetUniqueID(ctx context.Context, s *storage.Store, email, uid string) error {
+	return s.Users.SetUID(ctx, email, uid)
 }
 
-func HasUID(db *sql.DB, email string) (bool, error) {
-	var uid sql.NullString
-	err := db.QueryRow(`SELECT uid FROM users WHERE email=?`, email).Scan(&uid)
+func HasUID(ctx context.Context, s *storage.Store, email string) (bool, error) {
+	u, err := s.Users.GetByEmail(ctx, email)
 	if err != nil {
 		return false, err
 	}
-	return uid.Valid && uid.String != "", nil
+	return u.UID != "", nil
+}
+
+func UniqueIDExists(ctx context.Context, s *storage.Store, uid string) (bool, error) {
+	return s.Users.UIDExists(ctx, uid)
+}
+
+func GetUIDByEmail(ctx context.Context, s *storage.Store, email string) (string, error) {
+	u, err := s.Users.GetByEmail(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	return u.UID, nil
+}
+
+// OnboardingState reports which onboarding steps a verified account still has to complete
+type OnboardingState struct {
+	Email     string          `json:"email"`
+	Verified  bool            `json:"verified"`
+	Steps     map[string]bool `json:"steps"`
+	Remaining []string        `json:"remaining"`
+	Complete  bool            `json:"complete"`
 }
 
-func UniqueIDExists(db *sql.DB, uid string) (bool, error) {
-	var count int
-	err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE uid=?`, uid).Scan(&count)
-	return count > 0, err
+// OnboardingSteps lists the steps in the order the client should present them
+var OnboardingSteps = []string{"username", "fullname", "password"}
+
+func GetOnboardingState(ctx context.Context, s *storage.Store, email string) (*OnboardingState, error) {
+	u, err := s.Users.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &OnboardingState{
+		Email:    email,
+		Verified: u.Verified,
+		Steps: map[string]bool{
+			"username": u.Username != "",
+			"fullname": u.Fullname != "",
+			"password": u.HasPassword,
+		},
+		Remaining: []string{},
+	}
+	for _, step := range OnboardingSteps {
+		if !state.Steps[step] {
+			state.Remaining = append(state.Remaining, step)
+		}
+	}
+	state.Complete = len(state.Remaining) == 0
+
+	return state, nil
 }
@@ -0,0 +1,158 @@
+package profile_models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// AvatarImageType is the user_images type shown as a user's avatar
+	AvatarImageType = "profile"
+	CoverImageType  = "cover"
+)
+
+// Profile visibility settings
+const (
+	VisibilityPublic  = "public"  // anyone, including logged-out visitors
+	VisibilityMembers = "members" // signed-in users only
+	VisibilityPrivate = "private" // only the owner
+)
+
+var ErrInvalidVisibility = errors.New("visibility must be public, members or private")
+
+// ProfileCard is the compact public view of a user used when rendering lists
+type ProfileCard struct {
+	UID       string `json:"uid"`
+	Username  string `json:"username"`
+	Fullname  string `json:"fullname"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+// GetProfileCards looks up verified users by uid or canonical username in one query. Users that
+// do not exist, have not finished signing up or are suspended are left out, as are profiles
+// viewerUID may not see: private ones unless they are the viewer's own, and members-only ones
+// when viewerUID is empty (not signed in).
+func GetProfileCards(db *sql.DB, viewerUID string, uids, canonicalUsernames []string) ([]ProfileCard, error) {
+	if len(uids) == 0 && len(canonicalUsernames) == 0 {
+		return []ProfileCard{}, nil
+	}
+
+	var conds []string
+	var args []interface{}
+	args = append(args, AvatarImageType, VisibilityPublic, VisibilityMembers, viewerUID, viewerUID)
+	if len(uids) > 0 {
+		conds = append(conds, `u.uid IN (`+placeholders(len(uids))+`)`)
+		for _, uid := range uids {
+			args = append(args, uid)
+		}
+	}
+	if len(canonicalUsernames) > 0 {
+		conds = append(conds, `u.username_canonical IN (`+placeholders(len(canonicalUsernames))+`)`)
+		for _, name := range canonicalUsernames {
+			args = append(args, name)
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT u.uid, u.username, CASE WHEN u.show_fullname THEN COALESCE(u.fullname, '') ELSE '' END,
+			COALESCE(i.image_url, '')
+		FROM users u
+		LEFT JOIN user_images i ON i.uid = u.uid AND i.type = ?
+		WHERE u.verified = TRUE AND u.suspended_at IS NULL AND u.username IS NOT NULL
+			AND (u.profile_visibility = ? OR (u.profile_visibility = ? AND ? <> '') OR u.uid = ?)
+			AND (`+strings.Join(conds, " OR ")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cards := []ProfileCard{}
+	for rows.Next() {
+		var c ProfileCard
+		if err := rows.Scan(&c.UID, &c.Username, &c.Fullname, &c.AvatarURL); err != nil {
+			return nil, err
+		}
+		cards = append(cards, c)
+	}
+	return cards, rows.Err()
+}
+
+// ProfileStats are the social counters shown on a profile. They stay zero until following and
+// posting exist; clients can already lay them out.
+type ProfileStats struct {
+	Followers int `json:"followers"`
+	Following int `json:"following"`
+	Posts     int `json:"posts"`
+}
+
+// PublicProfile is what GET /api/v1/profiles/{username} shows
+type PublicProfile struct {
+	UID             string       `json:"uid"`
+	Username        string       `json:"username"`
+	Fullname        string       `json:"fullname,omitempty"`
+	JoinedAt        time.Time    `json:"joined_at"`
+	ProfileImageURL string       `json:"profile_image_url,omitempty"`
+	CoverImageURL   string       `json:"cover_image_url,omitempty"`
+	Stats           ProfileStats `json:"stats"`
+
+	Visibility string `json:"-"`
+}
+
+// GetPublicProfile returns the profile of a verified, unsuspended user or sql.ErrNoRows
+func GetPublicProfile(db *sql.DB, canonicalUsername string) (*PublicProfile, error) {
+	var p PublicProfile
+	var showFullname bool
+	err := db.QueryRow(`
+		SELECT u.uid, u.username, COALESCE(u.fullname, ''), u.show_fullname, u.profile_visibility, u.created_at,
+			COALESCE(avatar.image_url, ''), COALESCE(cover.image_url, '')
+		FROM users u
+		LEFT JOIN user_images avatar ON avatar.uid = u.uid AND avatar.type = ?
+		LEFT JOIN user_images cover ON cover.uid = u.uid AND cover.type = ?
+		WHERE u.username_canonical = ? AND u.verified = TRUE AND u.suspended_at IS NULL AND u.username IS NOT NULL`,
+		AvatarImageType, CoverImageType, canonicalUsername,
+	).Scan(&p.UID, &p.Username, &p.Fullname, &showFullname, &p.Visibility, &p.JoinedAt,
+		&p.ProfileImageURL, &p.CoverImageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if !showFullname {
+		p.Fullname = ""
+	}
+	p.JoinedAt = p.JoinedAt.UTC()
+	return &p, nil
+}
+
+// PrivacySettings control what other people see of a user
+type PrivacySettings struct {
+	ProfileVisibility string `json:"profile_visibility"`
+	ShowFullname      bool   `json:"show_fullname"`
+}
+
+func GetPrivacySettings(db *sql.DB, uid string) (*PrivacySettings, error) {
+	var s PrivacySettings
+	err := db.QueryRow(`SELECT profile_visibility, show_fullname FROM users WHERE uid=?`, uid).
+		Scan(&s.ProfileVisibility, &s.ShowFullname)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func UpdatePrivacySettings(db *sql.DB, uid string, s PrivacySettings) error {
+	switch s.ProfileVisibility {
+	case VisibilityPublic, VisibilityMembers, VisibilityPrivate:
+	default:
+		return ErrInvalidVisibility
+	}
+
+	_, err := db.Exec(`UPDATE users SET profile_visibility=?, show_fullname=? WHERE uid=?`,
+		s.ProfileVisibility, s.ShowFullname, uid)
+	return err
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
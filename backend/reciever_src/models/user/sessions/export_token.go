@@ -0,0 +1,49 @@
+package session_models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ExportAudience marks tokens that only allow downloading one data export archive
+const ExportAudience = "export-download"
+
+// ExportDownloadClaims carry the export id in ID and its owner's uid in Subject
+type ExportDownloadClaims struct {
+	jwt.RegisteredClaims
+}
+
+// CreateExportDownloadToken issues the token embedded in a time-limited download link
+func CreateExportDownloadToken(exportID, uid string, expiresAt time.Time) (string, error) {
+	if exportID == "" || uid == "" {
+		return "", errors.New("export id and uid cannot be empty")
+	}
+
+	claims := ExportDownloadClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        exportID,
+			Subject:   uid,
+			Audience:  jwt.ClaimStrings{ExportAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return signToken(claims)
+}
+
+// ValidateExportDownloadToken returns the export id and uid a download token was issued for
+func ValidateExportDownloadToken(tokenStr string) (string, string, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &ExportDownloadClaims{}, verificationKey, jwt.WithAudience(ExportAudience), validMethods)
+	if err != nil {
+		return "", "", err
+	}
+
+	claims, ok := token.Claims.(*ExportDownloadClaims)
+	if !ok || !token.Valid || claims.ID == "" || claims.Subject == "" {
+		return "", "", errors.New("invalid download token")
+	}
+	return claims.ID, claims.Subject, nil
+}
@@ -0,0 +1,50 @@
+package session_models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OnboardingAudience marks tokens that may only be used on the /api/onboarding endpoints
+const OnboardingAudience = "onboarding"
+
+// OnboardingClaims identify a verified email that is still completing onboarding.
+// The email is carried in the subject.
+type OnboardingClaims struct {
+	jwt.RegisteredClaims
+}
+
+// CreateOnboardingToken issues the scoped token handed out after signup OTP verification
+func CreateOnboardingToken(email string, duration time.Duration) (string, error) {
+	if email == "" {
+		return "", errors.New("email cannot be empty")
+	}
+
+	now := time.Now()
+	claims := OnboardingClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   email,
+			Audience:  jwt.ClaimStrings{OnboardingAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	return signToken(claims)
+}
+
+// ValidateOnboardingToken returns the email an onboarding token was issued for
+func ValidateOnboardingToken(tokenStr string) (string, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &OnboardingClaims{}, verificationKey, jwt.WithAudience(OnboardingAudience), validMethods)
+	if err != nil {
+		return "", err
+	}
+
+	claims, ok := token.Claims.(*OnboardingClaims)
+	if !ok || !token.Valid || claims.Subject == "" {
+		return "", errors.New("invalid onboarding token")
+	}
+	return claims.Subject, nil
+}
@@ -1,18 +1,18 @@
 package session_models
 
 import (
+	"context"
 	"crypto/rand"
-	"database/sql"
 	"encoding/hex"
 	"errors"
-	"log"
+	"log/slog"
 	"time"
 
+	"sraraa/storage"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var JwtSecret = []byte("2669b02cb3dfd75154206495c9d460e09080cc398a5c02abe2ede88e883dfd26")
-
 type SessionClaims struct {
 	UserID   int    `json:"user_id"`
 	Email    string `json:"email"`
@@ -20,23 +20,67 @@ type SessionClaims struct {
 	Fullname string `json:"fullname"`
 	Verified bool   `json:"verified"`
 	UID      string `json:"uid"`
+	// Act identifies the admin behind an impersonation session (RFC 8693 actor claim)
+	Act *ActorClaim `json:"act,omitempty"`
 	jwt.RegisteredClaims
+
+	// Set when the caller authenticated with a personal access token instead of a session.
+	// Never part of the JWT.
+	AccessTokenID int64    `json:"-"`
+	Scopes        []string `json:"-"`
+}
+
+type ActorClaim struct {
+	Sub string `json:"sub"`
 }
 
-func CreateSession(db *sql.DB, userID int, duration time.Duration, userAgent, ip string) (string, error) {
+// ImpersonatorUID returns the uid of the admin impersonating the user, or "" for normal sessions
+func (c *SessionClaims) ImpersonatorUID() string {
+	if c.Act == nil {
+		return ""
+	}
+	return c.Act.Sub
+}
+
+// HasScope reports whether the credential may be used for scope. Sessions carry every scope,
+// personal access tokens only the ones they were created with.
+func (c *SessionClaims) HasScope(scope string) bool {
+	if c.AccessTokenID == 0 {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateSession(ctx context.Context, s *storage.Store, userID int, duration time.Duration, userAgent, ip string) (string, error) {
+	return createSession(ctx, s, userID, duration, userAgent, ip, "")
+}
+
+// CreateImpersonationSession mints a session for userID on behalf of adminUID. The token carries
+// an act claim naming the admin and the stored session is marked so it shows in the user's
+// session list.
+func CreateImpersonationSession(ctx context.Context, s *storage.Store, userID int, adminUID string, duration time.Duration, userAgent, ip string) (string, error) {
+	if adminUID == "" {
+		return "", errors.New("admin uid cannot be empty")
+	}
+	return createSession(ctx, s, userID, duration, userAgent, ip, adminUID)
+}
+
+func createSession(ctx context.Context, s *storage.Store, userID int, duration time.Duration, userAgent, ip, actorUID string) (string, error) {
 	if userID <= 0 {
 		return "", errors.New("invalid user ID")
 	}
 
-	var email, username, fullname, uid string
-	var verified bool
-	err := db.QueryRow(`SELECT email, username, fullname, verified, uid FROM users WHERE id=?`, userID).
-		Scan(&email, &username, &fullname, &verified, &uid)
+	user, err := s.Users.GetByID(ctx, userID)
 	if err != nil {
 		return "", err
 	}
 
-	if uid == "" {
+	if user.UID == "" {
 		return "", errors.New("user does not have a UID assigned")
 	}
 
@@ -48,138 +92,142 @@ func CreateSession(db *sql.DB, userID int, duration time.Duration, userAgent, ip
 
 	claims := SessionClaims{
 		UserID:   userID,
-		Email:    email,
-		Username: username,
-		Fullname: fullname,
-		Verified: verified,
-		UID:      uid,
+		Email:    user.Email,
+		Username: user.Username,
+		Fullname: user.Fullname,
+		Verified: user.Verified,
+		UID:      user.UID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        hex.EncodeToString(nonce),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	if actorUID != "" {
+		claims.Act = &ActorClaim{Sub: actorUID}
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(JwtSecret)
+	signedToken, err := signToken(claims)
 	if err != nil {
 		return "", err
 	}
 
-	_, err = db.Exec(`
-		INSERT INTO sessions (uid, session_token, user_agent, ip_address, expires_at)
-		VALUES (?, ?, ?, ?, ?)`,
-		uid, signedToken, userAgent, ip, time.Now().Add(duration))
+	err = s.Sessions.Create(ctx, &storage.Session{
+		UID:            user.UID,
+		Token:          signedToken,
+		UserAgent:      userAgent,
+		IPAddress:      ip,
+		ExpiresAt:      claims.ExpiresAt.Time,
+		ImpersonatedBy: actorUID,
+	})
 	if err != nil {
-		log.Println("CreateSession insert failed:", err)
+		slog.Error("CreateSession insert failed", "err", err)
 		return "", err
 	}
 
 	return signedToken, nil
 }
 
-func DeleteSession(db *sql.DB, token string) error {
-	res, err := db.Exec(`DELETE FROM sessions WHERE session_token=?`, token)
+// DeleteSession removes the session for token and reports whether there was one
+func DeleteSession(ctx context.Context, s *storage.Store, token string) (bool, error) {
+	rows, err := s.Sessions.Delete(ctx, token)
 	if err != nil {
-		return err
+		return false, err
 	}
-	rows, _ := res.RowsAffected()
-	log.Printf("Deleted %d session(s) with token=%s\n", rows, token)
-	return nil
+	slog.Info("Deleted session", "count", rows)
+	return rows > 0, nil
 }
 
-func DeleteAllSessions(db *sql.DB, userID int) error {
-	var uid string
-	err := db.QueryRow(`SELECT uid FROM users WHERE id=?`, userID).Scan(&uid)
+func DeleteAllSessions(ctx context.Context, s *storage.Store, userID int) error {
+	user, err := s.Users.GetByID(ctx, userID)
 	if err != nil {
 		return err
 	}
 
-	if uid == "" {
+	if user.UID == "" {
 		return errors.New("user does not have a UID")
 	}
 
-	res, err := db.Exec(`DELETE FROM sessions WHERE uid=?`, uid)
+	rows, err := s.Sessions.DeleteByUID(ctx, user.UID)
 	if err != nil {
 		return err
 	}
-	rows, _ := res.RowsAffected()
-	log.Printf("Deleted %d session(s) for UID=%s\n", rows, uid)
+	slog.Info("Deleted sessions", "count", rows, "uid", user.UID)
 	return nil
 }
 
-func DeleteAllSessionsByUID(db *sql.DB, uid string) error {
+func DeleteAllSessionsByUID(ctx context.Context, s *storage.Store, uid string) error {
 	if uid == "" {
 		return errors.New("uid cannot be empty")
 	}
 
-	res, err := db.Exec(`DELETE FROM sessions WHERE uid=?`, uid)
+	rows, err := s.Sessions.DeleteByUID(ctx, uid)
 	if err != nil {
 		return err
 	}
-	rows, _ := res.RowsAffected()
-	log.Printf("Deleted %d session(s) for UID=%s\n", rows, uid)
+	slog.Info("Deleted sessions", "count", rows, "uid", uid)
 	return nil
 }
 
-func GetSessionsByUID(db *sql.DB, uid string) ([]map[string]interface{}, error) {
+// DeleteOtherSessions logs a user out everywhere except the session making the request
+func DeleteOtherSessions(ctx context.Context, s *storage.Store, uid, keepToken string) error {
+	if uid == "" {
+		return errors.New("uid cannot be empty")
+	}
+
+	rows, err := s.Sessions.DeleteOthers(ctx, uid, keepToken)
+	if err != nil {
+		return err
+	}
+	slog.Info("Deleted other sessions", "count", rows, "uid", uid)
+	return nil
+}
+
+func GetSessionsByUID(ctx context.Context, s *storage.Store, uid string) ([]map[string]interface{}, error) {
 	if uid == "" {
 		return nil, errors.New("uid cannot be empty")
 	}
 
-	rows, err := db.Query(`
-		SELECT session_token, user_agent, ip_address, created_at, expires_at 
-		FROM sessions 
-		WHERE uid=? AND expires_at > datetime('now')
-		ORDER BY created_at DESC
-	`, uid)
+	active, err := s.Sessions.ListActive(ctx, uid, time.Now())
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
 	var sessions []map[string]interface{}
-	for rows.Next() {
-		var token, userAgent, ipAddress string
-		var createdAt, expiresAt time.Time
-		if err := rows.Scan(&token, &userAgent, &ipAddress, &createdAt, &expiresAt); err != nil {
-			continue
-		}
+	for _, s := range active {
 		sessions = append(sessions, map[string]interface{}{
-			"session_token": token,
-			"user_agent":    userAgent,
-			"ip_address":    ipAddress,
-			"created_at":    createdAt,
-			"expires_at":    expiresAt,
+			"id":              s.ID,
+			"impersonated_by": s.ImpersonatedBy,
+			"session_token":   s.Token,
+			"user_agent":      s.UserAgent,
+			"ip_address":      s.IPAddress,
+			"created_at":      s.CreatedAt,
+			"expires_at":      s.ExpiresAt,
 		})
 	}
 	return sessions, nil
 }
 
-func CountActiveSessions(db *sql.DB, uid string) (int, error) {
+func CountActiveSessions(ctx context.Context, s *storage.Store, uid string) (int, error) {
 	if uid == "" {
 		return 0, errors.New("uid cannot be empty")
 	}
+	return s.Sessions.CountActive(ctx, uid, time.Now())
+}
 
-	var count int
-	err := db.QueryRow(`
-		SELECT COUNT(*) 
-		FROM sessions 
-		WHERE uid=? AND expires_at > datetime('now')
-	`, uid).Scan(&count)
-
-	return count, err
+// SessionExists reports whether the token is still stored, i.e. has not been logged out
+func SessionExists(ctx context.Context, s *storage.Store, token string) (bool, error) {
+	return s.Sessions.Exists(ctx, token)
 }
 
 func ValidateSessionToken(tokenStr string) (*SessionClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &SessionClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return JwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &SessionClaims{}, verificationKey, validMethods)
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*SessionClaims); ok && token.Valid {
+	// Scoped tokens (e.g. onboarding) share the signing key but carry an audience and no UID
+	if claims, ok := token.Claims.(*SessionClaims); ok && token.Valid && len(claims.Audience) == 0 && claims.UID != "" {
 		return claims, nil
 	}
 	return nil, errors.New("invalid session token")
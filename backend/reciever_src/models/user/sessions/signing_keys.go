@@ -0,0 +1,235 @@
+package session_models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultKeysDir holds the Ed25519 signing keys when SESSION_KEYS_DIR is not set
+const DefaultKeysDir = "keys"
+
+// SigningKey is one Ed25519 key pair. KID is the RFC 7638 thumbprint of the public key.
+type SigningKey struct {
+	KID     string
+	Private ed25519.PrivateKey
+	Public  ed25519.PublicKey
+}
+
+// JWK is the public part of a signing key as published in the JWKS
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+var (
+	keysMu     sync.RWMutex
+	activeKey  *SigningKey
+	keysByKID  map[string]*SigningKey
+	keysLoaded bool
+)
+
+// LoadSigningKeys reads every *.pem Ed25519 private key in dir. The most recently modified file
+// signs new tokens, the others stay valid for verification so keys can be rotated by adding a new
+// file and removing the old one once its tokens have expired. An empty dir gets a fresh key.
+func LoadSigningKeys(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create keys dir: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	if len(paths) == 0 {
+		path, err := GenerateSigningKey(dir)
+		if err != nil {
+			return err
+		}
+		slog.Info("Generated new session signing key", "path", path)
+		paths = []string{path}
+	}
+
+	// Newest last
+	sort.Slice(paths, func(i, j int) bool {
+		return modTime(paths[i]) < modTime(paths[j])
+	})
+
+	byKID := make(map[string]*SigningKey, len(paths))
+	var newest *SigningKey
+	for _, path := range paths {
+		key, err := readSigningKey(path)
+		if err != nil {
+			return fmt.Errorf("failed to load signing key %s: %v", path, err)
+		}
+		byKID[key.KID] = key
+		newest = key
+	}
+
+	keysMu.Lock()
+	activeKey = newest
+	keysByKID = byKID
+	keysLoaded = true
+	keysMu.Unlock()
+
+	slog.Info("Loaded session signing keys", "count", len(byKID), "active_kid", newest.KID)
+	return nil
+}
+
+// GenerateSigningKey writes a new Ed25519 key to dir as <kid>.pem and returns its path
+func GenerateSigningKey(dir string) (string, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, Thumbprint(priv.Public().(ed25519.PublicKey))+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func readSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 private key")
+	}
+
+	pub := priv.Public().(ed25519.PublicKey)
+	return &SigningKey{KID: Thumbprint(pub), Private: priv, Public: pub}, nil
+}
+
+func modTime(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.ModTime().UnixNano()
+}
+
+// Thumbprint is the RFC 7638 JWK thumbprint of an Ed25519 public key
+func Thumbprint(pub ed25519.PublicKey) string {
+	x := base64.RawURLEncoding.EncodeToString(pub)
+	sum := sha256.Sum256([]byte(`{"crv":"Ed25519","kty":"OKP","x":"` + x + `"}`))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ErrKeysNotLoaded is returned when tokens are signed or verified before LoadSigningKeys
+var ErrKeysNotLoaded = errors.New("session signing keys not loaded")
+
+// ensureKeys checks that main has loaded the keys from the configured SESSION_KEYS_DIR
+func ensureKeys() error {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	if !keysLoaded {
+		return ErrKeysNotLoaded
+	}
+	return nil
+}
+
+// signToken signs claims with the active key and sets its kid in the header
+func signToken(claims jwt.Claims) (string, error) {
+	if err := ensureKeys(); err != nil {
+		return "", err
+	}
+
+	keysMu.RLock()
+	key := activeKey
+	keysMu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.Private)
+}
+
+// verificationKey is the jwt.Keyfunc for tokens signed by signToken
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if err := ensureKeys(); err != nil {
+		return nil, err
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	keysMu.RLock()
+	key, ok := keysByKID[kid]
+	keysMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key.Public, nil
+}
+
+// validMethods restricts parsing to EdDSA so a token cannot pick a weaker algorithm
+var validMethods = jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()})
+
+// PublicJWKs returns the public keys for the JWKS endpoint, active key first
+func PublicJWKs() ([]JWK, error) {
+	if err := ensureKeys(); err != nil {
+		return nil, err
+	}
+
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+
+	keys := make([]JWK, 0, len(keysByKID))
+	keys = append(keys, toJWK(activeKey))
+	for kid, key := range keysByKID {
+		if kid != activeKey.KID {
+			keys = append(keys, toJWK(key))
+		}
+	}
+	sort.SliceStable(keys[1:], func(i, j int) bool {
+		return strings.Compare(keys[1+i].Kid, keys[1+j].Kid) < 0
+	})
+	return keys, nil
+}
+
+func toJWK(key *SigningKey) JWK {
+	return JWK{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(key.Public),
+		Kid: key.KID,
+		Use: "sig",
+		Alg: jwt.SigningMethodEdDSA.Alg(),
+	}
+}
@@ -1,57 +1,48 @@
 package signup_models
 
 import (
-	"database/sql"
+	"context"
 	"time"
+
+	"sraraa/storage"
 )
 
-func IsVerified(db *sql.DB, email string) (bool, error) {
-	var verified bool
-	err := db.QueryRow("SELECT verified FROM users WHERE email=?", email).Scan(&verified)
-	return verified, err
+func IsVerified(ctx context.Context, s *storage.Store, email string) (bool, error) {
+	u, err := s.Users.GetByEmail(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	return u.Verified, nil
 }
 
-func MarkVerified(db *sql.DB, email string) error {
-	_, err := db.Exec("UPDATE users SET verified=1 WHERE email=?", email)
-	return err
+func MarkVerified(ctx context.Context, s *storage.Store, email string) error {
+	return s.Users.MarkVerified(ctx, email)
 }
 
-func SaveOTP(db *sql.DB, email, code string) error {
-	_, _ = db.Exec("DELETE FROM signup_otps WHERE email=?", email)
-	_, err := db.Exec("INSERT INTO signup_otps (email, code) VALUES (?, ?)", email, code)
-	return err
+func SaveOTP(ctx context.Context, s *storage.Store, email, code string) error {
+	return s.OTPs.Save(ctx, storage.PurposeSignup, email, code)
 }
 
-func GetOTP(db *sql.DB, email string) (string, time.Time, error) {
-	var code string
-	var created time.Time
-	err := db.QueryRow("SELECT code, created_at FROM signup_otps WHERE email=? ORDER BY created_at DESC LIMIT 1", email).Scan(&code, &created)
-	return code, created, err
+func GetOTP(ctx context.Context, s *storage.Store, email string) (string, time.Time, error) {
+	return s.OTPs.Get(ctx, storage.PurposeSignup, email)
 }
 
-func DeleteOTP(db *sql.DB, email string) error {
-	_, err := db.Exec("DELETE FROM signup_otps WHERE email=?", email)
-	return err
+func DeleteOTP(ctx context.Context, s *storage.Store, email string) error {
+	return s.OTPs.Delete(ctx, storage.PurposeSignup, email)
 }
 
-func AddOTPRequest(db *sql.DB, email string) error {
-	_, err := db.Exec("INSERT INTO signup_otp_requests (email) VALUES (?)", email)
-	return err
+func AddOTPRequest(ctx context.Context, s *storage.Store, email string) error {
+	return s.OTPs.AddRequest(ctx, storage.PurposeSignup, email)
 }
 
-func CountRequestsLastHour(db *sql.DB, email string) (int, error) {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM signup_otp_requests WHERE email=? AND request_time > datetime('now','-1 hour')", email).Scan(&count)
-	return count, err
+func CountRequestsLastHour(ctx context.Context, s *storage.Store, email string, now time.Time) (int, error) {
+	return s.OTPs.CountRequestsSince(ctx, storage.PurposeSignup, email, now.Add(-time.Hour))
 }
 
-func SetCooldown(db *sql.DB, email string, until time.Time) error {
-	_, err := db.Exec("INSERT OR REPLACE INTO signup_otp_cooldowns (email, cooldown_until) VALUES (?, ?)", email, until)
-	return err
+func SetCooldown(ctx context.Context, s *storage.Store, email string, until time.Time) error {
+	return s.OTPs.SetCooldown(ctx, storage.PurposeSignup, email, until)
 }
 
-func GetCooldown(db *sql.DB, email string) (time.Time, error) {
-	var t time.Time
-	err := db.QueryRow("SELECT cooldown_until FROM signup_otp_cooldowns WHERE email=?", email).Scan(&t)
-	return t, err
+func GetCooldown(ctx context.Context, s *storage.Store, email string) (time.Time, error) {
+	return s.OTPs.GetCooldown(ctx, storage.PurposeSignup, email)
 }
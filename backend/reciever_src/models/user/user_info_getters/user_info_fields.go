@@ -0,0 +1,91 @@
+package user_info_getter_models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrUnknownUserField = errors.New("unknown user field")
+
+// userInfoColumns maps the fields internal services may read to their users column. Email,
+// password and anything else sensitive is deliberately absent.
+var userInfoColumns = map[string]string{
+	"uid":        "uid",
+	"user_id":    "id",
+	"username":   "username",
+	"fullname":   "fullname",
+	"verified":   "verified",
+	"role":       "role",
+	"created_at": "created_at",
+}
+
+// UserInfoFields lists the readable fields in their default order
+var UserInfoFields = []string{"uid", "user_id", "username", "fullname", "verified", "role", "created_at"}
+
+// GetUserFields reads the requested fields of one user in a single query. No fields means all of
+// UserInfoFields.
+func GetUserFields(db *sql.DB, uid string, fields []string) (map[string]interface{}, error) {
+	if uid == "" {
+		return nil, errors.New("uid cannot be empty")
+	}
+	if len(fields) == 0 {
+		fields = UserInfoFields
+	}
+
+	requested := map[string]bool{}
+	for _, f := range fields {
+		if _, ok := userInfoColumns[f]; !ok {
+			return nil, ErrUnknownUserField
+		}
+		requested[f] = true
+	}
+
+	// Keep a stable order and drop duplicates
+	fields = []string{}
+	columns := []string{}
+	for _, f := range UserInfoFields {
+		if requested[f] {
+			fields = append(fields, f)
+			columns = append(columns, userInfoColumns[f])
+		}
+	}
+
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	// A missing user is returned as sql.ErrNoRows
+	err := db.QueryRow(`SELECT `+strings.Join(columns, ", ")+` FROM users WHERE uid=?`, uid).Scan(ptrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	info := make(map[string]interface{}, len(fields))
+	for i, f := range fields {
+		switch v := values[i].(type) {
+		case []byte:
+			info[f] = string(v)
+		case time.Time:
+			info[f] = v.UTC()
+		case int64:
+			if f == "verified" {
+				info[f] = v != 0
+			} else {
+				info[f] = v
+			}
+		case nil:
+			if f == "verified" {
+				info[f] = false
+			} else {
+				info[f] = ""
+			}
+		default:
+			info[f] = v
+		}
+	}
+	return info, nil
+}
@@ -1,164 +1,98 @@
 package user_info_getter_models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"sraraa/db"
+	"sraraa/storage"
 	"time"
 )
 
-func GetUserEmailByUID(uid string) (string, error) {
+// userByUID loads the user for the field getters below
+func userByUID(ctx context.Context, s *storage.Store, uid string) (*storage.User, error) {
 	if uid == "" {
-		return "", errors.New("uid cannot be empty")
+		return nil, errors.New("uid cannot be empty")
 	}
-	var value sql.NullString
-	err := db.DB.QueryRow(`SELECT email FROM users WHERE uid=?`, uid).Scan(&value)
+	u, err := s.Users.GetByUID(ctx, uid)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", errors.New("user not found")
+			return nil, errors.New("user not found")
 		}
-		return "", err
-	}
-	if value.Valid {
-		return value.String, nil
+		return nil, err
 	}
-	return "", nil
+	return u, nil
 }
 
-func GetUsernameByUID(uid string) (string, error) {
-	if uid == "" {
-		return "", errors.New("uid cannot be empty")
-	}
-	var value sql.NullString
-	err := db.DB.QueryRow(`SELECT username FROM users WHERE uid=?`, uid).Scan(&value)
+func GetUserEmailByUID(ctx context.Context, s *storage.Store, uid string) (string, error) {
+	u, err := userByUID(ctx, s, uid)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", errors.New("user not found")
-		}
 		return "", err
 	}
-	if value.Valid {
-		return value.String, nil
-	}
-	return "", nil
+	return u.Email, nil
 }
 
-func GetFullnameByUID(uid string) (string, error) {
-	if uid == "" {
-		return "", errors.New("uid cannot be empty")
-	}
-	var value sql.NullString
-	err := db.DB.QueryRow(`SELECT fullname FROM users WHERE uid=?`, uid).Scan(&value)
+func GetUsernameByUID(ctx context.Context, s *storage.Store, uid string) (string, error) {
+	u, err := userByUID(ctx, s, uid)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", errors.New("user not found")
-		}
 		return "", err
 	}
-	if value.Valid {
-		return value.String, nil
-	}
-	return "", nil
+	return u.Username, nil
 }
 
-func GetPasswordByUID(uid string) (string, error) {
-	if uid == "" {
-		return "", errors.New("uid cannot be empty")
-	}
-	var value sql.NullString
-	err := db.DB.QueryRow(`SELECT password FROM users WHERE uid=?`, uid).Scan(&value)
+func GetFullnameByUID(ctx context.Context, s *storage.Store, uid string) (string, error) {
+	u, err := userByUID(ctx, s, uid)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", errors.New("user not found")
-		}
 		return "", err
 	}
-	if value.Valid {
-		return value.String, nil
-	}
-	return "", nil
+	return u.Fullname, nil
 }
 
-func GetUserVerifiedByUID(uid string) (bool, error) {
-	if uid == "" {
-		return false, errors.New("uid cannot be empty")
-	}
-	var verified bool
-	err := db.DB.QueryRow(`SELECT verified FROM users WHERE uid=?`, uid).Scan(&verified)
+func GetUserVerifiedByUID(ctx context.Context, s *storage.Store, uid string) (bool, error) {
+	u, err := userByUID(ctx, s, uid)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return false, errors.New("user not found")
-		}
 		return false, err
 	}
-	return verified, nil
+	return u.Verified, nil
 }
 
-func GetUserIDByUID(uid string) (int, error) {
-	if uid == "" {
-		return 0, errors.New("uid cannot be empty")
-	}
-	var id int
-	err := db.DB.QueryRow(`SELECT id FROM users WHERE uid=?`, uid).Scan(&id)
+func GetUserIDByUID(ctx context.Context, s *storage.Store, uid string) (int, error) {
+	u, err := userByUID(ctx, s, uid)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, errors.New("user not found")
-		}
 		return 0, err
 	}
-	return id, nil
+	return u.ID, nil
 }
 
 // Password Reset Models
-func SavePasswordResetOTP(db *sql.DB, email, code string) error {
-	_, _ = db.Exec("DELETE FROM password_reset_otps WHERE email=?", email)
-	_, err := db.Exec("INSERT INTO password_reset_otps (email, code) VALUES (?, ?)", email, code)
-	return err
+func SavePasswordResetOTP(ctx context.Context, s *storage.Store, email, code string) error {
+	return s.OTPs.Save(ctx, storage.PurposePasswordReset, email, code)
+}
+
+func GetPasswordResetOTP(ctx context.Context, s *storage.Store, email string) (string, time.Time, error) {
+	return s.OTPs.Get(ctx, storage.PurposePasswordReset, email)
 }
 
-func GetPasswordResetOTP(db *sql.DB, email string) (string, time.Time, error) {
-	var code string
-	var created time.Time
-	err := db.QueryRow(
-		"SELECT code, created_at FROM password_reset_otps WHERE email=? ORDER BY created_at DESC LIMIT 1",
-		email,
-	).Scan(&code, &created)
-	return code, created, err
+func DeletePasswordResetOTP(ctx context.Context, s *storage.Store, email string) error {
+	return s.OTPs.Delete(ctx, storage.PurposePasswordReset, email)
 }
 
-func DeletePasswordResetOTP(db *sql.DB, email string) error {
-	_, err := db.Exec("DELETE FROM password_reset_otps WHERE email=?", email)
-	return err
+// AddPasswordResetFailure counts a wrong reset code and returns the count for the current code
+func AddPasswordResetFailure(ctx context.Context, s *storage.Store, email string) (int, error) {
+	return s.OTPs.AddFailedAttempt(ctx, storage.PurposePasswordReset, email)
 }
 
-func AddPasswordResetRequest(db *sql.DB, email string) error {
-	_, err := db.Exec("INSERT INTO password_reset_requests (email) VALUES (?)", email)
-	return err
+func AddPasswordResetRequest(ctx context.Context, s *storage.Store, email string) error {
+	return s.OTPs.AddRequest(ctx, storage.PurposePasswordReset, email)
 }
 
-func CountPasswordResetRequestsLastHour(db *sql.DB, email string) (int, error) {
-	var count int
-	err := db.QueryRow(
-		"SELECT COUNT(*) FROM password_reset_requests WHERE email=? AND request_time > datetime('now','-1 hour')",
-		email,
-	).Scan(&count)
-	return count, err
+func CountPasswordResetRequestsLastHour(ctx context.Context, s *storage.Store, email string, now time.Time) (int, error) {
+	return s.OTPs.CountRequestsSince(ctx, storage.PurposePasswordReset, email, now.Add(-time.Hour))
 }
 
-func SetPasswordResetCooldown(db *sql.DB, email string, until time.Time) error {
-	_, err := db.Exec(
-		"INSERT OR REPLACE INTO password_reset_cooldowns (email, cooldown_until) VALUES (?, ?)",
-		email,
-		until,
-	)
-	return err
+func SetPasswordResetCooldown(ctx context.Context, s *storage.Store, email string, until time.Time) error {
+	return s.OTPs.SetCooldown(ctx, storage.PurposePasswordReset, email, until)
 }
 
-func GetPasswordResetCooldown(db *sql.DB, email string) (time.Time, error) {
-	var t time.Time
-	err := db.QueryRow(
-		"SELECT cooldown_until FROM password_reset_cooldowns WHERE email=?",
-		email,
-	).Scan(&t)
-	return t, err
+func GetPasswordResetCooldown(ctx context.Context, s *storage.Store, email string) (time.Time, error) {
+	return s.OTPs.GetCooldown(ctx, storage.PurposePasswordReset, email)
 }
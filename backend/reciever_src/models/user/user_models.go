@@ -1,241 +1,560 @@
 package user_models
 
 import (
+	"context"
 	"database/sql"
+	access_token_models "sraraa/reciever_src/models/user/access_tokens"
 	auth_models "sraraa/reciever_src/models/user/auth"
+	export_models "sraraa/reciever_src/models/user/exports"
+	impersonation_models "sraraa/reciever_src/models/user/impersonation"
+	invite_models "sraraa/reciever_src/models/user/invites"
 	login_models "sraraa/reciever_src/models/user/login"
 	onboard_models "sraraa/reciever_src/models/user/onboard"
+	profile_models "sraraa/reciever_src/models/user/profiles"
 	session_models "sraraa/reciever_src/models/user/sessions"
 	signup_models "sraraa/reciever_src/models/user/signup"
 	user_images_models "sraraa/reciever_src/models/user/user_images"
 	user_info_getter_models "sraraa/reciever_src/models/user/user_info_getters"
+	username_models "sraraa/reciever_src/models/user/username"
+	auth_utils "sraraa/reciever_src/utils/auth"
+	"sraraa/storage"
 	"time"
 )
 
 // Re-export all models for easy access
 
-// JWT Secret
-var JwtSecret = session_models.JwtSecret
+// Session signing keys
+type JWK = session_models.JWK
+
+const DefaultKeysDir = session_models.DefaultKeysDir
+
+func LoadSigningKeys(dir string) error {
+	return session_models.LoadSigningKeys(dir)
+}
+
+func PublicJWKs() ([]JWK, error) {
+	return session_models.PublicJWKs()
+}
 
 // Session Claims type
 type SessionClaims = session_models.SessionClaims
+type ActorClaim = session_models.ActorClaim
 
 // Auth models
-func SetPassword(db *sql.DB, email, password string) error {
-	return auth_models.SetPassword(db, email, password)
+type PasswordCheck = auth_utils.PasswordCheck
+type BreachPolicy = auth_utils.BreachPolicy
+
+var ErrPasswordBreached = auth_utils.ErrPasswordBreached
+
+func SetPassword(ctx context.Context, s *storage.Store, email, password string, breach BreachPolicy) (PasswordCheck, error) {
+	return auth_models.SetPassword(ctx, s, email, password, breach)
 }
 
 func SetUsername(db *sql.DB, email, username string) error {
 	return auth_models.SetUsername(db, email, username)
 }
 
-func SetFullname(db *sql.DB, email, fullname string) error {
-	return auth_models.SetFullname(db, email, fullname)
+func SetFullname(ctx context.Context, s *storage.Store, email, fullname string) error {
+	return auth_models.SetFullname(ctx, s, email, fullname)
 }
 
 func UsernameExists(db *sql.DB, username string) (bool, error) {
 	return auth_models.UsernameExists(db, username)
 }
 
-func EmailExists(db *sql.DB, email string) (bool, error) {
-	return auth_models.EmailExists(db, email)
+func SuggestUsernames(db *sql.DB, username string, limit int) ([]string, error) {
+	return auth_models.SuggestUsernames(db, username, limit)
+}
+
+var ErrUsernameTaken = auth_models.ErrUsernameTaken
+
+func EmailExists(ctx context.Context, s *storage.Store, email string) (bool, error) {
+	return auth_models.EmailExists(ctx, s, email)
+}
+
+func GetRoleByUID(ctx context.Context, s *storage.Store, uid string) (string, error) {
+	return auth_models.GetRoleByUID(ctx, s, uid)
 }
 
-func HasAllRequiredFields(db *sql.DB, email string) (bool, time.Time, error) {
-	return auth_models.HasAllRequiredFields(db, email)
+func HasAllRequiredFields(ctx context.Context, s *storage.Store, email string) (bool, time.Time, error) {
+	return auth_models.HasAllRequiredFields(ctx, s, email)
 }
 
-func HasAllRequiredFieldsForLogin(db *sql.DB, email string) (bool, error) {
-	return auth_models.HasAllRequiredFieldsForLogin(db, email)
+func HasAllRequiredFieldsForLogin(ctx context.Context, s *storage.Store, email string) (bool, error) {
+	return auth_models.HasAllRequiredFieldsForLogin(ctx, s, email)
 }
 
 // Onboarding models
-func CreateUser(db *sql.DB, email string) error {
-	return onboard_models.CreateUser(db, email)
+type OnboardingState = onboard_models.OnboardingState
+
+func CreateUser(ctx context.Context, s *storage.Store, email string) error {
+	return onboard_models.CreateUser(ctx, s, email)
 }
 
-func SetUniqueID(db *sql.DB, email, uid string) error {
-	return onboard_models.SetUniqueID(db, email, uid)
+func SetUniqueID(ctx context.Context, s *storage.Store, email, uid string) error {
+	return onboard_models.SetUniqueID(ctx, s, email, uid)
 }
 
-func HasUID(db *sql.DB, email string) (bool, error) {
-	return onboard_models.HasUID(db, email)
+func HasUID(ctx context.Context, s *storage.Store, email string) (bool, error) {
+	return onboard_models.HasUID(ctx, s, email)
 }
 
-func UniqueIDExists(db *sql.DB, uid string) (bool, error) {
-	return onboard_models.UniqueIDExists(db, uid)
+func UniqueIDExists(ctx context.Context, s *storage.Store, uid string) (bool, error) {
+	return onboard_models.UniqueIDExists(ctx, s, uid)
+}
+
+func GetUIDByEmail(ctx context.Context, s *storage.Store, email string) (string, error) {
+	return onboard_models.GetUIDByEmail(ctx, s, email)
+}
+
+func GetAccountByUID(ctx context.Context, s *storage.Store, uid string) (*storage.User, error) {
+	return auth_models.GetAccountByUID(ctx, s, uid)
+}
+
+func IsSuspendedByEmail(ctx context.Context, s *storage.Store, email string) (bool, error) {
+	return auth_models.IsSuspendedByEmail(ctx, s, email)
+}
+
+func SetSuspended(ctx context.Context, s *storage.Store, uid string, suspended bool) error {
+	return auth_models.SetSuspended(ctx, s, uid, suspended)
 }
 
 // Signup models
-func IsVerified(db *sql.DB, email string) (bool, error) {
-	return signup_models.IsVerified(db, email)
+func IsVerified(ctx context.Context, s *storage.Store, email string) (bool, error) {
+	return signup_models.IsVerified(ctx, s, email)
 }
 
-func MarkVerified(db *sql.DB, email string) error {
-	return signup_models.MarkVerified(db, email)
+func MarkVerified(ctx context.Context, s *storage.Store, email string) error {
+	return signup_models.MarkVerified(ctx, s, email)
 }
 
-func SaveOTP(db *sql.DB, email, code string) error {
-	return signup_models.SaveOTP(db, email, code)
+func SaveOTP(ctx context.Context, s *storage.Store, email, code string) error {
+	return signup_models.SaveOTP(ctx, s, email, code)
 }
 
-func GetOTP(db *sql.DB, email string) (string, time.Time, error) {
-	return signup_models.GetOTP(db, email)
+func GetOTP(ctx context.Context, s *storage.Store, email string) (string, time.Time, error) {
+	return signup_models.GetOTP(ctx, s, email)
 }
 
-func DeleteOTP(db *sql.DB, email string) error {
-	return signup_models.DeleteOTP(db, email)
+func DeleteOTP(ctx context.Context, s *storage.Store, email string) error {
+	return signup_models.DeleteOTP(ctx, s, email)
 }
 
-func AddOTPRequest(db *sql.DB, email string) error {
-	return signup_models.AddOTPRequest(db, email)
+func AddOTPRequest(ctx context.Context, s *storage.Store, email string) error {
+	return signup_models.AddOTPRequest(ctx, s, email)
 }
 
-func CountRequestsLastHour(db *sql.DB, email string) (int, error) {
-	return signup_models.CountRequestsLastHour(db, email)
+func CountRequestsLastHour(ctx context.Context, s *storage.Store, email string, now time.Time) (int, error) {
+	return signup_models.CountRequestsLastHour(ctx, s, email, now)
 }
 
-func SetCooldown(db *sql.DB, email string, until time.Time) error {
-	return signup_models.SetCooldown(db, email, until)
+func SetCooldown(ctx context.Context, s *storage.Store, email string, until time.Time) error {
+	return signup_models.SetCooldown(ctx, s, email, until)
 }
 
-func GetCooldown(db *sql.DB, email string) (time.Time, error) {
-	return signup_models.GetCooldown(db, email)
+func GetCooldown(ctx context.Context, s *storage.Store, email string) (time.Time, error) {
+	return signup_models.GetCooldown(ctx, s, email)
 }
 
 // Login models
-func GetUserIDByEmailOrUsername(db *sql.DB, login string) (int, error) {
-	return login_models.GetUserIDByEmailOrUsername(db, login)
+func GetUserIDByEmailOrUsername(ctx context.Context, s *storage.Store, login string) (int, error) {
+	return login_models.GetUserIDByEmailOrUsername(ctx, s, login)
 }
 
-func GetStoredPasswordByEmail(db *sql.DB, email string) (string, error) {
-	return login_models.GetStoredPasswordByEmail(db, email)
+func GetStoredPasswordByEmail(ctx context.Context, s *storage.Store, email string) (string, error) {
+	return login_models.GetStoredPasswordByEmail(ctx, s, email)
 }
 
-func SaveLoginOTP(db *sql.DB, email, code string) error {
-	return login_models.SaveLoginOTP(db, email, code)
+func SaveLoginOTP(ctx context.Context, s *storage.Store, email, code string) error {
+	return login_models.SaveLoginOTP(ctx, s, email, code)
 }
 
-func GetLoginOTP(db *sql.DB, email string) (string, time.Time, error) {
-	return login_models.GetLoginOTP(db, email)
+func GetLoginOTP(ctx context.Context, s *storage.Store, email string) (string, time.Time, error) {
+	return login_models.GetLoginOTP(ctx, s, email)
 }
 
-func DeleteLoginOTP(db *sql.DB, email string) error {
-	return login_models.DeleteLoginOTP(db, email)
+func DeleteLoginOTP(ctx context.Context, s *storage.Store, email string) error {
+	return login_models.DeleteLoginOTP(ctx, s, email)
 }
 
-func AddLoginOTPRequest(db *sql.DB, email string) error {
-	return login_models.AddLoginOTPRequest(db, email)
+func AddLoginOTPRequest(ctx context.Context, s *storage.Store, email string) error {
+	return login_models.AddLoginOTPRequest(ctx, s, email)
 }
 
-func CountLoginRequestsLastHour(db *sql.DB, email string) (int, error) {
-	return login_models.CountLoginRequestsLastHour(db, email)
+func CountLoginRequestsLastHour(ctx context.Context, s *storage.Store, email string, now time.Time) (int, error) {
+	return login_models.CountLoginRequestsLastHour(ctx, s, email, now)
 }
 
-func SetLoginCooldown(db *sql.DB, email string, until time.Time) error {
-	return login_models.SetLoginCooldown(db, email, until)
+func SetLoginCooldown(ctx context.Context, s *storage.Store, email string, until time.Time) error {
+	return login_models.SetLoginCooldown(ctx, s, email, until)
 }
 
-func GetLoginCooldown(db *sql.DB, email string) (time.Time, error) {
-	return login_models.GetLoginCooldown(db, email)
+func GetLoginCooldown(ctx context.Context, s *storage.Store, email string) (time.Time, error) {
+	return login_models.GetLoginCooldown(ctx, s, email)
 }
 
 // Session models
-func CreateSession(db *sql.DB, userID int, duration time.Duration, userAgent, ip string) (string, error) {
-	return session_models.CreateSession(db, userID, duration, userAgent, ip)
+func CreateSession(ctx context.Context, s *storage.Store, userID int, duration time.Duration, userAgent, ip string) (string, error) {
+	return session_models.CreateSession(ctx, s, userID, duration, userAgent, ip)
+}
+
+func CreateImpersonationSession(ctx context.Context, s *storage.Store, userID int, adminUID string, duration time.Duration, userAgent, ip string) (string, error) {
+	return session_models.CreateImpersonationSession(ctx, s, userID, adminUID, duration, userAgent, ip)
+}
+
+func DeleteSession(ctx context.Context, s *storage.Store, token string) (bool, error) {
+	return session_models.DeleteSession(ctx, s, token)
+}
+
+func DeleteAllSessions(ctx context.Context, s *storage.Store, userID int) error {
+	return session_models.DeleteAllSessions(ctx, s, userID)
 }
 
-func DeleteSession(db *sql.DB, token string) error {
-	return session_models.DeleteSession(db, token)
+func DeleteAllSessionsByUID(ctx context.Context, s *storage.Store, uid string) error {
+	return session_models.DeleteAllSessionsByUID(ctx, s, uid)
 }
 
-func DeleteAllSessions(db *sql.DB, userID int) error {
-	return session_models.DeleteAllSessions(db, userID)
+func DeleteOtherSessions(ctx context.Context, s *storage.Store, uid, keepToken string) error {
+	return session_models.DeleteOtherSessions(ctx, s, uid, keepToken)
 }
 
-func DeleteAllSessionsByUID(db *sql.DB, uid string) error {
-	return session_models.DeleteAllSessionsByUID(db, uid)
+func GetSessionsByUID(ctx context.Context, s *storage.Store, uid string) ([]map[string]interface{}, error) {
+	return session_models.GetSessionsByUID(ctx, s, uid)
 }
 
-func GetSessionsByUID(db *sql.DB, uid string) ([]map[string]interface{}, error) {
-	return session_models.GetSessionsByUID(db, uid)
+func CountActiveSessions(ctx context.Context, s *storage.Store, uid string) (int, error) {
+	return session_models.CountActiveSessions(ctx, s, uid)
 }
 
-func CountActiveSessions(db *sql.DB, uid string) (int, error) {
-	return session_models.CountActiveSessions(db, uid)
+func SessionExists(ctx context.Context, s *storage.Store, token string) (bool, error) {
+	return session_models.SessionExists(ctx, s, token)
 }
 
 func ValidateSessionToken(tokenStr string) (*SessionClaims, error) {
 	return session_models.ValidateSessionToken(tokenStr)
 }
 
+func CreateOnboardingToken(email string, duration time.Duration) (string, error) {
+	return session_models.CreateOnboardingToken(email, duration)
+}
+
+func ValidateOnboardingToken(tokenStr string) (string, error) {
+	return session_models.ValidateOnboardingToken(tokenStr)
+}
+
+func CreateExportDownloadToken(exportID, uid string, expiresAt time.Time) (string, error) {
+	return session_models.CreateExportDownloadToken(exportID, uid, expiresAt)
+}
+
+func ValidateExportDownloadToken(tokenStr string) (string, string, error) {
+	return session_models.ValidateExportDownloadToken(tokenStr)
+}
+
+func GetOnboardingState(ctx context.Context, s *storage.Store, email string) (*OnboardingState, error) {
+	return onboard_models.GetOnboardingState(ctx, s, email)
+}
+
 // Image models
-func SaveUserImage(db *sql.DB, uid, username, imageType, imageURL string) error {
-	return user_images_models.SaveUserImage(db, uid, username, imageType, imageURL)
+func SaveUserImage(ctx context.Context, s *storage.Store, uid, username, imageType, imageURL string) error {
+	return user_images_models.SaveUserImage(ctx, s, uid, username, imageType, imageURL)
+}
+
+func GetUserImage(ctx context.Context, s *storage.Store, uid, username, imageType string) (map[string]interface{}, error) {
+	return user_images_models.GetUserImage(ctx, s, uid, username, imageType)
+}
+
+func GetAllUserImages(ctx context.Context, s *storage.Store, uid, username string) ([]map[string]interface{}, error) {
+	return user_images_models.GetAllUserImages(ctx, s, uid, username)
+}
+
+func DeleteUserImage(ctx context.Context, s *storage.Store, uid, imageType string) error {
+	return user_images_models.DeleteUserImage(ctx, s, uid, imageType)
+}
+
+// Profile models
+type ProfileCard = profile_models.ProfileCard
+
+const AvatarImageType = profile_models.AvatarImageType
+
+type PublicProfile = profile_models.PublicProfile
+type ProfileStats = profile_models.ProfileStats
+type PrivacySettings = profile_models.PrivacySettings
+
+const (
+	CoverImageType           = profile_models.CoverImageType
+	ProfileVisibilityPublic  = profile_models.VisibilityPublic
+	ProfileVisibilityMembers = profile_models.VisibilityMembers
+	ProfileVisibilityPrivate = profile_models.VisibilityPrivate
+)
+
+var ErrInvalidVisibility = profile_models.ErrInvalidVisibility
+
+func GetProfileCards(db *sql.DB, viewerUID string, uids, canonicalUsernames []string) ([]ProfileCard, error) {
+	return profile_models.GetProfileCards(db, viewerUID, uids, canonicalUsernames)
 }
 
-func GetUserImage(db *sql.DB, uid, username, imageType string) (map[string]interface{}, error) {
-	return user_images_models.GetUserImage(db, uid, username, imageType)
+func GetPublicProfile(db *sql.DB, canonicalUsername string) (*PublicProfile, error) {
+	return profile_models.GetPublicProfile(db, canonicalUsername)
 }
 
-func GetAllUserImages(db *sql.DB, uid, username string) ([]map[string]interface{}, error) {
-	return user_images_models.GetAllUserImages(db, uid, username)
+func GetPrivacySettings(db *sql.DB, uid string) (*PrivacySettings, error) {
+	return profile_models.GetPrivacySettings(db, uid)
 }
 
-func DeleteUserImage(db *sql.DB, uid, imageType string) error {
-	return user_images_models.DeleteUserImage(db, uid, imageType)
+func UpdatePrivacySettings(db *sql.DB, uid string, settings PrivacySettings) error {
+	return profile_models.UpdatePrivacySettings(db, uid, settings)
+}
+
+// Username change models
+type UsernameChange = username_models.UsernameChange
+type UsernameCooldownError = username_models.CooldownError
+
+var (
+	ErrUsernameUnchanged = username_models.ErrUsernameUnchanged
+	ErrUserNotFound      = username_models.ErrUserNotFound
+)
+
+func ChangeUsername(ctx context.Context, db *sql.DB, uid, newUsername string, cooldown, quarantine time.Duration, now time.Time) (*UsernameChange, error) {
+	return username_models.ChangeUsername(ctx, db, uid, newUsername, cooldown, quarantine, now)
+}
+
+func ReplaceImageURLPaths(db *sql.DB, uid, oldPath, newPath string) error {
+	return username_models.ReplaceImageURLPaths(db, uid, oldPath, newPath)
+}
+
+func GetUsernameHistory(db *sql.DB, uid string) ([]UsernameChange, error) {
+	return username_models.GetUsernameHistory(db, uid)
+}
+
+func ResolveUsername(db *sql.DB, username string) (string, string, bool, error) {
+	return username_models.ResolveUsername(db, username)
+}
+
+// Invite and waitlist models
+type Invite = invite_models.Invite
+type WaitlistEntry = invite_models.WaitlistEntry
+
+var (
+	ErrInviteInvalid   = invite_models.ErrInviteInvalid
+	ErrInviteExhausted = invite_models.ErrInviteExhausted
+	ErrInviteQuota     = invite_models.ErrInviteQuota
+)
+
+func CreateInvite(db *sql.DB, createdByUID, email string, maxUses int, expiresAt *time.Time) (*Invite, error) {
+	return invite_models.CreateInvite(db, createdByUID, email, maxUses, expiresAt)
+}
+
+func CountActiveInvitesByUser(db *sql.DB, uid string) (int, error) {
+	return invite_models.CountActiveInvitesByUser(db, uid)
+}
+
+func GetInvitesByUser(db *sql.DB, uid string) ([]Invite, error) {
+	return invite_models.GetInvitesByUser(db, uid)
+}
+
+func RevokeInvite(db *sql.DB, code, ownerUID string) error {
+	return invite_models.RevokeInvite(db, code, ownerUID)
+}
+
+func RedeemInvite(ctx context.Context, db *sql.DB, code, email string, now time.Time) error {
+	return invite_models.RedeemInvite(ctx, db, code, email, now)
+}
+
+func JoinWaitlist(db *sql.DB, email string) error {
+	return invite_models.JoinWaitlist(db, email)
+}
+
+func GetWaitlist(db *sql.DB, status string, limit, offset int) ([]WaitlistEntry, error) {
+	return invite_models.GetWaitlist(db, status, limit, offset)
+}
+
+func ApproveWaitlist(ctx context.Context, db *sql.DB, emails []string, count int, inviteTTL time.Duration, now time.Time) ([]WaitlistEntry, error) {
+	return invite_models.ApproveWaitlist(ctx, db, emails, count, inviteTTL, now)
+}
+
+// Personal access token models
+type AccessToken = access_token_models.AccessToken
+
+const (
+	ScopeProfileRead  = access_token_models.ScopeProfileRead
+	ScopeImagesWrite  = access_token_models.ScopeImagesWrite
+	ScopeInvitesWrite = access_token_models.ScopeInvitesWrite
+	ScopeUsersRead    = access_token_models.ScopeUsersRead
+)
+
+var (
+	AccessTokenScopes     = access_token_models.Scopes
+	SessionScopes         = access_token_models.SessionScopes
+	ErrAccessTokenInvalid = access_token_models.ErrAccessTokenInvalid
+	ErrUnknownScope       = access_token_models.ErrUnknownScope
+	ErrTokenNotFound      = access_token_models.ErrTokenNotFound
+)
+
+func IsAccessToken(raw string) bool {
+	return access_token_models.IsAccessToken(raw)
+}
+
+func IsAdminScope(scope string) bool {
+	return access_token_models.IsAdminScope(scope)
+}
+
+func CreateAccessToken(db *sql.DB, uid, name string, scopes []string, expiresAt time.Time) (*AccessToken, string, error) {
+	return access_token_models.CreateAccessToken(db, uid, name, scopes, expiresAt)
+}
+
+func CountActiveAccessTokens(db *sql.DB, uid string) (int, error) {
+	return access_token_models.CountActiveAccessTokens(db, uid)
+}
+
+func GetAccessTokensByUID(db *sql.DB, uid string) ([]AccessToken, error) {
+	return access_token_models.GetAccessTokensByUID(db, uid)
+}
+
+func RevokeAccessToken(db *sql.DB, uid string, id int64) error {
+	return access_token_models.RevokeAccessToken(db, uid, id)
+}
+
+func RevokeAllAccessTokens(db *sql.DB, uid string) error {
+	return access_token_models.RevokeAllAccessTokens(db, uid)
+}
+
+func AuthenticateAccessToken(db *sql.DB, raw string) (*SessionClaims, error) {
+	return access_token_models.AuthenticateAccessToken(db, raw)
+}
+
+// Impersonation audit models
+type ImpersonationEvent = impersonation_models.ImpersonationEvent
+
+const (
+	ImpersonationEventStart   = impersonation_models.EventStart
+	ImpersonationEventRequest = impersonation_models.EventRequest
+)
+
+func LogImpersonationEvent(db *sql.DB, e ImpersonationEvent) error {
+	return impersonation_models.LogImpersonationEvent(db, e)
+}
+
+func GetImpersonationLog(db *sql.DB, targetUID, adminUID string, limit, offset int) ([]ImpersonationEvent, error) {
+	return impersonation_models.GetImpersonationLog(db, targetUID, adminUID, limit, offset)
+}
+
+// Data export models
+type DataExport = export_models.DataExport
+type UserData = export_models.UserData
+
+const (
+	ExportStatusPending = export_models.StatusPending
+	ExportStatusRunning = export_models.StatusRunning
+	ExportStatusReady   = export_models.StatusReady
+	ExportStatusFailed  = export_models.StatusFailed
+	ExportStatusExpired = export_models.StatusExpired
+)
+
+var ErrExportNotFound = export_models.ErrExportNotFound
+
+func CreateExport(db *sql.DB, uid string) (*DataExport, error) {
+	return export_models.CreateExport(db, uid)
+}
+
+func GetExport(db *sql.DB, id string) (*DataExport, error) {
+	return export_models.GetExport(db, id)
+}
+
+func GetLatestExport(db *sql.DB, uid string) (*DataExport, error) {
+	return export_models.GetLatestExport(db, uid)
+}
+
+func MarkExportRunning(db *sql.DB, id string) error {
+	return export_models.MarkExportRunning(db, id)
+}
+
+func MarkExportReady(db *sql.DB, id, filePath string, size int64, expiresAt time.Time) error {
+	return export_models.MarkExportReady(db, id, filePath, size, expiresAt)
+}
+
+func MarkExportFailed(db *sql.DB, id, reason string) error {
+	return export_models.MarkExportFailed(db, id, reason)
+}
+
+func MarkExportExpired(db *sql.DB, id string) error {
+	return export_models.MarkExportExpired(db, id)
+}
+
+func GetUnfinishedExports(db *sql.DB) ([]DataExport, error) {
+	return export_models.GetUnfinishedExports(db)
+}
+
+func CountUnfinishedExports(db *sql.DB) (map[string]int, error) {
+	return export_models.CountUnfinishedExports(db)
+}
+
+func GetExpiredExports(db *sql.DB) ([]DataExport, error) {
+	return export_models.GetExpiredExports(db)
+}
+
+func CollectUserData(db *sql.DB, uid string) (*UserData, error) {
+	return export_models.CollectUserData(db, uid)
 }
 
 // Getter models
-func GetUserEmailByUID(uid string) (string, error) {
-	return user_info_getter_models.GetUserEmailByUID(uid)
+func GetUserEmailByUID(ctx context.Context, s *storage.Store, uid string) (string, error) {
+	return user_info_getter_models.GetUserEmailByUID(ctx, s, uid)
 }
 
-func GetUsernameByUID(uid string) (string, error) {
-	return user_info_getter_models.GetUsernameByUID(uid)
+func GetUsernameByUID(ctx context.Context, s *storage.Store, uid string) (string, error) {
+	return user_info_getter_models.GetUsernameByUID(ctx, s, uid)
 }
 
-func GetFullnameByUID(uid string) (string, error) {
-	return user_info_getter_models.GetFullnameByUID(uid)
+func GetFullnameByUID(ctx context.Context, s *storage.Store, uid string) (string, error) {
+	return user_info_getter_models.GetFullnameByUID(ctx, s, uid)
 }
 
-func GetPasswordByUID(uid string) (string, error) {
-	return user_info_getter_models.GetPasswordByUID(uid)
+func GetUserVerifiedByUID(ctx context.Context, s *storage.Store, uid string) (bool, error) {
+	return user_info_getter_models.GetUserVerifiedByUID(ctx, s, uid)
 }
 
-func GetUserVerifiedByUID(uid string) (bool, error) {
-	return user_info_getter_models.GetUserVerifiedByUID(uid)
+func GetUserIDByUID(ctx context.Context, s *storage.Store, uid string) (int, error) {
+	return user_info_getter_models.GetUserIDByUID(ctx, s, uid)
 }
 
-func GetUserIDByUID(uid string) (int, error) {
-	return user_info_getter_models.GetUserIDByUID(uid)
+var (
+	UserInfoFields      = user_info_getter_models.UserInfoFields
+	ErrUnknownUserField = user_info_getter_models.ErrUnknownUserField
+)
+
+func GetUserFields(db *sql.DB, uid string, fields []string) (map[string]interface{}, error) {
+	return user_info_getter_models.GetUserFields(db, uid, fields)
 }
 
 // Password reset models
-func SavePasswordResetOTP(db *sql.DB, email, code string) error {
-	return user_info_getter_models.SavePasswordResetOTP(db, email, code)
+func SavePasswordResetOTP(ctx context.Context, s *storage.Store, email, code string) error {
+	return user_info_getter_models.SavePasswordResetOTP(ctx, s, email, code)
+}
+
+func GetPasswordResetOTP(ctx context.Context, s *storage.Store, email string) (string, time.Time, error) {
+	return user_info_getter_models.GetPasswordResetOTP(ctx, s, email)
 }
 
-func GetPasswordResetOTP(db *sql.DB, email string) (string, time.Time, error) {
-	return user_info_getter_models.GetPasswordResetOTP(db, email)
+func DeletePasswordResetOTP(ctx context.Context, s *storage.Store, email string) error {
+	return user_info_getter_models.DeletePasswordResetOTP(ctx, s, email)
 }
 
-func DeletePasswordResetOTP(db *sql.DB, email string) error {
-	return user_info_getter_models.DeletePasswordResetOTP(db, email)
+func AddPasswordResetFailure(ctx context.Context, s *storage.Store, email string) (int, error) {
+	return user_info_getter_models.AddPasswordResetFailure(ctx, s, email)
 }
 
-func AddPasswordResetRequest(db *sql.DB, email string) error {
-	return user_info_getter_models.AddPasswordResetRequest(db, email)
+func AddPasswordResetRequest(ctx context.Context, s *storage.Store, email string) error {
+	return user_info_getter_models.AddPasswordResetRequest(ctx, s, email)
 }
 
-func CountPasswordResetRequestsLastHour(db *sql.DB, email string) (int, error) {
-	return user_info_getter_models.CountPasswordResetRequestsLastHour(db, email)
+func CountPasswordResetRequestsLastHour(ctx context.Context, s *storage.Store, email string, now time.Time) (int, error) {
+	return user_info_getter_models.CountPasswordResetRequestsLastHour(ctx, s, email, now)
 }
 
-func SetPasswordResetCooldown(db *sql.DB, email string, until time.Time) error {
-	return user_info_getter_models.SetPasswordResetCooldown(db, email, until)
+func SetPasswordResetCooldown(ctx context.Context, s *storage.Store, email string, until time.Time) error {
+	return user_info_getter_models.SetPasswordResetCooldown(ctx, s, email, until)
 }
 
-func GetPasswordResetCooldown(db *sql.DB, email string) (time.Time, error) {
-	return user_info_getter_models.GetPasswordResetCooldown(db, email)
+func GetPasswordResetCooldown(ctx context.Context, s *storage.Store, email string) (time.Time, error) {
+	return user_info_getter_models.GetPasswordResetCooldown(ctx, s, email)
 }
@@ -0,0 +1,213 @@
+package username_models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	auth_models "sraraa/reciever_src/models/user/auth"
+	auth_utils "sraraa/reciever_src/utils/auth"
+	"sraraa/storage"
+)
+
+var (
+	ErrUsernameUnchanged = errors.New("new username is the same as the current one")
+	ErrUsernameTaken     = auth_models.ErrUsernameTaken
+	ErrUserNotFound      = errors.New("user not found")
+)
+
+// CooldownError is returned when the user renamed too recently
+type CooldownError struct {
+	Until time.Time
+}
+
+func (e *CooldownError) Error() string {
+	return "username was changed recently, try again after " + e.Until.Format(time.RFC3339)
+}
+
+type UsernameChange struct {
+	UID         string    `json:"uid"`
+	OldUsername string    `json:"old_username"`
+	NewUsername string    `json:"new_username"`
+	ChangedAt   time.Time `json:"changed_at"`
+	HeldUntil   time.Time `json:"held_until"`
+}
+
+// ChangeUsername renames the user identified by uid, records the change in username_history,
+// updates the username on the user's image records and queues the move of the user's CDN files,
+// all in one transaction. The old name is held for this user until now+quarantine, and further
+// renames are refused until now+cooldown. newUsername is stored in its NFKC form.
+func ChangeUsername(ctx context.Context, db *sql.DB, uid, newUsername string, cooldown, quarantine time.Duration, now time.Time) (*UsernameChange, error) {
+	newUsername = auth_utils.NormalizeUsername(newUsername)
+	if err := auth_utils.ValidateUsername(newUsername); err != nil {
+		return nil, err
+	}
+
+	now = now.UTC()
+	canonical := auth_utils.CanonicalUsername(newUsername)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var oldUsername, oldCanonical sql.NullString
+	err = tx.QueryRowContext(ctx, `SELECT username, username_canonical FROM users WHERE uid=?`, uid).Scan(&oldUsername, &oldCanonical)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if !oldUsername.Valid || oldUsername.String == "" {
+		return nil, errors.New("username has not been set yet, finish onboarding first")
+	}
+	if oldUsername.String == newUsername {
+		return nil, ErrUsernameUnchanged
+	}
+
+	var lastChange time.Time
+	err = tx.QueryRowContext(ctx, `SELECT changed_at FROM username_history WHERE uid=? ORDER BY changed_at DESC LIMIT 1`, uid).Scan(&lastChange)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err == nil && now.Before(lastChange.Add(cooldown)) {
+		return nil, &CooldownError{Until: lastChange.Add(cooldown)}
+	}
+
+	// A case-only change keeps the canonical form, which this user already owns
+	if canonical != oldCanonical.String {
+		var takenBy sql.NullString
+		err = tx.QueryRowContext(ctx, `SELECT uid FROM users WHERE username_canonical=?`, canonical).Scan(&takenBy)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil {
+			return nil, ErrUsernameTaken
+		}
+
+		var heldByOther bool
+		err = tx.QueryRowContext(ctx, `
+			SELECT EXISTS(
+				SELECT 1 FROM username_history
+				WHERE old_canonical=? AND released_until > ? AND uid != ?
+			)`, canonical, now, uid).Scan(&heldByOther)
+		if err != nil {
+			return nil, err
+		}
+		if heldByOther {
+			return nil, ErrUsernameTaken
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET username=?, username_canonical=? WHERE uid=?`, newUsername, canonical, uid)
+	if err != nil {
+		if storage.IsUniqueViolation(err) {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
+	}
+
+	heldUntil := now.Add(quarantine)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO username_history (uid, old_username, old_canonical, new_username, changed_at, released_until)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		uid, oldUsername.String, oldCanonical.String, newUsername, now, heldUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reclaiming one of your own held names ends that hold
+	_, err = tx.ExecContext(ctx, `UPDATE username_history SET released_until=? WHERE uid=? AND old_canonical=? AND released_until > ?`,
+		now, uid, canonical, now)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE user_images SET username=?, updated_at=CURRENT_TIMESTAMP WHERE uid=?`, newUsername, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files stay under the old path until the CDN moves them; the cdn_renames job retries a
+	// move the CDN can't do right away
+	if err := storage.QueueCDNRename(ctx, tx, uid, oldUsername.String, newUsername, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &UsernameChange{
+		UID:         uid,
+		OldUsername: oldUsername.String,
+		NewUsername: newUsername,
+		ChangedAt:   now,
+		HeldUntil:   heldUntil,
+	}, nil
+}
+
+// ReplaceImageURLPaths rewrites stored image URLs after the CDN moved the user's files
+func ReplaceImageURLPaths(db *sql.DB, uid, oldPath, newPath string) error {
+	_, err := db.Exec(`UPDATE user_images SET image_url=REPLACE(image_url, ?, ?) WHERE uid=?`, oldPath, newPath, uid)
+	return err
+}
+
+// GetUsernameHistory returns the renames of a user, newest first
+func GetUsernameHistory(db *sql.DB, uid string) ([]UsernameChange, error) {
+	rows, err := db.Query(`
+		SELECT uid, old_username, new_username, changed_at, released_until
+		FROM username_history
+		WHERE uid=?
+		ORDER BY changed_at DESC
+	`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []UsernameChange{}
+	for rows.Next() {
+		var c UsernameChange
+		if err := rows.Scan(&c.UID, &c.OldUsername, &c.NewUsername, &c.ChangedAt, &c.HeldUntil); err != nil {
+			return nil, err
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
+
+// ResolveUsername finds the account currently or previously known by username. redirected is
+// true when the name is an old handle; a name currently owned by someone else always wins.
+func ResolveUsername(db *sql.DB, username string) (uid, currentUsername string, redirected bool, err error) {
+	canonical := auth_utils.CanonicalUsername(username)
+
+	var current sql.NullString
+	err = db.QueryRow(`SELECT uid, username FROM users WHERE username_canonical=?`, canonical).Scan(&uid, &current)
+	if err == nil {
+		return uid, current.String, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", "", false, err
+	}
+
+	err = db.QueryRow(`
+		SELECT u.uid, u.username
+		FROM username_history h
+		JOIN users u ON u.uid = h.uid
+		WHERE h.old_canonical=?
+		ORDER BY h.changed_at DESC
+		LIMIT 1
+	`, canonical).Scan(&uid, &current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", false, ErrUserNotFound
+		}
+		return "", "", false, err
+	}
+
+	return uid, current.String, true, nil
+}
@@ -0,0 +1,103 @@
+package username_models
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"sraraa/db"
+	auth_models "sraraa/reciever_src/models/user/auth"
+	"sraraa/storage"
+)
+
+func newTestStore(t *testing.T) *storage.Store {
+	t.Helper()
+	store, err := storage.Open(storage.Memory)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := db.Migrate(store.DB, store.Dialect); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return store
+}
+
+// addUser stores an account with a uid and, unless username is empty, a username
+func addUser(t *testing.T, s *storage.Store, uid, username string) {
+	t.Helper()
+	ctx := context.Background()
+	email := uid + "@example.com"
+	if err := s.Users.Create(ctx, email); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := s.Users.SetUID(ctx, email, uid); err != nil {
+		t.Fatalf("set uid: %v", err)
+	}
+	if username != "" {
+		if err := auth_models.SetUsername(s.DB, email, username); err != nil {
+			t.Fatalf("set username: %v", err)
+		}
+	}
+}
+
+func TestChangeUsernameQueuesCDNRename(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	addUser(t, s, "uid-henry", "henry")
+
+	now := time.Now()
+	if _, err := ChangeUsername(ctx, s.DB, "uid-henry", "henry2", 0, time.Hour, now); err != nil {
+		t.Fatalf("change: %v", err)
+	}
+	rn, err := s.CDNRenames.Get(ctx, "uid-henry")
+	if err != nil || rn.OldUsername != "henry" || rn.NewUsername != "henry2" {
+		t.Fatalf("queued rename = %+v, %v; want henry -> henry2", rn, err)
+	}
+
+	// a refused rename queues nothing
+	addUser(t, s, "uid-ivy", "ivyleaf")
+	if _, err := ChangeUsername(ctx, s.DB, "uid-ivy", "henry2", 0, time.Hour, now); err == nil {
+		t.Fatal("renaming to a taken username succeeded")
+	}
+	if _, err := s.CDNRenames.Get(ctx, "uid-ivy"); err != sql.ErrNoRows {
+		t.Fatalf("refused rename: got %v, want no queued rename", err)
+	}
+}
+
+// storedUsername returns the username column for uid
+func storedUsername(t *testing.T, s *storage.Store, uid string) string {
+	t.Helper()
+	u, err := s.Users.GetByUID(context.Background(), uid)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	return u.Username
+}
+
+func TestFullwidthUsernameStoredNormalized(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	// fullwidth letters and digits pass the ASCII policy only once NFKC-normalized
+	addUser(t, s, "uid-jack", "\uff4a\uff41\uff43\uff4b\uff11")
+	if got := storedUsername(t, s, "uid-jack"); got != "jack1" {
+		t.Fatalf("SetUsername stored %q, want %q", got, "jack1")
+	}
+
+	change, err := ChangeUsername(ctx, s.DB, "uid-jack", "\uff4a\uff41\uff43\uff4b\uff12", 0, time.Hour, time.Now())
+	if err != nil {
+		t.Fatalf("change: %v", err)
+	}
+	if change.NewUsername != "jack2" {
+		t.Fatalf("change reports %q, want %q", change.NewUsername, "jack2")
+	}
+	if got := storedUsername(t, s, "uid-jack"); got != "jack2" {
+		t.Fatalf("ChangeUsername stored %q, want %q", got, "jack2")
+	}
+	rn, err := s.CDNRenames.Get(ctx, "uid-jack")
+	if err != nil || rn.NewUsername != "jack2" {
+		t.Fatalf("queued rename = %+v, %v; want the normalized name", rn, err)
+	}
+}
@@ -1,12 +1,13 @@
 package access_auth_routes
 
 import (
-	"database/sql"
 	"net/http"
+	"sraraa/app"
 	access_auth_controller "sraraa/reciever_src/controllers/auth/access_auth"
+	"sraraa/router"
 )
 
-func RegisterAccessAuthRoutes(db *sql.DB) {
-	http.HandleFunc("/api/user/info", access_auth_controller.CheckUserCompleteHandler(db))
-	http.HandleFunc("/api/user/check-username", access_auth_controller.CheckUsernameHandler(db))
+func RegisterAccessAuthRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodPost, "/user/check-username", access_auth_controller.CheckUsernameHandler(a)).
+		Deprecated("POST /api/user/check-username")
 }
@@ -0,0 +1,14 @@
+package access_token_routes
+
+import (
+	"net/http"
+	"sraraa/app"
+	access_token_controller "sraraa/reciever_src/controllers/auth/access_tokens"
+	"sraraa/router"
+)
+
+func RegisterAccessTokenRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodGet, "/user/tokens", access_token_controller.ListAccessTokensHandler(a))
+	r.HandleFunc(http.MethodPost, "/user/tokens", access_token_controller.CreateAccessTokenHandler(a))
+	r.HandleFunc(http.MethodPost, "/user/tokens/revoke", access_token_controller.RevokeAccessTokenHandler(a))
+}
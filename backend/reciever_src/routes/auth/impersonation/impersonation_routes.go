@@ -0,0 +1,13 @@
+package impersonation_routes
+
+import (
+	"net/http"
+	"sraraa/app"
+	impersonation_controller "sraraa/reciever_src/controllers/auth/impersonation"
+	"sraraa/router"
+)
+
+func RegisterImpersonationRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodPost, "/admin/impersonate", impersonation_controller.StartImpersonationHandler(a))
+	r.HandleFunc(http.MethodGet, "/admin/impersonation-log", impersonation_controller.ImpersonationLogHandler(a))
+}
@@ -0,0 +1,12 @@
+package introspection_routes
+
+import (
+	"net/http"
+	"sraraa/app"
+	introspection_controller "sraraa/reciever_src/controllers/auth/introspection"
+	"sraraa/router"
+)
+
+func RegisterIntrospectionRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodPost, "/internal/introspect", introspection_controller.IntrospectHandler(a))
+}
@@ -0,0 +1,18 @@
+package invite_routes
+
+import (
+	"net/http"
+	"sraraa/app"
+	invite_controller "sraraa/reciever_src/controllers/auth/invites"
+	"sraraa/router"
+)
+
+func RegisterInviteRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodGet, "/auth/signup/mode", invite_controller.SignupModeHandler(a))
+	r.HandleFunc(http.MethodPost, "/auth/waitlist", invite_controller.JoinWaitlistHandler(a))
+	r.HandleFunc(http.MethodGet, "/invites", invite_controller.ListInvitesHandler(a))
+	r.HandleFunc(http.MethodPost, "/invites", invite_controller.CreateInviteHandler(a))
+	r.HandleFunc(http.MethodPost, "/invites/revoke", invite_controller.RevokeInviteHandler(a))
+	r.HandleFunc(http.MethodGet, "/admin/waitlist", invite_controller.WaitlistHandler(a))
+	r.HandleFunc(http.MethodPost, "/admin/waitlist/approve", invite_controller.ApproveWaitlistHandler(a))
+}
@@ -0,0 +1,12 @@
+package jwks_routes
+
+import (
+	"net/http"
+	jwks_controller "sraraa/reciever_src/controllers/auth/jwks"
+	"sraraa/router"
+)
+
+func RegisterJWKSRoutes(r *router.Router) {
+	// Standard discovery location, not versioned
+	r.HandleRootFunc(http.MethodGet, "/.well-known/jwks.json", jwks_controller.JWKSHandler)
+}
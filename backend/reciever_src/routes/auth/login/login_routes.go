@@ -2,18 +2,26 @@ package login_routes
 
 import (
 	"net/http"
+	"sraraa/app"
 	login_controller "sraraa/reciever_src/controllers/auth/login"
+	"sraraa/router"
 )
 
-func LoginRoutes() {
+func LoginRoutes(r *router.Router, a *app.App) {
 	// Step 1: Request OTP (validates email + password, sends OTP)
-	http.HandleFunc("/api/auth/login/request-otp", login_controller.RequestLoginOTPHandler)
+	r.HandleFunc(http.MethodPost, "/auth/login/request-otp", login_controller.RequestLoginOTPHandler(a)).
+		Deprecated("POST /api/auth/login/request-otp")
 
 	// Step 2: Verify OTP and get session token
-	http.HandleFunc("/api/auth/login/verify-otp", login_controller.VerifyLoginOTPHandler)
+	r.HandleFunc(http.MethodPost, "/auth/login/verify-otp", login_controller.VerifyLoginOTPHandler(a)).
+		Deprecated("POST /api/auth/login/verify-otp")
 
-	// Session management
-	http.HandleFunc("/api/auth/logout", login_controller.LogoutHandler)
-	http.HandleFunc("/api/auth/logout_all", login_controller.LogoutAllHandler)
-	http.HandleFunc("/api/auth/validate_session", login_controller.ValidateSessionHandler)
+	// Session management. The old paths accepted any method.
+	r.HandleFunc(http.MethodPost, "/auth/logout", login_controller.LogoutHandler(a)).
+		Deprecated("/api/auth/logout")
+	r.HandleFunc(http.MethodPost, "/auth/logout-all", login_controller.LogoutAllHandler(a)).
+		Deprecated("/api/auth/logout_all")
+	r.HandleFunc(http.MethodGet, "/auth/validate-session", login_controller.ValidateSessionHandler(a)).
+		Deprecated("/api/auth/validate_session")
+	r.HandleFunc(http.MethodGet, "/user/sessions", login_controller.ListSessionsHandler(a))
 }
@@ -2,10 +2,20 @@ package forgot_password_routes
 
 import (
 	"net/http"
+	"sraraa/app"
 	forgot_password_controller "sraraa/reciever_src/controllers/auth/password"
+	"sraraa/router"
 )
 
-func RegisterForgotPasswordRoutes() {
-	http.HandleFunc("/auth/forgot-password/send-otp", forgot_password_controller.SendResetOTP)
-	http.HandleFunc("/auth/forgot-password/verify-otp", forgot_password_controller.VerifyResetOTP)
+// The forgot-password routes used to live outside /api and accepted any method
+func RegisterForgotPasswordRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodPost, "/auth/forgot-password/send-otp", forgot_password_controller.SendResetOTP(a)).
+		Deprecated("/auth/forgot-password/send-otp")
+	r.HandleFunc(http.MethodPost, "/auth/forgot-password/verify-otp", forgot_password_controller.VerifyResetOTP(a)).
+		Deprecated("/auth/forgot-password/verify-otp")
+	r.HandleFunc(http.MethodPost, "/auth/forgot-password/reset", forgot_password_controller.ResetPassword(a))
+}
+
+func RegisterChangePasswordRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodPost, "/auth/change-password", forgot_password_controller.ChangePasswordHandler(a))
 }
@@ -2,11 +2,17 @@ package onboarding_routes
 
 import (
 	"net/http"
+	"sraraa/app"
 	onboarding_controller "sraraa/reciever_src/controllers/auth/signup/onboarding_controllers"
+	"sraraa/router"
 )
 
-func RegisterOnboardingRoutes() {
-	http.HandleFunc("/api/onboarding/username", onboarding_controller.SetUsernameHandler)
-	http.HandleFunc("/api/onboarding/fullname", onboarding_controller.SetFullnameHandler)
-	http.HandleFunc("/api/onboarding/password", onboarding_controller.SetPasswordHandler)
+func RegisterOnboardingRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodPost, "/onboarding/username", onboarding_controller.SetUsernameHandler(a)).
+		Deprecated("POST /api/onboarding/username")
+	r.HandleFunc(http.MethodPost, "/onboarding/fullname", onboarding_controller.SetFullnameHandler(a)).
+		Deprecated("POST /api/onboarding/fullname")
+	r.HandleFunc(http.MethodPost, "/onboarding/password", onboarding_controller.SetPasswordHandler(a)).
+		Deprecated("POST /api/onboarding/password")
+	r.HandleFunc(http.MethodGet, "/onboarding/state", onboarding_controller.OnboardingStateHandler(a))
 }
@@ -2,10 +2,14 @@ package signup_routes
 
 import (
 	"net/http"
+	"sraraa/app"
 	signup_controller "sraraa/reciever_src/controllers/auth/signup"
+	"sraraa/router"
 )
 
-func RegisterSignupRoutes() {
-	http.HandleFunc("/api/signup/send-otp", signup_controller.SendOTPHandler)
-	http.HandleFunc("/api/signup/verify-otp", signup_controller.VerifyOTPHandler)
+func RegisterSignupRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodPost, "/auth/signup/send-otp", signup_controller.SendOTPHandler(a)).
+		Deprecated("POST /api/signup/send-otp")
+	r.HandleFunc(http.MethodPost, "/auth/signup/verify-otp", signup_controller.VerifyOTPHandler(a)).
+		Deprecated("POST /api/signup/verify-otp")
 }
@@ -0,0 +1,12 @@
+package suspension_routes
+
+import (
+	"net/http"
+	"sraraa/app"
+	suspension_controller "sraraa/reciever_src/controllers/auth/suspension"
+	"sraraa/router"
+)
+
+func RegisterSuspensionRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodPost, "/admin/users/suspend", suspension_controller.SuspendUserHandler(a))
+}
@@ -0,0 +1,14 @@
+package username_routes
+
+import (
+	"net/http"
+	"sraraa/app"
+	username_change_controller "sraraa/reciever_src/controllers/auth/username"
+	"sraraa/router"
+)
+
+func RegisterUsernameRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodPost, "/user/change-username", username_change_controller.ChangeUsernameHandler(a))
+	r.HandleFunc(http.MethodGet, "/user/username-history", username_change_controller.UsernameHistoryHandler(a))
+	r.HandleFunc(http.MethodGet, "/users/resolve", username_change_controller.ResolveUsernameHandler(a))
+}
@@ -2,9 +2,12 @@ package verify_session_routes
 
 import (
 	"net/http"
+	"sraraa/app"
 	verify_session_controller "sraraa/reciever_src/controllers/auth/verify_session"
+	"sraraa/router"
 )
 
-func VerifySessionRoutes() {
-	http.HandleFunc("/api/auth/verify_session", verify_session_controller.VerifySessionHandler)
+func VerifySessionRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodGet, "/auth/verify-session", verify_session_controller.VerifySessionHandler(a)).
+		Deprecated("/api/auth/verify_session")
 }
@@ -0,0 +1,12 @@
+package config_routes
+
+import (
+	"net/http"
+	"sraraa/app"
+	config_controller "sraraa/reciever_src/controllers/main/config"
+	"sraraa/router"
+)
+
+func RegisterConfigRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodGet, "/admin/config", config_controller.ConfigDumpHandler(a))
+}
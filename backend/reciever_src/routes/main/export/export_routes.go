@@ -0,0 +1,14 @@
+package export_routes
+
+import (
+	"net/http"
+	"sraraa/app"
+	export_controller "sraraa/reciever_src/controllers/main/export"
+	"sraraa/router"
+)
+
+func RegisterExportRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodGet, "/user/export", export_controller.ExportStatusHandler(a))
+	r.HandleFunc(http.MethodPost, "/user/export", export_controller.RequestExportHandler(a))
+	r.HandleFunc(http.MethodGet, "/user/export/download", export_controller.DownloadExportHandler(a))
+}
@@ -0,0 +1,14 @@
+package maintenance_routes
+
+import (
+	"net/http"
+	"sraraa/app"
+	"sraraa/maintenance"
+	maintenance_controller "sraraa/reciever_src/controllers/main/maintenance"
+	"sraraa/router"
+)
+
+func RegisterMaintenanceRoutes(r *router.Router, a *app.App, s *maintenance.Scheduler) {
+	r.HandleFunc(http.MethodGet, "/admin/maintenance/jobs", maintenance_controller.ListJobsHandler(a, s))
+	r.HandleFunc(http.MethodPost, "/admin/maintenance/jobs/{name}/run", maintenance_controller.RunJobHandler(a, s))
+}
@@ -0,0 +1,15 @@
+package profile_routes
+
+import (
+	"net/http"
+	"sraraa/app"
+	profile_controller "sraraa/reciever_src/controllers/main/profiles"
+	"sraraa/router"
+)
+
+func RegisterProfileRoutes(r *router.Router, a *app.App) {
+	r.HandleFunc(http.MethodPost, "/users/lookup", profile_controller.BatchLookupHandler(a))
+	r.HandleFunc(http.MethodGet, "/profiles/{username}", profile_controller.PublicProfileHandler(a))
+	r.HandleFunc(http.MethodGet, "/user/privacy", profile_controller.GetPrivacySettingsHandler(a))
+	r.HandleFunc(http.MethodPost, "/user/privacy", profile_controller.UpdatePrivacySettingsHandler(a))
+}
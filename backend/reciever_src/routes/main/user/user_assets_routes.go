@@ -1,22 +1,20 @@
 package user_assets_routes
 
 import (
+	"net/http"
+	"sraraa/app"
 	user_assets_controller "sraraa/reciever_src/controllers/main/user"
-
-	"github.com/gin-gonic/gin"
+	"sraraa/router"
 )
 
-func RegisterUserAssetsRoutes(router *gin.Engine) {
+func RegisterUserAssetsRoutes(r *router.Router, a *app.App) {
 	// Image upload and management routes
-	imageRoutes := router.Group("/image")
-	{
-		imageRoutes.POST("", user_assets_controller.UploadImage)
-
-		imageRoutes.GET("/all", user_assets_controller.GetAllUserImages)
-
-		imageRoutes.GET("/:type", user_assets_controller.GetImage)
-
-		imageRoutes.DELETE("/:type", user_assets_controller.DeleteImage)
-	}
-
+	r.HandleFunc(http.MethodPost, "/images", user_assets_controller.UploadImage(a)).
+		Deprecated("POST /image")
+	r.HandleFunc(http.MethodGet, "/images/all", user_assets_controller.GetAllUserImages(a)).
+		Deprecated("GET /image/all")
+	r.HandleFunc(http.MethodGet, "/images/{type}", user_assets_controller.GetImage(a)).
+		Deprecated("GET /image/{type}")
+	r.HandleFunc(http.MethodDelete, "/images/{type}", user_assets_controller.DeleteImage(a)).
+		Deprecated("DELETE /image/{type}")
 }
@@ -0,0 +1,114 @@
+package auth_utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Breached passwords are looked up in a local copy of the Have I Been Pwned range dataset,
+// stored the same way the range API serves it: one file per 5 character SHA-1 prefix
+// (e.g. "21BD1.txt") holding "SUFFIX:COUNT" lines. cmd/internal/hibp-import builds the
+// directory from the full "HASH:COUNT" download. Nothing leaves the server.
+
+const (
+	BreachModeOff    = "off"
+	BreachModeWarn   = "warn"
+	BreachModeReject = "reject"
+)
+
+var ErrPasswordBreached = errors.New("password has appeared in a data breach, choose a different one")
+
+// BreachPolicy is how CheckPassword treats breached passwords: Mode is off, warn or reject and
+// Dir the range directory, empty to skip the lookup
+type BreachPolicy struct {
+	Mode string
+	Dir  string
+}
+
+// HashPrefixSuffix splits the uppercase SHA-1 of a password into the 5 character range prefix
+// and the 35 character suffix
+func HashPrefixSuffix(password string) (string, string) {
+	sum := sha1.Sum([]byte(password))
+	h := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return h[:5], h[5:]
+}
+
+// BreachedPasswordCount returns how often the password appears in the local range dataset.
+// It returns 0 when the dataset is not configured or has no file for the prefix.
+func BreachedPasswordCount(dir, password string) (int, error) {
+	if dir == "" {
+		return 0, nil
+	}
+
+	prefix, suffix := HashPrefixSuffix(password)
+
+	f, err := os.Open(filepath.Join(dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		hashSuffix, countStr, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(hashSuffix, suffix) {
+			continue
+		}
+		count, err := strconv.Atoi(countStr)
+		if err != nil {
+			return 0, err
+		}
+		return count, nil
+	}
+
+	return 0, scanner.Err()
+}
+
+// PasswordCheck is the outcome of CheckPassword, returned to clients alongside a password change
+type PasswordCheck struct {
+	Breached    bool             `json:"breached"`
+	BreachCount int              `json:"breach_count,omitempty"`
+	Warning     string           `json:"warning,omitempty"`
+	Strength    PasswordStrength `json:"strength"`
+}
+
+// CheckPassword runs the character-class rules, the breach lookup and the strength estimate.
+// In reject mode a breached password returns ErrPasswordBreached; in warn mode it is accepted
+// and the result carries a warning. A failing dataset read is treated as "not breached" so an
+// unreadable shard can never lock users out.
+func CheckPassword(password string, breach BreachPolicy) (PasswordCheck, error) {
+	if err := ValidatePassword(password); err != nil {
+		return PasswordCheck{}, err
+	}
+
+	check := PasswordCheck{}
+
+	if breach.Mode != BreachModeOff {
+		count, err := BreachedPasswordCount(breach.Dir, password)
+		if err == nil && count > 0 {
+			check.Breached = true
+			check.BreachCount = count
+		}
+	}
+
+	check.Strength = EstimatePasswordStrength(password, check.BreachCount)
+
+	if check.Breached {
+		if breach.Mode == BreachModeReject {
+			return check, ErrPasswordBreached
+		}
+		check.Warning = ErrPasswordBreached.Error()
+	}
+
+	return check, nil
+}
@@ -0,0 +1,138 @@
+package auth_utils
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// PasswordStrength is a rough zxcvbn-style estimate. Score runs from 0 (trivially guessable)
+// to 4 (very strong); GuessesLog10 is the estimated number of guesses as a power of ten.
+type PasswordStrength struct {
+	Score        int      `json:"score"`
+	Label        string   `json:"label"`
+	GuessesLog10 float64  `json:"guesses_log10"`
+	Feedback     []string `json:"feedback,omitempty"`
+}
+
+var strengthLabels = []string{"very weak", "weak", "fair", "strong", "very strong"}
+
+// commonPasswordParts are fragments that make a password much easier to guess than its length suggests
+var commonPasswordParts = []string{
+	"password", "passw0rd", "qwerty", "azerty", "letmein", "welcome", "admin", "login", "iloveyou",
+	"monkey", "dragon", "master", "sunshine", "football", "baseball", "princess", "summer", "winter",
+	"spring", "autumn", "hello", "secret", "abc123", "111111", "123456", "654321",
+}
+
+// EstimatePasswordStrength sums a per-character guess cost (letters, digits, symbols) with
+// discounts for repeats, runs like "abc"/"321", a capitalized first letter, years and common
+// fragments. A password seen in a breach is always scored 0.
+func EstimatePasswordStrength(password string, breachCount int) PasswordStrength {
+	var feedback []string
+
+	runes := []rune(password)
+	covered := make([]bool, len(runes))
+	guessesLog10 := 0.0
+
+	// A common fragment costs about as much as picking it from a small dictionary
+	lower := strings.ToLower(password)
+	for _, part := range commonPasswordParts {
+		if idx := strings.Index(lower, part); idx >= 0 {
+			start := len([]rune(lower[:idx]))
+			for i := start; i < start+len(part) && i < len(covered); i++ {
+				covered[i] = true
+			}
+			guessesLog10 += 1.5
+			feedback = append(feedback, "Avoid common words and patterns like \""+part+"\"")
+			break
+		}
+	}
+
+	// So does a year
+	for i := 0; i+4 <= len(runes); i++ {
+		if covered[i] || !isYear(runes[i:i+4]) {
+			continue
+		}
+		for j := i; j < i+4; j++ {
+			covered[j] = true
+		}
+		guessesLog10 += 2
+		feedback = append(feedback, "Avoid years and dates")
+		break
+	}
+
+	weak := 0
+	for i, r := range runes {
+		if covered[i] {
+			continue
+		}
+
+		cost := math.Log10(float64(charClassSize(r)))
+		switch {
+		case i == 0 && unicode.IsUpper(r):
+			cost = math.Log10(26)
+		case i > 0 && runes[i-1] == r:
+			cost *= 0.25
+			weak++
+		case i > 1 && runes[i-1]-runes[i-2] == r-runes[i-1] && (r-runes[i-1] == 1 || r-runes[i-1] == -1):
+			cost *= 0.25
+			weak++
+		}
+		guessesLog10 += cost
+	}
+	if weak > len(runes)/4 {
+		feedback = append(feedback, "Avoid repeated characters and sequences like abc or 123")
+	}
+
+	var score int
+	switch {
+	case guessesLog10 < 3:
+		score = 0
+	case guessesLog10 < 6:
+		score = 1
+	case guessesLog10 < 8:
+		score = 2
+	case guessesLog10 < 10:
+		score = 3
+	default:
+		score = 4
+	}
+
+	if breachCount > 0 {
+		score = 0
+		feedback = append(feedback, "This password is known from data breaches")
+	}
+	if score < 3 && len(runes) < 12 {
+		feedback = append(feedback, "Use a longer password, a few unrelated words work well")
+	}
+
+	return PasswordStrength{
+		Score:        score,
+		Label:        strengthLabels[score],
+		GuessesLog10: math.Round(guessesLog10*10) / 10,
+		Feedback:     feedback,
+	}
+}
+
+func charClassSize(r rune) int {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return 26
+	case r >= '0' && r <= '9':
+		return 10
+	case r < unicode.MaxASCII:
+		return 33
+	default:
+		return 100
+	}
+}
+
+// isYear matches 1900-2099
+func isYear(r []rune) bool {
+	for _, c := range r {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return (r[0] == '1' && r[1] == '9') || (r[0] == '2' && r[1] == '0')
+}
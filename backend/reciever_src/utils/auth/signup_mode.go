@@ -0,0 +1,23 @@
+package auth_utils
+
+import "strings"
+
+// Signup modes control who may start a new account
+const (
+	SignupModeOpen       = "open"
+	SignupModeInviteOnly = "invite_only"
+	SignupModeWaitlist   = "waitlist"
+)
+
+// ParseSignupMode normalizes a SIGNUP_MODE value (open, invite_only or waitlist; invite-only is
+// also accepted) and reports whether it is one
+func ParseSignupMode(s string) (string, bool) {
+	switch mode := strings.ToLower(strings.TrimSpace(s)); mode {
+	case SignupModeOpen, SignupModeWaitlist:
+		return mode, true
+	case SignupModeInviteOnly, "invite-only":
+		return SignupModeInviteOnly, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,156 @@
+package auth_utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// UsernamePolicy describes which usernames are accepted at signup/rename time.
+// Length limits are counted in runes after NFKC normalization.
+type UsernamePolicy struct {
+	MinLength int
+	MaxLength int
+	// AllowUnicodeLetters allows letters outside a-z (e.g. "josé"). When false only ASCII is accepted.
+	AllowUnicodeLetters bool
+	// AllowedSymbols lists the separator characters allowed between letters/digits.
+	AllowedSymbols string
+	// Reserved names are compared by canonical form, so "ADMIN" and "adm1n" are rejected too.
+	Reserved []string
+}
+
+// DefaultReservedUsernames are names that collide with routes, system accounts or staff roles
+var DefaultReservedUsernames = []string{
+	"admin", "administrator", "api", "app", "auth", "cdn", "cover", "help", "image", "images",
+	"login", "logout", "me", "media", "moderator", "mod", "null", "onboarding", "profile",
+	"profiles", "root", "security", "settings", "signup", "staff", "static", "support",
+	"system", "undefined", "user", "users", "www",
+}
+
+// DefaultUsernamePolicy is used until SetUsernamePolicy is called
+var DefaultUsernamePolicy = UsernamePolicy{
+	MinLength:           4,
+	MaxLength:           30,
+	AllowUnicodeLetters: false,
+	AllowedSymbols:      "_.",
+	Reserved:            DefaultReservedUsernames,
+}
+
+var (
+	policyMu      sync.RWMutex
+	currentPolicy = DefaultUsernamePolicy
+	reservedSet   = buildReservedSet(DefaultUsernamePolicy.Reserved)
+)
+
+// SetUsernamePolicy replaces the active username policy
+func SetUsernamePolicy(p UsernamePolicy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	currentPolicy = p
+	reservedSet = buildReservedSet(p.Reserved)
+}
+
+// GetUsernamePolicy returns the active username policy
+func GetUsernamePolicy() UsernamePolicy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return currentPolicy
+}
+
+var ErrUsernameReserved = errors.New("username is reserved")
+
+// NormalizeUsername returns the NFKC form of username, so fullwidth and other compatibility
+// characters become the ones they stand for. It is the form that is validated and stored.
+func NormalizeUsername(username string) string {
+	return norm.NFKC.String(username)
+}
+
+// ValidateUsernamePolicy checks a username against the active policy: length, charset,
+// separator placement and the reserved list. It checks NormalizeUsername(username), which is
+// what callers must store.
+func ValidateUsernamePolicy(username string) error {
+	p := GetUsernamePolicy()
+	normalized := NormalizeUsername(username)
+
+	length := len([]rune(normalized))
+	if length < p.MinLength || length > p.MaxLength {
+		return fmt.Errorf("username must be %d-%d characters", p.MinLength, p.MaxLength)
+	}
+
+	var prevSymbol bool
+	for i, r := range []rune(normalized) {
+		isSymbol := strings.ContainsRune(p.AllowedSymbols, r)
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case p.AllowUnicodeLetters && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+		case isSymbol:
+			if i == 0 || i == length-1 {
+				return errors.New("username cannot start or end with a symbol")
+			}
+			if prevSymbol {
+				return errors.New("username cannot contain consecutive symbols")
+			}
+		default:
+			return fmt.Errorf("username contains invalid character %q", r)
+		}
+		prevSymbol = isSymbol
+	}
+
+	if IsReservedUsername(normalized) {
+		return ErrUsernameReserved
+	}
+
+	return nil
+}
+
+// IsReservedUsername reports whether the username matches a reserved name after canonicalization
+func IsReservedUsername(username string) bool {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return reservedSet[CanonicalUsername(username)]
+}
+
+// CanonicalUsername returns the form used for uniqueness checks: NFKC normalized, lowercased and
+// reduced to a confusable skeleton so that "Admin", "admin" and "adm1n" all compare equal
+func CanonicalUsername(username string) string {
+	folded := strings.ToLower(norm.NFKC.String(strings.TrimSpace(username)))
+
+	var b strings.Builder
+	b.Grow(len(folded))
+	for _, r := range folded {
+		if s, ok := confusables[r]; ok {
+			b.WriteString(s)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func buildReservedSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[CanonicalUsername(name)] = true
+	}
+	return set
+}
+
+// confusables maps lowercase look-alike runes to a single skeleton. It covers the digits and
+// Cyrillic/Greek letters commonly used to impersonate Latin handles, not the full Unicode table.
+var confusables = map[rune]string{
+	// digits and symbols
+	'0': "o", '1': "l", 'i': "l", '|': "l", '3': "e", '5': "s", '$': "s",
+
+	// Cyrillic
+	'а': "a", 'в': "b", 'с': "c", 'е': "e", 'ё': "e", 'һ': "h", 'і': "l", 'ї': "l", 'ј': "j",
+	'к': "k", 'м': "m", 'н': "h", 'о': "o", 'р': "p", 'ѕ': "s", 'т': "t", 'у': "y", 'х': "x",
+	'ԁ': "d", 'ԛ': "q", 'ԝ': "w", 'ь': "b",
+
+	// Greek
+	'α': "a", 'β': "b", 'ε': "e", 'η': "n", 'ι': "l", 'κ': "k", 'ν': "v", 'ο': "o", 'ρ': "p",
+	'τ': "t", 'υ': "u", 'χ': "x", 'ω': "w",
+}
@@ -33,13 +33,9 @@ func ValidatePassword(password string) error {
 	return nil
 }
 
-// ValidateUsername checks username requirements: 4-120 characters, letters, numbers, special characters allowed
+// ValidateUsername checks username requirements against the active UsernamePolicy
 func ValidateUsername(username string) error {
-	if len(username) < 4 || len(username) > 120 {
-		return errors.New("username must be 4-120 characters")
-	}
-	// optional: further character checks can be added
-	return nil
+	return ValidateUsernamePolicy(username)
 }
 
 // ValidateFullname checks fullname requirements: 4-120 characters, letters, spaces, special characters allowed
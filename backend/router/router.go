@@ -0,0 +1,135 @@
+// Package router is the API's single HTTP router. Routes are registered with their method and a
+// path relative to /api/v1, so handlers no longer check r.Method themselves: the mux answers 405
+// with an Allow header. Paths from before versioning can be kept as deprecated aliases. Requests
+// no route matches get the JSON error envelope like any handler failure.
+package router
+
+import (
+	"log/slog"
+	"net/http"
+	"sraraa/config"
+	"sraraa/pkg/response"
+	"strings"
+	"sync"
+)
+
+// APIPrefix is prepended to every versioned route
+const APIPrefix = "/api/v1"
+
+type Router struct {
+	mux    *http.ServeMux
+	legacy bool
+
+	warnedMu sync.Mutex
+	warned   map[string]bool
+}
+
+// New returns an empty router. Deprecated aliases are served unless LEGACY_API_ROUTES is off.
+func New(cfg *config.Config) *Router {
+	return &Router{
+		mux:    http.NewServeMux(),
+		legacy: cfg.LegacyAPIRoutes,
+		warned: map[string]bool{},
+	}
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// An empty pattern is the mux's own 404 or 405, which it writes as plain text
+	if _, pattern := rt.mux.Handler(r); pattern == "" {
+		w = &unmatchedWriter{ResponseWriter: w, r: r}
+	}
+	rt.mux.ServeHTTP(w, r)
+}
+
+// unmatchedWriter replaces the mux's plain text error with the envelope. Headers the mux set,
+// such as a 405's Allow, are kept.
+type unmatchedWriter struct {
+	http.ResponseWriter
+	r        *http.Request
+	replaced bool
+}
+
+func (w *unmatchedWriter) WriteHeader(code int) {
+	if code < http.StatusBadRequest {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.replaced = true
+	err := response.ErrNotFound
+	if code != http.StatusNotFound {
+		err = response.NewError(response.ForStatus(code), http.StatusText(code))
+	}
+	response.WriteError(w.ResponseWriter, w.r, err)
+}
+
+func (w *unmatchedWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Route is a registered versioned route, used to attach deprecated aliases
+type Route struct {
+	rt      *Router
+	path    string
+	handler http.HandlerFunc
+}
+
+// HandleFunc registers h for method and APIPrefix+path. path may contain {wildcards}; a GET
+// route also answers HEAD.
+func (rt *Router) HandleFunc(method, path string, h http.HandlerFunc) *Route {
+	full := APIPrefix + path
+	rt.mux.HandleFunc(method+" "+full, h)
+	return &Route{rt: rt, path: full, handler: h}
+}
+
+// HandleRootFunc registers an unversioned route such as /.well-known/jwks.json
+func (rt *Router) HandleRootFunc(method, path string, h http.HandlerFunc) {
+	rt.mux.HandleFunc(method+" "+path, h)
+}
+
+// Deprecated also serves the route at an old ServeMux pattern ("POST /api/auth/logout", or
+// just a path when the old route accepted any method). Responses carry a Deprecation header and
+// a Link to the versioned path; the first use of each alias is logged.
+func (r *Route) Deprecated(pattern string) *Route {
+	if !r.rt.legacy {
+		return r
+	}
+
+	r.rt.mux.HandleFunc(pattern, func(w http.ResponseWriter, req *http.Request) {
+		successor := r.successorPath(req)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		r.rt.warnOnce(pattern, successor)
+		r.handler(w, req)
+	})
+	return r
+}
+
+// successorPath fills the route's wildcards from the alias request
+func (r *Route) successorPath(req *http.Request) string {
+	path := r.path
+	for {
+		start := strings.Index(path, "{")
+		if start < 0 {
+			return path
+		}
+		end := strings.Index(path[start:], "}")
+		if end < 0 {
+			return path
+		}
+		name := strings.TrimSuffix(path[start+1:start+end], "...")
+		path = path[:start] + req.PathValue(name) + path[start+end+1:]
+	}
+}
+
+func (rt *Router) warnOnce(pattern, successor string) {
+	rt.warnedMu.Lock()
+	defer rt.warnedMu.Unlock()
+	if rt.warned[pattern] {
+		return
+	}
+	rt.warned[pattern] = true
+	slog.Warn("Deprecated route used", "route", pattern, "successor", successor)
+}
@@ -1,129 +1,73 @@
 package user_info_sender_controller
 
 import (
-	"encoding/json"
+	"database/sql"
 	"errors"
 	"net/http"
+	"strings"
+
+	"sraraa/app"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/reciever_src/controllers/auth/service_auth"
+	"sraraa/reciever_src/controllers/auth/session_auth"
 	user_models "sraraa/reciever_src/models/user"
 )
 
-// getUID extracts UID from query parameter
-func getUID(r *http.Request) (string, error) {
-	uid := r.URL.Query().Get("uid")
-	if uid == "" {
-		return "", errors.New("missing uid parameter")
-	}
-	return uid, nil
-}
-
-func GetEmailHandler(w http.ResponseWriter, r *http.Request) {
-	uid, err := getUID(r)
-	if err != nil {
-		http.Error(w, "Missing UID", http.StatusBadRequest)
-		return
-	}
-
-	email, err := user_models.GetUserEmailByUID(uid)
-	if err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"email": email})
-}
-
-func GetUsernameHandler(w http.ResponseWriter, r *http.Request) {
-	uid, err := getUID(r)
-	if err != nil {
-		http.Error(w, "Missing UID", http.StatusBadRequest)
-		return
-	}
-
-	username, err := user_models.GetUsernameByUID(uid)
-	if err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"username": username})
-}
-
-func GetFullnameHandler(w http.ResponseWriter, r *http.Request) {
-	uid, err := getUID(r)
-	if err != nil {
-		http.Error(w, "Missing UID", http.StatusBadRequest)
-		return
-	}
-
-	fullname, err := user_models.GetFullnameByUID(uid)
-	if err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
-		return
+// authenticateCaller lets in internal services (HTTP Basic, see service_auth) and personal access
+// tokens with the users:read scope. Interactive sessions are refused.
+func authenticateCaller(a *app.App, w http.ResponseWriter, r *http.Request) bool {
+	if service_auth.HasBasicAuth(r) {
+		if _, ok := service_auth.AuthenticateClient(a, r); !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="internal"`)
+			response.Fail(w, r, response.CodeInvalidCredentials, "Invalid client credentials")
+			return false
+		}
+		return true
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"fullname": fullname})
+	_, ok := session_auth.AuthenticateScope(a, w, r, user_models.ScopeUsersRead)
+	return ok
 }
 
-func GetVerifiedHandler(w http.ResponseWriter, r *http.Request) {
-	uid, err := getUID(r)
-	if err != nil {
-		http.Error(w, "Missing UID", http.StatusBadRequest)
-		return
-	}
-
-	verified, err := user_models.GetUserVerifiedByUID(uid)
-	if err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"verified": verified})
-}
-
-func GetUIDHandler(w http.ResponseWriter, r *http.Request) {
-	uid, err := getUID(r)
-	if err != nil {
-		http.Error(w, "Missing UID", http.StatusBadRequest)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"uid": uid})
-}
-
-func GetUserIDHandler(w http.ResponseWriter, r *http.Request) {
-	uid, err := getUID(r)
-	if err != nil {
-		http.Error(w, "Missing UID", http.StatusBadRequest)
-		return
-	}
-
-	userID, err := user_models.GetUserIDByUID(uid)
-	if err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"user_id": userID})
-}
-
-func GetPasswordHandler(w http.ResponseWriter, r *http.Request) {
-	uid, err := getUID(r)
-	if err != nil {
-		http.Error(w, "Missing UID", http.StatusBadRequest)
-		return
-	}
-
-	password, err := user_models.GetPasswordByUID(uid)
-	if err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
-		return
+// GetUserInfoHandler returns a projection of one user's non-sensitive fields:
+// GET /api/v1/internal/users?uid=...&fields=username,fullname. Without fields every readable field
+// is returned. Email and credentials are never available.
+func GetUserInfoHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authenticateCaller(a, w, r) {
+			return
+		}
+
+		uid := r.URL.Query().Get("uid")
+		if uid == "" {
+			response.Fail(w, r, response.CodeInvalidRequest, "Missing UID")
+			return
+		}
+
+		var fields []string
+		for _, f := range strings.Split(r.URL.Query().Get("fields"), ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				fields = append(fields, f)
+			}
+		}
+
+		info, err := user_models.GetUserFields(a.DB, uid, fields)
+		if errors.Is(err, user_models.ErrUnknownUserField) {
+			response.WriteError(w, r, response.Invalid("fields", "Unknown field, readable fields: "+strings.Join(user_models.UserInfoFields, ", ")))
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			response.WriteError(w, r, response.ErrNotFound)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("GetUserFields error", "err", err)
+			response.WriteError(w, r, response.ErrInternal)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		response.OK(w, info)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"Password": password})
 }
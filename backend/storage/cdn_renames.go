@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlCDNRenames struct {
+	db *sql.DB
+}
+
+const cdnRenameColumns = `uid, old_username, new_username, attempts, COALESCE(last_error, ''), created_at, updated_at`
+
+func scanCDNRename(row interface{ Scan(...interface{}) error }) (*CDNRename, error) {
+	var rn CDNRename
+	err := row.Scan(&rn.UID, &rn.OldUsername, &rn.NewUsername, &rn.Attempts, &rn.LastError,
+		&rn.CreatedAt, &rn.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rn, nil
+}
+
+// execer is a connection or a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (r *sqlCDNRenames) Queue(ctx context.Context, uid, oldUsername, newUsername string, now time.Time) error {
+	return queueCDNRename(ctx, r.db, uid, oldUsername, newUsername, now)
+}
+
+// QueueCDNRename is CDNRenames.Queue run in tx, so the rename is queued exactly when the
+// username change that needs it commits
+func QueueCDNRename(ctx context.Context, tx *sql.Tx, uid, oldUsername, newUsername string, now time.Time) error {
+	return queueCDNRename(ctx, tx, uid, oldUsername, newUsername, now)
+}
+
+// queueCDNRename keeps the row's old_username when one is already pending: that is where the
+// files are
+func queueCDNRename(ctx context.Context, db execer, uid, oldUsername, newUsername string, now time.Time) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO cdn_renames (uid, old_username, new_username, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (uid) DO UPDATE SET
+			new_username = excluded.new_username,
+			updated_at = excluded.updated_at`,
+		uid, oldUsername, newUsername, now.UTC(), now.UTC())
+	if err != nil {
+		return err
+	}
+	return deleteSettled(ctx, db, uid)
+}
+
+func (r *sqlCDNRenames) Get(ctx context.Context, uid string) (*CDNRename, error) {
+	return scanCDNRename(r.db.QueryRowContext(ctx, `SELECT `+cdnRenameColumns+` FROM cdn_renames WHERE uid=?`, uid))
+}
+
+func (r *sqlCDNRenames) List(ctx context.Context, limit int) ([]CDNRename, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+cdnRenameColumns+` FROM cdn_renames ORDER BY updated_at, uid LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var renames []CDNRename
+	for rows.Next() {
+		rn, err := scanCDNRename(rows)
+		if err != nil {
+			return nil, err
+		}
+		renames = append(renames, *rn)
+	}
+	return renames, rows.Err()
+}
+
+func (r *sqlCDNRenames) Moved(ctx context.Context, uid, username string) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE cdn_renames SET old_username=? WHERE uid=?`, username, uid); err != nil {
+		return err
+	}
+	return deleteSettled(ctx, r.db, uid)
+}
+
+func (r *sqlCDNRenames) Failed(ctx context.Context, uid, reason string, now time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE cdn_renames SET attempts = attempts + 1, last_error = ?, updated_at = ?
+		WHERE uid=?`,
+		reason, now.UTC(), uid)
+	return err
+}
+
+// deleteSettled drops the row once the files are where the username says they should be
+func deleteSettled(ctx context.Context, db execer, uid string) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM cdn_renames WHERE uid=? AND old_username = new_username`, uid)
+	return err
+}
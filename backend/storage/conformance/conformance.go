@@ -0,0 +1,664 @@
+// Package conformance checks that a storage.Store behaves the way the models rely on. The same
+// cases run against every backend, so a difference between SQLite and PostgreSQL shows up here
+// rather than in a handler. The store must already be migrated (db.Migrate).
+//
+// Every case creates its own users with fresh emails and uids, but some delete by time (expired
+// sessions, unverified accounts) across the whole table, so run it against a scratch database.
+//
+// go test runs the cases on a throwaway SQLite file, and on PostgreSQL as well when
+// POSTGRES_DSN names one (a local or CI database):
+//
+//	POSTGRES_DSN=postgres://sraraa@localhost:5432/sraraa_test go test ./storage/conformance
+package conformance
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sraraa/storage"
+)
+
+// Case is one behaviour every Store must have
+type Case struct {
+	Name string
+	Run  func(ctx context.Context, s *storage.Store) error
+}
+
+// Cases lists the checks in the order they run
+var Cases = []Case{
+	{"users: create is idempotent", usersCreateIdempotent},
+	{"users: lookups and updates", usersLookups},
+	{"users: login by legacy username", usersLegacyLogin},
+	{"users: suspension", usersSuspension},
+	{"users: delete unverified before cutoff", usersDeleteUnverified},
+	{"sessions: create, list and count", sessionsCreateList},
+	{"sessions: delete variants", sessionsDelete},
+	{"sessions: expiry", sessionsExpiry},
+	{"otps: save replaces the previous code", otpsSaveReplaces},
+	{"otps: failed attempts counted per code", otpsFailedAttempts},
+	{"otps: requests counted since", otpsRequestsSince},
+	{"otps: cooldown upsert", otpsCooldown},
+	{"otps: purge before cutoff", otpsPurge},
+	{"jobs: lock and record runs", jobsLock},
+	{"images: upsert by uid and type", imagesUpsert},
+	{"images: list and delete", imagesListDelete},
+	{"cdn renames: queue, merge and settle", cdnRenamesQueue},
+}
+
+func randomID(prefix string) string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// newUser creates a verified user with a uid, since sessions, OTPs and images reference one
+func newUser(ctx context.Context, s *storage.Store) (*storage.User, error) {
+	email := randomID("conformance-") + "@example.com"
+	if err := s.Users.Create(ctx, email); err != nil {
+		return nil, fmt.Errorf("create user: %w", err)
+	}
+	if err := s.Users.SetUID(ctx, email, randomID("uid-")); err != nil {
+		return nil, fmt.Errorf("set uid: %w", err)
+	}
+	if err := s.Users.MarkVerified(ctx, email); err != nil {
+		return nil, fmt.Errorf("mark verified: %w", err)
+	}
+	return s.Users.GetByEmail(ctx, email)
+}
+
+func expectNoRows(what string, err error) error {
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: want sql.ErrNoRows, got %v", what, err)
+	}
+	return nil
+}
+
+// sameInstant compares times to the second, which every backend keeps
+func sameInstant(a, b time.Time) bool {
+	return a.UTC().Truncate(time.Second).Equal(b.UTC().Truncate(time.Second))
+}
+
+func usersCreateIdempotent(ctx context.Context, s *storage.Store) error {
+	email := randomID("conformance-") + "@example.com"
+	for i := 0; i < 2; i++ {
+		if err := s.Users.Create(ctx, email); err != nil {
+			return fmt.Errorf("create #%d: %w", i+1, err)
+		}
+	}
+
+	exists, err := s.Users.EmailExists(ctx, email)
+	if err != nil || !exists {
+		return fmt.Errorf("email exists = %v, %v; want true", exists, err)
+	}
+	u, err := s.Users.GetByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("get by email: %w", err)
+	}
+	if u.Verified || u.HasPassword || u.UID != "" || u.Role != "user" {
+		return fmt.Errorf("new user has unexpected state: %+v", u)
+	}
+	if u.CreatedAt.IsZero() {
+		return errors.New("new user has no created_at")
+	}
+	return nil
+}
+
+func usersLookups(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	byID, err := s.Users.GetByID(ctx, u.ID)
+	if err != nil || byID.Email != u.Email {
+		return fmt.Errorf("get by id = %v, %v", byID, err)
+	}
+	byUID, err := s.Users.GetByUID(ctx, u.UID)
+	if err != nil || byUID.ID != u.ID {
+		return fmt.Errorf("get by uid = %v, %v", byUID, err)
+	}
+	if exists, err := s.Users.UIDExists(ctx, u.UID); err != nil || !exists {
+		return fmt.Errorf("uid exists = %v, %v; want true", exists, err)
+	}
+	if id, err := s.Users.GetIDByLogin(ctx, u.Email, ""); err != nil || id != u.ID {
+		return fmt.Errorf("id by login = %d, %v; want %d", id, err, u.ID)
+	}
+
+	if err := s.Users.SetPassword(ctx, u.Email, "hunter2"); err != nil {
+		return fmt.Errorf("set password: %w", err)
+	}
+	if pw, err := s.Users.GetPassword(ctx, u.Email); err != nil || pw != "hunter2" {
+		return fmt.Errorf("get password = %q, %v", pw, err)
+	}
+	if err := s.Users.SetFullname(ctx, u.Email, "Conformance Check"); err != nil {
+		return fmt.Errorf("set fullname: %w", err)
+	}
+	u, err = s.Users.GetByUID(ctx, u.UID)
+	if err != nil {
+		return err
+	}
+	if !u.Verified || !u.HasPassword || u.Fullname != "Conformance Check" {
+		return fmt.Errorf("updates not visible: %+v", u)
+	}
+
+	_, err = s.Users.GetByUID(ctx, randomID("missing-"))
+	return expectNoRows("get missing uid", err)
+}
+
+// Legacy rows whose canonical username collided on upgrade keep username_canonical NULL; the
+// repository has no setter for usernames, so the rows are shaped with SQL
+func usersLegacyLogin(ctx context.Context, s *storage.Store) error {
+	owner, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	legacy, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	name := randomID("n")
+	canonical := strings.ToLower(name)
+	if _, err := s.DB.ExecContext(ctx, `UPDATE users SET username=?, username_canonical=? WHERE id=?`, canonical, canonical, owner.ID); err != nil {
+		return err
+	}
+	if _, err := s.DB.ExecContext(ctx, `UPDATE users SET username=?, username_canonical=NULL WHERE id=?`, strings.ToUpper(name), legacy.ID); err != nil {
+		return err
+	}
+
+	if id, err := s.Users.GetIDByLogin(ctx, strings.ToUpper(name), canonical); err != nil || id != legacy.ID {
+		return fmt.Errorf("id by legacy username = %d, %v; want %d", id, err, legacy.ID)
+	}
+	if id, err := s.Users.GetIDByLogin(ctx, canonical, canonical); err != nil || id != owner.ID {
+		return fmt.Errorf("id by canonical username = %d, %v; want %d", id, err, owner.ID)
+	}
+	return nil
+}
+
+func usersSuspension(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	at := time.Now().UTC()
+	if err := s.Users.SetSuspended(ctx, u.UID, &at); err != nil {
+		return fmt.Errorf("suspend: %w", err)
+	}
+	got, err := s.Users.GetByUID(ctx, u.UID)
+	if err != nil {
+		return err
+	}
+	if got.SuspendedAt == nil || !sameInstant(*got.SuspendedAt, at) {
+		return fmt.Errorf("suspended_at = %v, want %v", got.SuspendedAt, at)
+	}
+
+	if err := s.Users.SetSuspended(ctx, u.UID, nil); err != nil {
+		return fmt.Errorf("unsuspend: %w", err)
+	}
+	if got, err = s.Users.GetByUID(ctx, u.UID); err != nil || got.SuspendedAt != nil {
+		return fmt.Errorf("after unsuspend suspended_at = %v, %v", got.SuspendedAt, err)
+	}
+
+	return expectNoRows("suspend missing uid", s.Users.SetSuspended(ctx, randomID("missing-"), &at))
+}
+
+func usersDeleteUnverified(ctx context.Context, s *storage.Store) error {
+	kept, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	email := randomID("conformance-") + "@example.com"
+	if err := s.Users.Create(ctx, email); err != nil {
+		return err
+	}
+
+	// A cutoff in the past leaves the new unverified row alone
+	if _, err := s.Users.DeleteUnverifiedBefore(ctx, time.Now().Add(-time.Hour)); err != nil {
+		return fmt.Errorf("delete before past cutoff: %w", err)
+	}
+	if exists, _ := s.Users.EmailExists(ctx, email); !exists {
+		return errors.New("unverified user deleted before the cutoff")
+	}
+
+	n, err := s.Users.DeleteUnverifiedBefore(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		return fmt.Errorf("delete before future cutoff: %w", err)
+	}
+	if n < 1 {
+		return fmt.Errorf("deleted %d rows, want at least 1", n)
+	}
+	if exists, _ := s.Users.EmailExists(ctx, email); exists {
+		return errors.New("unverified user survived the cutoff")
+	}
+	if exists, _ := s.Users.EmailExists(ctx, kept.Email); !exists {
+		return errors.New("verified user was deleted")
+	}
+	return nil
+}
+
+func newSession(ctx context.Context, s *storage.Store, uid string, ttl time.Duration) (*storage.Session, error) {
+	sess := &storage.Session{
+		UID:       uid,
+		Token:     randomID("token-"),
+		UserAgent: "conformance",
+		IPAddress: "127.0.0.1",
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.Sessions.Create(ctx, sess); err != nil {
+		return nil, fmt.Errorf("create session: %w", err)
+	}
+	return sess, nil
+}
+
+func sessionsCreateList(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	first, err := newSession(ctx, s, u.UID, time.Hour)
+	if err != nil {
+		return err
+	}
+	second, err := newSession(ctx, s, u.UID, time.Hour)
+	if err != nil {
+		return err
+	}
+	if first.ID == 0 || second.ID <= first.ID {
+		return fmt.Errorf("session ids %d, %d; want increasing and non-zero", first.ID, second.ID)
+	}
+
+	if exists, err := s.Sessions.Exists(ctx, first.Token); err != nil || !exists {
+		return fmt.Errorf("session exists = %v, %v; want true", exists, err)
+	}
+	list, err := s.Sessions.ListActive(ctx, u.UID, time.Now())
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	if len(list) != 2 || list[0].ID != second.ID {
+		return fmt.Errorf("list = %+v; want 2 sessions, newest first", list)
+	}
+	if list[1].UserAgent != "conformance" || list[1].ImpersonatedBy != "" || !sameInstant(list[1].ExpiresAt, first.ExpiresAt) {
+		return fmt.Errorf("listed session does not match what was stored: %+v", list[1])
+	}
+	if n, err := s.Sessions.CountActive(ctx, u.UID, time.Now()); err != nil || n != 2 {
+		return fmt.Errorf("count = %d, %v; want 2", n, err)
+	}
+	return nil
+}
+
+func sessionsDelete(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		sess, err := newSession(ctx, s, u.UID, time.Hour)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, sess.Token)
+	}
+
+	if n, err := s.Sessions.Delete(ctx, tokens[0]); err != nil || n != 1 {
+		return fmt.Errorf("delete = %d, %v; want 1", n, err)
+	}
+	if n, err := s.Sessions.DeleteOthers(ctx, u.UID, tokens[1]); err != nil || n != 1 {
+		return fmt.Errorf("delete others = %d, %v; want 1", n, err)
+	}
+	if exists, _ := s.Sessions.Exists(ctx, tokens[1]); !exists {
+		return errors.New("delete others removed the kept session")
+	}
+	if n, err := s.Sessions.DeleteByUID(ctx, u.UID); err != nil || n != 1 {
+		return fmt.Errorf("delete by uid = %d, %v; want 1", n, err)
+	}
+	return nil
+}
+
+func sessionsExpiry(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	expired, err := newSession(ctx, s, u.UID, -time.Minute)
+	if err != nil {
+		return err
+	}
+	if _, err := newSession(ctx, s, u.UID, time.Hour); err != nil {
+		return err
+	}
+
+	if n, err := s.Sessions.CountActive(ctx, u.UID, time.Now()); err != nil || n != 1 {
+		return fmt.Errorf("count active = %d, %v; want 1", n, err)
+	}
+	if _, err := s.Sessions.DeleteExpired(ctx, time.Now()); err != nil {
+		return fmt.Errorf("delete expired: %w", err)
+	}
+	if exists, _ := s.Sessions.Exists(ctx, expired.Token); exists {
+		return errors.New("expired session survived DeleteExpired")
+	}
+	if n, _ := s.Sessions.CountActive(ctx, u.UID, time.Now()); n != 1 {
+		return fmt.Errorf("DeleteExpired removed a live session, %d left", n)
+	}
+	return nil
+}
+
+func otpsSaveReplaces(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	for _, purpose := range []storage.OTPPurpose{storage.PurposeSignup, storage.PurposeLogin, storage.PurposePasswordReset} {
+		if err := s.OTPs.Save(ctx, purpose, u.Email, "111111"); err != nil {
+			return fmt.Errorf("%s: save: %w", purpose, err)
+		}
+		if err := s.OTPs.Save(ctx, purpose, u.Email, "222222"); err != nil {
+			return fmt.Errorf("%s: save again: %w", purpose, err)
+		}
+		code, created, err := s.OTPs.Get(ctx, purpose, u.Email)
+		if err != nil || code != "222222" {
+			return fmt.Errorf("%s: get = %q, %v; want the second code", purpose, code, err)
+		}
+		if time.Since(created) > time.Minute || time.Since(created) < -time.Minute {
+			return fmt.Errorf("%s: created_at %v is not now", purpose, created)
+		}
+		if err := s.OTPs.Delete(ctx, purpose, u.Email); err != nil {
+			return fmt.Errorf("%s: delete: %w", purpose, err)
+		}
+		_, _, err = s.OTPs.Get(ctx, purpose, u.Email)
+		if err := expectNoRows(string(purpose)+": get after delete", err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func otpsFailedAttempts(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	for _, purpose := range storage.Purposes {
+		_, err := s.OTPs.AddFailedAttempt(ctx, purpose, u.Email)
+		if err := expectNoRows(string(purpose)+": attempt without a code", err); err != nil {
+			return err
+		}
+		if err := s.OTPs.Save(ctx, purpose, u.Email, "111111"); err != nil {
+			return fmt.Errorf("%s: save: %w", purpose, err)
+		}
+		for want := 1; want <= 2; want++ {
+			if n, err := s.OTPs.AddFailedAttempt(ctx, purpose, u.Email); err != nil || n != want {
+				return fmt.Errorf("%s: attempt = %d, %v; want %d", purpose, n, err, want)
+			}
+		}
+		// a new code starts the count over
+		if err := s.OTPs.Save(ctx, purpose, u.Email, "222222"); err != nil {
+			return fmt.Errorf("%s: save again: %w", purpose, err)
+		}
+		if n, err := s.OTPs.AddFailedAttempt(ctx, purpose, u.Email); err != nil || n != 1 {
+			return fmt.Errorf("%s: attempt after a new code = %d, %v; want 1", purpose, n, err)
+		}
+	}
+	return nil
+}
+
+func otpsRequestsSince(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	start := time.Now().Add(-time.Second)
+	for i := 0; i < 3; i++ {
+		if err := s.OTPs.AddRequest(ctx, storage.PurposeLogin, u.Email); err != nil {
+			return fmt.Errorf("add request: %w", err)
+		}
+	}
+
+	if n, err := s.OTPs.CountRequestsSince(ctx, storage.PurposeLogin, u.Email, start); err != nil || n != 3 {
+		return fmt.Errorf("count since start = %d, %v; want 3", n, err)
+	}
+	if n, err := s.OTPs.CountRequestsSince(ctx, storage.PurposeLogin, u.Email, time.Now().Add(time.Minute)); err != nil || n != 0 {
+		return fmt.Errorf("count since the future = %d, %v; want 0", n, err)
+	}
+	if n, err := s.OTPs.CountRequestsSince(ctx, storage.PurposeSignup, u.Email, start); err != nil || n != 0 {
+		return fmt.Errorf("signup count = %d, %v; want 0, purposes must not share requests", n, err)
+	}
+	return nil
+}
+
+func otpsCooldown(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	_, err = s.OTPs.GetCooldown(ctx, storage.PurposeSignup, u.Email)
+	if err := expectNoRows("cooldown before set", err); err != nil {
+		return err
+	}
+
+	first := time.Now().Add(time.Minute)
+	second := time.Now().Add(time.Hour)
+	if err := s.OTPs.SetCooldown(ctx, storage.PurposeSignup, u.Email, first); err != nil {
+		return fmt.Errorf("set cooldown: %w", err)
+	}
+	if err := s.OTPs.SetCooldown(ctx, storage.PurposeSignup, u.Email, second); err != nil {
+		return fmt.Errorf("set cooldown again: %w", err)
+	}
+	until, err := s.OTPs.GetCooldown(ctx, storage.PurposeSignup, u.Email)
+	if err != nil || !sameInstant(until, second) {
+		return fmt.Errorf("cooldown = %v, %v; want %v", until, err, second)
+	}
+	return nil
+}
+
+func otpsPurge(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	if err := s.OTPs.Save(ctx, storage.PurposeLogin, u.Email, "123456"); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	if err := s.OTPs.AddRequest(ctx, storage.PurposeLogin, u.Email); err != nil {
+		return fmt.Errorf("add request: %w", err)
+	}
+	if err := s.OTPs.SetCooldown(ctx, storage.PurposeLogin, u.Email, time.Now().Add(time.Hour)); err != nil {
+		return fmt.Errorf("set cooldown: %w", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if _, err := s.OTPs.DeleteCodesBefore(ctx, storage.PurposeLogin, past); err != nil {
+		return fmt.Errorf("delete codes before the past: %w", err)
+	}
+	if _, _, err := s.OTPs.Get(ctx, storage.PurposeLogin, u.Email); err != nil {
+		return fmt.Errorf("fresh code purged: %v", err)
+	}
+	if _, err := s.OTPs.DeleteCooldownsBefore(ctx, storage.PurposeLogin, time.Now()); err != nil {
+		return fmt.Errorf("delete ended cooldowns: %w", err)
+	}
+	if _, err := s.OTPs.GetCooldown(ctx, storage.PurposeLogin, u.Email); err != nil {
+		return fmt.Errorf("running cooldown purged: %v", err)
+	}
+
+	future := time.Now().Add(2 * time.Hour)
+	if n, err := s.OTPs.DeleteCodesBefore(ctx, storage.PurposeLogin, future); err != nil || n < 1 {
+		return fmt.Errorf("delete codes = %d, %v; want at least 1", n, err)
+	}
+	_, _, err = s.OTPs.Get(ctx, storage.PurposeLogin, u.Email)
+	if err := expectNoRows("code after purge", err); err != nil {
+		return err
+	}
+	if n, err := s.OTPs.DeleteRequestsBefore(ctx, storage.PurposeLogin, future); err != nil || n < 1 {
+		return fmt.Errorf("delete requests = %d, %v; want at least 1", n, err)
+	}
+	if n, _ := s.OTPs.CountRequestsSince(ctx, storage.PurposeLogin, u.Email, past); n != 0 {
+		return fmt.Errorf("%d requests left after purge", n)
+	}
+	if n, err := s.OTPs.DeleteCooldownsBefore(ctx, storage.PurposeLogin, future); err != nil || n < 1 {
+		return fmt.Errorf("delete cooldowns = %d, %v; want at least 1", n, err)
+	}
+	_, err = s.OTPs.GetCooldown(ctx, storage.PurposeLogin, u.Email)
+	return expectNoRows("cooldown after purge", err)
+}
+
+func jobsLock(ctx context.Context, s *storage.Store) error {
+	name := randomID("job-")
+	now := time.Now()
+
+	ok, err := s.Jobs.Acquire(ctx, name, "first", now, now.Add(time.Minute))
+	if err != nil || !ok {
+		return fmt.Errorf("acquire new job = %v, %v; want true", ok, err)
+	}
+	if ok, err := s.Jobs.Acquire(ctx, name, "second", now, now.Add(time.Minute)); err != nil || ok {
+		return fmt.Errorf("acquire held job = %v, %v; want false", ok, err)
+	}
+	if err := s.Jobs.Finish(ctx, name, "first", now, "ok", 3, ""); err != nil {
+		return fmt.Errorf("finish: %w", err)
+	}
+	j, err := s.Jobs.Get(ctx, name)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	if j.LockedUntil != nil || j.LastStatus != "ok" || j.LastResult != 3 || j.RunCount != 1 || j.LastFinishedAt == nil {
+		return fmt.Errorf("job after finish has unexpected state: %+v", j)
+	}
+
+	// An expired lease can be taken over
+	if ok, err := s.Jobs.Acquire(ctx, name, "first", now, now.Add(-time.Second)); err != nil || !ok {
+		return fmt.Errorf("acquire finished job = %v, %v; want true", ok, err)
+	}
+	if ok, err := s.Jobs.Acquire(ctx, name, "second", now, now.Add(time.Minute)); err != nil || !ok {
+		return fmt.Errorf("acquire expired lock = %v, %v; want true", ok, err)
+	}
+	if err := s.Jobs.Finish(ctx, name, "first", now, "failed", 0, "stale owner"); err != nil {
+		return fmt.Errorf("finish by stale owner: %w", err)
+	}
+	if j, _ := s.Jobs.Get(ctx, name); j == nil || j.LockedBy != "second" || j.RunCount != 1 {
+		return fmt.Errorf("stale owner's finish changed the job: %+v", j)
+	}
+	return nil
+}
+
+func imagesUpsert(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	img := storage.Image{UID: u.UID, Username: "before", Type: "profile", URL: "https://cdn.example/a.png"}
+	if err := s.Images.Save(ctx, img); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	first, err := s.Images.Get(ctx, u.UID, "profile")
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+
+	img.Username, img.URL = "after", "https://cdn.example/b.png"
+	if err := s.Images.Save(ctx, img); err != nil {
+		return fmt.Errorf("save again: %w", err)
+	}
+	got, err := s.Images.GetByUsername(ctx, "after", "profile")
+	if err != nil {
+		return fmt.Errorf("get by username: %w", err)
+	}
+	if got.URL != img.URL || !sameInstant(got.CreatedAt, first.CreatedAt) {
+		return fmt.Errorf("upsert = %+v; want new url and the original created_at %v", got, first.CreatedAt)
+	}
+	if list, err := s.Images.List(ctx, u.UID); err != nil || len(list) != 1 {
+		return fmt.Errorf("list = %d images, %v; want 1", len(list), err)
+	}
+	return nil
+}
+
+func imagesListDelete(ctx context.Context, s *storage.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	username := randomID("user-")
+	for _, t := range []string{"profile", "banner"} {
+		if err := s.Images.Save(ctx, storage.Image{UID: u.UID, Username: username, Type: t, URL: "https://cdn.example/" + t}); err != nil {
+			return fmt.Errorf("save %s: %w", t, err)
+		}
+	}
+	if list, err := s.Images.ListByUsername(ctx, username); err != nil || len(list) != 2 {
+		return fmt.Errorf("list by username = %d images, %v; want 2", len(list), err)
+	}
+
+	if deleted, err := s.Images.Delete(ctx, u.UID, "banner"); err != nil || !deleted {
+		return fmt.Errorf("delete = %v, %v; want true", deleted, err)
+	}
+	if deleted, err := s.Images.Delete(ctx, u.UID, "banner"); err != nil || deleted {
+		return fmt.Errorf("second delete = %v, %v; want false", deleted, err)
+	}
+	_, err = s.Images.Get(ctx, u.UID, "banner")
+	if err := expectNoRows("get deleted image", err); err != nil {
+		return err
+	}
+	if list, err := s.Images.List(ctx, u.UID); err != nil || len(list) != 1 || list[0].Type != "profile" {
+		return fmt.Errorf("list after delete = %+v, %v; want only the profile image", list, err)
+	}
+	return nil
+}
+
+func cdnRenamesQueue(ctx context.Context, s *storage.Store) error {
+	uid := randomID("u-")
+	now := time.Now()
+
+	if err := s.CDNRenames.Queue(ctx, uid, "first", "second", now); err != nil {
+		return fmt.Errorf("queue: %w", err)
+	}
+	// A second rename keeps the path the files are still stored under
+	if err := s.CDNRenames.Queue(ctx, uid, "second", "third", now); err != nil {
+		return fmt.Errorf("queue again: %w", err)
+	}
+	rn, err := s.CDNRenames.Get(ctx, uid)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	if rn.OldUsername != "first" || rn.NewUsername != "third" {
+		return fmt.Errorf("merged rename is %s -> %s, want first -> third", rn.OldUsername, rn.NewUsername)
+	}
+
+	if err := s.CDNRenames.Failed(ctx, uid, "cdn down", now.Add(time.Second)); err != nil {
+		return fmt.Errorf("failed: %w", err)
+	}
+	if rn, _ := s.CDNRenames.Get(ctx, uid); rn == nil || rn.Attempts != 1 || rn.LastError != "cdn down" {
+		return fmt.Errorf("rename after a failure has unexpected state: %+v", rn)
+	}
+	pending, err := s.CDNRenames.List(ctx, 1000)
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	found := false
+	for _, p := range pending {
+		found = found || p.UID == uid
+	}
+	if !found {
+		return errors.New("pending rename missing from list")
+	}
+
+	if err := s.CDNRenames.Moved(ctx, uid, "third"); err != nil {
+		return fmt.Errorf("moved: %w", err)
+	}
+	_, err = s.CDNRenames.Get(ctx, uid)
+	if err := expectNoRows("rename after the move", err); err != nil {
+		return err
+	}
+
+	// Renaming back to where the files are needs no move at all
+	if err := s.CDNRenames.Queue(ctx, uid, "third", "fourth", now); err != nil {
+		return fmt.Errorf("queue: %w", err)
+	}
+	if err := s.CDNRenames.Queue(ctx, uid, "fourth", "third", now); err != nil {
+		return fmt.Errorf("queue back: %w", err)
+	}
+	_, err = s.CDNRenames.Get(ctx, uid)
+	return expectNoRows("rename back to the stored path", err)
+}
@@ -0,0 +1,50 @@
+package conformance_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sraraa/db"
+	"sraraa/storage"
+	"sraraa/storage/conformance"
+)
+
+func TestSQLite(t *testing.T) {
+	run(t, filepath.Join(t.TempDir(), "conformance.db"), storage.SQLite)
+}
+
+// TestPostgres needs a scratch database: some cases delete expired and unverified rows
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN not set")
+	}
+	run(t, dsn, storage.Postgres)
+}
+
+// run migrates the database at dsn and runs every case against it, in order. It goes through
+// Open, so the cases see the traced connection the services use.
+func run(t *testing.T, dsn string, dialect storage.Dialect) {
+	store, err := storage.Open(dsn)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	if store.Dialect != dialect {
+		t.Fatalf("store reports dialect %q, want %q", store.Dialect, dialect)
+	}
+
+	if err := db.Migrate(store.DB, store.Dialect); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	for _, c := range conformance.Cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if err := c.Run(context.Background(), store); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"sraraa/pkg/tracing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteParams keep the settings the database has always been opened with
+const sqliteParams = "_journal_mode=WAL&_foreign_keys=ON&_busy_timeout=5000"
+
+// ParseDSN returns the dialect a DSN selects and the connection string for its driver
+func ParseDSN(dsn string) (Dialect, string, error) {
+	switch {
+	case dsn == "":
+		return "", "", errors.New("storage: empty DSN")
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return Postgres, dsn, nil
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return SQLite, sqliteSource(strings.TrimPrefix(dsn, "sqlite://")), nil
+	case strings.HasPrefix(dsn, "sqlite:"):
+		return SQLite, sqliteSource(strings.TrimPrefix(dsn, "sqlite:")), nil
+	case strings.Contains(dsn, "://"):
+		return "", "", fmt.Errorf("storage: unsupported database URL scheme in %q", redactDSN(dsn))
+	}
+	return SQLite, sqliteSource(dsn), nil
+}
+
+func sqliteSource(path string) string {
+	if strings.Contains(path, "?") {
+		return path + "&" + sqliteParams
+	}
+	return path + "?" + sqliteParams
+}
+
+// Memory is the DSN of a private in-memory SQLite database, for tests
+const Memory = ":memory:"
+
+// Open connects to the database named by dsn and checks that it is reachable. Its queries are
+// traced when they run under a span (see sraraa/pkg/tracing).
+func Open(dsn string) (*Store, error) {
+	dialect, source, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	driverName, system := "sqlite3", "sqlite"
+	if dialect == Postgres {
+		driverName, system = postgresDriverName, "postgresql"
+	}
+
+	db, err := tracing.OpenDB(driverName, source, system)
+	if err != nil {
+		return nil, fmt.Errorf("storage: open %s: %w", dialect, err)
+	}
+	if dsn == Memory {
+		// every connection would get its own empty database
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("storage: connect to %s: %w", dialect, err)
+	}
+	return New(db, dialect), nil
+}
+
+// IsUniqueViolation reports whether err comes from a UNIQUE or primary key constraint
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	return false
+}
+
+// redactDSN hides the password in a database URL for error messages and logs
+func redactDSN(dsn string) string {
+	scheme := strings.Index(dsn, "://")
+	at := strings.LastIndex(dsn, "@")
+	if scheme < 0 || at < scheme {
+		return dsn
+	}
+	userinfo := dsn[scheme+3 : at]
+	if colon := strings.Index(userinfo, ":"); colon >= 0 {
+		return dsn[:scheme+3] + userinfo[:colon] + ":xxxxx" + dsn[at:]
+	}
+	return dsn
+}
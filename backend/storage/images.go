@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlImages struct {
+	db *sql.DB
+}
+
+const imageColumns = `uid, username, type, image_url, created_at, updated_at`
+
+func scanImage(row interface{ Scan(...interface{}) error }) (*Image, error) {
+	var img Image
+	var created, updated sql.NullTime
+	if err := row.Scan(&img.UID, &img.Username, &img.Type, &img.URL, &created, &updated); err != nil {
+		return nil, err
+	}
+	img.CreatedAt, img.UpdatedAt = created.Time, updated.Time
+	return &img, nil
+}
+
+func (r *sqlImages) Save(ctx context.Context, img Image) error {
+	now := time.Now().UTC()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_images (uid, username, type, image_url, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (uid, type) DO UPDATE SET
+			username = excluded.username,
+			image_url = excluded.image_url,
+			updated_at = excluded.updated_at`,
+		img.UID, img.Username, img.Type, img.URL, now, now)
+	return err
+}
+
+func (r *sqlImages) Get(ctx context.Context, uid, imageType string) (*Image, error) {
+	return scanImage(r.db.QueryRowContext(ctx, `SELECT `+imageColumns+` FROM user_images WHERE uid=? AND type=?`, uid, imageType))
+}
+
+func (r *sqlImages) GetByUsername(ctx context.Context, username, imageType string) (*Image, error) {
+	return scanImage(r.db.QueryRowContext(ctx, `SELECT `+imageColumns+` FROM user_images WHERE username=? AND type=?`, username, imageType))
+}
+
+func (r *sqlImages) List(ctx context.Context, uid string) ([]Image, error) {
+	return r.list(ctx, `SELECT `+imageColumns+` FROM user_images WHERE uid=? ORDER BY created_at DESC, id DESC`, uid)
+}
+
+func (r *sqlImages) ListByUsername(ctx context.Context, username string) ([]Image, error) {
+	return r.list(ctx, `SELECT `+imageColumns+` FROM user_images WHERE username=? ORDER BY created_at DESC, id DESC`, username)
+}
+
+func (r *sqlImages) Delete(ctx context.Context, uid, imageType string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM user_images WHERE uid=? AND type=?`, uid, imageType)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *sqlImages) list(ctx context.Context, query string, arg string) ([]Image, error) {
+	rows, err := r.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []Image
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, *img)
+	}
+	return images, rows.Err()
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlJobs struct {
+	db *sql.DB
+}
+
+const jobColumns = `name, COALESCE(locked_by, ''), locked_until, last_started_at, last_finished_at,
+	COALESCE(last_status, ''), COALESCE(last_error, ''), last_result, run_count`
+
+func scanJob(row interface{ Scan(...interface{}) error }) (*Job, error) {
+	var j Job
+	var lockedUntil, started, finished sql.NullTime
+	err := row.Scan(&j.Name, &j.LockedBy, &lockedUntil, &started, &finished,
+		&j.LastStatus, &j.LastError, &j.LastResult, &j.RunCount)
+	if err != nil {
+		return nil, err
+	}
+	j.LockedUntil = nullTime(lockedUntil)
+	j.LastStartedAt = nullTime(started)
+	j.LastFinishedAt = nullTime(finished)
+	return &j, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// Acquire is a single upsert, so two instances racing for a free lock can't both get it: the
+// row only changes when the lock is free or expired, and RowsAffected says whether it did
+func (r *sqlJobs) Acquire(ctx context.Context, name, owner string, now, until time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO maintenance_jobs (name, locked_by, locked_until, last_started_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			locked_by = excluded.locked_by,
+			locked_until = excluded.locked_until,
+			last_started_at = excluded.last_started_at
+		WHERE maintenance_jobs.locked_until IS NULL OR maintenance_jobs.locked_until <= ?`,
+		name, owner, until.UTC(), now.UTC(), now.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *sqlJobs) Finish(ctx context.Context, name, owner string, now time.Time, status string, result int64, runErr string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE maintenance_jobs SET
+			locked_by = NULL,
+			locked_until = NULL,
+			last_finished_at = ?,
+			last_status = ?,
+			last_error = ?,
+			last_result = ?,
+			run_count = run_count + 1
+		WHERE name=? AND locked_by=?`,
+		now.UTC(), status, runErr, result, name, owner)
+	return err
+}
+
+func (r *sqlJobs) Get(ctx context.Context, name string) (*Job, error) {
+	return scanJob(r.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM maintenance_jobs WHERE name=?`, name))
+}
+
+func (r *sqlJobs) List(ctx context.Context) ([]Job, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM maintenance_jobs ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, rows.Err()
+}
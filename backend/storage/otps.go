@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type sqlOTPs struct {
+	db *sql.DB
+}
+
+type otpTables struct {
+	codes, requests, cooldowns string
+}
+
+var otpTablesByPurpose = map[OTPPurpose]otpTables{
+	PurposeSignup:        {"signup_otps", "signup_otp_requests", "signup_otp_cooldowns"},
+	PurposeLogin:         {"login_otps", "login_otp_requests", "login_otp_cooldowns"},
+	PurposePasswordReset: {"password_reset_otps", "password_reset_requests", "password_reset_cooldowns"},
+}
+
+func tablesFor(purpose OTPPurpose) (otpTables, error) {
+	t, ok := otpTablesByPurpose[purpose]
+	if !ok {
+		return otpTables{}, fmt.Errorf("storage: unknown OTP purpose %q", purpose)
+	}
+	return t, nil
+}
+
+func (r *sqlOTPs) Save(ctx context.Context, purpose OTPPurpose, email, code string) error {
+	t, err := tablesFor(purpose)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+t.codes+` WHERE email=?`, email); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO `+t.codes+` (email, code, created_at) VALUES (?, ?, ?)`,
+		email, code, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlOTPs) Get(ctx context.Context, purpose OTPPurpose, email string) (string, time.Time, error) {
+	t, err := tablesFor(purpose)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var code string
+	var created time.Time
+	err = r.db.QueryRowContext(ctx, `SELECT code, created_at FROM `+t.codes+` WHERE email=? ORDER BY created_at DESC LIMIT 1`, email).
+		Scan(&code, &created)
+	return code, created, err
+}
+
+func (r *sqlOTPs) Delete(ctx context.Context, purpose OTPPurpose, email string) error {
+	t, err := tablesFor(purpose)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `DELETE FROM `+t.codes+` WHERE email=?`, email)
+	return err
+}
+
+func (r *sqlOTPs) AddFailedAttempt(ctx context.Context, purpose OTPPurpose, email string) (int, error) {
+	t, err := tablesFor(purpose)
+	if err != nil {
+		return 0, err
+	}
+	var attempts int
+	err = r.db.QueryRowContext(ctx, `UPDATE `+t.codes+` SET failed_attempts = failed_attempts + 1 WHERE email=? RETURNING failed_attempts`, email).
+		Scan(&attempts)
+	return attempts, err
+}
+
+func (r *sqlOTPs) AddRequest(ctx context.Context, purpose OTPPurpose, email string) error {
+	t, err := tablesFor(purpose)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `INSERT INTO `+t.requests+` (email, request_time) VALUES (?, ?)`, email, time.Now().UTC())
+	return err
+}
+
+func (r *sqlOTPs) CountRequestsSince(ctx context.Context, purpose OTPPurpose, email string, since time.Time) (int, error) {
+	t, err := tablesFor(purpose)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+t.requests+` WHERE email=? AND request_time > ?`, email, since.UTC()).
+		Scan(&count)
+	return count, err
+}
+
+func (r *sqlOTPs) SetCooldown(ctx context.Context, purpose OTPPurpose, email string, until time.Time) error {
+	t, err := tablesFor(purpose)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO `+t.cooldowns+` (email, cooldown_until) VALUES (?, ?)
+		ON CONFLICT (email) DO UPDATE SET cooldown_until = excluded.cooldown_until`,
+		email, until.UTC())
+	return err
+}
+
+func (r *sqlOTPs) GetCooldown(ctx context.Context, purpose OTPPurpose, email string) (time.Time, error) {
+	t, err := tablesFor(purpose)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var until time.Time
+	err = r.db.QueryRowContext(ctx, `SELECT cooldown_until FROM `+t.cooldowns+` WHERE email=?`, email).Scan(&until)
+	return until, err
+}
+
+func (r *sqlOTPs) DeleteCodesBefore(ctx context.Context, purpose OTPPurpose, cutoff time.Time) (int64, error) {
+	t, err := tablesFor(purpose)
+	if err != nil {
+		return 0, err
+	}
+	return r.exec(ctx, `DELETE FROM `+t.codes+` WHERE created_at < ?`, cutoff.UTC())
+}
+
+func (r *sqlOTPs) DeleteRequestsBefore(ctx context.Context, purpose OTPPurpose, cutoff time.Time) (int64, error) {
+	t, err := tablesFor(purpose)
+	if err != nil {
+		return 0, err
+	}
+	return r.exec(ctx, `DELETE FROM `+t.requests+` WHERE request_time < ?`, cutoff.UTC())
+}
+
+func (r *sqlOTPs) DeleteCooldownsBefore(ctx context.Context, purpose OTPPurpose, cutoff time.Time) (int64, error) {
+	t, err := tablesFor(purpose)
+	if err != nil {
+		return 0, err
+	}
+	return r.exec(ctx, `DELETE FROM `+t.cooldowns+` WHERE cooldown_until < ?`, cutoff.UTC())
+}
+
+func (r *sqlOTPs) exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlSessions struct {
+	db *sql.DB
+}
+
+func (r *sqlSessions) Create(ctx context.Context, s *Session) error {
+	s.CreatedAt = time.Now().UTC()
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO sessions (uid, session_token, user_agent, ip_address, created_at, expires_at, impersonated_by)
+		VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''))
+		RETURNING id`,
+		s.UID, s.Token, s.UserAgent, s.IPAddress, s.CreatedAt, s.ExpiresAt.UTC(), s.ImpersonatedBy,
+	).Scan(&s.ID)
+}
+
+func (r *sqlSessions) Exists(ctx context.Context, token string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM sessions WHERE session_token=?)`, token).Scan(&exists)
+	return exists, err
+}
+
+func (r *sqlSessions) Delete(ctx context.Context, token string) (int64, error) {
+	return r.exec(ctx, `DELETE FROM sessions WHERE session_token=?`, token)
+}
+
+func (r *sqlSessions) DeleteByUID(ctx context.Context, uid string) (int64, error) {
+	return r.exec(ctx, `DELETE FROM sessions WHERE uid=?`, uid)
+}
+
+func (r *sqlSessions) DeleteOthers(ctx context.Context, uid, keepToken string) (int64, error) {
+	return r.exec(ctx, `DELETE FROM sessions WHERE uid=? AND session_token != ?`, uid, keepToken)
+}
+
+func (r *sqlSessions) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	return r.exec(ctx, `DELETE FROM sessions WHERE expires_at <= ?`, now.UTC())
+}
+
+func (r *sqlSessions) ListActive(ctx context.Context, uid string, now time.Time) ([]Session, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, uid, session_token, COALESCE(user_agent, ''), COALESCE(ip_address, ''),
+			COALESCE(impersonated_by, ''), created_at, expires_at
+		FROM sessions
+		WHERE uid=? AND expires_at > ?
+		ORDER BY created_at DESC, id DESC`, uid, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var s Session
+		var created, expires sql.NullTime
+		if err := rows.Scan(&s.ID, &s.UID, &s.Token, &s.UserAgent, &s.IPAddress, &s.ImpersonatedBy, &created, &expires); err != nil {
+			return nil, err
+		}
+		s.CreatedAt, s.ExpiresAt = created.Time, expires.Time
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sqlSessions) CountActive(ctx context.Context, uid string, now time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sessions WHERE uid=? AND expires_at > ?`, uid, now.UTC()).Scan(&count)
+	return count, err
+}
+
+func (r *sqlSessions) exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,231 @@
+// Package storage is the persistence layer for users, sessions, OTPs, profile images, pending
+// CDN renames and the state of maintenance jobs. The repositories are interfaces so handlers can be given fakes; the
+// SQL implementation behind them runs unchanged on SQLite and PostgreSQL. It sticks to SQL both
+// understand: times are computed in Go and passed as parameters instead of datetime('now', ...),
+// upserts use INSERT ... ON CONFLICT, and new ids come back through RETURNING.
+//
+// Open picks the database from the DSN: postgres:// and postgresql:// URLs use PostgreSQL,
+// anything else is a SQLite file (optionally written as sqlite:path or a file: URI).
+//
+// Lookups return sql.ErrNoRows when nothing matches, as the models always have.
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Dialect names the database behind a Store
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// Store bundles the repositories sharing one database connection
+type Store struct {
+	DB      *sql.DB
+	Dialect Dialect
+
+	Users    UserRepository
+	Sessions SessionRepository
+	OTPs     OTPRepository
+	Images   ImageRepository
+	Jobs     JobRepository
+	// CDNRenames queues username changes the CDN has yet to apply to the user's files
+	CDNRenames CDNRenameRepository
+}
+
+// New wraps an open connection to a database of the given dialect. The driver cannot be asked
+// for it: connections from Open are wrapped for tracing, which hides the driver.
+func New(db *sql.DB, dialect Dialect) *Store {
+	return &Store{
+		DB:       db,
+		Dialect:  dialect,
+		Users:    &sqlUsers{db: db},
+		Sessions: &sqlSessions{db: db},
+		OTPs:     &sqlOTPs{db: db},
+		Images:   &sqlImages{db: db},
+		Jobs:     &sqlJobs{db: db},
+
+		CDNRenames: &sqlCDNRenames{db: db},
+	}
+}
+
+// Close closes the underlying connection
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
+
+type User struct {
+	ID          int
+	UID         string
+	Email       string
+	Username    string
+	Fullname    string
+	Verified    bool
+	Role        string
+	HasPassword bool
+	CreatedAt   time.Time
+	SuspendedAt *time.Time
+}
+
+type UserRepository interface {
+	// Create adds an unverified account; an existing email is left untouched
+	Create(ctx context.Context, email string) error
+	GetByID(ctx context.Context, id int) (*User, error)
+	GetByUID(ctx context.Context, uid string) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	// GetIDByLogin finds the account whose email or canonical username matches. Accounts left
+	// without a canonical username (legacy names that collided on upgrade) match their exact
+	// username instead.
+	GetIDByLogin(ctx context.Context, login, canonicalUsername string) (int, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
+	UIDExists(ctx context.Context, uid string) (bool, error)
+	SetUID(ctx context.Context, email, uid string) error
+	MarkVerified(ctx context.Context, email string) error
+	SetPassword(ctx context.Context, email, password string) error
+	// GetPassword returns the stored password, "" when none has been set
+	GetPassword(ctx context.Context, email string) (string, error)
+	SetFullname(ctx context.Context, email, fullname string) error
+	// SetSuspended records a suspension time, or clears it when at is nil
+	SetSuspended(ctx context.Context, uid string, at *time.Time) error
+	// DeleteUnverifiedBefore removes accounts that never verified their email and were
+	// created before cutoff
+	DeleteUnverifiedBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type Session struct {
+	ID             int64
+	UID            string
+	Token          string
+	UserAgent      string
+	IPAddress      string
+	ImpersonatedBy string
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+}
+
+type SessionRepository interface {
+	// Create stores s and fills in its ID and CreatedAt
+	Create(ctx context.Context, s *Session) error
+	Exists(ctx context.Context, token string) (bool, error)
+	Delete(ctx context.Context, token string) (int64, error)
+	DeleteByUID(ctx context.Context, uid string) (int64, error)
+	// DeleteOthers removes every session of uid except keepToken
+	DeleteOthers(ctx context.Context, uid, keepToken string) (int64, error)
+	// ListActive returns uid's sessions that expire after now, newest first
+	ListActive(ctx context.Context, uid string, now time.Time) ([]Session, error)
+	CountActive(ctx context.Context, uid string, now time.Time) (int, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// OTPPurpose selects the flow an OTP belongs to; each has its own codes, request log and
+// cooldowns
+type OTPPurpose string
+
+const (
+	PurposeSignup        OTPPurpose = "signup"
+	PurposeLogin         OTPPurpose = "login"
+	PurposePasswordReset OTPPurpose = "password_reset"
+)
+
+type OTPRepository interface {
+	// Save stores code as the only valid code for email
+	Save(ctx context.Context, purpose OTPPurpose, email, code string) error
+	// Get returns the latest code for email and when it was issued
+	Get(ctx context.Context, purpose OTPPurpose, email string) (string, time.Time, error)
+	Delete(ctx context.Context, purpose OTPPurpose, email string) error
+	// AddFailedAttempt counts a wrong guess against email's code and returns how many there have
+	// been since it was saved; sql.ErrNoRows when there is no code
+	AddFailedAttempt(ctx context.Context, purpose OTPPurpose, email string) (int, error)
+	// AddRequest logs that a code was requested, for rate limiting
+	AddRequest(ctx context.Context, purpose OTPPurpose, email string) error
+	CountRequestsSince(ctx context.Context, purpose OTPPurpose, email string, since time.Time) (int, error)
+	SetCooldown(ctx context.Context, purpose OTPPurpose, email string, until time.Time) error
+	GetCooldown(ctx context.Context, purpose OTPPurpose, email string) (time.Time, error)
+	// DeleteCodesBefore removes every email's codes issued before cutoff
+	DeleteCodesBefore(ctx context.Context, purpose OTPPurpose, cutoff time.Time) (int64, error)
+	// DeleteRequestsBefore trims the request log to the requests made since cutoff
+	DeleteRequestsBefore(ctx context.Context, purpose OTPPurpose, cutoff time.Time) (int64, error)
+	// DeleteCooldownsBefore removes cooldowns that ended before cutoff
+	DeleteCooldownsBefore(ctx context.Context, purpose OTPPurpose, cutoff time.Time) (int64, error)
+}
+
+// Purposes lists every OTPPurpose, for work that covers all flows
+var Purposes = []OTPPurpose{PurposeSignup, PurposeLogin, PurposePasswordReset}
+
+type Image struct {
+	UID       string
+	Username  string
+	Type      string
+	URL       string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type ImageRepository interface {
+	// Save stores img, replacing the user's existing image of the same type
+	Save(ctx context.Context, img Image) error
+	Get(ctx context.Context, uid, imageType string) (*Image, error)
+	GetByUsername(ctx context.Context, username, imageType string) (*Image, error)
+	// List returns the user's images, newest first
+	List(ctx context.Context, uid string) ([]Image, error)
+	ListByUsername(ctx context.Context, username string) ([]Image, error)
+	// Delete reports whether an image was removed
+	Delete(ctx context.Context, uid, imageType string) (bool, error)
+}
+
+// Job is the persisted state of a maintenance job: who holds its lock, and how its last run went
+type Job struct {
+	Name           string
+	LockedBy       string
+	LockedUntil    *time.Time
+	LastStartedAt  *time.Time
+	LastFinishedAt *time.Time
+	// LastStatus is "ok" or "failed", empty before the first run finishes
+	LastStatus string
+	LastError  string
+	// LastResult is the number of rows or files the last run removed
+	LastResult int64
+	RunCount   int64
+}
+
+type JobRepository interface {
+	// Acquire locks the job for owner until until, unless another owner holds an unexpired
+	// lock, and records now as the start of a run. It reports whether the lock was taken.
+	Acquire(ctx context.Context, name, owner string, now, until time.Time) (bool, error)
+	// Finish releases owner's lock and records the run's outcome
+	Finish(ctx context.Context, name, owner string, now time.Time, status string, result int64, runErr string) error
+	Get(ctx context.Context, name string) (*Job, error)
+	// List returns every job that has run at least once, by name
+	List(ctx context.Context) ([]Job, error)
+}
+
+// CDNRename is a username change whose files the CDN has not moved yet. They are stored under
+// OldUsername and belong under NewUsername.
+type CDNRename struct {
+	UID         string
+	OldUsername string
+	NewUsername string
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type CDNRenameRepository interface {
+	// Queue records that uid's files must move from oldUsername to newUsername. When a rename is
+	// already pending the files are still under its old username, so only its target changes.
+	Queue(ctx context.Context, uid, oldUsername, newUsername string, now time.Time) error
+	Get(ctx context.Context, uid string) (*CDNRename, error)
+	// List returns up to limit pending renames, least recently tried first
+	List(ctx context.Context, limit int) ([]CDNRename, error)
+	// Moved records that the CDN now stores uid's files under username, and drops the rename
+	// once that is its target
+	Moved(ctx context.Context, uid, username string) error
+	// Failed counts an attempt that did not go through
+	Failed(ctx context.Context, uid, reason string, now time.Time) error
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlUsers struct {
+	db *sql.DB
+}
+
+const userColumns = `id, COALESCE(uid, ''), email, COALESCE(username, ''), COALESCE(fullname, ''),
+	COALESCE(verified, FALSE), role, password IS NOT NULL AND password != '', created_at, suspended_at`
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*User, error) {
+	var u User
+	var created, suspended sql.NullTime
+	err := row.Scan(&u.ID, &u.UID, &u.Email, &u.Username, &u.Fullname, &u.Verified, &u.Role, &u.HasPassword, &created, &suspended)
+	if err != nil {
+		return nil, err
+	}
+	u.CreatedAt = created.Time
+	if suspended.Valid {
+		u.SuspendedAt = &suspended.Time
+	}
+	return &u, nil
+}
+
+func (r *sqlUsers) Create(ctx context.Context, email string) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO users (email) VALUES (?) ON CONFLICT (email) DO NOTHING`, email)
+	return err
+}
+
+func (r *sqlUsers) GetByID(ctx context.Context, id int) (*User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id=?`, id))
+}
+
+func (r *sqlUsers) GetByUID(ctx context.Context, uid string) (*User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE uid=?`, uid))
+}
+
+func (r *sqlUsers) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE email=?`, email))
+}
+
+// GetIDByLogin prefers an exact match over the canonical one: "Bob" on a legacy row is a closer
+// match than another account's canonical "bob"
+func (r *sqlUsers) GetIDByLogin(ctx context.Context, login, canonicalUsername string) (int, error) {
+	var id int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id FROM users
+		WHERE email=? OR username_canonical=? OR (username_canonical IS NULL AND username=?)
+		ORDER BY CASE WHEN email=? THEN 0 WHEN username=? THEN 1 ELSE 2 END, id
+		LIMIT 1`,
+		login, canonicalUsername, login, login, login).Scan(&id)
+	return id, err
+}
+
+func (r *sqlUsers) EmailExists(ctx context.Context, email string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE email=?)`, email).Scan(&exists)
+	return exists, err
+}
+
+func (r *sqlUsers) UIDExists(ctx context.Context, uid string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE uid=?)`, uid).Scan(&exists)
+	return exists, err
+}
+
+func (r *sqlUsers) SetUID(ctx context.Context, email, uid string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET uid=? WHERE email=?`, uid, email)
+	return err
+}
+
+func (r *sqlUsers) MarkVerified(ctx context.Context, email string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET verified=TRUE WHERE email=?`, email)
+	return err
+}
+
+func (r *sqlUsers) SetPassword(ctx context.Context, email, password string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET password=? WHERE email=?`, password, email)
+	return err
+}
+
+func (r *sqlUsers) GetPassword(ctx context.Context, email string) (string, error) {
+	var password sql.NullString
+	err := r.db.QueryRowContext(ctx, `SELECT password FROM users WHERE email=?`, email).Scan(&password)
+	return password.String, err
+}
+
+func (r *sqlUsers) SetFullname(ctx context.Context, email, fullname string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET fullname=? WHERE email=?`, fullname, email)
+	return err
+}
+
+func (r *sqlUsers) SetSuspended(ctx context.Context, uid string, at *time.Time) error {
+	var value interface{}
+	if at != nil {
+		value = at.UTC()
+	}
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET suspended_at=? WHERE uid=?`, value, uid)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sqlUsers) DeleteUnverifiedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE verified=FALSE AND created_at <= ?`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
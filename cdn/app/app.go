@@ -0,0 +1,33 @@
+// Package app holds what the CDN's handlers depend on. main builds one App and passes it to
+// every route registration instead of setting package globals, so handlers can be tested
+// against a scratch database with a fixed clock.
+package app
+
+import (
+	"database/sql"
+
+	"cdn/metrics"
+	"cdn/src_reciever/config"
+	"cdn/src_reciever/session_check"
+	"sraraa/pkg/clock"
+)
+
+type App struct {
+	Config *config.Config
+	DB     *sql.DB
+	Clock  clock.Clock
+	// Uploads checks the tokens forwarded with uploads
+	Uploads *session_check.Checker
+	Metrics *metrics.Metrics
+}
+
+// New assembles an App with the system clock, cfg's token checks and its own metrics registry
+func New(cfg *config.Config, db *sql.DB) *App {
+	return &App{
+		Config:  cfg,
+		DB:      db,
+		Clock:   clock.System,
+		Uploads: session_check.New(cfg),
+		Metrics: metrics.New(db),
+	}
+}
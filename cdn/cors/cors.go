@@ -1,13 +1,19 @@
 package cors
 
-import "github.com/gin-gonic/gin"
+import (
+	"cdn/src_reciever/config"
 
-func AllowLocalHTML() gin.HandlerFunc {
+	"github.com/gin-gonic/gin"
+)
+
+// AllowLocalHTML lets browsers on the CORS_ORIGINS origins call the CDN
+func AllowLocalHTML(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
 
-		if origin == "http://127.0.0.1:5500" {
+		if cfg.AllowsOrigin(origin) {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
 			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		}
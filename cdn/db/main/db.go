@@ -1,84 +1,95 @@
+// Package db opens the CDN's SQLite database and keeps its schema current. It holds no
+// connection of its own: main opens one and hands it to the app.
 package db
 
 import (
+	"context"
 	"database/sql"
-	"log"
-	"sync"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 
-	_ "github.com/mattn/go-sqlite3"
-)
+	"cdn/src_reciever/config"
 
-var (
-	DB   *sql.DB
-	once sync.Once
+	_ "github.com/mattn/go-sqlite3"
+	"sraraa/pkg/migrate"
+	"sraraa/pkg/tracing"
 )
 
-// InitDB initializes sqlite with WAL mode and shm
-func InitDB() *sql.DB {
-	once.Do(func() {
-		dbPath := "cdn.db"
+// migrationFiles holds the numbered schema scripts, applied by Migrate
+//
+//go:embed migrations
+var migrationFiles embed.FS
 
-		var err error
-		DB, err = sql.Open(
-			"sqlite3",
-			dbPath+"?_journal_mode=WAL&_foreign_keys=ON&_busy_timeout=5000",
-		)
-		if err != nil {
-			log.Fatal("failed to open database:", err)
-		}
-
-		if err := DB.Ping(); err != nil {
-			log.Fatal("failed to ping database:", err)
-		}
-	})
-	return DB
+// OpenSQLite opens the database file with WAL mode and foreign keys on. Queries run under a
+// request's span are traced.
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := tracing.OpenDB("sqlite3", path+"?_journal_mode=WAL&_foreign_keys=ON&_busy_timeout=5000", "sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return db, nil
 }
 
-// InitializeDatabase creates tables and indexes
-func InitializeDatabase() (*sql.DB, error) {
-	db := InitDB()
-
-	if err := InitUserProfileImageTable(db); err != nil {
+// Open opens cfg's database and applies pending migrations, or with AUTO_MIGRATE off, checks
+// that there are none
+func Open(cfg *config.Config) (*sql.DB, error) {
+	db, err := OpenSQLite(cfg.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepare(db, cfg.AutoMigrate); err != nil {
+		db.Close()
 		return nil, err
 	}
-
 	return db, nil
 }
 
-func GetDB() *sql.DB {
-	if DB == nil {
-		return InitDB()
+func prepare(db *sql.DB, autoMigrate bool) error {
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
 	}
-	return DB
-}
 
-func CloseDB() {
-	if DB != nil {
-		_ = DB.Close()
+	if !autoMigrate {
+		pending, err := m.Pending(context.Background())
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d migration(s) pending, starting with %04d_%s; run \"migrate up\"",
+				len(pending), pending[0].Version, pending[0].Name)
+		}
+		return nil
 	}
-}
 
-// Table + indexes in same place
-func InitUserProfileImageTable(db *sql.DB) error {
-	query := `
-	CREATE TABLE IF NOT EXISTS user_profile_images (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		uid TEXT NOT NULL,
-		username TEXT NOT NULL,
-		image_type TEXT NOT NULL,
-		file_name TEXT NOT NULL,
-		url TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		UNIQUE(uid, image_type)
-	);
+	applied, err := m.Up(context.Background())
+	for _, mig := range applied {
+		slog.Info("applied migration", "version", mig.Version, "name", mig.Name)
+	}
+	return err
+}
 
-	CREATE INDEX IF NOT EXISTS idx_user_profile_images_uid
-	ON user_profile_images(uid);
+// NewMigrator returns the migrator for the CDN's schema scripts
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	scripts, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, scripts)
+}
 
-	CREATE INDEX IF NOT EXISTS idx_user_profile_images_username
-	ON user_profile_images(username);
-	`
-	_, err := db.Exec(query)
-	return err
+// MigrateCommand runs the "migrate up|down|status" subcommand against db
+func MigrateCommand(db *sql.DB, args []string, out io.Writer) error {
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	return migrate.Command(context.Background(), m, args, out)
 }
@@ -0,0 +1,3 @@
+-- Drops everything the baseline created. This deletes all image records.
+
+DROP TABLE IF EXISTS user_profile_images;
@@ -0,0 +1,20 @@
+-- Baseline: the schema as it stood when migrations were introduced. IF NOT EXISTS lets it
+-- adopt cdn.db files created before then. Schema changes go in new numbered migrations.
+
+CREATE TABLE IF NOT EXISTS user_profile_images (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	uid TEXT NOT NULL,
+	username TEXT NOT NULL,
+	image_type TEXT NOT NULL,
+	file_name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(uid, image_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_profile_images_uid
+ON user_profile_images(uid);
+
+CREATE INDEX IF NOT EXISTS idx_user_profile_images_username
+ON user_profile_images(username);
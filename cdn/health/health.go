@@ -0,0 +1,66 @@
+// Package health builds the CDN's readiness checks on top of sraraa/pkg/health: the image
+// storage directory takes writes and has room left, and cdn.db takes writes and is fully
+// migrated. main serves them at /readyz next to the /healthz liveness probe.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"cdn/app"
+	db "cdn/db/main"
+	"cdn/src_reciever/mapping"
+	shared_health "sraraa/pkg/health"
+)
+
+// New returns the checker behind /readyz
+func New(a *app.App) *shared_health.Checker {
+	return shared_health.New(
+		shared_health.Check{Name: "storage", Run: func(ctx context.Context) (string, error) {
+			return checkStorage(mapping.StorageRoot, a.Config.MinFreeSpace)
+		}},
+		shared_health.Check{Name: "database", Run: func(ctx context.Context) (string, error) {
+			return a.Config.DBPath, shared_health.CheckWritable(ctx, a.DB)
+		}},
+		shared_health.Check{Name: "migrations", Run: func(ctx context.Context) (string, error) {
+			m, err := db.NewMigrator(a.DB)
+			if err != nil {
+				return "", err
+			}
+			return shared_health.CheckMigrated(ctx, m)
+		}},
+	)
+}
+
+// checkStorage writes and removes a scratch file in dir, then compares the disk's free space
+// with minFree
+func checkStorage(dir string, minFree int64) (string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return "", fmt.Errorf("not writable: %w", err)
+	}
+	_, writeErr := f.Write([]byte("ok"))
+	closeErr := f.Close()
+	removeErr := os.Remove(f.Name())
+	if err := errors.Join(writeErr, closeErr, removeErr); err != nil {
+		return "", fmt.Errorf("not writable: %w", err)
+	}
+
+	free, err := freeSpace(dir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return "writable; free space unknown on this platform", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	detail := fmt.Sprintf("%d MiB free", free>>20)
+	if free < uint64(minFree) {
+		return detail, fmt.Errorf("free space below MIN_FREE_SPACE (%d MiB)", minFree>>20)
+	}
+	return detail, nil
+}
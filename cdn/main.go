@@ -1,35 +1,136 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
 
+	"cdn/app"
 	"cdn/cors"
 	db "cdn/db/main"
-	profile_image_upload_controller "cdn/src_reciever/controllers/profile_images"
+	"cdn/health"
+	"cdn/request_log"
+	"cdn/request_trace"
+	"cdn/src_reciever/config"
+	"cdn/src_reciever/routes/ops/config_dump_routes"
 	"cdn/src_reciever/routes/user/profile_image_routes"
+	"cdn/src_reciever/routes/user/user_rename_routes"
 	"cdn/src_reciever/static"
-	"cdn/src_sender/controllers/users/user_profile_images_senders_controller"
 	"cdn/src_sender/routes/user/user_profile_images_routes"
+	shared_health "sraraa/pkg/health"
+	"sraraa/pkg/lifecycle"
+	"sraraa/pkg/logging"
+	shared_metrics "sraraa/pkg/metrics"
+	"sraraa/pkg/response"
+	"sraraa/pkg/tracing"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	dbConn, err := db.InitializeDatabase()
+	cfg, command, err := config.LoadCommand(os.Args[1:])
 	if err != nil {
-		log.Fatal(err)
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		log.Fatal("invalid configuration: ", err)
 	}
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logger := logging.Setup("cdn", level)
+	slog.Info("loaded configuration", "env", cfg.Env)
 
-	profile_image_upload_controller.SetDB(dbConn)
+	// cdn [flags] migrate up|down [steps]|status
+	if len(command) > 0 {
+		if command[0] != "migrate" {
+			fatal("unknown command", fmt.Errorf("%q", command[0]))
+		}
+		dbConn, err := db.OpenSQLite(cfg.DBPath)
+		if err != nil {
+			fatal("failed to open database", err)
+		}
+		err = db.MigrateCommand(dbConn, command[1:], os.Stdout)
+		dbConn.Close()
+		if err != nil {
+			fatal("migration failed", err)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Service:  "cdn",
+		Exporter: cfg.TraceExporter,
+		File:     cfg.TraceFile,
+		Endpoint: cfg.TraceEndpoint,
+	})
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
+	dbConn, err := db.Open(cfg)
+	if err != nil {
+		fatal("failed to initialize database", err)
+	}
+
+	a := app.New(cfg, dbConn)
 
 	r := gin.New()
-	r.Use(gin.Logger(), gin.Recovery())
-	r.Use(cors.AllowLocalHTML())
+	// Errors outside the handlers use the same JSON envelope as theirs
+	recovery := gin.CustomRecovery(func(c *gin.Context, _ any) {
+		response.WriteError(c.Writer, c.Request, response.ErrInternal)
+		c.Abort()
+	})
+	r.Use(request_log.Middleware(logger), request_trace.Middleware(), a.Metrics.Middleware(), recovery)
+	r.Use(cors.AllowLocalHTML(cfg))
+	r.NoRoute(func(c *gin.Context) {
+		response.WriteError(c.Writer, c.Request, response.ErrNotFound)
+	})
 
 	static.RegisterStaticRoutes(r)
-	profile_image_routes.UploadRoutes(r)
-	user_profile_images_senders_controller.SetDB(dbConn)
-	user_profile_images_routes.RegisterUserProfileImageRoutes(r)
+	profile_image_routes.UploadRoutes(r, a)
+	user_rename_routes.RenameRoutes(r, a)
+	user_profile_images_routes.RegisterUserProfileImageRoutes(r, a)
+
+	config_dump_routes.ConfigDumpRoutes(r, a)
+
+	metricsGate, err := shared_metrics.NewGate(cfg.MetricsToken, cfg.MetricsAllow)
+	if err != nil {
+		fatal("invalid metrics allowlist", err)
+	}
+	r.GET("/metrics", gin.WrapH(shared_metrics.Handler(a.Metrics.Registry, metricsGate)))
+
+	probes := health.New(a)
+	r.GET("/healthz", gin.WrapH(shared_health.LiveHandler()))
+	r.GET("/readyz", gin.WrapH(probes.ReadyHandler()))
+
+	srv := &http.Server{
+		Addr:    ":" + strconv.Itoa(cfg.Port),
+		Handler: r,
+	}
+
+	lc := lifecycle.New(cfg.ShutdownTimeout)
+	lc.OnStop("readiness", func(ctx context.Context) error {
+		probes.Drain()
+		return lifecycle.Sleep(ctx, cfg.ShutdownDelay)
+	})
+	lc.Serve("http", srv)
+	lc.OnStop("tracing", shutdownTracing)
+	lc.OnStop("database", func(context.Context) error { return dbConn.Close() })
+	slog.Info("server running", "port", cfg.Port)
+
+	if err := lc.Wait(); err != nil {
+		fatal("shutdown incomplete", err)
+	}
+	slog.Info("server exiting")
+}
 
-	r.Run(":8090")
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
@@ -0,0 +1,69 @@
+// Package metrics holds the CDN's Prometheus registry and upload counters. The app owns one
+// Metrics; main serves it at /metrics behind the gate from sraraa/pkg/metrics.
+package metrics
+
+import (
+	"database/sql"
+	"time"
+
+	shared_metrics "sraraa/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Upload outcomes
+const (
+	UploadOK            = "ok"
+	UploadInvalid       = "invalid"
+	UploadTooLarge      = "too_large"
+	UploadInvalidFormat = "invalid_format"
+	UploadError         = "error"
+)
+
+type Metrics struct {
+	Registry *prometheus.Registry
+	HTTP     *prometheus.HistogramVec
+
+	uploads     *prometheus.CounterVec
+	storedBytes *prometheus.CounterVec
+}
+
+// New registers the CDN's metrics, including pool stats for db
+func New(db *sql.DB) *Metrics {
+	reg := shared_metrics.NewRegistry()
+	m := &Metrics{
+		Registry: reg,
+		HTTP:     shared_metrics.NewHTTPDuration(reg),
+		uploads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cdn_uploads_total",
+			Help: "Image uploads by image type and outcome.",
+		}, []string{"type", "outcome"}),
+		storedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cdn_stored_bytes_total",
+			Help: "Bytes written by successful uploads, by image type.",
+		}, []string{"type"}),
+	}
+
+	reg.MustRegister(m.uploads, m.storedBytes)
+	reg.MustRegister(collectors.NewDBStatsCollector(db, "cdn"))
+	return m
+}
+
+// Upload counts one upload attempt, and the bytes kept when it succeeded
+func (m *Metrics) Upload(imageType, outcome string, size int64) {
+	m.uploads.WithLabelValues(imageType, outcome).Inc()
+	if outcome == UploadOK {
+		m.storedBytes.WithLabelValues(imageType).Add(float64(size))
+	}
+}
+
+// Middleware times requests by gin route pattern
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		shared_metrics.Observe(m.HTTP, c.Request.Method, c.FullPath(), c.Writer.Status(), time.Since(start))
+	}
+}
@@ -0,0 +1,32 @@
+package request_log
+
+import (
+	"log/slog"
+	"time"
+
+	"sraraa/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware replaces gin's logger: it keeps the X-Request-ID the backend forwards (or makes
+// one), gives the request a logger carrying it and writes one JSON access line per request
+func Middleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := logging.RequestID(c.Request)
+		c.Header(logging.RequestIDHeader, id)
+
+		ctx := logging.NewContext(c.Request.Context(), logger, id)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		logging.FromContext(ctx).Info("request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", c.Request.RemoteAddr,
+		)
+	}
+}
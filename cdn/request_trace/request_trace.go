@@ -0,0 +1,19 @@
+package request_trace
+
+import (
+	"sraraa/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware gives each request a server span, continuing the trace the backend sends in the
+// traceparent header, and names it after the gin route once the handler has run. Register it
+// after request_log so the trace ID lands on the request's log lines.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, span := tracing.StartServer(c.Request)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		tracing.EndServer(span, c.Request.Method, c.FullPath(), c.Writer.Status())
+	}
+}
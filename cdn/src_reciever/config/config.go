@@ -1,5 +1,153 @@
+// Package config holds the CDN's typed settings, loaded once at startup by main. See
+// sraraa/pkg/config for where values come from.
 package config
 
-const (
-	MaxUploadSize = 5 << 20
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	shared_config "sraraa/pkg/config"
+	"sraraa/pkg/logging"
+	shared_metrics "sraraa/pkg/metrics"
+	"sraraa/pkg/tracing"
+)
+
+// DefaultMaxUploadSize is the upload limit when MAX_UPLOAD_SIZE is not set
+const DefaultMaxUploadSize = 5 << 20
+
+type Config struct {
+	Env           string   `env:"APP_ENV" default:"development" usage:"environment: development, staging or production"`
+	Port          int      `env:"PORT" default:"8090" usage:"HTTP port"`
+	LogLevel      string   `env:"LOG_LEVEL" default:"info" usage:"lowest level logged: debug, info, warn or error"`
+	DBPath        string   `env:"DB_PATH" default:"cdn.db" usage:"SQLite database file"`
+	AutoMigrate   bool     `env:"AUTO_MIGRATE" default:"on" usage:"apply pending migrations at startup; when off, refuse to start with any pending"`
+	CORSOrigins   []string `env:"CORS_ORIGINS" default:"http://127.0.0.1:5500" usage:"comma-separated origins allowed to call the CDN from a browser"`
+	MaxUploadSize int64    `env:"MAX_UPLOAD_SIZE" default:"5242880" usage:"largest accepted upload in bytes"`
+	MinFreeSpace  int64    `env:"MIN_FREE_SPACE" default:"104857600" usage:"free bytes on the image storage disk below which the CDN reports not ready"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"30s" usage:"time allowed for shutdown: draining requests and uploads, flushing traces"`
+	ShutdownDelay   time.Duration `env:"SHUTDOWN_DELAY" default:"0s" usage:"time to keep serving with readiness failing before the listener closes"`
+
+	JWKSURL                   string `env:"JWKS_URL" usage:"backend JWKS endpoint for turning away bad session tokens before introspection"`
+	IntrospectionURL          string `env:"INTROSPECTION_URL" usage:"backend token introspection endpoint"`
+	IntrospectionClientID     string `env:"INTROSPECTION_CLIENT_ID" usage:"client id for introspection"`
+	IntrospectionClientSecret string `env:"INTROSPECTION_CLIENT_SECRET" secret:"true" usage:"client secret for introspection"`
+	InternalToken             string `env:"CDN_INTERNAL_TOKEN" secret:"true" usage:"token the backend sends on internal calls"`
+
+	MetricsToken string   `env:"METRICS_TOKEN" secret:"true" usage:"bearer token that may scrape /metrics from any address"`
+	MetricsAllow []string `env:"METRICS_ALLOW" default:"127.0.0.1,::1" usage:"comma-separated IPs or CIDRs that may scrape /metrics without the token"`
+
+	TraceExporter string `env:"TRACE_EXPORTER" default:"none" usage:"where spans go: none, otlp, stdout or file"`
+	TraceFile     string `env:"TRACE_FILE" default:"traces.jsonl" usage:"file spans are appended to with TRACE_EXPORTER=file"`
+	TraceEndpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT" usage:"OTLP/HTTP collector URL for TRACE_EXPORTER=otlp; defaults to http://localhost:4318"`
+}
+
+var (
+	mu       sync.RWMutex
+	snapshot *shared_config.Snapshot
 )
+
+// Load reads and validates the settings, keeping their redacted view for Snapshot
+func Load(args []string) (*Config, error) {
+	cfg := &Config{}
+	snap, err := shared_config.Load(cfg, args)
+	if err != nil {
+		return nil, err
+	}
+	set(snap)
+	return cfg, nil
+}
+
+// LoadCommand is Load for a command line that may end in a subcommand, which it returns
+func LoadCommand(args []string) (*Config, []string, error) {
+	cfg := &Config{}
+	snap, rest, err := shared_config.LoadCommand(cfg, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	set(snap)
+	return cfg, rest, nil
+}
+
+func set(snap *shared_config.Snapshot) {
+	mu.Lock()
+	snapshot = snap
+	mu.Unlock()
+}
+
+// Snapshot returns the redacted view of the loaded settings, nil before Load
+func Snapshot() *shared_config.Snapshot {
+	mu.RLock()
+	defer mu.RUnlock()
+	return snapshot
+}
+
+func (c *Config) Validate() error {
+	if err := shared_config.CheckPort("PORT", c.Port); err != nil {
+		return err
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+	if c.DBPath == "" {
+		return errors.New("DB_PATH is required")
+	}
+	if c.MaxUploadSize <= 0 {
+		return errors.New("MAX_UPLOAD_SIZE must be positive")
+	}
+	if c.MinFreeSpace < 0 {
+		return errors.New("MIN_FREE_SPACE must not be negative")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return errors.New("SHUTDOWN_TIMEOUT must be positive")
+	}
+	if c.ShutdownDelay < 0 || c.ShutdownDelay >= c.ShutdownTimeout {
+		return errors.New("SHUTDOWN_DELAY must be between 0 and SHUTDOWN_TIMEOUT")
+	}
+	if _, err := shared_metrics.ParseAllowlist(c.MetricsAllow); err != nil {
+		return fmt.Errorf("METRICS_ALLOW: %w", err)
+	}
+	if err := tracing.CheckExporter(c.TraceExporter); err != nil {
+		return fmt.Errorf("TRACE_EXPORTER: %w", err)
+	}
+	if c.TraceExporter == tracing.ExporterFile && c.TraceFile == "" {
+		return errors.New("TRACE_FILE is required with TRACE_EXPORTER=file")
+	}
+	if err := shared_config.CheckURL("OTEL_EXPORTER_OTLP_ENDPOINT", c.TraceEndpoint, true); err != nil {
+		return err
+	}
+	if err := shared_config.CheckOrigins("CORS_ORIGINS", c.CORSOrigins, c.Env); err != nil {
+		return err
+	}
+	if err := shared_config.CheckURL("JWKS_URL", c.JWKSURL, true); err != nil {
+		return err
+	}
+	if err := shared_config.CheckURL("INTROSPECTION_URL", c.IntrospectionURL, true); err != nil {
+		return err
+	}
+	if c.IntrospectionURL != "" && (c.IntrospectionClientID == "" || c.IntrospectionClientSecret == "") {
+		return errors.New("INTROSPECTION_URL needs INTROSPECTION_CLIENT_ID and INTROSPECTION_CLIENT_SECRET")
+	}
+
+	if c.Env == shared_config.Production {
+		if c.InternalToken == "" {
+			return errors.New("CDN_INTERNAL_TOKEN is required in production")
+		}
+		if c.IntrospectionURL == "" {
+			return errors.New("INTROSPECTION_URL is required in production so uploads are checked")
+		}
+	}
+	return nil
+}
+
+// AllowsOrigin reports whether browsers on origin may call the CDN
+func (c *Config) AllowsOrigin(origin string) bool {
+	for _, o := range c.CORSOrigins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
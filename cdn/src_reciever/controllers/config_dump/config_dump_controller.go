@@ -0,0 +1,37 @@
+package config_dump_controller
+
+import (
+	"crypto/subtle"
+
+	"cdn/app"
+	"cdn/src_reciever/config"
+	"sraraa/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigDump shows operators the settings the CDN is running with and where each value came
+// from, with secrets redacted. It needs the X-Internal-Token header and is not served at all
+// when CDN_INTERNAL_TOKEN is unset.
+func ConfigDump(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := a.Config.InternalToken
+		if token == "" {
+			response.WriteError(c.Writer, c.Request, response.ErrNotFound)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Internal-Token")), []byte(token)) != 1 {
+			response.Fail(c.Writer, c.Request, response.CodeUnauthenticated, "unauthorized")
+			return
+		}
+
+		snapshot := config.Snapshot()
+		if snapshot == nil {
+			response.Fail(c.Writer, c.Request, response.CodeUnavailable, "configuration not loaded")
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		response.OK(c.Writer, snapshot)
+	}
+}
@@ -1,24 +1,22 @@
 package profile_image_upload_controller
 
 import (
-	"database/sql"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"cdn/src_reciever/config"
+	"cdn/app"
+	"cdn/metrics"
 	"cdn/src_reciever/mapping"
+	"cdn/src_reciever/session_check"
+	"sraraa/pkg/response"
+	"sraraa/pkg/tracing"
 
 	"github.com/gin-gonic/gin"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
 )
 
-var DB *sql.DB
-
-func SetDB(db *sql.DB) {
-	DB = db
-}
-
 var allowedFormats = map[string]bool{
 	".jpg":  true,
 	".jpeg": true,
@@ -26,35 +24,53 @@ var allowedFormats = map[string]bool{
 	".webp": true,
 }
 
-func uploadImage(c *gin.Context, imageType string) {
-	username := c.PostForm("username")
-	uid := c.PostForm("uid")
+// multipartOverhead is room in the body for the form's boundaries, part headers and text fields on
+// top of the image itself
+const multipartOverhead = 64 << 10
+
+// LimitUploadBody caps an upload's body at MAX_UPLOAD_SIZE, so an oversized request is cut off
+// while the form is read instead of being spooled to disk first
+func LimitUploadBody(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, a.Config.MaxUploadSize+multipartOverhead)
+		c.Next()
+	}
+}
 
-	if username == "" || uid == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing required fields"})
+func uploadImage(a *app.App, c *gin.Context, imageType string) {
+	// The path comes from the verified token only; the form's uid was checked against it
+	uploader, ok := session_check.UploaderFrom(c)
+	if !ok {
+		a.Metrics.Upload(imageType, metrics.UploadError, 0)
+		response.WriteError(c.Writer, c.Request, response.ErrInternal)
 		return
 	}
+	uid, username := uploader.UID, uploader.Username
 
 	file, err := c.FormFile("image")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "image not provided"})
+		a.Metrics.Upload(imageType, metrics.UploadInvalid, 0)
+		response.WriteError(c.Writer, c.Request, response.Invalid("image", "image not provided"))
 		return
 	}
 
-	if file.Size > config.MaxUploadSize {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file too large"})
+	if file.Size > a.Config.MaxUploadSize {
+		a.Metrics.Upload(imageType, metrics.UploadTooLarge, 0)
+		response.Fail(c.Writer, c.Request, response.CodePayloadTooLarge, "file too large")
 		return
 	}
 
 	ext := strings.ToLower(filepath.Ext(file.Filename))
 	if !allowedFormats[ext] {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file format"})
+		a.Metrics.Upload(imageType, metrics.UploadInvalidFormat, 0)
+		response.WriteError(c.Writer, c.Request, response.Invalid("image", "invalid file format"))
 		return
 	}
 
 	saveDir, err := mapping.EnsureImagePath(uid, username, imageType)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create directory"})
+		a.Metrics.Upload(imageType, metrics.UploadError, 0)
+		response.Fail(c.Writer, c.Request, response.CodeInternal, "failed to create directory")
 		return
 	}
 
@@ -62,22 +78,31 @@ func uploadImage(c *gin.Context, imageType string) {
 	finalPath := filepath.Join(saveDir, finalFileName)
 	tempPath := finalPath + ".tmp"
 
-	if err := c.SaveUploadedFile(file, tempPath); err != nil {
+	ctx := c.Request.Context()
+	_, span := tracing.Start(ctx, "image.write", semconv.FilePath(tempPath), semconv.FileSize(int(file.Size)))
+	err = c.SaveUploadedFile(file, tempPath)
+	tracing.End(span, err)
+	if err != nil {
 		os.Remove(tempPath)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save image"})
+		a.Metrics.Upload(imageType, metrics.UploadError, 0)
+		response.Fail(c.Writer, c.Request, response.CodeInternal, "failed to save image")
 		return
 	}
 
+	// Drop the previous image, whatever its extension, and move the new one in place
+	_, span = tracing.Start(ctx, "image.replace", semconv.FilePath(finalPath))
 	files, _ := os.ReadDir(saveDir)
 	for _, f := range files {
 		if f.Name() != filepath.Base(tempPath) {
 			_ = os.Remove(filepath.Join(saveDir, f.Name()))
 		}
 	}
-
-	if err := os.Rename(tempPath, finalPath); err != nil {
+	err = os.Rename(tempPath, finalPath)
+	tracing.End(span, err)
+	if err != nil {
 		os.Remove(tempPath)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to finalize image"})
+		a.Metrics.Upload(imageType, metrics.UploadError, 0)
+		response.Fail(c.Writer, c.Request, response.CodeInternal, "failed to finalize image")
 		return
 	}
 
@@ -89,11 +114,12 @@ func uploadImage(c *gin.Context, imageType string) {
 	baseURL := scheme + "://" + c.Request.Host
 	imageURL := baseURL + "/media/" + uid + "/" + username + "/" + imageType + "/" + finalFileName
 
-	_, err = DB.Exec(`
+	_, err = a.DB.ExecContext(ctx, `
 	INSERT INTO user_profile_images (uid, username, image_type, file_name, url)
 	VALUES (?, ?, ?, ?, ?)
 	ON CONFLICT(uid, image_type)
 	DO UPDATE SET
+		username = excluded.username,
 		file_name = excluded.file_name,
 		url = excluded.url,
 		updated_at = CURRENT_TIMESTAMP
@@ -102,21 +128,27 @@ func uploadImage(c *gin.Context, imageType string) {
 	)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save metadata"})
+		a.Metrics.Upload(imageType, metrics.UploadError, 0)
+		response.Fail(c.Writer, c.Request, response.CodeInternal, "failed to save metadata")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	a.Metrics.Upload(imageType, metrics.UploadOK, file.Size)
+	response.OK(c.Writer, gin.H{
 		"message": "upload successful",
 		"file":    finalFileName,
 		"url":     imageURL,
 	})
 }
 
-func UploadProfilePhoto(c *gin.Context) {
-	uploadImage(c, "profile")
+func UploadProfilePhoto(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uploadImage(a, c, "profile")
+	}
 }
 
-func UploadCoverImage(c *gin.Context) {
-	uploadImage(c, "cover")
+func UploadCoverImage(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uploadImage(a, c, "cover")
+	}
 }
@@ -0,0 +1,83 @@
+package user_rename_controller
+
+import (
+	"crypto/subtle"
+	"log/slog"
+
+	"cdn/app"
+	"cdn/src_reciever/mapping"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type renameRequest struct {
+	UID         string `json:"uid"`
+	OldUsername string `json:"old_username"`
+	NewUsername string `json:"new_username"`
+}
+
+// RenameUser moves a user's files to the new username folder and rewrites the stored URLs.
+// Called by the backend after a username change, with the X-Internal-Token header. Without
+// CDN_INTERNAL_TOKEN nobody could be told apart from the backend, so every call is refused;
+// the backend keeps the rename queued until the CDN is configured.
+func RenameUser(a *app.App) gin.HandlerFunc {
+	token := a.Config.InternalToken
+	if token == "" {
+		slog.Error("CDN_INTERNAL_TOKEN not set; user renames are refused")
+	}
+
+	return func(c *gin.Context) {
+		if token == "" {
+			response.Fail(c.Writer, c.Request, response.CodeUnavailable, "internal calls are not configured")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Internal-Token")), []byte(token)) != 1 {
+			response.Fail(c.Writer, c.Request, response.CodeUnauthenticated, "unauthorized")
+			return
+		}
+
+		var body renameRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			response.Fail(c.Writer, c.Request, response.CodeInvalidRequest, "invalid request body")
+			return
+		}
+
+		if !mapping.IsSafeSegment(body.UID) || !mapping.IsSafeSegment(body.OldUsername) || !mapping.IsSafeSegment(body.NewUsername) {
+			response.Fail(c.Writer, c.Request, response.CodeValidationFailed, "invalid uid or username")
+			return
+		}
+
+		ctx := c.Request.Context()
+		_, span := tracing.Start(ctx, "storage.rename_user")
+		err := mapping.RenameUserPath(body.UID, body.OldUsername, body.NewUsername)
+		tracing.End(span, err)
+		if err != nil {
+			logging.FromContext(ctx).Error("rename user path error", "err", err)
+			response.Fail(c.Writer, c.Request, response.CodeConflict, "failed to move files")
+			return
+		}
+
+		oldPath := "/media/" + body.UID + "/" + body.OldUsername + "/"
+		newPath := "/media/" + body.UID + "/" + body.NewUsername + "/"
+
+		_, err = a.DB.ExecContext(ctx, `
+		UPDATE user_profile_images
+		SET username = ?, url = REPLACE(url, ?, ?), updated_at = CURRENT_TIMESTAMP
+		WHERE uid = ?
+		`, body.NewUsername, oldPath, newPath, body.UID)
+		if err != nil {
+			logging.FromContext(ctx).Error("rename metadata error", "err", err)
+			response.Fail(c.Writer, c.Request, response.CodeInternal, "failed to update metadata")
+			return
+		}
+
+		response.OK(c.Writer, gin.H{
+			"message":  "rename successful",
+			"uid":      body.UID,
+			"username": body.NewUsername,
+		})
+	}
+}
@@ -1,13 +1,38 @@
 package mapping
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 )
 
+// StorageRoot is the directory holding every user's files, served under /media
+const StorageRoot = "src_reciever/storage"
+
+// ErrUnsafeSegment is a uid, username or image type that could escape the user's folder
+var ErrUnsafeSegment = errors.New("unsafe path segment")
+
+// IsSafeSegment rejects values that could escape the storage folder
+func IsSafeSegment(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, `/\`)
+}
+
+func checkSegments(segments ...string) error {
+	for _, s := range segments {
+		if !IsSafeSegment(s) {
+			return fmt.Errorf("%w: %q", ErrUnsafeSegment, s)
+		}
+	}
+	return nil
+}
+
+// EnsureImagePath creates and returns the folder for a user's images of imageType
 func EnsureImagePath(uid string, username string, imageType string) (string, error) {
-	basePath := "src_reciever/storage"
-	fullPath := fmt.Sprintf("%s/%s/%s/%s", basePath, uid, username, imageType)
+	if err := checkSegments(uid, username, imageType); err != nil {
+		return "", err
+	}
+	fullPath := fmt.Sprintf("%s/%s/%s/%s", StorageRoot, uid, username, imageType)
 
 	err := os.MkdirAll(fullPath, os.ModePerm)
 	if err != nil {
@@ -16,3 +41,23 @@ func EnsureImagePath(uid string, username string, imageType string) (string, err
 
 	return fullPath, nil
 }
+
+// RenameUserPath moves a user's storage folder from the old username to the new one.
+// A missing source folder is not an error: the user simply has no files yet.
+func RenameUserPath(uid string, oldUsername string, newUsername string) error {
+	if err := checkSegments(uid, oldUsername, newUsername); err != nil {
+		return err
+	}
+	oldPath := fmt.Sprintf("%s/%s/%s", StorageRoot, uid, oldUsername)
+	newPath := fmt.Sprintf("%s/%s/%s", StorageRoot, uid, newUsername)
+
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("destination %s already exists", newPath)
+	}
+
+	return os.Rename(oldPath, newPath)
+}
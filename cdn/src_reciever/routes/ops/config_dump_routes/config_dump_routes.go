@@ -0,0 +1,12 @@
+package config_dump_routes
+
+import (
+	"cdn/app"
+	config_dump_controller "cdn/src_reciever/controllers/config_dump"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ConfigDumpRoutes(router *gin.Engine, a *app.App) {
+	router.GET("/api/internal/config", config_dump_controller.ConfigDump(a))
+}
@@ -1,12 +1,14 @@
 package profile_image_routes
 
 import (
+	"cdn/app"
 	profile_image_upload_controller "cdn/src_reciever/controllers/profile_images"
 
 	"github.com/gin-gonic/gin"
 )
 
-func UploadRoutes(router *gin.Engine) {
-	router.POST("/api/upload/image/profile-photo-image", profile_image_upload_controller.UploadProfilePhoto)
-	router.POST("/api/upload/image/profile-cover-image", profile_image_upload_controller.UploadCoverImage)
+func UploadRoutes(router *gin.Engine, a *app.App) {
+	limit := profile_image_upload_controller.LimitUploadBody(a)
+	router.POST("/api/upload/image/profile-photo-image", limit, a.Uploads.RequireUploader(), profile_image_upload_controller.UploadProfilePhoto(a))
+	router.POST("/api/upload/image/profile-cover-image", limit, a.Uploads.RequireUploader(), profile_image_upload_controller.UploadCoverImage(a))
 }
@@ -0,0 +1,12 @@
+package user_rename_routes
+
+import (
+	"cdn/app"
+	user_rename_controller "cdn/src_reciever/controllers/user_rename"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RenameRoutes(router *gin.Engine, a *app.App) {
+	router.POST("/api/internal/users/rename", user_rename_controller.RenameUser(a))
+}
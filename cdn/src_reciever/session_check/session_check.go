@@ -0,0 +1,165 @@
+package session_check
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"cdn/src_reciever/config"
+	"cdn/src_reciever/mapping"
+	"sraraa/pkg/introspection"
+	"sraraa/pkg/jwks"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
+	"sraraa/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const uploadScope = "images:write"
+
+// Checker verifies the tokens forwarded with uploads
+type Checker struct {
+	client   *introspection.Client
+	verifier *jwks.Verifier
+}
+
+// New configures token checks for uploads. Uploads write files, so every token is confirmed
+// through INTROSPECTION_URL (with INTROSPECTION_CLIENT_ID and INTROSPECTION_CLIENT_SECRET), which
+// knows about logouts, suspensions and username changes; without it every upload is refused.
+// JWKS_URL only lets session tokens that are forged, expired or impersonating be turned away
+// without asking the backend.
+func New(cfg *config.Config) *Checker {
+	ch := &Checker{}
+	// Calls to the backend carry the upload's trace
+	traced := &http.Client{Timeout: 5 * time.Second, Transport: tracing.Transport(nil)}
+	if cfg.JWKSURL != "" {
+		ch.verifier = jwks.NewVerifier(cfg.JWKSURL)
+		ch.verifier.HTTPClient = traced
+	}
+
+	if cfg.IntrospectionURL != "" {
+		ch.client = introspection.NewClient(cfg.IntrospectionURL, cfg.IntrospectionClientID, cfg.IntrospectionClientSecret)
+		ch.client.HTTPClient = traced
+	}
+
+	if ch.client == nil {
+		slog.Error("INTROSPECTION_URL not set; uploads are refused")
+	}
+	return ch
+}
+
+// Uploader is the account a checked upload belongs to, as the token says
+type Uploader struct {
+	UID      string
+	Username string
+}
+
+const uploaderKey = "session_check.uploader"
+
+// UploaderFrom returns the uploader RequireUploader verified for the request
+func UploaderFrom(c *gin.Context) (Uploader, bool) {
+	u, ok := c.Get(uploaderKey)
+	if !ok {
+		return Uploader{}, false
+	}
+	uploader, ok := u.(Uploader)
+	return uploader, ok
+}
+
+// RequireUploader checks the Authorization token forwarded with an upload and makes sure the
+// uid in the form belongs to it. Handlers take the uid and username from UploaderFrom, never
+// from the form.
+func (ch *Checker) RequireUploader() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ch.client == nil {
+			abort(c, response.NewError(response.CodeUnavailable, "uploads are not configured"))
+			return
+		}
+
+		token := c.GetHeader("Authorization")
+		if token == "" {
+			abort(c, response.ErrNoToken)
+			return
+		}
+
+		uploader, err := ch.checkToken(c, token)
+		if err != nil {
+			abort(c, err)
+			return
+		}
+
+		// Read the form here so a body over the upload limit is reported as that, not as a
+		// missing uid
+		if _, err := c.MultipartForm(); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abort(c, response.NewError(response.CodePayloadTooLarge, "file too large"))
+				return
+			}
+			abort(c, response.ErrInvalidBody)
+			return
+		}
+
+		if c.PostForm("uid") != uploader.UID {
+			abort(c, response.NewError(response.CodeForbidden, "uid does not match token"))
+			return
+		}
+		if username := c.PostForm("username"); username != "" && username != uploader.Username {
+			abort(c, response.NewError(response.CodeForbidden, "username does not match token"))
+			return
+		}
+		// Both end up in file paths
+		if !mapping.IsSafeSegment(uploader.UID) || !mapping.IsSafeSegment(uploader.Username) {
+			abort(c, response.NewError(response.CodeForbidden, "account cannot upload until it has a username"))
+			return
+		}
+		logging.With(c.Request.Context(), "uid", uploader.UID)
+		c.Set(uploaderKey, uploader)
+
+		c.Next()
+	}
+}
+
+func abort(c *gin.Context, err *response.Error) {
+	response.WriteError(c.Writer, c.Request, err)
+	c.Abort()
+}
+
+var errInvalidSession = response.NewError(response.CodeSessionInvalid, "invalid session")
+
+var errImpersonating = response.NewError(response.CodeImpersonationForbidden, "not allowed while impersonating a user")
+
+// checkToken returns the account the token belongs to, or the error to send. A valid signature
+// says nothing about whether the session was logged out, the account suspended or renamed since,
+// so the answer always comes from introspection; session JWTs that fail the offline check are
+// refused before that. Impersonation sessions are read-only.
+func (ch *Checker) checkToken(c *gin.Context, token string) (Uploader, *response.Error) {
+	if strings.Count(token, ".") == 2 && ch.verifier != nil {
+		claims, err := ch.verifier.Verify(c.Request.Context(), token)
+		if err != nil {
+			return Uploader{}, errInvalidSession
+		}
+		if claims.Act != nil {
+			return Uploader{}, errImpersonating
+		}
+	}
+
+	resp, err := ch.client.Introspect(c.Request.Context(), token)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("introspection error", "err", err)
+		return Uploader{}, response.NewError(response.CodeUpstream, "failed to verify token")
+	}
+	if !resp.Active {
+		return Uploader{}, errInvalidSession
+	}
+	if resp.Act != nil {
+		return Uploader{}, errImpersonating
+	}
+	if !resp.HasScope(uploadScope) {
+		return Uploader{}, response.NewError(response.CodeInsufficientScope, "token lacks images:write scope")
+	}
+	return Uploader{UID: resp.UID, Username: resp.Username}, nil
+}
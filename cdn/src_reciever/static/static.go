@@ -1,7 +1,11 @@
 package static
 
-import "github.com/gin-gonic/gin"
+import (
+	"cdn/src_reciever/mapping"
+
+	"github.com/gin-gonic/gin"
+)
 
 func RegisterStaticRoutes(r *gin.Engine) {
-	r.Static("/media", "src_reciever/storage")
+	r.Static("/media", mapping.StorageRoot)
 }
@@ -2,29 +2,26 @@ package user_profile_images_senders_controller
 
 import (
 	"database/sql"
-	"net/http"
+
+	"cdn/app"
+	"sraraa/pkg/logging"
+	"sraraa/pkg/response"
 
 	"github.com/gin-gonic/gin"
 )
 
-var DB *sql.DB
-
-func SetDB(db *sql.DB) {
-	DB = db
-}
-
-func getImageByType(c *gin.Context, imageType string) {
+func getImageByType(a *app.App, c *gin.Context, imageType string) {
 	uid := c.Query("uid")
 	username := c.Query("username")
 
 	if uid == "" || username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "uid and username required"})
+		response.Fail(c.Writer, c.Request, response.CodeInvalidRequest, "uid and username required")
 		return
 	}
 
 	var url string
 
-	err := DB.QueryRow(`
+	err := a.DB.QueryRow(`
 		SELECT url
 		FROM user_profile_images
 		WHERE uid = ? AND username = ? AND image_type = ?
@@ -32,24 +29,29 @@ func getImageByType(c *gin.Context, imageType string) {
 	`, uid, username, imageType).Scan(&url)
 
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		response.Fail(c.Writer, c.Request, response.CodeNotFound, "image not found")
 		return
 	}
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		logging.FromContext(c.Request.Context()).Error("image lookup error", "err", err)
+		response.WriteError(c.Writer, c.Request, response.ErrInternal)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response.OK(c.Writer, gin.H{
 		"url": url,
 	})
 }
 
-func GetProfilePhoto(c *gin.Context) {
-	getImageByType(c, "profile")
+func GetProfilePhoto(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		getImageByType(a, c, "profile")
+	}
 }
 
-func GetCoverImage(c *gin.Context) {
-	getImageByType(c, "cover")
+func GetCoverImage(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		getImageByType(a, c, "cover")
+	}
 }